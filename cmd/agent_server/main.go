@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
 	"parallel-calculator/internal/agent"
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/metrics"
+	"parallel-calculator/internal/tracing"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -11,8 +19,81 @@ func main() {
 	logger.InitAgentLogger()
 	defer logger.CloseLogger()
 
-	logger.INFO.Println("Agent server started")
-	defer logger.INFO.Println("Agent server stopped")
+	// По SIGHUP файл журнала открывается заново (внешний logrotate)
+	stopReopen := logger.ReopenOnSIGHUP()
+	defer stopReopen()
 
-	agent.StartAgent()
-}
\ No newline at end of file
+	// Остановка по SIGINT/SIGTERM: воркеры завершают текущие задачи и отправляют результаты
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info(ctx, "Agent server started")
+	defer logger.Info(ctx, "Agent server stopped")
+
+	// Трассировка включается, если задан файл трасс
+	if path := config.AppConfig.AgentTraceFilePath; path != "" {
+		exporter, err := tracing.NewFileExporter(path, config.AppConfig.TraceFormat)
+		if err != nil {
+			logger.Fatal(ctx, "Failed to open trace file", "error", err)
+		}
+		stopTracing := tracing.Init("agent", exporter)
+		defer func() {
+			// Накопленные спаны сохраняются при остановке агента
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ShutdownTimeout)
+			defer cancel()
+			if err := stopTracing(shutdownCtx); err != nil {
+				logger.Error(ctx, "Failed to save traces", "error", err)
+			}
+		}()
+	}
+
+	metricsServer := startMetricsServer(config.AppConfig.AgentMetricsPort)
+	if metricsServer != nil {
+		defer metricsServer.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agent.StartAgent(ctx)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	stop()
+	logger.Info(ctx, "Stop signal received, shutting down", "timeout", config.AppConfig.ShutdownTimeout)
+
+	select {
+	case <-done:
+	case <-time.After(config.AppConfig.ShutdownTimeout):
+		logger.Error(ctx, "Shutdown timeout exceeded, unfinished tasks will be returned after lease expiry")
+	}
+}
+
+// startMetricsServer запускает HTTP сервер с метриками агента на /metrics.
+// Если port равен "0", сервер не запускается и возвращается nil
+func startMetricsServer(port string) *http.Server {
+	if port == "0" {
+		return nil
+	}
+
+	registry := metrics.NewRegistry()
+	agent.RegisterMetrics(registry)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry.Handler())
+	server := &http.Server{Addr: ":" + port, Handler: mux}
+
+	go func() {
+		logger.Info(context.Background(), "Metrics server started", "port", port)
+		// Без метрик агент продолжает вычислять задачи
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error(context.Background(), "Metrics server error", "error", err)
+		}
+	}()
+
+	return server
+}
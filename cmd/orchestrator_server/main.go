@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"parallel-calculator/internal/auth"
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/db"
 	"parallel-calculator/internal/grpc"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/metrics"
 	"parallel-calculator/internal/orchestrator"
+	"parallel-calculator/internal/tracing"
 	"strconv"
+	"syscall"
 
 	"github.com/gorilla/mux"
 )
@@ -19,14 +26,41 @@ func main() {
 	logger.InitClientLogger()
 	defer logger.CloseLogger()
 
+	// По SIGHUP файл журнала открывается заново (внешний logrotate)
+	stopReopen := logger.ReopenOnSIGHUP()
+	defer stopReopen()
+
+	// Остановка по SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Трассировка включается, если задан файл трасс
+	stopTracing := func(context.Context) error { return nil }
+	if path := config.AppConfig.ClientTraceFilePath; path != "" {
+		exporter, err := tracing.NewFileExporter(path, config.AppConfig.TraceFormat)
+		if err != nil {
+			logger.Fatal(ctx, "Ошибка открытия файла трасс", "error", err)
+		}
+		stopTracing = tracing.Init("orchestrator", exporter)
+	}
+
 	// Инициализируем базу данных
 	err := db.InitDB("internal/db/")
 	if err != nil {
-		logger.ERROR.Fatalf("Ошибка инициализации базы данных: %v", err)
+		logger.Fatal(ctx, "Ошибка инициализации базы данных", "error", err)
 	}
 
-	// Настраиваем HTTP сервер
+	// Настраиваем HTTP сервер. Каждому запросу назначается request_id для журнала
 	r := mux.NewRouter()
+	r.Use(logger.Middleware)
+	r.Use(tracing.Middleware)
+
+	// Метрики в формате Prometheus
+	registry := metrics.NewRegistry()
+	db.RegisterMetrics(registry)
+	orchestrator.RegisterMetrics(registry)
+	grpc.RegisterServerMetrics(registry)
+	r.Handle("/metrics", registry.Handler()).Methods("GET")
 
 	// Публичные эндпоинты для аутентификации
 	r.HandleFunc("/api/v1/register", auth.Register).Methods("POST")
@@ -36,19 +70,39 @@ func main() {
 	protected := r.PathPrefix("/api/v1").Subrouter()
 	protected.Use(auth.AuthMiddleware)
 	protected.HandleFunc("/calculate", orchestrator.HandleCalculate).Methods("POST")
+	protected.HandleFunc("/calculate/batch", orchestrator.HandleCalculateBatch).Methods("POST")
+	protected.HandleFunc("/batches/{id}", orchestrator.HandleGetBatch).Methods("GET")
 	protected.HandleFunc("/expressions", orchestrator.HandleGetExpressions).Methods("GET")
 	protected.HandleFunc("/expressions/{id}", orchestrator.HandleGetExpressionByID).Methods("GET")
+	protected.HandleFunc("/expressions/{id}/events", orchestrator.HandleExpressionEvents).Methods("GET")
+	protected.HandleFunc("/expressions/{id}/operations", orchestrator.HandleGetExpressionOperations).Methods("GET")
+	protected.HandleFunc("/expressions/{id}/cancel", orchestrator.HandleCancelExpression).Methods("POST")
+	protected.HandleFunc("/expressions/{id}/webhooks", orchestrator.HandleGetExpressionWebhooks).Methods("GET")
+	protected.HandleFunc("/webhooks/secret", orchestrator.HandleGetWebhookSecret).Methods("GET")
+	protected.HandleFunc("/webhooks/secret", orchestrator.HandleRotateWebhookSecret).Methods("POST")
+	protected.HandleFunc("/variables", orchestrator.HandleSetVariable).Methods("POST")
+	protected.HandleFunc("/variables", orchestrator.HandleGetVariables).Methods("GET")
+	protected.HandleFunc("/variables/{name}", orchestrator.HandleDeleteVariable).Methods("DELETE")
+
+	// Административные эндпоинты доступны только пользователям из ADMIN_USERS
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(auth.AdminMiddleware)
+	admin.HandleFunc("/agents", orchestrator.HandleGetAgents).Methods("GET")
 
-	// Запускаем HTTP сервер в отдельной горутине
+	// Запускаем HTTP сервер в отдельной горутине.
+	// Контекст запросов отменяется при остановке, чтобы завершились long-poll и SSE
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
 	httpServer := &http.Server{
-		Addr:    ":" + config.AppConfig.ServerPort,
-		Handler: r,
+		Addr:        ":" + config.AppConfig.ServerPort,
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
 	}
+	httpServer.RegisterOnShutdown(cancelRequests)
 
 	go func() {
-		logger.INFO.Println("HTTP сервер запущен на порту " + config.AppConfig.ServerPort)
+		logger.Info(ctx, "HTTP сервер запущен", "port", config.AppConfig.ServerPort)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.ERROR.Fatalf("Ошибка запуска HTTP сервера: %v", err)
+			logger.Fatal(ctx, "Ошибка запуска HTTP сервера", "error", err)
 		}
 	}()
 
@@ -58,16 +112,47 @@ func main() {
 	grpcPort := fmt.Sprintf("%d", httpPort+1)
 	grpcAddress := ":" + grpcPort
 
-	// Используем обновленную сигнатуру, но игнорируем возвращаемый сервер
-	_, err = grpc.StartGRPCServer(grpcAddress)
+	grpcServer, err := grpc.StartGRPCServer(grpcAddress)
 	if err != nil {
-		logger.ERROR.Fatalf("Ошибка запуска gRPC сервера: %v", err)
+		logger.Fatal(ctx, "Ошибка запуска gRPC сервера", "error", err)
 	}
-	logger.INFO.Println("gRPC сервер запущен на порту " + grpcPort)
+	logger.Info(ctx, "gRPC сервер запущен", "port", grpcPort)
+
+	// Запускаем возврат в очередь операций, аренда которых истекла
+	stopReaper := orchestrator.StartLeaseReaper(config.AppConfig.LeaseReapInterval)
+
+	// Запускаем доставку webhook о завершении выражений
+	stopWebhooks := orchestrator.StartWebhookDispatcher(config.AppConfig.WebhookPollInterval)
 
 	// Серверы запущены и работают в фоновом режиме
-	logger.INFO.Println("Оркестратор запущен и работает")
+	logger.Info(ctx, "Оркестратор запущен и работает")
 
-	// Бесконечный цикл, чтобы программа не завершалась
-	select {}
+	<-ctx.Done()
+	stop()
+	logger.Info(ctx, "Получен сигнал остановки, завершение работы", "timeout", config.AppConfig.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ShutdownTimeout)
+	defer cancel()
+
+	// Перестаем принимать запросы и ждем завершения текущих
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error(ctx, "HTTP сервер не остановился вовремя", "error", err)
+		httpServer.Close()
+	}
+	// Потоки задач закрываются, результаты, которые агенты уже отправляют, принимаются
+	if err := grpcServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error(ctx, "gRPC сервер не остановился вовремя", "error", err)
+	}
+
+	stopReaper()
+	stopWebhooks(shutdownCtx)
+
+	if err := stopTracing(shutdownCtx); err != nil {
+		logger.Error(ctx, "Ошибка сохранения трасс", "error", err)
+	}
+
+	if err := db.CloseDB(); err != nil {
+		logger.Error(ctx, "Ошибка закрытия базы данных", "error", err)
+	}
+	logger.Info(ctx, "Оркестратор остановлен")
 }
@@ -1,11 +1,14 @@
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/grpc"
 	"parallel-calculator/internal/logger"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -19,6 +22,37 @@ type TaskClient interface {
 	Close() error
 }
 
+// TaskStream представляет поток задач от оркестратора
+type TaskStream interface {
+	// RequestTasks сообщает оркестратору, что освободилось n воркеров
+	RequestTasks(n int) error
+	// Recv ожидает следующую задачу
+	Recv() (*Task, error)
+	// Close закрывает поток
+	Close() error
+}
+
+// TaskStreamClient представляет клиента, умеющего получать задачи потоком вместо опроса
+type TaskStreamClient interface {
+	TaskClient
+	// StreamTasks открывает поток задач
+	StreamTasks(ctx context.Context) (TaskStream, error)
+}
+
+// TaskReleaser представляет клиента, умеющего вернуть оркестратору полученную, но не начатую задачу
+type TaskReleaser interface {
+	// ReleaseTask возвращает задачу в очередь оркестратора
+	ReleaseTask(Task) error
+}
+
+// AgentRegistrar представляет клиента, умеющего регистрировать агента в оркестраторе
+type AgentRegistrar interface {
+	// RegisterAgent регистрирует агента и возвращает период Heartbeat
+	RegisterAgent(AgentInfo) (time.Duration, error)
+	// Heartbeat сообщает, что агент работает. Возвращает false, если агента нужно зарегистрировать заново
+	Heartbeat() (bool, error)
+}
+
 // grpcClientAdapter адаптирует GRPCTaskClient к интерфейсу TaskClient
 type grpcClientAdapter struct {
 	address string
@@ -60,13 +94,69 @@ func (g *grpcClientAdapter) GetTask() (*Task, error) {
 	}
 
 	// Преобразуем в локальный тип Task
+	return taskFromGRPC(grpcTask), nil
+}
+
+// taskFromGRPC преобразует задачу gRPC клиента в локальный тип Task
+func taskFromGRPC(grpcTask *grpc.Task) *Task {
 	return &Task{
 		ID:            grpcTask.ID,
 		LeftValue:     grpcTask.LeftValue,
 		RightValue:    grpcTask.RightValue,
 		Operator:      grpcTask.Operator,
+		Kind:          grpcTask.Kind,
+		Args:          grpcTask.Args,
 		OperationTime: grpcTask.OperationTime,
-	}, nil
+		LeaseID:       grpcTask.LeaseID,
+		RequestID:     grpcTask.RequestID,
+		UserID:        grpcTask.UserID,
+		ExpressionID:  grpcTask.ExpressionID,
+		Traceparent:   grpcTask.Traceparent,
+		Mode:          grpcTask.Mode,
+		LeftExact:     grpcTask.LeftExact,
+		RightExact:    grpcTask.RightExact,
+		ArgsExact:     grpcTask.ArgsExact,
+		Precision:     grpcTask.Precision,
+		Rounding:      grpcTask.Rounding,
+		LeftInterval:  grpcTask.LeftInterval,
+		RightInterval: grpcTask.RightInterval,
+		ArgsInterval:  grpcTask.ArgsInterval,
+	}
+}
+
+// StreamTasks открывает поток задач через gRPC
+func (g *grpcClientAdapter) StreamTasks(ctx context.Context) (TaskStream, error) {
+	if err := g.ensureClient(); err != nil {
+		return nil, err
+	}
+
+	stream, err := g.client.StreamTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcStreamAdapter{stream: stream}, nil
+}
+
+// grpcStreamAdapter адаптирует grpc.TaskStream к интерфейсу TaskStream
+type grpcStreamAdapter struct {
+	stream *grpc.TaskStream
+}
+
+func (s *grpcStreamAdapter) RequestTasks(n int) error {
+	return s.stream.RequestTasks(n)
+}
+
+func (s *grpcStreamAdapter) Recv() (*Task, error) {
+	grpcTask, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return taskFromGRPC(grpcTask), nil
+}
+
+func (s *grpcStreamAdapter) Close() error {
+	return s.stream.Close()
 }
 
 // SendTaskResult отправляет результат задачи через gRPC
@@ -77,14 +167,54 @@ func (g *grpcClientAdapter) SendTaskResult(result TaskResult) error {
 
 	// Преобразуем в тип для gRPC
 	grpcResult := grpc.TaskResult{
-		ID:     result.ID,
-		Result: result.Result,
-		Error:  result.Error,
+		ID:           result.ID,
+		Result:       result.Result,
+		Error:        result.Error,
+		LeaseID:      result.LeaseID,
+		RequestID:    result.RequestID,
+		UserID:       result.UserID,
+		ExpressionID: result.ExpressionID,
+		Traceparent:  result.Traceparent,
+		Exact:        result.Exact,
+		Interval:     result.Interval,
 	}
 
 	return g.client.SendTaskResult(grpcResult)
 }
 
+// ReleaseTask возвращает задачу оркестратору через gRPC
+func (g *grpcClientAdapter) ReleaseTask(task Task) error {
+	if err := g.ensureClient(); err != nil {
+		return err
+	}
+
+	return g.client.ReleaseTask(grpc.Task{
+		ID:           task.ID,
+		LeaseID:      task.LeaseID,
+		RequestID:    task.RequestID,
+		UserID:       task.UserID,
+		ExpressionID: task.ExpressionID,
+	})
+}
+
+// RegisterAgent регистрирует агента через gRPC
+func (g *grpcClientAdapter) RegisterAgent(info AgentInfo) (time.Duration, error) {
+	if err := g.ensureClient(); err != nil {
+		return 0, err
+	}
+
+	return g.client.RegisterAgent(info.Hostname, info.ComputingPower, info.Version)
+}
+
+// Heartbeat сообщает оркестратору через gRPC, что агент работает
+func (g *grpcClientAdapter) Heartbeat() (bool, error) {
+	if err := g.ensureClient(); err != nil {
+		return false, err
+	}
+
+	return g.client.Heartbeat()
+}
+
 // Close закрывает соединение
 func (g *grpcClientAdapter) Close() error {
 	if g.client != nil {
@@ -96,24 +226,17 @@ func (g *grpcClientAdapter) Close() error {
 // Оставляем только gRPC реализацию
 
 // StartAgent инициализирует и запускает агента с заданным количеством воркеров,
-// которые получают задачи от оркестратора и выполняют их параллельно
-func StartAgent() {
+// которые получают задачи от оркестратора и выполняют их параллельно, пока не отменен ctx
+func StartAgent(ctx context.Context) {
 	cp := config.AppConfig.ComputingPower
 	// Исправлено дублирование условия
 	if cp == 0 {
-		logger.ERROR.Println("COMPUTING_POWER is 0. AUTO SET TO 1")
+		logger.Error(ctx, "COMPUTING_POWER is 0. AUTO SET TO 1")
 		cp = 1
 	}
 
-	logger.INFO.Println("COMPUTING_POWER set to", cp)
-	logger.INFO.Println("Starting workers...")
-
-	tasks_chan := make(chan Task, cp)
-	for i := 0; i < cp; i++ {
-		go Worker(tasks_chan, i+1)
-	}
-
-	logger.INFO.Println("Starting Agent with gRPC communication")
+	logger.Info(ctx, "COMPUTING_POWER set", "computing_power", cp)
+	logger.Info(ctx, "Starting Agent with gRPC communication")
 
 	var client TaskClient
 	var err error
@@ -123,27 +246,151 @@ func StartAgent() {
 	grpcPort := httpPort + 1
 	grpcAddress := fmt.Sprintf("%s:%d", config.AppConfig.OrchestratorHost, grpcPort)
 
-	logger.INFO.Printf("Connecting to gRPC server at %s", grpcAddress)
+	logger.Info(ctx, "Connecting to gRPC server", "address", grpcAddress)
 	client, err = NewGRPCClient(grpcAddress)
 	if err != nil {
-		logger.ERROR.Fatalf("Failed to create gRPC client: %v - terminating agent", err)
+		logger.Fatal(ctx, "Failed to create gRPC client - terminating agent", "error", err)
 	}
 	defer client.Close()
 
+	Run(ctx, client, cp)
+}
+
+// Run запускает cp воркеров и передает им задачи, полученные через client, пока не отменен ctx.
+// После отмены новые задачи не запрашиваются, задачи, которые воркеры еще не начали,
+// возвращаются оркестратору (если client реализует TaskReleaser), а Run дожидается,
+// пока воркеры завершат текущие задачи и отправят их результаты
+func Run(ctx context.Context, client TaskClient, cp int) {
+	logger.Info(ctx, "Starting workers...")
+
+	slots := newWorkerSlots(cp)
+	SetTaskDoneHook(slots.release)
 	SetGlobalClient(client)
 
-	for {
-		time.Sleep(config.AppConfig.AgentRequestTimeout)
+	// Регистрируем агента, если это поддерживают клиент и оркестратор
+	var heartbeats sync.WaitGroup
+	if registrar, ok := client.(AgentRegistrar); ok {
+		heartbeats.Add(1)
+		go func() {
+			defer heartbeats.Done()
+			runHeartbeats(ctx, registrar, newAgentInfo(cp))
+		}()
+	}
+
+	tasks_chan := make(chan Task, cp)
+	workersTotal.Set(float64(cp))
+	defer workersTotal.Set(0)
+	var workers sync.WaitGroup
+	for i := 0; i < cp; i++ {
+		workers.Add(1)
+		go func(worker_id int) {
+			defer workers.Done()
+			Worker(tasks_chan, worker_id)
+		}(i + 1)
+	}
+
+	fetchTasks(ctx, client, tasks_chan, slots)
+
+	logger.Info(ctx, "Agent is stopping: waiting for workers to finish current tasks")
+
+	// Задачи, которые воркеры еще не взяли, отдаем другим агентам
+	releaseQueuedTasks(client, tasks_chan)
+	close(tasks_chan)
+	workers.Wait()
+	heartbeats.Wait()
+
+	logger.Info(ctx, "All workers finished")
+}
+
+// fetchTasks получает задачи от оркестратора и передает их воркерам, пока не отменен ctx
+func fetchTasks(ctx context.Context, client TaskClient, tasks_chan chan Task, slots *workerSlots) {
+	// Получаем задачи потоком, если это поддерживают клиент и оркестратор
+	streamer, streaming := client.(TaskStreamClient)
+	streaming = streaming && config.AppConfig.AgentStreaming
+
+	for ctx.Err() == nil {
+		if streaming {
+			err := runTaskStream(ctx, streamer, tasks_chan, slots)
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, grpc.ErrStreamingUnsupported) {
+				logger.Info(ctx, "Orchestrator does not support task streaming, falling back to polling")
+				streaming = false
+				continue
+			}
+			logger.Error(ctx, "Task stream interrupted", "error", err)
+			sleepContext(ctx, config.AppConfig.AgentRequestTimeout)
+			continue
+		}
+
+		if !sleepContext(ctx, config.AppConfig.AgentRequestTimeout) {
+			return
+		}
 
 		task, err := client.GetTask()
 
 		if err != nil {
-			logger.ERROR.Println(err)
+			logger.Error(ctx, "Failed to get task", "error", err)
 			continue
 		}
 		if task == nil {
 			continue
 		}
-		tasks_chan <- *task
+		dispatchTask(ctx, client, tasks_chan, slots, *task)
+	}
+}
+
+// dispatchTask передает задачу воркерам. Если ctx отменен раньше, чем воркер освободился,
+// задача возвращается оркестратору
+func dispatchTask(ctx context.Context, client TaskClient, tasks_chan chan Task, slots *workerSlots, task Task) {
+	if ctx.Err() == nil {
+		slots.acquire()
+		select {
+		case tasks_chan <- task:
+			return
+		case <-ctx.Done():
+		}
+	}
+	releaseTask(client, task)
+}
+
+// releaseQueuedTasks возвращает оркестратору задачи, оставшиеся в очереди воркеров
+func releaseQueuedTasks(client TaskClient, tasks_chan chan Task) {
+	for {
+		select {
+		case task := <-tasks_chan:
+			releaseTask(client, task)
+		default:
+			return
+		}
+	}
+}
+
+// releaseTask возвращает задачу оркестратору. Если клиент этого не умеет или возврат не удался,
+// операция вернется в очередь после истечения аренды
+func releaseTask(client TaskClient, task Task) {
+	releaser, ok := client.(TaskReleaser)
+	if !ok {
+		return
+	}
+	ctx := task.logContext(context.Background())
+	if err := releaser.ReleaseTask(task); err != nil {
+		logger.Error(ctx, "Failed to release task", "error", err)
+		return
+	}
+	logger.Info(ctx, "Task released")
+}
+
+// sleepContext ждет d или отмены ctx. Возвращает false, если ctx отменен
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
 }
@@ -1,40 +1,98 @@
 package agent_test
 
 import (
+	"context"
+	"errors"
 	"parallel-calculator/internal/agent"
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/metrics"
+	"parallel-calculator/internal/numeric"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
-// mockTaskClient реализует интерфейс TaskClient для тестирования
+// mockTaskClient реализует интерфейс TaskClient для тестирования.
+// Воркеры вызывают его из своих горутин, поэтому счетчики защищены mu,
+// а отправленные результаты передаются в results, если канал задан
 type mockTaskClient struct {
 	getTaskFunc          func() (*agent.Task, error)
 	sendTaskResultFunc   func(result agent.TaskResult) error
 	closeFunc            func() error
+	mu                   sync.Mutex
 	getTaskCalled        int
 	sendTaskResultCalled int
 	closeCalled          int
 	lastTaskResult       agent.TaskResult
+	results              chan agent.TaskResult
+}
+
+// newMockTaskClient создает мок клиента, который принимает любые результаты и передает их в results
+func newMockTaskClient() *mockTaskClient {
+	return &mockTaskClient{
+		getTaskFunc: func() (*agent.Task, error) {
+			return nil, nil
+		},
+		sendTaskResultFunc: func(result agent.TaskResult) error {
+			return nil
+		},
+		closeFunc: func() error {
+			return nil
+		},
+		results: make(chan agent.TaskResult, 1),
+	}
 }
 
 func (m *mockTaskClient) GetTask() (*agent.Task, error) {
+	m.mu.Lock()
 	m.getTaskCalled++
+	m.mu.Unlock()
 	return m.getTaskFunc()
 }
 
 func (m *mockTaskClient) SendTaskResult(result agent.TaskResult) error {
+	m.mu.Lock()
 	m.sendTaskResultCalled++
 	m.lastTaskResult = result
-	return m.sendTaskResultFunc(result)
+	m.mu.Unlock()
+
+	err := m.sendTaskResultFunc(result)
+	if m.results != nil {
+		m.results <- result
+	}
+	return err
 }
 
 func (m *mockTaskClient) Close() error {
+	m.mu.Lock()
 	m.closeCalled++
+	m.mu.Unlock()
 	return m.closeFunc()
 }
 
+// waitResult ждет результат, отправленный воркером, и проверяет, что он отправлен один раз
+func (m *mockTaskClient) waitResult(t *testing.T) agent.TaskResult {
+	t.Helper()
+
+	select {
+	case result := <-m.results:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.sendTaskResultCalled != 1 {
+			t.Fatalf("SendTaskResult called %d times, want 1", m.sendTaskResultCalled)
+		}
+		m.sendTaskResultCalled = 0
+		return result
+	case <-time.After(time.Second):
+		t.Fatalf("Worker did not call SendTaskResult")
+		return agent.TaskResult{}
+	}
+}
+
 // Инициализация конфигурации для тестов
 func setupAgentTest() {
 	// Инициализируем конфигурацию
@@ -65,17 +123,7 @@ func TestSetGlobalClient(t *testing.T) {
 	// Инициализируем конфигурацию
 	setupAgentTest()
 	// Создаем мок клиента
-	mockClient := &mockTaskClient{
-		getTaskFunc: func() (*agent.Task, error) {
-			return nil, nil
-		},
-		sendTaskResultFunc: func(result agent.TaskResult) error {
-			return nil
-		},
-		closeFunc: func() error {
-			return nil
-		},
-	}
+	mockClient := newMockTaskClient()
 
 	// Устанавливаем глобального клиента
 	agent.SetGlobalClient(mockClient)
@@ -99,18 +147,13 @@ func TestSetGlobalClient(t *testing.T) {
 	// Отправляем задачу
 	tasksChan <- task
 
-	// Даем время воркеру обработать задачу
-	time.Sleep(50 * time.Millisecond)
-
-	// Проверяем, что метод SendTaskResult был вызван
-	if mockClient.sendTaskResultCalled != 1 {
-		t.Errorf("Worker did not call SendTaskResult on global client")
-	}
+	// Ждем, пока воркер отправит результат через глобального клиента
+	result := mockClient.waitResult(t)
 
 	// Проверяем, что результат правильный
 	expectedResult := 5.0 // 2.0 + 3.0 = 5.0
-	if mockClient.lastTaskResult.Result != expectedResult {
-		t.Errorf("Task result = %v, want %v", mockClient.lastTaskResult.Result, expectedResult)
+	if result.Result != expectedResult {
+		t.Errorf("Task result = %v, want %v", result.Result, expectedResult)
 	}
 }
 
@@ -118,17 +161,7 @@ func TestWorkerWithDifferentOperators(t *testing.T) {
 	// Инициализируем конфигурацию
 	setupAgentTest()
 	// Создаем мок клиента
-	mockClient := &mockTaskClient{
-		getTaskFunc: func() (*agent.Task, error) {
-			return nil, nil
-		},
-		sendTaskResultFunc: func(result agent.TaskResult) error {
-			return nil
-		},
-		closeFunc: func() error {
-			return nil
-		},
-	}
+	mockClient := newMockTaskClient()
 
 	// Устанавливаем глобального клиента
 	agent.SetGlobalClient(mockClient)
@@ -199,13 +232,226 @@ func TestWorkerWithDifferentOperators(t *testing.T) {
 			expectedResult: 0.0,
 			expectedError:  "division by zero",
 		},
+		{
+			name: "Modulo",
+			task: agent.Task{
+				ID:            7,
+				LeftValue:     7.0,
+				RightValue:    3.0,
+				Operator:      "%",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 1.0,
+			expectedError:  "nil",
+		},
+		{
+			name: "Modulo of negative dividend",
+			task: agent.Task{
+				ID:            8,
+				LeftValue:     -7.0,
+				RightValue:    3.0,
+				Operator:      "%",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 2.0,
+			expectedError:  "nil",
+		},
+		{
+			name: "Modulo by negative divisor",
+			task: agent.Task{
+				ID:            20,
+				LeftValue:     7.0,
+				RightValue:    -3.0,
+				Operator:      "%",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: -2.0,
+			expectedError:  "nil",
+		},
+		{
+			name: "Modulo of negative operands",
+			task: agent.Task{
+				ID:            21,
+				LeftValue:     -7.0,
+				RightValue:    -3.0,
+				Operator:      "%",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: -1.0,
+			expectedError:  "nil",
+		},
+		{
+			name: "Modulo by zero",
+			task: agent.Task{
+				ID:            9,
+				LeftValue:     7.0,
+				RightValue:    0.0,
+				Operator:      "%",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.0,
+			expectedError:  "modulo by zero",
+		},
+		{
+			name: "Modulo of non-integer",
+			task: agent.Task{
+				ID:            10,
+				LeftValue:     7.5,
+				RightValue:    2.0,
+				Operator:      "%",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.0,
+			expectedError:  "non-integer operand",
+		},
+		{
+			name: "Integer division",
+			task: agent.Task{
+				ID:            11,
+				LeftValue:     7.0,
+				RightValue:    2.0,
+				Operator:      "//",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 3.0,
+			expectedError:  "nil",
+		},
+		{
+			name: "Integer division rounds down",
+			task: agent.Task{
+				ID:            12,
+				LeftValue:     -7.0,
+				RightValue:    2.0,
+				Operator:      "//",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: -4.0,
+			expectedError:  "nil",
+		},
+		{
+			name: "Integer division by zero",
+			task: agent.Task{
+				ID:            13,
+				LeftValue:     7.0,
+				RightValue:    0.0,
+				Operator:      "//",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.0,
+			expectedError:  "division by zero",
+		},
+		{
+			name: "Power",
+			task: agent.Task{
+				ID:            14,
+				LeftValue:     2.0,
+				RightValue:    10.0,
+				Operator:      "^",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 1024.0,
+			expectedError:  "nil",
+		},
+		{
+			name: "Negative power",
+			task: agent.Task{
+				ID:            15,
+				LeftValue:     2.0,
+				RightValue:    -1.0,
+				Operator:      "^",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.5,
+			expectedError:  "nil",
+		},
+		{
+			name: "Zero to negative power",
+			task: agent.Task{
+				ID:            16,
+				LeftValue:     0.0,
+				RightValue:    -1.0,
+				Operator:      "^",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.0,
+			expectedError:  "division by zero",
+		},
+		{
+			name: "Fractional power of negative",
+			task: agent.Task{
+				ID:            17,
+				LeftValue:     -8.0,
+				RightValue:    0.5,
+				Operator:      "^",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.0,
+			expectedError:  "invalid power",
+		},
+		{
+			name: "Power overflow",
+			task: agent.Task{
+				ID:            22,
+				LeftValue:     10.0,
+				RightValue:    400.0,
+				Operator:      "^",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.0,
+			expectedError:  "overflow",
+		},
+		{
+			name: "Multiplication overflow",
+			task: agent.Task{
+				ID:            23,
+				LeftValue:     1e308,
+				RightValue:    10.0,
+				Operator:      "*",
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.0,
+			expectedError:  "overflow",
+		},
+		{
+			name: "Function",
+			task: agent.Task{
+				ID:            18,
+				Operator:      "max",
+				Kind:          agent.TaskKindFunction,
+				Args:          []float64{2, 12, 5},
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 12.0,
+			expectedError:  "nil",
+		},
+		{
+			name: "Function domain error",
+			task: agent.Task{
+				ID:            19,
+				Operator:      "sqrt",
+				Kind:          agent.TaskKindFunction,
+				Args:          []float64{-4},
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: 0.0,
+			expectedError:  "sqrt of negative number",
+		},
+		{
+			name: "Unary negation",
+			task: agent.Task{
+				ID:            6,
+				LeftValue:     6.0,
+				Operator:      "-",
+				Kind:          agent.TaskKindUnary,
+				OperationTime: 10 * time.Millisecond,
+			},
+			expectedResult: -6.0,
+			expectedError:  "nil",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Сбрасываем счетчики вызовов
-			mockClient.sendTaskResultCalled = 0
-
 			// Создаем канал задач
 			tasksChan := make(chan agent.Task, 1)
 
@@ -215,23 +461,190 @@ func TestWorkerWithDifferentOperators(t *testing.T) {
 			// Отправляем задачу
 			tasksChan <- tt.task
 
-			// Даем время воркеру обработать задачу
-			time.Sleep(50 * time.Millisecond)
-
-			// Проверяем, что метод SendTaskResult был вызван
-			if mockClient.sendTaskResultCalled != 1 {
-				t.Errorf("Worker did not call SendTaskResult")
-				return
-			}
+			// Ждем результат задачи
+			result := mockClient.waitResult(t)
 
 			// Проверяем, что результат правильный
-			if mockClient.lastTaskResult.Result != tt.expectedResult {
-				t.Errorf("Task result = %v, want %v", mockClient.lastTaskResult.Result, tt.expectedResult)
+			if result.Result != tt.expectedResult {
+				t.Errorf("Task result = %v, want %v", result.Result, tt.expectedResult)
 			}
 
 			// Проверяем, что ошибка правильная
-			if mockClient.lastTaskResult.Error != tt.expectedError {
-				t.Errorf("Task error = %v, want %v", mockClient.lastTaskResult.Error, tt.expectedError)
+			if result.Error != tt.expectedError {
+				t.Errorf("Task error = %v, want %v", result.Error, tt.expectedError)
+			}
+		})
+	}
+}
+
+// TestWorkerExactModes проверяет вычисление задач режимов rational и decimal
+func TestWorkerExactModes(t *testing.T) {
+	setupAgentTest()
+	mockClient := newMockTaskClient()
+	agent.SetGlobalClient(mockClient)
+
+	tests := []struct {
+		name          string
+		task          agent.Task
+		expectedExact string
+		expectedError string
+	}{
+		{
+			name: "Addition of decimal fractions",
+			task: agent.Task{
+				ID: 1, Mode: "rational", Operator: "+", Kind: agent.TaskKindBinary,
+				LeftValue: 0.1, RightValue: 0.2, LeftExact: "1/10", RightExact: "1/5",
+			},
+			expectedExact: "3/10",
+			expectedError: "nil",
+		},
+		{
+			name: "Unary negation",
+			task: agent.Task{
+				ID: 2, Mode: "rational", Operator: "-", Kind: agent.TaskKindUnary, LeftExact: "1/3",
+			},
+			expectedExact: "-1/3",
+			expectedError: "nil",
+		},
+		{
+			name: "Function",
+			task: agent.Task{
+				ID: 3, Mode: "rational", Operator: "max", Kind: agent.TaskKindFunction,
+				ArgsExact: []string{"1/3", "2/7"},
+			},
+			expectedExact: "1/3",
+			expectedError: "nil",
+		},
+		{
+			name: "Division by zero",
+			task: agent.Task{
+				ID: 4, Mode: "rational", Operator: "/", Kind: agent.TaskKindBinary, LeftExact: "1", RightExact: "0",
+			},
+			expectedError: "division by zero",
+		},
+		{
+			name: "Result out of float64 range",
+			task: agent.Task{
+				ID: 7, Mode: "rational", Operator: "*", Kind: agent.TaskKindBinary, LeftExact: "1e300", RightExact: "1e300",
+			},
+			expectedError: "overflow",
+		},
+		{
+			name: "Decimal division",
+			task: agent.Task{
+				ID: 5, Mode: "decimal", Precision: 2, Rounding: "half_up", Operator: "/", Kind: agent.TaskKindBinary,
+				LeftExact: "2", RightExact: "3",
+			},
+			expectedExact: "0.666666666667",
+			expectedError: "nil",
+		},
+		{
+			name: "Decimal square root",
+			task: agent.Task{
+				ID: 6, Mode: "decimal", Precision: 0, Rounding: "down", Operator: "sqrt", Kind: agent.TaskKindFunction,
+				ArgsExact: []string{"2.25"},
+			},
+			expectedExact: "1.5",
+			expectedError: "nil",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasksChan := make(chan agent.Task, 1)
+			go agent.Worker(tasksChan, 1)
+			tasksChan <- tt.task
+			close(tasksChan)
+
+			got := mockClient.waitResult(t)
+			if got.Exact != tt.expectedExact {
+				t.Errorf("Task exact = %q, want %q", got.Exact, tt.expectedExact)
+			}
+			if got.Error != tt.expectedError {
+				t.Errorf("Task error = %v, want %v", got.Error, tt.expectedError)
+			}
+		})
+	}
+}
+
+// TestWorkerIntervalMode проверяет вычисление задач режима interval
+func TestWorkerIntervalMode(t *testing.T) {
+	setupAgentTest()
+	mockClient := newMockTaskClient()
+	agent.SetGlobalClient(mockClient)
+
+	tests := []struct {
+		name             string
+		task             agent.Task
+		expectedInterval *numeric.Interval
+		expectedError    string
+	}{
+		{
+			name: "Multiplication",
+			task: agent.Task{
+				ID: 1, Mode: "interval", Operator: "*", Kind: agent.TaskKindBinary,
+				LeftInterval: &numeric.Interval{Lower: 1.5, Upper: 2.5}, RightInterval: &numeric.Interval{Lower: -2, Upper: 3},
+			},
+			expectedInterval: &numeric.Interval{Lower: -5, Upper: 7.5},
+			expectedError:    "nil",
+		},
+		{
+			name: "Unary negation",
+			task: agent.Task{
+				ID: 2, Mode: "interval", Operator: "-", Kind: agent.TaskKindUnary,
+				LeftInterval: &numeric.Interval{Lower: 1, Upper: 2},
+			},
+			expectedInterval: &numeric.Interval{Lower: -2, Upper: -1},
+			expectedError:    "nil",
+		},
+		{
+			name: "Function",
+			task: agent.Task{
+				ID: 3, Mode: "interval", Operator: "max", Kind: agent.TaskKindFunction,
+				ArgsInterval: []numeric.Interval{{Lower: 1, Upper: 4}, {Lower: 2, Upper: 3}},
+			},
+			expectedInterval: &numeric.Interval{Lower: 2, Upper: 4},
+			expectedError:    "nil",
+		},
+		{
+			name: "Division by interval containing zero",
+			task: agent.Task{
+				ID: 4, Mode: "interval", Operator: "/", Kind: agent.TaskKindBinary,
+				LeftInterval: &numeric.Interval{Lower: 1, Upper: 1}, RightInterval: &numeric.Interval{Lower: -0.1, Upper: 0.1},
+			},
+			expectedError: "division by interval containing zero",
+		},
+		{
+			name: "Missing operand from an old orchestrator",
+			task: agent.Task{
+				ID: 5, Mode: "interval", Operator: "+", Kind: agent.TaskKindBinary, LeftValue: 1, RightValue: 2,
+			},
+			expectedError: "missing interval operand",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasksChan := make(chan agent.Task, 1)
+			go agent.Worker(tasksChan, 1)
+			tasksChan <- tt.task
+			close(tasksChan)
+
+			got := mockClient.waitResult(t)
+			if got.Error != tt.expectedError {
+				t.Errorf("Task error = %v, want %v", got.Error, tt.expectedError)
+			}
+			if tt.expectedInterval == nil {
+				if got.Interval != nil {
+					t.Errorf("Task interval = %v, want nil", *got.Interval)
+				}
+				return
+			}
+			if got.Interval == nil || *got.Interval != *tt.expectedInterval {
+				t.Fatalf("Task interval = %v, want %v", got.Interval, *tt.expectedInterval)
+			}
+			if got.Result != tt.expectedInterval.Mid() {
+				t.Errorf("Task result = %v, want midpoint %v", got.Result, tt.expectedInterval.Mid())
 			}
 		})
 	}
@@ -250,3 +663,242 @@ func TestGRPCClientAdapter(t *testing.T) {
 		// Тестирование через интерфейс TaskClient будет более подходящим.
 	})
 }
+
+// releasingTaskClient выдает задачи по порядку и запоминает отправленные результаты и возвращенные задачи
+type releasingTaskClient struct {
+	mu       sync.Mutex
+	nextID   uint32
+	onGet    func(id uint32)
+	results  []uint32
+	released []uint32
+}
+
+func (c *releasingTaskClient) GetTask() (*agent.Task, error) {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.mu.Unlock()
+
+	c.onGet(id)
+	return &agent.Task{
+		ID:            id,
+		LeftValue:     1,
+		RightValue:    1,
+		Operator:      "+",
+		OperationTime: 10 * config.AppConfig.AgentRequestTimeout,
+		LeaseID:       "lease",
+	}, nil
+}
+
+func (c *releasingTaskClient) SendTaskResult(result agent.TaskResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = append(c.results, result.ID)
+	return nil
+}
+
+func (c *releasingTaskClient) ReleaseTask(task agent.Task) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.released = append(c.released, task.ID)
+	return nil
+}
+
+func (c *releasingTaskClient) Close() error {
+	return nil
+}
+
+func TestRunGracefulShutdown(t *testing.T) {
+	setupAgentTest()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Первая задача выполняется воркером, вторая ждет в очереди,
+	// третья получена уже после сигнала остановки
+	client := &releasingTaskClient{
+		onGet: func(id uint32) {
+			if id == 3 {
+				cancel()
+			}
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agent.Run(ctx, client, 1)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * config.AppConfig.AgentRequestTimeout):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	// Начатая задача доведена до конца и ее результат отправлен
+	if len(client.results) != 1 || client.results[0] != 1 {
+		t.Errorf("Expected result of task 1 only, got %v", client.results)
+	}
+
+	// Не начатые задачи возвращены оркестратору
+	sort.Slice(client.released, func(i, j int) bool { return client.released[i] < client.released[j] })
+	if len(client.released) != 2 || client.released[0] != 2 || client.released[1] != 3 {
+		t.Errorf("Expected tasks [2 3] to be released, got %v", client.released)
+	}
+}
+
+// registeringTaskClient не выдает задач и учитывает регистрации и Heartbeat агента
+type registeringTaskClient struct {
+	mu            sync.Mutex
+	registrations []agent.AgentInfo
+	heartbeats    int
+	onHeartbeat   func(n int) bool
+}
+
+func (c *registeringTaskClient) GetTask() (*agent.Task, error) {
+	return nil, nil
+}
+
+func (c *registeringTaskClient) SendTaskResult(agent.TaskResult) error {
+	return nil
+}
+
+func (c *registeringTaskClient) Close() error {
+	return nil
+}
+
+func (c *registeringTaskClient) RegisterAgent(info agent.AgentInfo) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.registrations = append(c.registrations, info)
+	return 10 * time.Millisecond, nil
+}
+
+func (c *registeringTaskClient) Heartbeat() (bool, error) {
+	c.mu.Lock()
+	c.heartbeats++
+	n := c.heartbeats
+	c.mu.Unlock()
+	return c.onHeartbeat(n), nil
+}
+
+func TestRunHeartbeats(t *testing.T) {
+	setupAgentTest()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// На втором Heartbeat оркестратор не знает агента, на пятом агент останавливается
+	client := &registeringTaskClient{}
+	client.onHeartbeat = func(n int) bool {
+		if n == 5 {
+			cancel()
+		}
+		return n != 2
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agent.Run(ctx, client, 2)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if len(client.registrations) != 2 {
+		t.Fatalf("Expected agent to register twice, got %d registrations", len(client.registrations))
+	}
+
+	info := client.registrations[0]
+	if info.ComputingPower != 2 || info.Version != agent.Version || info.Hostname == "" {
+		t.Errorf("Unexpected agent info: %+v", info)
+	}
+}
+
+// metricValue возвращает значение строки метрики series (имя с метками) или 0, если ее нет
+func metricValue(t *testing.T, registry *metrics.Registry, series string) float64 {
+	t.Helper()
+
+	var out strings.Builder
+	if err := registry.Write(&out); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("Invalid value in %q: %v", line, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// TestWorkerMetrics проверяет учет занятых воркеров, обработанных задач и ошибок отправки результата
+func TestWorkerMetrics(t *testing.T) {
+	setupAgentTest()
+
+	registry := metrics.NewRegistry()
+	agent.RegisterMetrics(registry)
+
+	const (
+		busy      = "calculator_agent_workers_busy"
+		processed = `calculator_agent_tasks_processed_total{operator="%"}`
+		failures  = "calculator_agent_send_result_failures_total"
+	)
+	processedBefore := metricValue(t, registry, processed)
+	failuresBefore := metricValue(t, registry, failures)
+
+	sending := make(chan struct{})
+	unblock := make(chan struct{})
+	agent.SetGlobalClient(&mockTaskClient{
+		sendTaskResultFunc: func(result agent.TaskResult) error {
+			close(sending)
+			<-unblock
+			return errors.New("connection refused")
+		},
+	})
+	agent.SetTaskDoneHook(nil)
+
+	tasksChan := make(chan agent.Task, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agent.Worker(tasksChan, 1)
+	}()
+
+	tasksChan <- agent.Task{ID: 1, LeftValue: 7, RightValue: 4, Operator: "%"}
+	close(tasksChan)
+
+	// Пока воркер отправляет результат, он считается занятым
+	<-sending
+	if got := metricValue(t, registry, busy); got != 1 {
+		t.Errorf("Busy workers while sending = %v, want 1", got)
+	}
+
+	close(unblock)
+	<-done
+
+	if got := metricValue(t, registry, busy); got != 0 {
+		t.Errorf("Busy workers after task = %v, want 0", got)
+	}
+	if got := metricValue(t, registry, processed) - processedBefore; got != 1 {
+		t.Errorf("Processed %% tasks delta = %v, want 1", got)
+	}
+	if got := metricValue(t, registry, failures) - failuresBefore; got != 1 {
+		t.Errorf("Send result failures delta = %v, want 1", got)
+	}
+}
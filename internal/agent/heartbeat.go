@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"parallel-calculator/internal/config"
+	"parallel-calculator/internal/grpc"
+	"parallel-calculator/internal/logger"
+)
+
+// Version — версия агента, передаваемая оркестратору при регистрации.
+// Задается при сборке: -ldflags "-X parallel-calculator/internal/agent.Version=1.0.0"
+var Version = "dev"
+
+// newAgentInfo описывает агента с cp воркерами для регистрации
+func newAgentInfo(cp int) AgentInfo {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return AgentInfo{
+		Hostname:       hostname,
+		ComputingPower: cp,
+		Version:        Version,
+	}
+}
+
+// runHeartbeats регистрирует агента в оркестраторе и отправляет Heartbeat с периодом,
+// который оркестратор вернул при регистрации, пока не отменен ctx.
+// Если оркестратор забыл агента (например, после очистки базы), агент регистрируется заново
+func runHeartbeats(ctx context.Context, registrar AgentRegistrar, info AgentInfo) {
+	interval := config.AppConfig.AgentHeartbeatInterval
+	registered := false
+
+	for {
+		if !registered {
+			heartbeatInterval, err := registrar.RegisterAgent(info)
+			switch {
+			case errors.Is(err, grpc.ErrRegistrationUnsupported):
+				logger.Info(ctx, "Orchestrator does not support agent registration, heartbeats disabled")
+				return
+			case err != nil:
+				logger.Error(ctx, "Failed to register agent", "error", err)
+			default:
+				registered = true
+				if heartbeatInterval > 0 {
+					interval = heartbeatInterval
+				}
+				logger.Info(ctx, "Agent registered", "heartbeat_interval", interval)
+			}
+		} else {
+			ok, err := registrar.Heartbeat()
+			if err != nil {
+				logger.Error(ctx, "Heartbeat failed", "error", err)
+			} else if !ok {
+				logger.Info(ctx, "Orchestrator does not know this agent, registering again")
+				registered = false
+				continue
+			}
+		}
+
+		if !sleepContext(ctx, interval) {
+			return
+		}
+	}
+}
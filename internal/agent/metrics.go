@@ -0,0 +1,28 @@
+package agent
+
+import "parallel-calculator/internal/metrics"
+
+var (
+	workersTotal = metrics.NewGauge(
+		"calculator_agent_workers",
+		"Workers started by the agent.",
+	)
+	workersBusy = metrics.NewGauge(
+		"calculator_agent_workers_busy",
+		"Workers currently evaluating a task or sending its result.",
+	)
+	tasksProcessed = metrics.NewCounter(
+		"calculator_agent_tasks_processed_total",
+		"Tasks evaluated by the agent, by operator.",
+		"operator",
+	)
+	sendResultFailures = metrics.NewCounter(
+		"calculator_agent_send_result_failures_total",
+		"Task results the orchestrator did not accept or that could not be sent.",
+	)
+)
+
+// RegisterMetrics добавляет метрики агента в реестр
+func RegisterMetrics(registry *metrics.Registry) {
+	registry.MustRegister(workersTotal, workersBusy, tasksProcessed, sendResultFailures)
+}
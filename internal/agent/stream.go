@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"parallel-calculator/internal/logger"
+	"sync/atomic"
+)
+
+// workerSlots отслеживает число занятых воркеров агента
+type workerSlots struct {
+	total int
+	busy  atomic.Int64
+	freed chan struct{}
+}
+
+func newWorkerSlots(total int) *workerSlots {
+	return &workerSlots{
+		total: total,
+		freed: make(chan struct{}, total),
+	}
+}
+
+// acquire отмечает, что задача передана воркерам
+func (s *workerSlots) acquire() {
+	s.busy.Add(1)
+}
+
+// release отмечает, что воркер завершил задачу
+func (s *workerSlots) release() {
+	s.busy.Add(-1)
+	select {
+	case s.freed <- struct{}{}:
+	default:
+	}
+}
+
+// free возвращает число свободных воркеров
+func (s *workerSlots) free() int {
+	free := s.total - int(s.busy.Load())
+	if free < 0 {
+		return 0
+	}
+	return free
+}
+
+// runTaskStream получает задачи через поток и передает их воркерам, пока поток не оборвется.
+// Оркестратору сообщается о каждом освободившемся воркере. При отмене ctx поток закрывается
+func runTaskStream(ctx context.Context, client TaskStreamClient, tasks_chan chan Task, slots *workerSlots) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.StreamTasks(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// Оповещения, накопившиеся без потока, учтены в числе свободных воркеров
+	for len(slots.freed) > 0 {
+		<-slots.freed
+	}
+
+	if err := stream.RequestTasks(slots.free()); err != nil {
+		return err
+	}
+	logger.Info(ctx, "Task stream opened", "free_workers", slots.free())
+
+	sendErr := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-slots.freed:
+				if err := stream.RequestTasks(1); err != nil {
+					sendErr <- err
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		task, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case err := <-sendErr:
+			return err
+		default:
+		}
+
+		dispatchTask(ctx, client, tasks_chan, slots, *task)
+	}
+}
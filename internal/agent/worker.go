@@ -1,57 +1,284 @@
 package agent
 
 import (
+	"context"
+	"math"
+	"math/big"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/mathfunc"
+	"parallel-calculator/internal/numeric"
+	"parallel-calculator/internal/tracing"
+	"sync"
 	"time"
 )
 
-// Глобальный клиент gRPC для работы с оркестратором
-var globalClient TaskClient
+// Глобальный клиент gRPC для работы с оркестратором и функция, вызываемая воркером
+// после отправки результата задачи. Защищены globalMu: их меняют, пока работают воркеры
+var (
+	globalMu     sync.RWMutex
+	globalClient TaskClient
+	taskDoneHook func()
+)
 
 // Устанавливает глобального клиента для использования рабочими потоками
 func SetGlobalClient(client TaskClient) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
 	globalClient = client
 }
 
+// SetTaskDoneHook устанавливает функцию, которую воркер вызывает после отправки результата задачи
+func SetTaskDoneHook(hook func()) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	taskDoneHook = hook
+}
+
+// workerGlobals возвращает текущие глобального клиента и функцию завершения задачи
+func workerGlobals() (TaskClient, func()) {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalClient, taskDoneHook
+}
+
 // Worker обрабатывает поступающие задачи из канала
 func Worker(tasks_chan chan Task, worker_id int) {
 	for task := range tasks_chan {
-		logger.INFO.Println("Worker", worker_id, "received task: ", task)
+		ctx := logger.With(task.logContext(context.Background()), "worker", worker_id)
+		logger.Info(ctx, "Worker received task", "operator", task.Operator, "kind", task.Kind)
+
+		// Выполнение задачи и отправка результата — продолжение трассы выражения из оркестратора
+		ctx, span := tracing.Start(tracing.ContextWithTraceparent(ctx, task.Traceparent), "execute operation",
+			tracing.WithKind(tracing.SpanKindConsumer),
+			tracing.WithAttributes(
+				"operation.id", task.ID,
+				"operation.operator", task.Operator,
+				"operation.kind", task.Kind,
+				"worker.id", worker_id,
+			))
+		workersBusy.Inc()
 		result := 0.0
 		Error := "nil"
+		exact := ""
+		var interval *numeric.Interval
 
-		switch task.Operator {
-		case "+":
-			result = task.LeftValue + task.RightValue
-		case "-":
-			result = task.LeftValue - task.RightValue
-		case "*":
-			result = task.LeftValue * task.RightValue
-		case "/":
-			if task.RightValue == 0 {
-				result = 0
-				Error = "division by zero"
-			} else {
-				result = task.LeftValue / task.RightValue
-			}
+		switch {
+		case numeric.Exact(task.Mode):
+			result, exact, Error = evaluateExact(task)
+		case task.Mode == numeric.ModeInterval:
+			result, interval, Error = evaluateInterval(task)
+		case task.Kind == TaskKindUnary:
+			result, Error = evaluateUnary(task)
+		case task.Kind == TaskKindFunction:
+			result, Error = evaluateFunction(task)
+		default:
+			result, Error = evaluateBinary(task)
 		}
 		time.Sleep(task.OperationTime)
+		tasksProcessed.Inc(task.Operator)
 		taskResult := TaskResult{
-			ID:     task.ID,
-			Result: result,
-			Error:  Error,
+			ID:           task.ID,
+			Result:       result,
+			Error:        Error,
+			LeaseID:      task.LeaseID,
+			RequestID:    task.RequestID,
+			UserID:       task.UserID,
+			ExpressionID: task.ExpressionID,
+			Traceparent:  tracing.Traceparent(ctx),
+			Exact:        exact,
+			Interval:     interval,
+		}
+		if Error != "nil" {
+			span.SetStatus(tracing.StatusError, Error)
 		}
 
-		if globalClient == nil {
-			logger.ERROR.Printf("Worker %d: глобальный клиент не установлен", worker_id)
+		client, done := workerGlobals()
+		if client == nil {
+			logger.Error(ctx, "Worker: глобальный клиент не установлен")
+			span.End()
+			workersBusy.Dec()
 			return
 		}
 
-		err := globalClient.SendTaskResult(taskResult)
+		err := client.SendTaskResult(taskResult)
 
+		// Результат мог быть отклонен из-за истекшей аренды - воркер продолжает работу
 		if err != nil {
-			logger.ERROR.Printf("Worker %d: ошибка отправки результата: %v", worker_id, err)
-			return
+			logger.Error(ctx, "Worker: ошибка отправки результата", "error", err)
+			sendResultFailures.Inc()
+		} else {
+			logger.Info(ctx, "Worker finished task", "result", result, "task_error", Error)
+		}
+		span.End()
+		workersBusy.Dec()
+
+		if done != nil {
+			done()
+		}
+	}
+}
+
+// evaluateBinary вычисляет бинарную операцию над LeftValue и RightValue.
+// Результат за пределами float64 (например, 10^400) считается переполнением
+func evaluateBinary(task Task) (float64, string) {
+	result, Error := binaryValue(task)
+	if Error == "nil" && math.IsInf(result, 0) {
+		return 0, "overflow"
+	}
+	return result, Error
+}
+
+// binaryValue вычисляет значение бинарной операции без проверки переполнения
+func binaryValue(task Task) (float64, string) {
+	left, right := task.LeftValue, task.RightValue
+
+	switch task.Operator {
+	case "+":
+		return left + right, "nil"
+	case "-":
+		return left - right, "nil"
+	case "*":
+		return left * right, "nil"
+	case "/":
+		if right == 0 {
+			return 0, "division by zero"
+		}
+		return left / right, "nil"
+	case "%":
+		if !isInteger(left) || !isInteger(right) {
+			return 0, "non-integer operand"
+		}
+		if right == 0 {
+			return 0, "modulo by zero"
+		}
+		return floorMod(left, right), "nil"
+	case "//":
+		if !isInteger(left) || !isInteger(right) {
+			return 0, "non-integer operand"
+		}
+		if right == 0 {
+			return 0, "division by zero"
+		}
+		return math.Floor(left / right), "nil"
+	case "^":
+		if left == 0 && right < 0 {
+			return 0, "division by zero"
+		}
+		result := math.Pow(left, right)
+		if math.IsNaN(result) {
+			return 0, "invalid power"
+		}
+		return result, "nil"
+	default:
+		return 0, "unsupported operator: " + task.Operator
+	}
+}
+
+// isInteger сообщает, является ли значение целым числом
+func isInteger(value float64) bool {
+	return value == math.Trunc(value) && !math.IsInf(value, 0)
+}
+
+// floorMod возвращает остаток от деления left на right со знаком делителя,
+// согласованный с округлением частного вниз в "//" (как в Python)
+func floorMod(left, right float64) float64 {
+	mod := math.Mod(left, right)
+	if mod == 0 {
+		return 0
+	}
+	if (mod < 0) != (right < 0) {
+		mod += right
+	}
+	return mod
+}
+
+// evaluateUnary вычисляет унарную операцию над LeftValue
+func evaluateUnary(task Task) (float64, string) {
+	switch task.Operator {
+	case "-":
+		return -task.LeftValue, "nil"
+	case "+":
+		return task.LeftValue, "nil"
+	default:
+		return 0, "unsupported unary operator: " + task.Operator
+	}
+}
+
+// evaluateFunction вычисляет встроенную функцию Operator над Args.
+// Ошибка области определения (например, корень из отрицательного числа) возвращается оркестратору
+func evaluateFunction(task Task) (float64, string) {
+	result, err := mathfunc.Call(task.Operator, task.Args)
+	if err != nil {
+		return 0, err.Error()
+	}
+	return result, "nil"
+}
+
+// evaluateExact вычисляет операцию над точными операндами режима rational или decimal.
+// Возвращает приближение результата, его запись в режиме задачи и ошибку
+func evaluateExact(task Task) (float64, string, string) {
+	settings := numeric.Settings{Mode: task.Mode, Precision: task.Precision, Rounding: task.Rounding}
+	var (
+		result *big.Rat
+		err    error
+	)
+	switch task.Kind {
+	case TaskKindUnary:
+		var x *big.Rat
+		if x, err = numeric.ParseRational(task.LeftExact); err == nil {
+			result, err = settings.Unary(task.Operator, x)
 		}
+	case TaskKindFunction:
+		args := make([]*big.Rat, len(task.ArgsExact))
+		for i, arg := range task.ArgsExact {
+			if args[i], err = numeric.ParseRational(arg); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			result, err = settings.Function(task.Operator, args)
+		}
+	default:
+		var x, y *big.Rat
+		if x, err = numeric.ParseRational(task.LeftExact); err == nil {
+			if y, err = numeric.ParseRational(task.RightExact); err == nil {
+				result, err = settings.Binary(task.Operator, x, y)
+			}
+		}
+	}
+	if err != nil {
+		return 0, "", err.Error()
+	}
+	value, err := numeric.RationalFloat(result)
+	if err != nil {
+		return 0, "", err.Error()
+	}
+	return value, settings.Format(result), "nil"
+}
+
+// evaluateInterval вычисляет операцию над интервальными операндами режима interval.
+// Возвращает середину результата, его границы и ошибку
+func evaluateInterval(task Task) (float64, *numeric.Interval, string) {
+	var (
+		result numeric.Interval
+		err    error
+	)
+	switch task.Kind {
+	case TaskKindUnary:
+		if task.LeftInterval == nil {
+			return 0, nil, "missing interval operand"
+		}
+		result, err = numeric.IntervalUnary(task.Operator, *task.LeftInterval)
+	case TaskKindFunction:
+		result, err = numeric.IntervalFunction(task.Operator, task.ArgsInterval)
+	default:
+		if task.LeftInterval == nil || task.RightInterval == nil {
+			return 0, nil, "missing interval operand"
+		}
+		result, err = numeric.IntervalBinary(task.Operator, *task.LeftInterval, *task.RightInterval)
+	}
+	if err != nil {
+		return 0, nil, err.Error()
 	}
+	return result.Mid(), &result, "nil"
 }
@@ -3,6 +3,9 @@ package auth
 import (
 	"context"
 	"net/http"
+	"parallel-calculator/internal/config"
+	"parallel-calculator/internal/logger"
+	"slices"
 )
 
 // Ключ контекста для пользователя
@@ -26,11 +29,31 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), UserContextKey, claims)
+		ctx = logger.With(ctx, logger.KeyUserID, claims.UserID)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// AdminMiddleware пропускает только пользователей, перечисленных в ADMIN_USERS.
+// Используется после AuthMiddleware
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := GetUserFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Не авторизован: "+ErrInvalidToken.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if !slices.Contains(config.AppConfig.AdminUsers, claims.Login) {
+			http.Error(w, "Доступ запрещен", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // GetUserFromContext извлекает пользовательские утверждения из контекста
 func GetUserFromContext(ctx context.Context) (*Claims, bool) {
 	claims, ok := ctx.Value(UserContextKey).(*Claims)
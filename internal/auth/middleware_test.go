@@ -199,3 +199,39 @@ func TestRequireAuth(t *testing.T) {
 		}
 	})
 }
+
+// TestAdminMiddleware проверяет доступ к административным эндпоинтам
+func TestAdminMiddleware(t *testing.T) {
+	config.InitConfig("../../.env")
+	config.AppConfig.AdminUsers = []string{"admin"}
+
+	handler := auth.AdminMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		claims         *auth.Claims
+		expectedStatus int
+	}{
+		{"Admin user", &auth.Claims{UserID: 1, Login: "admin"}, http.StatusOK},
+		{"Regular user", &auth.Claims{UserID: 2, Login: "user"}, http.StatusForbidden},
+		{"Unauthenticated", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/admin/agents", nil)
+			if tt.claims != nil {
+				req = req.WithContext(context.WithValue(req.Context(), auth.UserContextKey, tt.claims))
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"log"
+	"log/slog"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
@@ -19,6 +21,10 @@ type Config struct {
 	TimeSubtraction     time.Duration
 	TimeMultiplication  time.Duration
 	TimeDivision        time.Duration
+	TimePower           time.Duration
+	TimeModulo          time.Duration
+	TimeIntDivision     time.Duration
+	TimeFunction        time.Duration
 	AgentRequestTimeout time.Duration
 	ServerPort          string
 	OrchestratorBaseURL string
@@ -26,9 +32,48 @@ type Config struct {
 	OrchestratorHost   string // Хост оркестратора для gRPC
 	OrchestratorPort   string // Порт оркестратора для HTTP
 	// База данных и аутентификация
+	DBDriver            string // Драйвер хранилища: sqlite или postgres
 	DBPath              string
+	DBDSN               string // Строка подключения к PostgreSQL
 	JWTSecret           string
 	JWTExpirationMinutes int
+	// Аренда операций
+	AgentID             string        // Идентификатор агента, передаваемый оркестратору
+	LeaseSlack          time.Duration // Запас времени сверх времени операции до истечения аренды
+	LeaseReapInterval   time.Duration // Период проверки истекших аренд
+	AgentStreaming      bool          // Получать задачи потоком вместо периодического опроса
+	// Webhook о завершении выражений
+	WebhookTimeout      time.Duration // Таймаут запроса на callback_url
+	WebhookMaxAttempts  int           // Число попыток доставки
+	WebhookRetryBase    time.Duration // Задержка перед повторной попыткой, удваивается с каждой попыткой
+	WebhookRetryMax     time.Duration // Максимальная задержка между попытками
+	WebhookPollInterval time.Duration // Период проверки очереди доставок
+	WebhookWorkers      int           // Число одновременно выполняемых доставок
+	// Сети, в которые разрешены запросы webhook. По умолчанию запрещены частные, loopback и link-local адреса.
+	// Запрет WebhookDeniedNetworks сильнее разрешения WebhookAllowedNetworks и WebhookAllowPrivate
+	WebhookAllowPrivate    bool           // Разрешить частные, loopback и link-local адреса
+	WebhookAllowedNetworks []netip.Prefix // Сети, разрешенные несмотря на запрет частных адресов
+	WebhookDeniedNetworks  []netip.Prefix // Сети, запрещенные всегда
+	// Реестр агентов
+	AgentHeartbeatInterval time.Duration // Период Heartbeat агента; агент без Heartbeat дольше трех периодов считается недоступным
+	AdminUsers             []string      // Логины пользователей с доступом к /api/v1/admin
+	// Метрики
+	AgentMetricsPort string // Порт HTTP сервера метрик агента; "0" — не запускать
+	// Логирование
+	LogFormat string     // Формат записей: text или json
+	LogLevel  slog.Level // Минимальный уровень записей
+	LogStdout bool       // Дублировать записи в стандартный вывод
+	// Ротация файлов журнала
+	LogMaxSizeMB      int           // Размер файла, после которого он ротируется; 0 — без ограничения
+	LogRotateInterval time.Duration // Период ротации по времени; 0 — не ротировать по времени
+	LogMaxBackups     int           // Число хранимых ротированных файлов; 0 — хранить все
+	LogCompress       bool          // Сжимать ротированные файлы gzip
+	// Трассировка
+	ClientTraceFilePath string // Файл трасс оркестратора; пусто — трассировка выключена
+	AgentTraceFilePath  string // Файл трасс агента; пусто — трассировка выключена
+	TraceFormat         string // Формат файла трасс: otlp или json
+
+	ShutdownTimeout time.Duration // Время на корректную остановку оркестратора и агента
 }
 
 var (
@@ -112,6 +157,48 @@ func InitConfig(configPath string) {
 		log.Fatal("TIME_DIVISION_MS not set")
 	}
 
+	// Время новых операций необязательно: по умолчанию степень считается как
+	// умножение, а остаток и целочисленное деление как деление
+	if os.Getenv("TIME_POWER_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("TIME_POWER_MS"))
+		if err != nil {
+			log.Fatal("TIME_POWER_MS not a number")
+		}
+		AppConfig.TimePower = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.TimePower = AppConfig.TimeMultiplication
+	}
+
+	if os.Getenv("TIME_MODULO_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("TIME_MODULO_MS"))
+		if err != nil {
+			log.Fatal("TIME_MODULO_MS not a number")
+		}
+		AppConfig.TimeModulo = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.TimeModulo = AppConfig.TimeDivision
+	}
+
+	if os.Getenv("TIME_INT_DIVISION_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("TIME_INT_DIVISION_MS"))
+		if err != nil {
+			log.Fatal("TIME_INT_DIVISION_MS not a number")
+		}
+		AppConfig.TimeIntDivision = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.TimeIntDivision = AppConfig.TimeDivision
+	}
+
+	if os.Getenv("TIME_FUNCTION_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("TIME_FUNCTION_MS"))
+		if err != nil {
+			log.Fatal("TIME_FUNCTION_MS not a number")
+		}
+		AppConfig.TimeFunction = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.TimeFunction = AppConfig.TimeMultiplication
+	}
+
 	if os.Getenv("AGENT_REQUEST_TIMEOUT_MS") != "" {
 		value, err := strconv.Atoi(os.Getenv("AGENT_REQUEST_TIMEOUT_MS"))
 		if err != nil {
@@ -163,6 +250,17 @@ func InitConfig(configPath string) {
 		log.Println("Using default DB_PATH: ./data/calculator.db")
 	}
 
+	if os.Getenv("DB_DRIVER") != "" {
+		AppConfig.DBDriver = os.Getenv("DB_DRIVER")
+	} else {
+		AppConfig.DBDriver = "sqlite"
+	}
+
+	AppConfig.DBDSN = os.Getenv("DB_DSN")
+	if AppConfig.DBDriver == "postgres" && AppConfig.DBDSN == "" {
+		log.Fatal("DB_DSN not set")
+	}
+
 	if os.Getenv("JWT_SECRET") != "" {
 		AppConfig.JWTSecret = os.Getenv("JWT_SECRET")
 	} else {
@@ -183,4 +281,255 @@ func InitConfig(configPath string) {
 		log.Println("JWT_EXPIRATION_MINUTES not set, using default value of 1440 minutes (24 hours)")
 		AppConfig.JWTExpirationMinutes = 1440
 	}
+
+	// Идентификатор агента: по умолчанию имя хоста и PID процесса
+	if os.Getenv("AGENT_ID") != "" {
+		AppConfig.AgentID = os.Getenv("AGENT_ID")
+	} else {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "agent"
+		}
+		AppConfig.AgentID = hostname + "-" + strconv.Itoa(os.Getpid())
+	}
+
+	if os.Getenv("LEASE_SLACK_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("LEASE_SLACK_MS"))
+		if err != nil {
+			log.Fatal("LEASE_SLACK_MS not a number")
+		}
+		AppConfig.LeaseSlack = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.LeaseSlack = 5 * time.Second
+	}
+
+	if os.Getenv("LEASE_REAP_INTERVAL_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("LEASE_REAP_INTERVAL_MS"))
+		if err != nil {
+			log.Fatal("LEASE_REAP_INTERVAL_MS not a number")
+		}
+		AppConfig.LeaseReapInterval = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.LeaseReapInterval = time.Second
+	}
+
+	if os.Getenv("AGENT_STREAMING") != "" {
+		value, err := strconv.ParseBool(os.Getenv("AGENT_STREAMING"))
+		if err != nil {
+			log.Fatal("AGENT_STREAMING not a boolean")
+		}
+		AppConfig.AgentStreaming = value
+	} else {
+		AppConfig.AgentStreaming = true
+	}
+
+	if os.Getenv("WEBHOOK_TIMEOUT_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("WEBHOOK_TIMEOUT_MS"))
+		if err != nil {
+			log.Fatal("WEBHOOK_TIMEOUT_MS not a number")
+		}
+		AppConfig.WebhookTimeout = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.WebhookTimeout = 5 * time.Second
+	}
+
+	if os.Getenv("WEBHOOK_MAX_ATTEMPTS") != "" {
+		value, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+		if err != nil || value < 1 {
+			log.Fatal("WEBHOOK_MAX_ATTEMPTS must be a positive number")
+		}
+		AppConfig.WebhookMaxAttempts = value
+	} else {
+		AppConfig.WebhookMaxAttempts = 5
+	}
+
+	if os.Getenv("WEBHOOK_RETRY_BASE_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("WEBHOOK_RETRY_BASE_MS"))
+		if err != nil {
+			log.Fatal("WEBHOOK_RETRY_BASE_MS not a number")
+		}
+		AppConfig.WebhookRetryBase = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.WebhookRetryBase = time.Second
+	}
+
+	if os.Getenv("WEBHOOK_RETRY_MAX_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("WEBHOOK_RETRY_MAX_MS"))
+		if err != nil {
+			log.Fatal("WEBHOOK_RETRY_MAX_MS not a number")
+		}
+		AppConfig.WebhookRetryMax = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.WebhookRetryMax = time.Minute
+	}
+
+	if os.Getenv("WEBHOOK_POLL_INTERVAL_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("WEBHOOK_POLL_INTERVAL_MS"))
+		if err != nil {
+			log.Fatal("WEBHOOK_POLL_INTERVAL_MS not a number")
+		}
+		AppConfig.WebhookPollInterval = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.WebhookPollInterval = time.Second
+	}
+
+	if os.Getenv("WEBHOOK_WORKERS") != "" {
+		value, err := strconv.Atoi(os.Getenv("WEBHOOK_WORKERS"))
+		if err != nil || value < 1 {
+			log.Fatal("WEBHOOK_WORKERS must be a positive number")
+		}
+		AppConfig.WebhookWorkers = value
+	} else {
+		AppConfig.WebhookWorkers = 4
+	}
+
+	if os.Getenv("WEBHOOK_ALLOW_PRIVATE") != "" {
+		value, err := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE"))
+		if err != nil {
+			log.Fatal("WEBHOOK_ALLOW_PRIVATE not a boolean")
+		}
+		AppConfig.WebhookAllowPrivate = value
+	} else {
+		AppConfig.WebhookAllowPrivate = false
+	}
+
+	AppConfig.WebhookAllowedNetworks = networksFromEnv("WEBHOOK_ALLOWED_NETWORKS")
+	AppConfig.WebhookDeniedNetworks = networksFromEnv("WEBHOOK_DENIED_NETWORKS")
+
+	if os.Getenv("AGENT_HEARTBEAT_INTERVAL_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("AGENT_HEARTBEAT_INTERVAL_MS"))
+		if err != nil {
+			log.Fatal("AGENT_HEARTBEAT_INTERVAL_MS not a number")
+		}
+		AppConfig.AgentHeartbeatInterval = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.AgentHeartbeatInterval = 5 * time.Second
+	}
+
+	AppConfig.AdminUsers = nil
+	for _, login := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if login = strings.TrimSpace(login); login != "" {
+			AppConfig.AdminUsers = append(AppConfig.AdminUsers, login)
+		}
+	}
+
+	if os.Getenv("AGENT_METRICS_PORT") != "" {
+		if _, err := strconv.Atoi(os.Getenv("AGENT_METRICS_PORT")); err != nil {
+			log.Fatal("AGENT_METRICS_PORT not a number")
+		}
+		AppConfig.AgentMetricsPort = os.Getenv("AGENT_METRICS_PORT")
+	} else {
+		AppConfig.AgentMetricsPort = "9100"
+	}
+
+	switch os.Getenv("LOG_FORMAT") {
+	case "", "text":
+		AppConfig.LogFormat = "text"
+	case "json":
+		AppConfig.LogFormat = "json"
+	default:
+		log.Fatal("LOG_FORMAT must be text or json")
+	}
+
+	if os.Getenv("LOG_LEVEL") != "" {
+		if err := AppConfig.LogLevel.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+			log.Fatal("LOG_LEVEL must be debug, info, warn or error")
+		}
+	} else {
+		AppConfig.LogLevel = slog.LevelInfo
+	}
+
+	if os.Getenv("LOG_STDOUT") != "" {
+		value, err := strconv.ParseBool(os.Getenv("LOG_STDOUT"))
+		if err != nil {
+			log.Fatal("LOG_STDOUT not a boolean")
+		}
+		AppConfig.LogStdout = value
+	} else {
+		AppConfig.LogStdout = false
+	}
+
+	if os.Getenv("LOG_MAX_SIZE_MB") != "" {
+		value, err := strconv.Atoi(os.Getenv("LOG_MAX_SIZE_MB"))
+		if err != nil || value < 0 {
+			log.Fatal("LOG_MAX_SIZE_MB not a number")
+		}
+		AppConfig.LogMaxSizeMB = value
+	} else {
+		AppConfig.LogMaxSizeMB = 100
+	}
+
+	if os.Getenv("LOG_ROTATE_INTERVAL_HOURS") != "" {
+		value, err := strconv.Atoi(os.Getenv("LOG_ROTATE_INTERVAL_HOURS"))
+		if err != nil || value < 0 {
+			log.Fatal("LOG_ROTATE_INTERVAL_HOURS not a number")
+		}
+		AppConfig.LogRotateInterval = time.Duration(value) * time.Hour
+	} else {
+		AppConfig.LogRotateInterval = 24 * time.Hour
+	}
+
+	if os.Getenv("LOG_MAX_BACKUPS") != "" {
+		value, err := strconv.Atoi(os.Getenv("LOG_MAX_BACKUPS"))
+		if err != nil || value < 0 {
+			log.Fatal("LOG_MAX_BACKUPS not a number")
+		}
+		AppConfig.LogMaxBackups = value
+	} else {
+		AppConfig.LogMaxBackups = 7
+	}
+
+	if os.Getenv("LOG_COMPRESS") != "" {
+		value, err := strconv.ParseBool(os.Getenv("LOG_COMPRESS"))
+		if err != nil {
+			log.Fatal("LOG_COMPRESS not a boolean")
+		}
+		AppConfig.LogCompress = value
+	} else {
+		AppConfig.LogCompress = true
+	}
+
+	AppConfig.ClientTraceFilePath = os.Getenv("CLIENT_TRACE_FILE_PATH")
+	AppConfig.AgentTraceFilePath = os.Getenv("AGENT_TRACE_FILE_PATH")
+
+	switch os.Getenv("TRACE_FORMAT") {
+	case "", "otlp":
+		AppConfig.TraceFormat = "otlp"
+	case "json":
+		AppConfig.TraceFormat = "json"
+	default:
+		log.Fatal("TRACE_FORMAT must be otlp or json")
+	}
+
+	if os.Getenv("SHUTDOWN_TIMEOUT_MS") != "" {
+		value, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT_MS"))
+		if err != nil {
+			log.Fatal("SHUTDOWN_TIMEOUT_MS not a number")
+		}
+		AppConfig.ShutdownTimeout = time.Duration(value) * time.Millisecond
+	} else {
+		AppConfig.ShutdownTimeout = 10 * time.Second
+	}
+}
+
+// networksFromEnv разбирает переменную окружения name — список сетей CIDR через запятую.
+// Адрес без длины префикса означает одну эту машину
+func networksFromEnv(name string) []netip.Prefix {
+	var networks []netip.Prefix
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		network, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				log.Fatalf("%s: invalid network %q", name, value)
+			}
+			network = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		networks = append(networks, network.Masked())
+	}
+	return networks
 }
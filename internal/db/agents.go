@@ -0,0 +1,158 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RegisterAgent сохраняет агента. Повторная регистрация обновляет его описание и время регистрации,
+// счетчики задач сохраняются
+func RegisterAgent(agent *Agent) error {
+	return active().RegisterAgent(agent)
+}
+
+func (s *sqlStore) RegisterAgent(agent *Agent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.exec(
+		`INSERT INTO agents (id, hostname, computing_power, version, last_seen_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (id) DO UPDATE
+		 SET hostname = excluded.hostname, computing_power = excluded.computing_power,
+		     version = excluded.version, last_seen_at = excluded.last_seen_at,
+		     registered_at = CURRENT_TIMESTAMP`,
+		agent.ID, agent.Hostname, agent.ComputingPower, agent.Version, agent.LastSeenAt.UnixMilli(),
+	)
+	return err
+}
+
+// TouchAgent обновляет время последнего обращения агента.
+// Возвращает false, если агент не зарегистрирован
+func TouchAgent(agentID string, now time.Time) (bool, error) {
+	return active().TouchAgent(agentID, now)
+}
+
+func (s *sqlStore) TouchAgent(agentID string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.exec("UPDATE agents SET last_seen_at = ? WHERE id = ?", now.UnixMilli(), agentID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// RecordAgentTask учитывает задачу, завершенную агентом успешно или с ошибкой,
+// и обновляет время его последнего обращения. Незарегистрированные агенты не учитываются
+func RecordAgentTask(agentID string, failed bool, now time.Time) error {
+	return active().RecordAgentTask(agentID, failed, now)
+}
+
+func (s *sqlStore) RecordAgentTask(agentID string, failed bool, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	completed, failedCount := 1, 0
+	if failed {
+		completed, failedCount = 0, 1
+	}
+
+	_, err := s.exec(
+		`UPDATE agents
+		 SET tasks_completed = tasks_completed + ?, tasks_failed = tasks_failed + ?, last_seen_at = ?
+		 WHERE id = ?`,
+		completed, failedCount, now.UnixMilli(), agentID,
+	)
+	return err
+}
+
+// GetAgents получает всех зарегистрированных агентов
+func GetAgents() ([]*Agent, error) {
+	return active().GetAgents()
+}
+
+func (s *sqlStore) GetAgents() ([]*Agent, error) {
+	rows, err := s.query(
+		`SELECT id, hostname, computing_power, version, last_seen_at, tasks_completed, tasks_failed, registered_at
+		 FROM agents ORDER BY id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var agents []*Agent
+	for rows.Next() {
+		var agent Agent
+		var lastSeenAt int64
+		var registeredAtStr string
+
+		err := rows.Scan(
+			&agent.ID, &agent.Hostname, &agent.ComputingPower, &agent.Version, &lastSeenAt,
+			&agent.TasksCompleted, &agent.TasksFailed, &registeredAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		agent.LastSeenAt = time.UnixMilli(lastSeenAt)
+		agent.RegisteredAt, err = time.Parse(time.RFC3339, registeredAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		agents = append(agents, &agent)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return agents, nil
+}
+
+// GetActiveLeases получает аренды операций, которые сейчас выполняются агентами
+func GetActiveLeases() ([]*Lease, error) {
+	return active().GetActiveLeases()
+}
+
+func (s *sqlStore) GetActiveLeases() ([]*Lease, error) {
+	rows, err := s.query(
+		`SELECT id, expression_id, lease_owner, lease_id, lease_expires_at
+		 FROM operations WHERE status = ? AND lease_id IS NOT NULL ORDER BY id`,
+		StatusProcessing,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leases []*Lease
+	for rows.Next() {
+		var lease Lease
+		var owner sql.NullString
+		var expiresAt sql.NullInt64
+
+		err := rows.Scan(&lease.OperationID, &lease.ExpressionID, &owner, &lease.LeaseID, &expiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		lease.Owner = owner.String
+		lease.ExpiresAt = time.UnixMilli(expiresAt.Int64)
+		leases = append(leases, &lease)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return leases, nil
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAgents проверяет регистрацию агентов и учет выполненных ими задач
+func TestAgents(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	now := time.Now().Truncate(time.Millisecond)
+	agent := &Agent{ID: "agent-1", Hostname: "host", ComputingPower: 4, Version: "1.0", LastSeenAt: now}
+	if err := RegisterAgent(agent); err != nil {
+		t.Fatalf("RegisterAgent() error = %v", err)
+	}
+
+	if err := RecordAgentTask("agent-1", false, now); err != nil {
+		t.Fatalf("RecordAgentTask() error = %v", err)
+	}
+	if err := RecordAgentTask("agent-1", true, now); err != nil {
+		t.Fatalf("RecordAgentTask() error = %v", err)
+	}
+	// Задачи незарегистрированного агента не учитываются
+	if err := RecordAgentTask("unknown", false, now); err != nil {
+		t.Fatalf("RecordAgentTask() for unknown agent error = %v", err)
+	}
+
+	// Повторная регистрация обновляет описание, но не счетчики
+	agent.Version = "1.1"
+	if err := RegisterAgent(agent); err != nil {
+		t.Fatalf("RegisterAgent() again error = %v", err)
+	}
+
+	later := now.Add(time.Minute)
+	if ok, err := TouchAgent("agent-1", later); err != nil || !ok {
+		t.Fatalf("TouchAgent() = %v, %v, want true", ok, err)
+	}
+	if ok, err := TouchAgent("unknown", later); err != nil || ok {
+		t.Errorf("TouchAgent() for unknown agent = %v, %v, want false", ok, err)
+	}
+
+	agents, err := GetAgents()
+	if err != nil {
+		t.Fatalf("GetAgents() error = %v", err)
+	}
+	if len(agents) != 1 {
+		t.Fatalf("GetAgents() returned %d agents, want 1", len(agents))
+	}
+
+	got := agents[0]
+	if got.Hostname != "host" || got.ComputingPower != 4 || got.Version != "1.1" {
+		t.Errorf("GetAgents() = %+v, want host, 4 workers, version 1.1", got)
+	}
+	if got.TasksCompleted != 1 || got.TasksFailed != 1 {
+		t.Errorf("Tasks completed/failed = %d/%d, want 1/1", got.TasksCompleted, got.TasksFailed)
+	}
+	if !got.LastSeenAt.Equal(later) {
+		t.Errorf("LastSeenAt = %v, want %v", got.LastSeenAt, later)
+	}
+}
+
+// TestGetActiveLeases проверяет получение операций, выполняемых агентами
+func TestGetActiveLeases(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "1+2")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	leased, err := CreateOperation(expr.ID, nil, "+", floatPtr(1), floatPtr(2), true, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create operation: %v", err)
+	}
+	if _, err := CreateOperation(expr.ID, nil, "+", floatPtr(3), floatPtr(4), false, nil, StatusReady); err != nil {
+		t.Fatalf("Failed to create operation: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	if err := LeaseOperation(leased.ID, "agent-1", "lease-1", expiresAt); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+
+	leases, err := GetActiveLeases()
+	if err != nil {
+		t.Fatalf("GetActiveLeases() error = %v", err)
+	}
+	if len(leases) != 1 {
+		t.Fatalf("GetActiveLeases() returned %d leases, want 1", len(leases))
+	}
+
+	lease := leases[0]
+	if lease.OperationID != leased.ID || lease.ExpressionID != expr.ID || lease.Owner != "agent-1" ||
+		lease.LeaseID != "lease-1" || !lease.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("GetActiveLeases() = %+v", lease)
+	}
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrBatchNotFound = errors.New("batch not found")
+)
+
+// CreateBatch создает пакет выражений пользователя
+func CreateBatch(userID int64) (*Batch, error) {
+	return active().CreateBatch(userID)
+}
+
+func (s *sqlStore) CreateBatch(userID int64) (*Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.insert("INSERT INTO batches (user_id) VALUES (?)", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Batch{
+		ID:        id,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// GetBatchByID получает пакет по ID
+func GetBatchByID(id int64) (*Batch, error) {
+	return active().GetBatchByID(id)
+}
+
+func (s *sqlStore) GetBatchByID(id int64) (*Batch, error) {
+	var batch Batch
+	var createdAtStr string
+
+	err := s.queryRow("SELECT id, user_id, created_at FROM batches WHERE id = ?", id).
+		Scan(&batch.ID, &batch.UserID, &createdAtStr)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrBatchNotFound
+		}
+		return nil, err
+	}
+
+	batch.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+// GetBatchExpressions получает выражения пакета в порядке их отправки
+func GetBatchExpressions(batchID int64) ([]*Expression, error) {
+	return active().GetBatchExpressions(batchID)
+}
+
+func (s *sqlStore) GetBatchExpressions(batchID int64) ([]*Expression, error) {
+	rows, err := s.query(
+		`SELECT `+expressionColumns+`
+         FROM expressions 
+         WHERE batch_id = ? 
+         ORDER BY id`,
+		batchID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expressions []*Expression
+
+	for rows.Next() {
+		expr, err := scanExpression(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		expressions = append(expressions, expr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return expressions, nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestBatches проверяет создание пакета и получение его выражений
+func TestBatches(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	batch, err := CreateBatch(user.ID)
+	if err != nil {
+		t.Fatalf("CreateBatch() error = %v", err)
+	}
+
+	for _, expression := range []string{"1+1", "2*2"} {
+		if err := active().CreateExpression(&Expression{UserID: user.ID, BatchID: &batch.ID, Expression: expression}); err != nil {
+			t.Fatalf("CreateExpression() error = %v", err)
+		}
+	}
+
+	// Выражение вне пакета
+	if _, err := CreateExpression(user.ID, "3+3"); err != nil {
+		t.Fatalf("CreateExpression() error = %v", err)
+	}
+
+	saved, err := GetBatchByID(batch.ID)
+	if err != nil {
+		t.Fatalf("GetBatchByID() error = %v", err)
+	}
+	if saved.UserID != user.ID {
+		t.Errorf("Batch user ID = %v, want %v", saved.UserID, user.ID)
+	}
+
+	expressions, err := GetBatchExpressions(batch.ID)
+	if err != nil {
+		t.Fatalf("GetBatchExpressions() error = %v", err)
+	}
+	if len(expressions) != 2 || expressions[0].Expression != "1+1" || expressions[1].Expression != "2*2" {
+		t.Fatalf("GetBatchExpressions() = %v, want 1+1 and 2*2", expressions)
+	}
+	if expressions[0].BatchID == nil || *expressions[0].BatchID != batch.ID {
+		t.Errorf("Expression batch ID = %v, want %v", expressions[0].BatchID, batch.ID)
+	}
+
+	if _, err := GetBatchByID(batch.ID + 1); err != ErrBatchNotFound {
+		t.Errorf("GetBatchByID() error = %v, want %v", err, ErrBatchNotFound)
+	}
+}
+
+// TestInTx_Rollback проверяет, что при ошибке транзакции изменения не сохраняются
+func TestInTx_Rollback(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	errFailed := errors.New("failed")
+	var batchID int64
+	err = InTx(func(tx TxStore) error {
+		batch, err := tx.CreateBatch(user.ID)
+		if err != nil {
+			return err
+		}
+		batchID = batch.ID
+
+		if err := tx.CreateExpression(&Expression{UserID: user.ID, BatchID: &batch.ID, Expression: "1+1"}); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("InTx() error = %v, want %v", err, errFailed)
+	}
+
+	if _, err := GetBatchByID(batchID); err != ErrBatchNotFound {
+		t.Errorf("GetBatchByID() after rollback error = %v, want %v", err, ErrBatchNotFound)
+	}
+
+	expressions, err := GetUserExpressions(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserExpressions() error = %v", err)
+	}
+	if len(expressions) != 0 {
+		t.Errorf("Expected no expressions after rollback, got %d", len(expressions))
+	}
+}
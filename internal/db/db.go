@@ -5,51 +5,99 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"parallel-calculator/internal/config"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
 	DB *sql.DB
 
-	// Мьютекс для защиты параллельных операций с базой данных
+	// Мьютекс для сериализации записи в базу данных SQLite. Чтение выполняется без него
 	DbMutex sync.Mutex
 )
 
-// InitDB инициализирует соединение с базой данных SQLite
+// Поддерживаемые драйверы хранилища
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// InitDB инициализирует хранилище, выбранное в конфигурации (SQLite или PostgreSQL)
 func InitDB(packagePath string) error {
-	// Получаем путь к базе данных из конфигурации
-	dbPath := config.AppConfig.DBPath
+	var (
+		store      Store
+		schemaFile string
+		err        error
+	)
+
+	switch config.AppConfig.DBDriver {
+	case DriverSQLite, "":
+		store, err = openSQLite(config.AppConfig.DBPath)
+		schemaFile = "schema.sql"
+	case DriverPostgres:
+		store, err = openPostgres(config.AppConfig.DBDSN)
+		schemaFile = "schema_postgres.sql"
+	default:
+		return fmt.Errorf("unsupported database driver: %s", config.AppConfig.DBDriver)
+	}
+	if err != nil {
+		return err
+	}
 
+	SetStore(store)
+
+	if err = ApplySchema(filepath.Join(packagePath, schemaFile)); err != nil {
+		return fmt.Errorf("failed to apply schema: %w", err)
+	}
+
+	return nil
+}
+
+// openSQLite открывает базу данных SQLite по пути dbPath
+func openSQLite(dbPath string) (Store, error) {
 	// Проверка, что директория для базы данных существует
 	dbDir := filepath.Dir(dbPath)
 	if _, err := os.Stat(dbDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(dbDir, 0755); err != nil {
-			return fmt.Errorf("failed to create database directory: %w", err)
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
 		}
 	}
 
-	var err error
+	// Журнал WAL позволяет читать параллельно с записью, а busy_timeout
+	// ждет освобождения базы вместо немедленной ошибки "database is locked"
+	dsn := dbPath + "?_journal_mode=WAL&_busy_timeout=5000"
+	if strings.Contains(dbPath, "?") {
+		dsn = dbPath + "&_journal_mode=WAL&_busy_timeout=5000"
+	}
 
 	// Открываем соединение с базой данных
-	DB, err = sql.Open("sqlite3", dbPath)
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Проверяем соединение
-	if err = DB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+	if err = conn.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	if err = ApplySchema(filepath.Join(packagePath, "schema.sql")); err != nil {
-		return fmt.Errorf("failed to apply schema: %w", err)
+	return NewSQLiteStore(conn), nil
+}
+
+// openPostgres подключается к PostgreSQL по строке подключения dsn
+func openPostgres(dsn string) (Store, error) {
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	return nil
+	if err = conn.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return NewPostgresStore(conn), nil
 }
 
 func CloseDB() error {
@@ -61,30 +109,10 @@ func CloseDB() error {
 
 // CleanupDB очищает все таблицы в базе данных (используется для тестирования)
 func CleanupDB() error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-
-	tables := []string{"operations", "expressions", "users"}
-
-	for _, table := range tables {
-		_, err := DB.Exec("DELETE FROM " + table)
-		if err != nil {
-			return fmt.Errorf("failed to clean up table %s: %w", table, err)
-		}
-	}
-
-	// Сбрасываем автоинкрементные счетчики
-	for _, table := range tables {
-		_, err := DB.Exec("DELETE FROM sqlite_sequence WHERE name=?", table)
-		if err != nil {
-			return fmt.Errorf("failed to reset auto-increment for table %s: %w", table, err)
-		}
-	}
-
-	return nil
+	return active().Cleanup()
 }
 
-// applySchema выполняет SQL из файла schema.sql
+// applySchema выполняет SQL из файла схемы
 func ApplySchema(schemaPath string) error {
 
 	schemaBytes, err := os.ReadFile(schemaPath)
@@ -92,7 +120,7 @@ func ApplySchema(schemaPath string) error {
 		return fmt.Errorf("failed to read schema file: %w", err)
 	}
 
-	_, err = DB.Exec(string(schemaBytes))
+	err = active().ApplySchema(string(schemaBytes))
 	if err != nil {
 		return fmt.Errorf("failed to execute schema: %w", err)
 	}
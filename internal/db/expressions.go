@@ -7,88 +7,105 @@ import (
 )
 
 var (
-	ErrExpressionNotFound = errors.New("expression not found")
+	ErrExpressionNotFound      = errors.New("expression not found")
+	ErrExpressionNotCancelable = errors.New("expression is already finished")
 )
 
+// Колонки выражения в порядке, ожидаемом scanExpression
+const expressionColumns = `id, user_id, batch_id, original_expression, status, result, mode,
+         decimal_precision, decimal_rounding, exact_result, result_lower, result_upper,
+         error_message, callback_url, request_id, traceparent, error_operation_id, error_start, error_end,
+         created_at, updated_at`
+
 // CreateExpression создает новое выражение в базе данных
 func CreateExpression(userID int64, expression string) (*Expression, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	res, err := DB.Exec(
-		`INSERT INTO expressions (user_id, original_expression, status) VALUES (?, ?, ?)`,
-		userID, expression, StatusPending,
-	)
-	if err != nil {
-		return nil, err
+	expr := &Expression{
+		UserID:     userID,
+		Expression: expression,
 	}
-	id, err := res.LastInsertId()
-	if err != nil {
+
+	if err := active().CreateExpression(expr); err != nil {
 		return nil, err
 	}
-	return &Expression{
-		ID:         id,
-		UserID:     userID,
-		Expression: expression,
-		Status:     StatusPending,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-	}, nil
+	return expr, nil
 }
 
-// GetExpressionByID получает выражение по ID
-func GetExpressionByID(id int64) (*Expression, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	var expr Expression
-	var createdAtStr, updatedAtStr string
-	var result sql.NullFloat64
-	var errorMessage sql.NullString
-
-	err := DB.QueryRow(
-		`SELECT id, user_id, original_expression, status, result, 
-         error_message, created_at, updated_at 
-         FROM expressions WHERE id = ?`,
-		id,
-	).Scan(
-		&expr.ID, &expr.UserID, &expr.Expression, &expr.Status,
-		&result, &errorMessage, &createdAtStr, &updatedAtStr,
-	)
+// CreateExpressionWithCallback создает выражение, результат которого будет отправлен на callbackURL
+func CreateExpressionWithCallback(userID int64, expression, callbackURL string) (*Expression, error) {
+	expr := &Expression{
+		UserID:      userID,
+		Expression:  expression,
+		CallbackURL: &callbackURL,
+	}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrExpressionNotFound
-		}
+	if err := active().CreateExpression(expr); err != nil {
 		return nil, err
 	}
+	return expr, nil
+}
 
-	if result.Valid {
-		val := result.Float64
-		expr.Result = &val
-	}
+// InsertExpression сохраняет выражение с заполненными пользователем, текстом и необязательными
+// режимом с параметрами режима decimal, callback_url, request_id и traceparent, заполняет его ID, статус и время создания
+func InsertExpression(expr *Expression) error {
+	return active().CreateExpression(expr)
+}
 
-	if errorMessage.Valid {
-		val := errorMessage.String
-		expr.ErrorMessage = &val
+// CreateExpression сохраняет ожидающее вычисления выражение и заполняет его ID, статус и время создания
+func (s *sqlStore) CreateExpression(expr *Expression) error {
+	if expr.Mode == "" {
+		expr.Mode = ModeFloat
 	}
 
-	expr.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := s.insert(
+		`INSERT INTO expressions (user_id, batch_id, original_expression, status, mode, decimal_precision, decimal_rounding,
+		 callback_url, request_id, traceparent)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		expr.UserID, expr.BatchID, expr.Expression, StatusPending, expr.Mode, expr.Precision, expr.Rounding,
+		expr.CallbackURL, expr.RequestID, expr.Traceparent,
+	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	expr.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
+	expr.ID = id
+	expr.Status = StatusPending
+	expr.CreatedAt = time.Now()
+	expr.UpdatedAt = expr.CreatedAt
+	return nil
+}
+
+// GetExpressionByID получает выражение по ID
+func GetExpressionByID(id int64) (*Expression, error) {
+	return active().GetExpressionByID(id)
+}
+
+func (s *sqlStore) GetExpressionByID(id int64) (*Expression, error) {
+	expr, err := scanExpression(s.queryRow(
+		`SELECT `+expressionColumns+`
+         FROM expressions WHERE id = ?`,
+		id,
+	))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrExpressionNotFound
+		}
 		return nil, err
 	}
 
-	return &expr, nil
+	return expr, nil
 }
 
 // UpdateExpressionStatus обновляет статус выражения
 func UpdateExpressionStatus(id int64, status string) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	_, err := DB.Exec(
+	return active().UpdateExpressionStatus(id, status)
+}
+
+func (s *sqlStore) UpdateExpressionStatus(id int64, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.exec(
 		"UPDATE expressions SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
 		status, id,
 	)
@@ -97,9 +114,13 @@ func UpdateExpressionStatus(id int64, status string) error {
 
 // SetExpressionResult устанавливает результат выражения
 func SetExpressionResult(id int64, result float64) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	_, err := DB.Exec(
+	return active().SetExpressionResult(id, result)
+}
+
+func (s *sqlStore) SetExpressionResult(id int64, result float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.exec(
 		`UPDATE expressions 
          SET result = ?, status = ?, updated_at = CURRENT_TIMESTAMP 
          WHERE id = ?`,
@@ -108,11 +129,72 @@ func SetExpressionResult(id int64, result float64) error {
 	return err
 }
 
+// CompleteExpression устанавливает результат выражения и статус "completed", если выражение
+// не было отменено или завершено с ошибкой. Возвращает false, если выражение не обновлено
+func CompleteExpression(id int64, result float64) (bool, error) {
+	return active().CompleteExpression(id, result)
+}
+
+func (s *sqlStore) CompleteExpression(id int64, result float64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, err := s.exec(
+		`UPDATE expressions
+		 SET result = ?, status = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND status NOT IN (?, ?)`,
+		result, StatusCompleted, id, StatusCanceled, StatusError,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// SetExpressionExactResult сохраняет точный результат выражения в режиме rational или decimal.
+// Приближенный результат и статус устанавливаются SetExpressionResult
+func SetExpressionExactResult(id int64, exact string) error {
+	return active().SetExpressionExactResult(id, exact)
+}
+
+func (s *sqlStore) SetExpressionExactResult(id int64, exact string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.exec(
+		"UPDATE expressions SET exact_result = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		exact, id,
+	)
+	return err
+}
+
+// SetExpressionIntervalResult сохраняет границы результата выражения в режиме interval.
+// Середина интервала и статус устанавливаются SetExpressionResult
+func SetExpressionIntervalResult(id int64, lower, upper float64) error {
+	return active().SetExpressionIntervalResult(id, lower, upper)
+}
+
+func (s *sqlStore) SetExpressionIntervalResult(id int64, lower, upper float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.exec(
+		"UPDATE expressions SET result_lower = ?, result_upper = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		lower, upper, id,
+	)
+	return err
+}
+
 // SetExpressionError устанавливает ошибку для выражения
 func SetExpressionError(id int64, errorMessage string) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	_, err := DB.Exec(
+	return active().SetExpressionError(id, errorMessage)
+}
+
+func (s *sqlStore) SetExpressionError(id int64, errorMessage string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.exec(
 		`UPDATE expressions 
          SET error_message = ?, status = ?, updated_at = CURRENT_TIMESTAMP 
          WHERE id = ?`,
@@ -121,13 +203,33 @@ func SetExpressionError(id int64, errorMessage string) error {
 	return err
 }
 
+// SetExpressionOperationError устанавливает ошибку выражения, вызванную операцией op,
+// и запоминает операцию и границы ее подвыражения в исходном выражении
+func SetExpressionOperationError(op *Operation, errorMessage string) error {
+	return active().SetExpressionOperationError(op, errorMessage)
+}
+
+func (s *sqlStore) SetExpressionOperationError(op *Operation, errorMessage string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.exec(
+		`UPDATE expressions 
+         SET error_message = ?, status = ?, error_operation_id = ?, error_start = ?, error_end = ?,
+             updated_at = CURRENT_TIMESTAMP 
+         WHERE id = ?`,
+		errorMessage, StatusError, op.ID, op.SourceStart, op.SourceEnd, op.ExpressionID,
+	)
+	return err
+}
+
 // GetUserExpressions получает все выражения пользователя
 func GetUserExpressions(userID int64) ([]*Expression, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	rows, err := DB.Query(
-		`SELECT id, user_id, original_expression, status, result, 
-         error_message, created_at, updated_at 
+	return active().GetUserExpressions(userID)
+}
+
+func (s *sqlStore) GetUserExpressions(userID int64) ([]*Expression, error) {
+	rows, err := s.query(
+		`SELECT `+expressionColumns+`
          FROM expressions 
          WHERE user_id = ? 
          ORDER BY created_at DESC`,
@@ -141,45 +243,161 @@ func GetUserExpressions(userID int64) ([]*Expression, error) {
 	var expressions []*Expression
 
 	for rows.Next() {
-		var expr Expression
-		var createdAtStr, updatedAtStr string
-		var result sql.NullFloat64
-		var errorMessage sql.NullString
-
-		err := rows.Scan(
-			&expr.ID, &expr.UserID, &expr.Expression, &expr.Status,
-			&result, &errorMessage, &createdAtStr, &updatedAtStr,
-		)
+		expr, err := scanExpression(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		if result.Valid {
-			val := result.Float64
-			expr.Result = &val
-		}
+		expressions = append(expressions, expr)
+	}
 
-		if errorMessage.Valid {
-			val := errorMessage.String
-			expr.ErrorMessage = &val
-		}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
-		expr.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
-		if err != nil {
-			return nil, err
-		}
+	return expressions, nil
+}
 
-		expr.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
-		if err != nil {
-			return nil, err
-		}
+// scanExpression читает выражение из результата запроса по колонкам expressionColumns
+func scanExpression(row rowScanner) (*Expression, error) {
+	var expr Expression
+	var createdAtStr, updatedAtStr string
+	var batchID sql.NullInt64
+	var result, resultLower, resultUpper sql.NullFloat64
+	var rounding, exactResult, errorMessage, callbackURL, requestID, traceparent sql.NullString
+	var precision, errorOperationID, errorStart, errorEnd sql.NullInt64
 
-		expressions = append(expressions, &expr)
+	err := row.Scan(
+		&expr.ID, &expr.UserID, &batchID, &expr.Expression, &expr.Status,
+		&result, &expr.Mode, &precision, &rounding, &exactResult, &resultLower, &resultUpper, &errorMessage, &callbackURL, &requestID, &traceparent,
+		&errorOperationID, &errorStart, &errorEnd, &createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	if err = rows.Err(); err != nil {
+	if batchID.Valid {
+		val := batchID.Int64
+		expr.BatchID = &val
+	}
+
+	if result.Valid {
+		val := result.Float64
+		expr.Result = &val
+	}
+
+	if precision.Valid {
+		val := int(precision.Int64)
+		expr.Precision = &val
+	}
+	expr.Rounding = nullString(rounding)
+
+	if exactResult.Valid {
+		val := exactResult.String
+		expr.ExactResult = &val
+	}
+
+	if resultLower.Valid && resultUpper.Valid {
+		lower, upper := resultLower.Float64, resultUpper.Float64
+		expr.ResultLower, expr.ResultUpper = &lower, &upper
+	}
+
+	if errorMessage.Valid {
+		val := errorMessage.String
+		expr.ErrorMessage = &val
+	}
+
+	if callbackURL.Valid {
+		val := callbackURL.String
+		expr.CallbackURL = &val
+	}
+
+	if requestID.Valid {
+		val := requestID.String
+		expr.RequestID = &val
+	}
+
+	if traceparent.Valid {
+		val := traceparent.String
+		expr.Traceparent = &val
+	}
+
+	if errorOperationID.Valid {
+		val := errorOperationID.Int64
+		expr.ErrorOperationID = &val
+	}
+
+	if errorStart.Valid && errorEnd.Valid {
+		start, end := int(errorStart.Int64), int(errorEnd.Int64)
+		expr.ErrorStart, expr.ErrorEnd = &start, &end
+	}
+
+	expr.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
 		return nil, err
 	}
 
-	return expressions, nil
+	expr.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &expr, nil
+}
+
+// CancelExpression отменяет выражение и все его незавершенные операции, включая выданные агентам.
+// Возвращает ErrExpressionNotCancelable, если выражение уже завершено, с ошибкой или отменено
+func CancelExpression(id int64) error {
+	return active().CancelExpression(id)
+}
+
+func (s *sqlStore) CancelExpression(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(s.rebind(
+		`UPDATE expressions
+		 SET status = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND status NOT IN (?, ?, ?)`),
+		StatusCanceled, id, StatusCompleted, StatusError, StatusCanceled,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var exists bool
+		err = tx.QueryRow(s.rebind("SELECT EXISTS(SELECT 1 FROM expressions WHERE id = ?)"), id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrExpressionNotFound
+		}
+		return ErrExpressionNotCancelable
+	}
+
+	// Аренда снимается, чтобы операция не вернулась в очередь после истечения срока
+	_, err = tx.Exec(s.rebind(
+		`UPDATE operations
+		 SET status = ?, lease_owner = NULL, lease_id = NULL, lease_expires_at = NULL,
+		 updated_at = CURRENT_TIMESTAMP
+		 WHERE expression_id = ? AND status IN (?, ?, ?)`),
+		StatusCanceled, id, StatusPending, StatusReady, StatusProcessing,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
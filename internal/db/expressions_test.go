@@ -2,6 +2,7 @@ package db
 
 import (
 	"testing"
+	"time"
 )
 
 // TestCreateExpression проверяет создание выражения
@@ -120,6 +121,45 @@ func TestSetExpressionResult(t *testing.T) {
 	}
 }
 
+// TestCompleteExpression проверяет, что результат не завершает отмененное выражение
+func TestCompleteExpression(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "5+5")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	if completed, err := CompleteExpression(expr.ID, 10); err != nil || !completed {
+		t.Errorf("CompleteExpression() = %v, %v, want true", completed, err)
+	}
+
+	canceled, err := CreateExpression(user.ID, "5+6")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	if err := CancelExpression(canceled.ID); err != nil {
+		t.Fatalf("CancelExpression() error = %v", err)
+	}
+	if completed, err := CompleteExpression(canceled.ID, 11); err != nil || completed {
+		t.Errorf("CompleteExpression() of canceled expression = %v, %v, want false", completed, err)
+	}
+
+	updated, err := GetExpressionByID(canceled.ID)
+	if err != nil {
+		t.Fatalf("GetExpressionByID() error = %v", err)
+	}
+	if updated.Status != StatusCanceled || updated.Result != nil {
+		t.Errorf("Expression status = %v, result = %v, want canceled without result", updated.Status, updated.Result)
+	}
+}
+
 // TestSetExpressionError проверяет установку ошибки выражения
 func TestSetExpressionError(t *testing.T) {
 	// Инициализируем конфигурацию
@@ -161,6 +201,66 @@ func TestSetExpressionError(t *testing.T) {
 	}
 }
 
+// TestSetExpressionOperationError проверяет сохранение операции и подвыражения, вызвавших ошибку
+func TestSetExpressionOperationError(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "1 + 4/0")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	left, right := 4.0, 0.0
+	start, end := 4, 7
+	op := &Operation{
+		ExpressionID: expr.ID,
+		Operator:     "/",
+		Kind:         KindBinary,
+		LeftValue:    &left,
+		RightValue:   &right,
+		Status:       StatusReady,
+		SourceStart:  &start,
+		SourceEnd:    &end,
+	}
+	if err := active().CreateOperation(op); err != nil {
+		t.Fatalf("Failed to create test operation: %v", err)
+	}
+
+	// Границы подвыражения сохраняются вместе с операцией
+	saved, err := GetOperationByID(op.ID)
+	if err != nil {
+		t.Fatalf("GetOperationByID() error = %v", err)
+	}
+	if saved.SourceStart == nil || *saved.SourceStart != start || saved.SourceEnd == nil || *saved.SourceEnd != end {
+		t.Errorf("Operation source = %v..%v, want %d..%d", saved.SourceStart, saved.SourceEnd, start, end)
+	}
+
+	if err := SetExpressionOperationError(saved, "division by zero"); err != nil {
+		t.Fatalf("SetExpressionOperationError() error = %v", err)
+	}
+
+	updatedExpr, err := GetExpressionByID(expr.ID)
+	if err != nil {
+		t.Fatalf("GetExpressionByID() error = %v", err)
+	}
+	if updatedExpr.Status != StatusError || updatedExpr.ErrorMessage == nil || *updatedExpr.ErrorMessage != "division by zero" {
+		t.Errorf("Expression = %s %v, want error %q", updatedExpr.Status, updatedExpr.ErrorMessage, "division by zero")
+	}
+	if updatedExpr.ErrorOperationID == nil || *updatedExpr.ErrorOperationID != op.ID {
+		t.Errorf("Expression error operation = %v, want %d", updatedExpr.ErrorOperationID, op.ID)
+	}
+	if updatedExpr.ErrorStart == nil || *updatedExpr.ErrorStart != start || updatedExpr.ErrorEnd == nil || *updatedExpr.ErrorEnd != end {
+		t.Errorf("Expression error span = %v..%v, want %d..%d", updatedExpr.ErrorStart, updatedExpr.ErrorEnd, start, end)
+	}
+}
+
 // TestUpdateExpressionStatus проверяет обновление статуса выражения
 func TestUpdateExpressionStatus(t *testing.T) {
 	// Инициализируем конфигурацию
@@ -211,6 +311,77 @@ func TestUpdateExpressionStatus(t *testing.T) {
 	}
 }
 
+// TestCancelExpression проверяет отмену выражения вместе с незавершенными операциями
+func TestCancelExpression(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "(1+2)*(3+4)")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	root, err := CreateOperation(expr.ID, nil, "*", nil, nil, true, nil, StatusPending)
+	if err != nil {
+		t.Fatalf("Failed to create root operation: %v", err)
+	}
+	readyOp, err := CreateOperation(expr.ID, &root.ID, "+", floatPtr(1.0), floatPtr(2.0), false, strPtr("left"), StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create ready operation: %v", err)
+	}
+	leasedOp, err := CreateOperation(expr.ID, &root.ID, "+", floatPtr(3.0), floatPtr(4.0), false, strPtr("right"), StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create leased operation: %v", err)
+	}
+	if err := LeaseOperation(leasedOp.ID, "agent-1", "lease-1", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+
+	if err := CancelExpression(expr.ID); err != nil {
+		t.Fatalf("CancelExpression() error = %v", err)
+	}
+
+	updatedExpr, err := GetExpressionByID(expr.ID)
+	if err != nil {
+		t.Fatalf("GetExpressionByID() error = %v", err)
+	}
+	if updatedExpr.Status != StatusCanceled {
+		t.Errorf("Expression status = %v, want %v", updatedExpr.Status, StatusCanceled)
+	}
+
+	for _, id := range []int64{root.ID, readyOp.ID, leasedOp.ID} {
+		op, err := GetOperationByID(id)
+		if err != nil {
+			t.Fatalf("GetOperationByID() error = %v", err)
+		}
+		if op.Status != StatusCanceled {
+			t.Errorf("Operation %d status = %v, want %v", id, op.Status, StatusCanceled)
+		}
+	}
+
+	// Отмененная операция не возвращается в очередь после истечения аренды
+	requeued, err := RequeueExpiredLeases(time.Now())
+	if err != nil {
+		t.Fatalf("RequeueExpiredLeases() error = %v", err)
+	}
+	if requeued != 0 {
+		t.Errorf("RequeueExpiredLeases() = %d, want 0", requeued)
+	}
+
+	if err := CancelExpression(expr.ID); err != ErrExpressionNotCancelable {
+		t.Errorf("CancelExpression() on canceled expression error = %v, want %v", err, ErrExpressionNotCancelable)
+	}
+	if err := CancelExpression(999999); err != ErrExpressionNotFound {
+		t.Errorf("CancelExpression() on missing expression error = %v, want %v", err, ErrExpressionNotFound)
+	}
+}
+
 // TestGetUserExpressions проверяет получение выражений пользователя
 func TestGetUserExpressions(t *testing.T) {
 	// Инициализируем конфигурацию
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrLeaseNotHeld = errors.New("lease is not held")
+)
+
+// Lease описывает аренду операции агентом
+type Lease struct {
+	OperationID  int64
+	ExpressionID int64 // заполняется только в GetActiveLeases
+	Owner        string
+	LeaseID      string
+	ExpiresAt    time.Time
+}
+
+// LeaseOperation переводит операцию в статус "processing" и закрепляет её за агентом до expiresAt
+func LeaseOperation(operationID int64, owner, leaseID string, expiresAt time.Time) error {
+	return active().LeaseOperation(operationID, owner, leaseID, expiresAt)
+}
+
+func (s *sqlStore) LeaseOperation(operationID int64, owner, leaseID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.exec(
+		`UPDATE operations
+		 SET status = ?, lease_owner = ?, lease_id = ?, lease_expires_at = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND status = ?`,
+		StatusProcessing, owner, leaseID, expiresAt.UnixMilli(), operationID, StatusReady,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrLeaseNotHeld
+	}
+	return nil
+}
+
+// ClaimReadyOperation атомарно выбирает готовую операцию, переводит её в статус "processing"
+// и закрепляет за агентом. Срок аренды вычисляет leaseUntil по выбранной операции.
+// Возвращает nil, если готовых операций нет
+func ClaimReadyOperation(owner, leaseID string, leaseUntil func(op *Operation) time.Time) (*Operation, error) {
+	return active().ClaimReadyOperation(owner, leaseID, leaseUntil)
+}
+
+func (s *sqlStore) ClaimReadyOperation(owner, leaseID string, leaseUntil func(op *Operation) time.Time) (*Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Условие на статус повторяется во внешнем UPDATE: если операцию успел забрать
+	// другой оркестратор, строка не изменится и будет возвращено sql.ErrNoRows
+	var id int64
+	err = tx.QueryRow(s.rebind(
+		`UPDATE operations
+		 SET status = ?, lease_owner = ?, lease_id = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = (SELECT id FROM operations WHERE status = ? ORDER BY id LIMIT 1`+s.skipLocked+`)
+		 AND status = ?
+		 RETURNING id`),
+		StatusProcessing, owner, leaseID, StatusReady, StatusReady,
+	).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	op, err := scanOperation(tx.QueryRow(s.rebind(
+		`SELECT `+operationColumns+`
+		FROM operations WHERE id = ?`),
+		id,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(s.rebind("UPDATE operations SET lease_expires_at = ? WHERE id = ?"),
+		leaseUntil(op).UnixMilli(), id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// GetOperationLease получает текущую аренду операции
+func GetOperationLease(operationID int64) (*Lease, error) {
+	return active().GetOperationLease(operationID)
+}
+
+func (s *sqlStore) GetOperationLease(operationID int64) (*Lease, error) {
+	var owner, leaseID sql.NullString
+	var expiresAt sql.NullInt64
+
+	err := s.queryRow(
+		"SELECT lease_owner, lease_id, lease_expires_at FROM operations WHERE id = ?",
+		operationID,
+	).Scan(&owner, &leaseID, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOperationNotFound
+		}
+		return nil, err
+	}
+
+	if !leaseID.Valid {
+		return nil, ErrLeaseNotHeld
+	}
+
+	return &Lease{
+		OperationID: operationID,
+		Owner:       owner.String,
+		LeaseID:     leaseID.String,
+		ExpiresAt:   time.UnixMilli(expiresAt.Int64),
+	}, nil
+}
+
+// ReleaseLease снимает аренду с операции перед приемом результата.
+// Возвращает ErrLeaseNotHeld, если leaseID пуст, операция не была выдана или аренда уже истекла
+// и была передана другому агенту. Вызывается в одной транзакции с записью результата,
+// чтобы операция не осталась в статусе "processing" без аренды
+func ReleaseLease(operationID int64, leaseID string) error {
+	return active().ReleaseLease(operationID, leaseID)
+}
+
+func (s *sqlStore) ReleaseLease(operationID int64, leaseID string) error {
+	if leaseID == "" {
+		return ErrLeaseNotHeld
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.exec(
+		`UPDATE operations
+		 SET lease_owner = NULL, lease_id = NULL, lease_expires_at = NULL
+		 WHERE id = ? AND lease_id = ? AND status = ?`,
+		operationID, leaseID, StatusProcessing,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrLeaseNotHeld
+	}
+	return nil
+}
+
+// RequeueExpiredLeases возвращает в статус "ready" операции, аренда которых истекла к моменту now.
+// Возвращает количество возвращенных в очередь операций
+func RequeueExpiredLeases(now time.Time) (int64, error) {
+	return active().RequeueExpiredLeases(now)
+}
+
+func (s *sqlStore) RequeueExpiredLeases(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.exec(
+		`UPDATE operations
+		 SET status = ?, lease_owner = NULL, lease_id = NULL, lease_expires_at = NULL,
+		 updated_at = CURRENT_TIMESTAMP
+		 WHERE status = ? AND lease_expires_at IS NOT NULL AND lease_expires_at < ?`,
+		StatusReady, StatusProcessing, now.UnixMilli(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// RequeueLeasedOperation возвращает операцию, выданную агенту с арендой leaseID, в статус "ready".
+// Возвращает ErrLeaseNotHeld, если аренда уже истекла, передана другому агенту или операция отменена
+func RequeueLeasedOperation(operationID int64, leaseID string) error {
+	return active().RequeueLeasedOperation(operationID, leaseID)
+}
+
+func (s *sqlStore) RequeueLeasedOperation(operationID int64, leaseID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.exec(
+		`UPDATE operations
+		 SET status = ?, lease_owner = NULL, lease_id = NULL, lease_expires_at = NULL,
+		 updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND status = ? AND lease_id = ?`,
+		StatusReady, operationID, StatusProcessing, leaseID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrLeaseNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package db
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLeaseOperation проверяет закрепление операции за агентом
+func TestLeaseOperation(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "2*3")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op, err := CreateOperation(expr.ID, nil, "*", floatPtr(2.0), floatPtr(3.0), true, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create test operation: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Minute)
+	if err := LeaseOperation(op.ID, "agent-1", "lease-1", expiresAt); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+
+	updatedOp, err := GetOperationByID(op.ID)
+	if err != nil {
+		t.Fatalf("Failed to get operation: %v", err)
+	}
+	if updatedOp.Status != StatusProcessing {
+		t.Errorf("Operation status = %v, want %v", updatedOp.Status, StatusProcessing)
+	}
+
+	lease, err := GetOperationLease(op.ID)
+	if err != nil {
+		t.Fatalf("GetOperationLease() error = %v", err)
+	}
+	if lease.Owner != "agent-1" || lease.LeaseID != "lease-1" {
+		t.Errorf("Lease = %+v, want owner agent-1 and id lease-1", lease)
+	}
+	if lease.ExpiresAt.UnixMilli() != expiresAt.UnixMilli() {
+		t.Errorf("Lease expires at %v, want %v", lease.ExpiresAt, expiresAt)
+	}
+
+	// Повторная аренда уже выданной операции невозможна
+	if err := LeaseOperation(op.ID, "agent-2", "lease-2", expiresAt); err != ErrLeaseNotHeld {
+		t.Errorf("LeaseOperation() on processing operation error = %v, want %v", err, ErrLeaseNotHeld)
+	}
+}
+
+// TestReleaseLease проверяет прием результата только от владельца аренды
+func TestReleaseLease(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "2*3")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op, err := CreateOperation(expr.ID, nil, "*", floatPtr(2.0), floatPtr(3.0), true, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create test operation: %v", err)
+	}
+
+	if err := LeaseOperation(op.ID, "agent-1", "lease-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		leaseID     string
+		expectedErr error
+	}{
+		{name: "Foreign lease", leaseID: "lease-2", expectedErr: ErrLeaseNotHeld},
+		{name: "Missing lease on leased operation", leaseID: "", expectedErr: ErrLeaseNotHeld},
+		{name: "Owner lease", leaseID: "lease-1", expectedErr: nil},
+		{name: "Already released", leaseID: "lease-1", expectedErr: ErrLeaseNotHeld},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ReleaseLease(op.ID, tt.leaseID); err != tt.expectedErr {
+				t.Errorf("ReleaseLease() error = %v, want %v", err, tt.expectedErr)
+			}
+		})
+	}
+
+	// Результат без аренды не принимается и для операции, которую никто не арендовал
+	notLeased, err := CreateOperation(expr.ID, nil, "+", floatPtr(1.0), floatPtr(1.0), false, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create test operation: %v", err)
+	}
+	if err := ReleaseLease(notLeased.ID, ""); err != ErrLeaseNotHeld {
+		t.Errorf("ReleaseLease() without lease error = %v, want %v", err, ErrLeaseNotHeld)
+	}
+}
+
+// TestRequeueExpiredLeases проверяет возврат в очередь операций с истекшей арендой
+func TestRequeueExpiredLeases(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "2*3+1")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	expiredOp, err := CreateOperation(expr.ID, nil, "*", floatPtr(2.0), floatPtr(3.0), false, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create expired operation: %v", err)
+	}
+	activeOp, err := CreateOperation(expr.ID, nil, "+", floatPtr(6.0), floatPtr(1.0), false, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create active operation: %v", err)
+	}
+
+	now := time.Now()
+	if err := LeaseOperation(expiredOp.ID, "agent-1", "lease-1", now.Add(-time.Second)); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+	if err := LeaseOperation(activeOp.ID, "agent-2", "lease-2", now.Add(time.Minute)); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+
+	requeued, err := RequeueExpiredLeases(now)
+	if err != nil {
+		t.Fatalf("RequeueExpiredLeases() error = %v", err)
+	}
+	if requeued != 1 {
+		t.Errorf("RequeueExpiredLeases() = %d, want 1", requeued)
+	}
+
+	op, err := GetOperationByID(expiredOp.ID)
+	if err != nil {
+		t.Fatalf("Failed to get operation: %v", err)
+	}
+	if op.Status != StatusReady {
+		t.Errorf("Expired operation status = %v, want %v", op.Status, StatusReady)
+	}
+	if _, err := GetOperationLease(expiredOp.ID); err != ErrLeaseNotHeld {
+		t.Errorf("GetOperationLease() error = %v, want %v", err, ErrLeaseNotHeld)
+	}
+
+	// Результат от прежнего владельца аренды больше не принимается
+	if err := ReleaseLease(expiredOp.ID, "lease-1"); err != ErrLeaseNotHeld {
+		t.Errorf("ReleaseLease() error = %v, want %v", err, ErrLeaseNotHeld)
+	}
+
+	op, err = GetOperationByID(activeOp.ID)
+	if err != nil {
+		t.Fatalf("Failed to get operation: %v", err)
+	}
+	if op.Status != StatusProcessing {
+		t.Errorf("Active operation status = %v, want %v", op.Status, StatusProcessing)
+	}
+}
+
+// TestRequeueLeasedOperation проверяет возврат агентом полученной, но не начатой операции
+func TestRequeueLeasedOperation(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "2*3")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op, err := CreateOperation(expr.ID, nil, "*", floatPtr(2.0), floatPtr(3.0), true, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create test operation: %v", err)
+	}
+
+	if err := LeaseOperation(op.ID, "agent-1", "lease-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+
+	// Вернуть операцию может только владелец аренды
+	if err := RequeueLeasedOperation(op.ID, "lease-2"); err != ErrLeaseNotHeld {
+		t.Errorf("RequeueLeasedOperation() with foreign lease error = %v, want %v", err, ErrLeaseNotHeld)
+	}
+
+	if err := RequeueLeasedOperation(op.ID, "lease-1"); err != nil {
+		t.Fatalf("RequeueLeasedOperation() error = %v", err)
+	}
+
+	updatedOp, err := GetOperationByID(op.ID)
+	if err != nil {
+		t.Fatalf("Failed to get operation: %v", err)
+	}
+	if updatedOp.Status != StatusReady {
+		t.Errorf("Operation status = %v, want %v", updatedOp.Status, StatusReady)
+	}
+	if _, err := GetOperationLease(op.ID); err != ErrLeaseNotHeld {
+		t.Errorf("GetOperationLease() error = %v, want %v", err, ErrLeaseNotHeld)
+	}
+
+	// Повторный возврат ничего не меняет
+	if err := RequeueLeasedOperation(op.ID, "lease-1"); err != ErrLeaseNotHeld {
+		t.Errorf("Second RequeueLeasedOperation() error = %v, want %v", err, ErrLeaseNotHeld)
+	}
+}
+
+// TestClaimReadyOperation проверяет атомарную выдачу готовой операции
+func TestClaimReadyOperation(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "2*3")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op, err := CreateOperation(expr.ID, nil, "*", floatPtr(2.0), floatPtr(3.0), true, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create test operation: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Minute)
+	claimed, err := ClaimReadyOperation("agent-1", "lease-1", func(claimed *Operation) time.Time {
+		if claimed.Operator != "*" {
+			t.Errorf("leaseUntil got operator %q, want %q", claimed.Operator, "*")
+		}
+		return expiresAt
+	})
+	if err != nil {
+		t.Fatalf("ClaimReadyOperation() error = %v", err)
+	}
+	if claimed == nil || claimed.ID != op.ID {
+		t.Fatalf("ClaimReadyOperation() = %+v, want operation %d", claimed, op.ID)
+	}
+	if claimed.Status != StatusProcessing {
+		t.Errorf("Claimed operation status = %v, want %v", claimed.Status, StatusProcessing)
+	}
+
+	lease, err := GetOperationLease(op.ID)
+	if err != nil {
+		t.Fatalf("GetOperationLease() error = %v", err)
+	}
+	if lease.Owner != "agent-1" || lease.LeaseID != "lease-1" || lease.ExpiresAt.UnixMilli() != expiresAt.UnixMilli() {
+		t.Errorf("Lease = %+v, want owner agent-1, id lease-1, expiry %v", lease, expiresAt)
+	}
+
+	// Готовых операций больше нет
+	claimed, err = ClaimReadyOperation("agent-2", "lease-2", func(*Operation) time.Time { return expiresAt })
+	if err != nil || claimed != nil {
+		t.Errorf("ClaimReadyOperation() on empty queue = %+v, %v, want nil", claimed, err)
+	}
+}
+
+// TestClaimReadyOperation_Concurrent проверяет, что при параллельной выдаче
+// каждая операция достается ровно одному агенту
+func TestClaimReadyOperation_Concurrent(t *testing.T) {
+	store, err := openSQLite(filepath.Join(t.TempDir(), "claim.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	previousDB := DB
+	SetStore(store)
+	defer func() {
+		CloseDB()
+		SetStore(nil)
+		DB = previousDB
+	}()
+
+	if err := ApplySchema(filepath.Join("../../internal/db", "schema.sql")); err != nil {
+		t.Fatalf("ApplySchema() error = %v", err)
+	}
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	expr, err := CreateExpression(user.ID, "1+1")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	const operations = 20
+	for i := 0; i < operations; i++ {
+		if _, err := CreateOperation(expr.ID, nil, "+", floatPtr(1.0), floatPtr(1.0), false, nil, StatusReady); err != nil {
+			t.Fatalf("Failed to create test operation: %v", err)
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		claimed = make(map[int64]int)
+		wg      sync.WaitGroup
+	)
+
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				op, err := ClaimReadyOperation("agent", "lease", func(*Operation) time.Time {
+					return time.Now().Add(time.Minute)
+				})
+				if err != nil {
+					t.Errorf("ClaimReadyOperation() error = %v", err)
+					return
+				}
+				if op == nil {
+					return
+				}
+
+				// Параллельное чтение не должно блокироваться выдачей
+				if _, err := GetUserExpressions(user.ID); err != nil {
+					t.Errorf("GetUserExpressions() error = %v", err)
+				}
+
+				mu.Lock()
+				claimed[op.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != operations {
+		t.Errorf("Claimed %d distinct operations, want %d", len(claimed), operations)
+	}
+	for id, count := range claimed {
+		if count != 1 {
+			t.Errorf("Operation %d claimed %d times, want 1", id, count)
+		}
+	}
+}
+
+// TestMarkOperationReady проверяет, что в очередь возвращается только ожидающая операция
+func TestMarkOperationReady(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "2*3")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op, err := CreateOperation(expr.ID, nil, "*", floatPtr(2.0), floatPtr(3.0), true, nil, StatusPending)
+	if err != nil {
+		t.Fatalf("Failed to create test operation: %v", err)
+	}
+
+	marked, err := MarkOperationReady(op.ID)
+	if err != nil || !marked {
+		t.Fatalf("MarkOperationReady() = %v, %v, want true", marked, err)
+	}
+
+	if err := LeaseOperation(op.ID, "agent-1", "lease-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+
+	// Повторное оповещение не возвращает выданную операцию в очередь
+	marked, err = MarkOperationReady(op.ID)
+	if err != nil || marked {
+		t.Errorf("MarkOperationReady() on processing operation = %v, %v, want false", marked, err)
+	}
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"parallel-calculator/internal/metrics"
+	"sync"
+	"time"
+)
+
+// Время ожидания DbMutex перед записью в SQLite
+var dbLockWait = metrics.NewHistogram(
+	"calculator_db_lock_wait_seconds",
+	"Time spent waiting for the SQLite write lock.",
+	[]float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+)
+
+// RegisterMetrics добавляет метрики хранилища в реестр
+func RegisterMetrics(registry *metrics.Registry) {
+	registry.MustRegister(dbLockWait)
+}
+
+// timedLock измеряет время ожидания блокировки
+type timedLock struct {
+	*sync.Mutex
+}
+
+func (l timedLock) Lock() {
+	start := time.Now()
+	l.Mutex.Lock()
+	dbLockWait.Observe(time.Since(start).Seconds())
+}
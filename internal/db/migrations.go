@@ -0,0 +1,344 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SchemaVersion — версия схемы в schema.sql и schema_postgres.sql. Изменяя схему, увеличьте
+// версию и добавьте в migrations шаг, приводящий к ней базы предыдущей версии
+const SchemaVersion = 14
+
+// migration — шаг обновления схемы существующей базы до версии version.
+// Шаги повторяемы: база, созданная до появления schema_version, проходит все шаги с первого
+type migration struct {
+	version int
+	tables  []string // новые таблицы, создаются по определению из файла схемы
+	columns []column // новые колонки существующих таблиц
+	// checks — измененные ограничения CHECK. SQLite не меняет ограничения существующей таблицы,
+	// поэтому таблица пересоздается по определению из файла схемы, а в PostgreSQL ограничение заменяется
+	checks []check
+	// statements выполняются после изменения схемы и переносят данные
+	statements []string
+}
+
+// column — колонка, добавляемая ALTER TABLE. Определения в SQLite и PostgreSQL различаются типами
+type column struct {
+	table, name      string
+	sqlite, postgres string
+}
+
+// check — ограничение CHECK. name — имя, которое PostgreSQL дает ограничению без имени
+type check struct {
+	table, name, expr string
+}
+
+// migrations обновляют схему начиная с версии 1 — таблиц users, expressions и operations первой версии
+var migrations = []migration{
+	{version: 2, columns: []column{ // аренда операций агентами
+		{"operations", "lease_owner", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "lease_id", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "lease_expires_at", "INTEGER DEFAULT NULL", "BIGINT DEFAULT NULL"},
+	}, statements: []string{
+		// Выданные до появления аренды операции никогда не вернулись бы в очередь
+		"UPDATE operations SET status = 'ready' WHERE status = 'processing' AND lease_expires_at IS NULL",
+	}},
+	{version: 3, columns: []column{ // унарные операции; ограничение operator_kind обновляется в версии 4
+		{"operations", "operator_kind", "TEXT NOT NULL DEFAULT 'binary'", "TEXT NOT NULL DEFAULT 'binary'"},
+	}},
+	{version: 4, columns: []column{ // функции
+		{"operations", "arguments", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+	}, checks: []check{
+		{"operations", "operations_child_position_check", "child_position IN ('left', 'right') OR child_position LIKE 'arg%'"},
+		{"operations", "operations_operator_kind_check", "operator_kind IN ('binary', 'unary', 'function')"},
+	}},
+	{version: 5, tables: []string{"variables"}},
+	{version: 6, tables: []string{"batches"}, columns: []column{
+		{"expressions", "batch_id", "INTEGER DEFAULT NULL REFERENCES batches(id) ON DELETE CASCADE",
+			"BIGINT DEFAULT NULL REFERENCES batches(id) ON DELETE CASCADE"},
+	}},
+	{version: 7, tables: []string{"webhook_deliveries"}, columns: []column{
+		{"users", "webhook_secret", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"expressions", "callback_url", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+	}},
+	{version: 8, tables: []string{"agents"}},
+	{version: 9, columns: []column{
+		{"expressions", "request_id", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+	}},
+	{version: 10, columns: []column{
+		{"expressions", "traceparent", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+	}},
+	{version: 11, columns: []column{ // позиции ошибок в исходном выражении
+		{"expressions", "error_operation_id", "INTEGER DEFAULT NULL", "BIGINT DEFAULT NULL"},
+		{"expressions", "error_start", "INTEGER DEFAULT NULL", "INTEGER DEFAULT NULL"},
+		{"expressions", "error_end", "INTEGER DEFAULT NULL", "INTEGER DEFAULT NULL"},
+		{"operations", "source_start", "INTEGER DEFAULT NULL", "INTEGER DEFAULT NULL"},
+		{"operations", "source_end", "INTEGER DEFAULT NULL", "INTEGER DEFAULT NULL"},
+	}},
+	{version: 12, columns: []column{ // режим rational
+		{"expressions", "mode", "TEXT NOT NULL DEFAULT 'float'", "TEXT NOT NULL DEFAULT 'float'"},
+		{"expressions", "exact_result", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "mode", "TEXT NOT NULL DEFAULT 'float'", "TEXT NOT NULL DEFAULT 'float'"},
+		{"operations", "left_exact", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "right_exact", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "arguments_exact", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "result_exact", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+	}},
+	{version: 13, columns: []column{ // режим decimal
+		{"expressions", "decimal_precision", "INTEGER DEFAULT NULL", "INTEGER DEFAULT NULL"},
+		{"expressions", "decimal_rounding", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "decimal_precision", "INTEGER DEFAULT NULL", "INTEGER DEFAULT NULL"},
+		{"operations", "decimal_rounding", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+	}},
+	{version: 14, columns: []column{ // режим interval
+		{"expressions", "result_lower", "NUMERIC DEFAULT NULL", "DOUBLE PRECISION DEFAULT NULL"},
+		{"expressions", "result_upper", "NUMERIC DEFAULT NULL", "DOUBLE PRECISION DEFAULT NULL"},
+		{"operations", "left_lower", "NUMERIC DEFAULT NULL", "DOUBLE PRECISION DEFAULT NULL"},
+		{"operations", "left_upper", "NUMERIC DEFAULT NULL", "DOUBLE PRECISION DEFAULT NULL"},
+		{"operations", "right_lower", "NUMERIC DEFAULT NULL", "DOUBLE PRECISION DEFAULT NULL"},
+		{"operations", "right_upper", "NUMERIC DEFAULT NULL", "DOUBLE PRECISION DEFAULT NULL"},
+		{"operations", "arguments_lower", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "arguments_upper", "TEXT DEFAULT NULL", "TEXT DEFAULT NULL"},
+		{"operations", "result_lower", "NUMERIC DEFAULT NULL", "DOUBLE PRECISION DEFAULT NULL"},
+		{"operations", "result_upper", "NUMERIC DEFAULT NULL", "DOUBLE PRECISION DEFAULT NULL"},
+	}},
+}
+
+// ApplySchema приводит базу к схеме schema. Новая база создается по схеме целиком,
+// существующая обновляется шагами migrations от своей версии до SchemaVersion.
+// Все изменения выполняются в одной транзакции
+func (s *sqlStore) ApplySchema(schema string) error {
+	ctx := context.Background()
+
+	// Соединение закрепляется: PRAGMA действует на соединение, а база SQLite в памяти
+	// у каждого соединения своя
+	conn, err := s.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)"); err != nil {
+		return fmt.Errorf("ошибка при создании таблицы schema_version: %w", err)
+	}
+
+	if s.driver == DriverSQLite {
+		// При пересоздании таблицы внешние ключи не проверяются, иначе удаление старой
+		// таблицы каскадно удалило бы строки, уже скопированные в новую
+		var foreignKeys bool
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+			return err
+		}
+		if foreignKeys {
+			if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+				return err
+			}
+			defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m := &migrator{sqlStore: &sqlStore{conn: s.conn, q: tx, mu: noLock{}, rebind: s.rebind, driver: s.driver}, schema: schema}
+	if err := m.migrate(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrator выполняет шаги migrations в транзакции ApplySchema
+type migrator struct {
+	*sqlStore
+	schema string
+}
+
+func (m *migrator) migrate() error {
+	var version sql.NullInt64
+	if err := m.queryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return fmt.Errorf("ошибка при чтении версии схемы: %w", err)
+	}
+
+	if !version.Valid {
+		existing, err := m.tableExists("expressions")
+		if err != nil {
+			return err
+		}
+		// База создана до появления schema_version: шаги повторяемы и выполняются с первого
+		version.Int64 = 1
+		if !existing {
+			version.Int64 = SchemaVersion
+		}
+	}
+
+	for _, step := range migrations {
+		if int64(step.version) <= version.Int64 {
+			continue
+		}
+		if err := m.apply(step); err != nil {
+			return fmt.Errorf("ошибка при обновлении схемы до версии %d: %w", step.version, err)
+		}
+	}
+
+	// Схема создает недостающие таблицы и индексы; существующие таблицы она не изменяет
+	if _, err := m.q.Exec(m.schema); err != nil {
+		return err
+	}
+
+	if _, err := m.exec("DELETE FROM schema_version"); err != nil {
+		return err
+	}
+	_, err := m.exec("INSERT INTO schema_version (version) VALUES (?)", max(version.Int64, SchemaVersion))
+	return err
+}
+
+// apply выполняет один шаг обновления схемы
+func (m *migrator) apply(step migration) error {
+	for _, table := range step.tables {
+		definition, err := m.tableDefinition(table)
+		if err != nil {
+			return err
+		}
+		if _, err := m.exec(definition); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range step.columns {
+		if m.driver == DriverPostgres {
+			if _, err := m.exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", c.table, c.name, c.postgres)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		columns, err := m.columns(c.table)
+		if err != nil {
+			return err
+		}
+		if !columns[c.name] {
+			if _, err := m.exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.sqlite)); err != nil {
+				return err
+			}
+		}
+	}
+
+	rebuilt := make(map[string]bool)
+	for _, c := range step.checks {
+		if m.driver == DriverPostgres {
+			if _, err := m.exec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", c.table, c.name)); err != nil {
+				return err
+			}
+			if _, err := m.exec(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", c.table, c.name, c.expr)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !rebuilt[c.table] {
+			if err := m.rebuild(c.table); err != nil {
+				return err
+			}
+			rebuilt[c.table] = true
+		}
+	}
+
+	for _, statement := range step.statements {
+		if _, err := m.exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuild пересоздает таблицу SQLite по определению из файла схемы, сохраняя данные
+// колонок, которые есть в обоих определениях
+func (m *migrator) rebuild(table string) error {
+	definition, err := m.tableDefinition(table)
+	if err != nil {
+		return err
+	}
+	temporary := table + "_new"
+	definition = strings.Replace(definition, "CREATE TABLE IF NOT EXISTS "+table+" (", "CREATE TABLE "+temporary+" (", 1)
+	if _, err := m.exec(definition); err != nil {
+		return err
+	}
+
+	oldColumns, err := m.columns(table)
+	if err != nil {
+		return err
+	}
+	newColumns, err := m.columns(temporary)
+	if err != nil {
+		return err
+	}
+	var common []string
+	for name := range newColumns {
+		if oldColumns[name] {
+			common = append(common, name)
+		}
+	}
+	list := strings.Join(common, ", ")
+
+	for _, query := range []string{
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", temporary, list, list, table),
+		"DROP TABLE " + table,
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", temporary, table),
+	} {
+		if _, err := m.exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableDefinition возвращает из файла схемы запрос CREATE TABLE таблицы table
+func (m *migrator) tableDefinition(table string) (string, error) {
+	start := strings.Index(m.schema, "CREATE TABLE IF NOT EXISTS "+table+" (")
+	if start < 0 {
+		return "", fmt.Errorf("table %s not found in schema", table)
+	}
+	end := strings.Index(m.schema[start:], "\n);")
+	if end < 0 {
+		return "", fmt.Errorf("unterminated definition of table %s", table)
+	}
+	return m.schema[start : start+end+len("\n);")], nil
+}
+
+// tableExists сообщает, есть ли в базе таблица table
+func (m *migrator) tableExists(table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if m.driver == DriverPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	var count int
+	if err := m.queryRow(query, table).Scan(&count); err != nil {
+		return false, fmt.Errorf("ошибка при проверке таблицы %s: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+// columns возвращает имена колонок таблицы SQLite
+func (m *migrator) columns(table string) (map[string]bool, error) {
+	rows, err := m.query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
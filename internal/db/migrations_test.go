@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// baselineSchema — схема первой версии, в которой еще не было schema_version
+const baselineSchema = `
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    login TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE expressions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    original_expression TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    result NUMERIC DEFAULT NULL,
+    error_message TEXT DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE TABLE operations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    expression_id INTEGER NOT NULL,
+    parent_operation_id INTEGER,
+    child_position TEXT,
+    left_value NUMERIC,
+    right_value NUMERIC,
+    operator TEXT,
+    status TEXT DEFAULT 'pending',
+    result NUMERIC DEFAULT NULL,
+    error_message TEXT DEFAULT NULL,
+    is_root_expression BOOLEAN NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (expression_id) REFERENCES expressions(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_operation_id) REFERENCES operations(id) ON DELETE CASCADE,
+    CHECK (status IN ('pending', 'ready', 'processing', 'completed', 'error', 'canceled')),
+    CHECK (child_position IN ('left', 'right', NULL))
+);
+INSERT INTO users (login, password_hash) VALUES ('olduser', 'hash');
+INSERT INTO expressions (user_id, original_expression, status) VALUES (1, '(2+3)*4', 'processing');
+INSERT INTO operations (expression_id, operator, right_value, status, is_root_expression) VALUES (1, '*', 4, 'pending', 1);
+INSERT INTO operations (expression_id, parent_operation_id, child_position, operator, left_value, right_value, status)
+    VALUES (1, 1, 'left', '+', 2, 3, 'processing');
+`
+
+// TestApplySchemaMigratesBaseline проверяет обновление базы первой версии до текущей схемы
+func TestApplySchemaMigratesBaseline(t *testing.T) {
+	// Внешние ключи включены, чтобы пересоздание operations не удалило дочерние операции каскадом
+	path := filepath.Join(t.TempDir(), "calculator.db")
+	conn, err := sql.Open("sqlite3", path+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := conn.Exec(baselineSchema); err != nil {
+		t.Fatalf("Failed to create baseline schema: %v", err)
+	}
+
+	previousDB := DB
+	SetStore(NewSQLiteStore(conn))
+	defer func() {
+		CloseDB()
+		SetStore(nil)
+		DB = previousDB
+	}()
+
+	schema := filepath.Join("../../internal/db", "schema.sql")
+	if err := ApplySchema(schema); err != nil {
+		t.Fatalf("ApplySchema() error = %v", err)
+	}
+	// Повторное применение к обновленной базе ничего не меняет
+	if err := ApplySchema(schema); err != nil {
+		t.Fatalf("ApplySchema() second run error = %v", err)
+	}
+
+	var version int
+	if err := conn.QueryRow("SELECT version FROM schema_version").Scan(&version); err != nil || version != SchemaVersion {
+		t.Fatalf("schema_version = %d (%v), want %d", version, err, SchemaVersion)
+	}
+	var foreignKeys bool
+	if err := conn.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil || !foreignKeys {
+		t.Errorf("foreign_keys = %v (%v), want restored after migration", foreignKeys, err)
+	}
+
+	// Данные первой версии сохранились и читаются с новыми колонками
+	operations, err := GetOperationsByExpressionID(1)
+	if err != nil {
+		t.Fatalf("GetOperationsByExpressionID() error = %v", err)
+	}
+	if len(operations) != 2 {
+		t.Fatalf("GetOperationsByExpressionID() returned %d operations, want 2", len(operations))
+	}
+	child := operations[1]
+	if child.Kind != KindBinary || child.Mode != ModeFloat || child.ParentOpID == nil || *child.ParentOpID != 1 {
+		t.Errorf("Migrated operation = %+v, want binary float child of operation 1", child)
+	}
+	// Операция, выданная агенту без аренды, возвращена в очередь
+	if child.Status != StatusReady {
+		t.Errorf("Migrated operation status = %s, want %s", child.Status, StatusReady)
+	}
+	if _, err := GetUserByLogin("olduser"); err != nil {
+		t.Errorf("GetUserByLogin() error = %v", err)
+	}
+
+	// Аренда и возврат просроченной операции работают на обновленной таблице
+	if err := LeaseOperation(child.ID, "agent-1", "lease-1", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+	if requeued, err := RequeueExpiredLeases(time.Now()); err != nil || requeued != 1 {
+		t.Errorf("RequeueExpiredLeases() = %d, %v, want 1", requeued, err)
+	}
+
+	// Новые ограничения CHECK: аргумент функции и вид операции function
+	user, err := GetUserByLogin("olduser")
+	if err != nil {
+		t.Fatalf("GetUserByLogin() error = %v", err)
+	}
+	expr, err := CreateExpression(user.ID, "max(1, 2)")
+	if err != nil {
+		t.Fatalf("CreateExpression() error = %v", err)
+	}
+	fn := &Operation{ExpressionID: expr.ID, Operator: "max", Kind: KindFunction, Args: []*float64{floatPtr(1), nil}, IsRootExpression: true, Status: StatusPending}
+	if err := active().CreateOperation(fn); err != nil {
+		t.Fatalf("CreateOperation(function) error = %v", err)
+	}
+	arg := &Operation{ExpressionID: expr.ID, ParentOpID: &fn.ID, ChildPosition: strPtr(ArgumentPosition(1)), Operator: "+", Kind: KindBinary,
+		LeftValue: floatPtr(1), RightValue: floatPtr(1), Status: StatusReady}
+	if err := active().CreateOperation(arg); err != nil {
+		t.Fatalf("CreateOperation(argument) error = %v", err)
+	}
+	if _, err := conn.Exec("UPDATE operations SET child_position = 'middle' WHERE id = ?", arg.ID); err == nil {
+		t.Error("CHECK on child_position was not applied")
+	}
+}
+
+// TestApplySchemaNewDatabase проверяет, что новая база создается сразу в текущей версии
+func TestApplySchemaNewDatabase(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	var version int
+	if err := DB.QueryRow("SELECT version FROM schema_version").Scan(&version); err != nil || version != SchemaVersion {
+		t.Fatalf("schema_version = %d (%v), want %d", version, err, SchemaVersion)
+	}
+
+	schema, err := os.ReadFile(filepath.Join("../../internal/db", "schema.sql"))
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	// Каждая таблица, добавленная шагом обновления, определена в схеме
+	m := &migrator{sqlStore: NewSQLiteStore(DB).sqlStore, schema: string(schema)}
+	for _, step := range migrations {
+		for _, table := range step.tables {
+			if _, err := m.tableDefinition(table); err != nil {
+				t.Errorf("migration %d: %v", step.version, err)
+			}
+		}
+	}
+	if migrations[len(migrations)-1].version != SchemaVersion {
+		t.Errorf("last migration version = %d, want SchemaVersion %d", migrations[len(migrations)-1].version, SchemaVersion)
+	}
+}
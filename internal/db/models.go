@@ -1,6 +1,9 @@
 package db
 
 import (
+	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,33 +17,162 @@ type User struct {
 
 // Expression представляет математическое выражение
 type Expression struct {
-	ID           int64     `json:"id"`
-	UserID       int64     `json:"user_id"`
-	Expression   string    `json:"expression"`
-	Status       string    `json:"status"`
-	Result       *float64  `json:"result"`
-	ErrorMessage *string   `json:"error_message"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-}
-
-// Operation представляет отдельную операцию в выражении
-type Operation struct {
 	ID               int64     `json:"id"`
-	ExpressionID     int64     `json:"expression_id"`
-	ParentOpID       *int64    `json:"parent_operation_id"`
-	ChildPosition    *string   `json:"child_position"` // "left" или "right" или nil для корневой операции
-	LeftValue        *float64  `json:"left_value"`
-	RightValue       *float64  `json:"right_value"`
-	Operator         string    `json:"operator"`
+	UserID           int64     `json:"user_id"`
+	BatchID          *int64    `json:"batch_id"` // пакет, в составе которого выражение отправлено, или nil
+	Expression       string    `json:"expression"`
 	Status           string    `json:"status"`
 	Result           *float64  `json:"result"`
+	Mode             string    `json:"mode"`                   // числовой режим: ModeFloat, ModeRational, ModeDecimal или ModeInterval
+	Precision        *int      `json:"precision,omitempty"`    // знаков после запятой результата в режиме decimal
+	Rounding         *string   `json:"rounding,omitempty"`     // способ округления в режиме decimal
+	ExactResult      *string   `json:"exact_result"`           // точный результат: "p/q" в режиме rational, десятичная запись в режиме decimal
+	ResultLower      *float64  `json:"result_lower,omitempty"` // границы результата в режиме interval
+	ResultUpper      *float64  `json:"result_upper,omitempty"`
 	ErrorMessage     *string   `json:"error_message"`
-	IsRootExpression bool      `json:"is_root_expression"`
+	CallbackURL      *string   `json:"callback_url"`       // адрес webhook о завершении выражения или nil
+	RequestID        *string   `json:"-"`                  // идентификатор HTTP-запроса, создавшего выражение, для журнала
+	Traceparent      *string   `json:"-"`                  // спан создания выражения, родитель спанов его операций
+	ErrorOperationID *int64    `json:"error_operation_id"` // операция, ошибка которой завершила выражение
+	ErrorStart       *int      `json:"error_start"`        // границы подвыражения этой операции в исходном выражении (байты)
+	ErrorEnd         *int      `json:"error_end"`
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
 }
 
+// Batch представляет пакет выражений, отправленных одним запросом
+type Batch struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery представляет доставку результата выражения на callback_url
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	ExpressionID  int64           `json:"expression_id"`
+	URL           string          `json:"url"`
+	Payload       json.RawMessage `json:"payload"` // тело запроса, отправляемое на URL
+	Status        string          `json:"status"`  // "pending", "delivered" или "failed"
+	Attempts      int             `json:"attempts"`
+	ResponseCode  *int            `json:"response_code"` // HTTP-код ответа на последнюю попытку
+	LastError     *string         `json:"last_error"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// Agent представляет агента, зарегистрированного в оркестраторе
+type Agent struct {
+	ID             string    `json:"id"`
+	Hostname       string    `json:"hostname"`
+	ComputingPower int       `json:"computing_power"`
+	Version        string    `json:"version"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+	TasksCompleted int64     `json:"tasks_completed"`
+	TasksFailed    int64     `json:"tasks_failed"`
+	RegisteredAt   time.Time `json:"registered_at"`
+}
+
+// Variable представляет именованное значение пользователя, доступное в его выражениях
+type Variable struct {
+	ID        int64     `json:"-"`
+	UserID    int64     `json:"-"`
+	Name      string    `json:"name"`
+	Value     float64   `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Operation представляет отдельную операцию в выражении
+type Operation struct {
+	ID               int64      `json:"id"`
+	ExpressionID     int64      `json:"expression_id"`
+	ParentOpID       *int64     `json:"parent_operation_id"`
+	ChildPosition    *string    `json:"child_position"` // "left", "right", "arg<N>" для аргумента функции или nil для корневой операции
+	LeftValue        *float64   `json:"left_value"`
+	RightValue       *float64   `json:"right_value"`
+	Operator         string     `json:"operator"`
+	Kind             string     `json:"kind"`           // "binary", "unary" или "function"
+	Args             []*float64 `json:"args,omitempty"` // аргументы функции, nil еще не вычисленных аргументов
+	Mode             string     `json:"mode"`           // числовой режим выражения операции
+	Precision        *int       `json:"precision,omitempty"`
+	Rounding         *string    `json:"rounding,omitempty"`
+	Status           string     `json:"status"`
+	Result           *float64   `json:"result"`
+	LeftExact        *string    `json:"left_exact,omitempty"` // точные значения в режимах rational и decimal, поля float64 содержат их приближения
+	RightExact       *string    `json:"right_exact,omitempty"`
+	ArgsExact        []*string  `json:"args_exact,omitempty"`
+	ResultExact      *string    `json:"result_exact,omitempty"`
+	LeftLower        *float64   `json:"left_lower,omitempty"` // границы значений в режиме interval, поля float64 содержат середины интервалов
+	LeftUpper        *float64   `json:"left_upper,omitempty"`
+	RightLower       *float64   `json:"right_lower,omitempty"`
+	RightUpper       *float64   `json:"right_upper,omitempty"`
+	ArgsLower        []*float64 `json:"args_lower,omitempty"`
+	ArgsUpper        []*float64 `json:"args_upper,omitempty"`
+	ResultLower      *float64   `json:"result_lower,omitempty"`
+	ResultUpper      *float64   `json:"result_upper,omitempty"`
+	ErrorMessage     *string    `json:"error_message"`
+	IsRootExpression bool       `json:"is_root_expression"`
+	SourceStart      *int       `json:"source_start"` // границы подвыражения операции в исходном выражении (байты)
+	SourceEnd        *int       `json:"source_end"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// OperandsReady сообщает, получены ли все операнды, необходимые для вычисления операции
+func (op *Operation) OperandsReady() bool {
+	switch op.Kind {
+	case KindUnary:
+		return op.LeftValue != nil
+	case KindFunction:
+		for _, arg := range op.Args {
+			if arg == nil {
+				return false
+			}
+		}
+		return true
+	}
+	return op.LeftValue != nil && op.RightValue != nil
+}
+
+// Виды операций: унарная хранит единственный операнд в left_value,
+// функция (operator — имя функции) хранит аргументы в Args
+const (
+	KindBinary   = "binary"
+	KindUnary    = "unary"
+	KindFunction = "function"
+)
+
+// Числовые режимы выражений и операций. В режимах rational и decimal значения хранятся точно
+// в колонках *_exact, а в колонках float64 — их приближения для отображения и проверки готовности.
+// В режиме interval границы значений хранятся в колонках *_lower и *_upper, а в колонках float64 — середины
+const (
+	ModeFloat    = "float"
+	ModeRational = "rational"
+	ModeDecimal  = "decimal"
+	ModeInterval = "interval"
+)
+
+// ArgumentPosition возвращает позицию операции, вычисляющей i-й аргумент родительской функции
+func ArgumentPosition(i int) string {
+	return "arg" + strconv.Itoa(i)
+}
+
+// ArgumentIndex возвращает номер аргумента функции по позиции вида "arg<N>"
+func ArgumentIndex(position string) (int, bool) {
+	digits, ok := strings.CutPrefix(position, "arg")
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(digits)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
+
 // Статусы для выражений и операций
 const (
 	StatusPending    = "pending"
@@ -50,3 +182,9 @@ const (
 	StatusError      = "error"
 	StatusCanceled   = "canceled"
 )
+
+// Статусы доставки webhook. Доставка, ожидающая очередной попытки, имеет статус StatusPending
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
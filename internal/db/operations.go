@@ -2,7 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -10,74 +12,204 @@ var (
 	ErrOperationNotFound = errors.New("operation not found")
 )
 
+// Колонки операции в порядке, ожидаемом scanOperation
+const operationColumns = `id, expression_id, parent_operation_id, child_position, left_value, right_value,
+		operator, operator_kind, arguments, mode, decimal_precision, decimal_rounding,
+		left_exact, right_exact, arguments_exact, result_exact,
+		left_lower, left_upper, right_lower, right_upper, arguments_lower, arguments_upper, result_lower, result_upper,
+		status, result, error_message, is_root_expression, source_start, source_end, created_at, updated_at`
+
 // CreateOperation создает новую операцию в базе данных
 func CreateOperation(expressionID int64, parentOpID *int64, operator string,
 	leftValue, rightValue *float64, isRoot bool, childPosition *string, status string) (*Operation, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+	op := &Operation{
+		ExpressionID:     expressionID,
+		ParentOpID:       parentOpID,
+		ChildPosition:    childPosition,
+		LeftValue:        leftValue,
+		RightValue:       rightValue,
+		Operator:         operator,
+		Kind:             KindBinary,
+		Status:           status,
+		IsRootExpression: isRoot,
+	}
+
+	if err := active().CreateOperation(op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// CreateUnaryOperation создает унарную операцию (например, смену знака) с единственным операндом
+func CreateUnaryOperation(expressionID int64, parentOpID *int64, operator string,
+	value *float64, isRoot bool, childPosition *string, status string) (*Operation, error) {
+	op := &Operation{
+		ExpressionID:     expressionID,
+		ParentOpID:       parentOpID,
+		ChildPosition:    childPosition,
+		LeftValue:        value,
+		Operator:         operator,
+		Kind:             KindUnary,
+		Status:           status,
+		IsRootExpression: isRoot,
+	}
+
+	if err := active().CreateOperation(op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// CreateFunctionOperation создает операцию вызова функции name с аргументами args.
+// Невычисленные аргументы передаются как nil и заполняются через UpdateOperationArgument
+func CreateFunctionOperation(expressionID int64, parentOpID *int64, name string,
+	args []*float64, isRoot bool, childPosition *string, status string) (*Operation, error) {
+	op := &Operation{
+		ExpressionID:     expressionID,
+		ParentOpID:       parentOpID,
+		ChildPosition:    childPosition,
+		Operator:         name,
+		Kind:             KindFunction,
+		Args:             args,
+		Status:           status,
+		IsRootExpression: isRoot,
+	}
+
+	if err := active().CreateOperation(op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// CreateOperation сохраняет операцию и заполняет её ID и время создания
+func (s *sqlStore) CreateOperation(op *Operation) error {
+	if op.Mode == "" {
+		op.Mode = ModeFloat
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	query := `
 		INSERT INTO operations 
 		(expression_id, parent_operation_id, child_position, left_value, right_value,
-		operator, status, is_root_expression) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		operator, operator_kind, arguments, mode, decimal_precision, decimal_rounding,
+		left_exact, right_exact, arguments_exact, left_lower, left_upper, right_lower, right_upper,
+		arguments_lower, arguments_upper, status, is_root_expression, source_start, source_end) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	res, err := DB.Exec(
+	arguments, err := encodeArguments(op.Args)
+	if err != nil {
+		return err
+	}
+	argumentsExact, err := encodeArguments(op.ArgsExact)
+	if err != nil {
+		return err
+	}
+	argumentsLower, err := encodeArguments(op.ArgsLower)
+	if err != nil {
+		return err
+	}
+	argumentsUpper, err := encodeArguments(op.ArgsUpper)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.insert(
 		query,
-		expressionID, parentOpID, childPosition, leftValue, rightValue,
-		operator, status, isRoot,
+		op.ExpressionID, op.ParentOpID, op.ChildPosition, op.LeftValue, op.RightValue,
+		op.Operator, op.Kind, arguments, op.Mode, op.Precision, op.Rounding,
+		op.LeftExact, op.RightExact, argumentsExact, op.LeftLower, op.LeftUpper, op.RightLower, op.RightUpper,
+		argumentsLower, argumentsUpper, op.Status, op.IsRootExpression, op.SourceStart, op.SourceEnd,
 	)
 	if err != nil {
+		return err
+	}
+
+	op.ID = id
+	op.CreatedAt = time.Now()
+	op.UpdatedAt = op.CreatedAt
+	return nil
+}
+
+// GetOperationByID получает операцию по ID
+func GetOperationByID(id int64) (*Operation, error) {
+	return active().GetOperationByID(id)
+}
+
+func (s *sqlStore) GetOperationByID(id int64) (*Operation, error) {
+	op, err := scanOperation(s.queryRow(
+		`SELECT `+operationColumns+`
+		FROM operations WHERE id = ?`,
+		id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOperationNotFound
+		}
 		return nil, err
 	}
 
-	id, err := res.LastInsertId()
+	return op, nil
+}
+
+// GetOperationsByExpressionID получает все операции для выражения
+func GetOperationsByExpressionID(expressionID int64) ([]*Operation, error) {
+	return active().GetOperationsByExpressionID(expressionID)
+}
+
+func (s *sqlStore) GetOperationsByExpressionID(expressionID int64) ([]*Operation, error) {
+	rows, err := s.query(
+		`SELECT `+operationColumns+`
+		FROM operations WHERE expression_id = ?`,
+		expressionID,
+	)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &Operation{
-		ID:               id,
-		ExpressionID:     expressionID,
-		ParentOpID:       parentOpID,
-		ChildPosition:    childPosition,
-		LeftValue:        leftValue,
-		RightValue:       rightValue,
-		Operator:         operator,
-		Status:           status,
-		IsRootExpression: isRoot,
-		CreatedAt:        time.Now(),
-		UpdatedAt:        time.Now(),
-	}, nil
+	var operations []*Operation
+
+	for rows.Next() {
+		op, err := scanOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		operations = append(operations, op)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return operations, nil
 }
 
-// GetOperationByID получает операцию по ID
-func GetOperationByID(id int64) (*Operation, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+// scanOperation читает операцию из результата запроса по колонкам operationColumns
+func scanOperation(row rowScanner) (*Operation, error) {
 	var op Operation
 	var createdAtStr, updatedAtStr string
 	var parentOpID sql.NullInt64
-	var leftValue, rightValue, result sql.NullFloat64
 	var childPosition sql.NullString
-	var errorMessage sql.NullString
+	var leftValue, rightValue, result sql.NullFloat64
+	var errorMessage, arguments, rounding sql.NullString
+	var leftExact, rightExact, argumentsExact, resultExact sql.NullString
+	var leftLower, leftUpper, rightLower, rightUpper, resultLower, resultUpper sql.NullFloat64
+	var argumentsLower, argumentsUpper sql.NullString
+	var precision, sourceStart, sourceEnd sql.NullInt64
 	var isRoot bool
 
-	err := DB.QueryRow(
-		`SELECT id, expression_id, parent_operation_id, child_position, left_value, right_value,
-		operator, status, result, error_message, is_root_expression, created_at, updated_at
-		FROM operations WHERE id = ?`,
-		id,
-	).Scan(
+	err := row.Scan(
 		&op.ID, &op.ExpressionID, &parentOpID, &childPosition, &leftValue, &rightValue,
-		&op.Operator, &op.Status, &result, &errorMessage, &isRoot, &createdAtStr, &updatedAtStr,
+		&op.Operator, &op.Kind, &arguments, &op.Mode, &precision, &rounding,
+		&leftExact, &rightExact, &argumentsExact, &resultExact,
+		&leftLower, &leftUpper, &rightLower, &rightUpper, &argumentsLower, &argumentsUpper, &resultLower, &resultUpper,
+		&op.Status, &result, &errorMessage, &isRoot, &sourceStart, &sourceEnd, &createdAtStr, &updatedAtStr,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrOperationNotFound
-		}
 		return nil, err
 	}
 
@@ -101,6 +233,37 @@ func GetOperationByID(id int64) (*Operation, error) {
 		op.ChildPosition = &val
 	}
 
+	op.Args, err = decodeArguments[float64](arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	if precision.Valid {
+		val := int(precision.Int64)
+		op.Precision = &val
+	}
+	op.Rounding = nullString(rounding)
+
+	op.LeftExact = nullString(leftExact)
+	op.RightExact = nullString(rightExact)
+	op.ResultExact = nullString(resultExact)
+	op.ArgsExact, err = decodeArguments[string](argumentsExact)
+	if err != nil {
+		return nil, err
+	}
+
+	op.LeftLower, op.LeftUpper = nullFloat(leftLower), nullFloat(leftUpper)
+	op.RightLower, op.RightUpper = nullFloat(rightLower), nullFloat(rightUpper)
+	op.ResultLower, op.ResultUpper = nullFloat(resultLower), nullFloat(resultUpper)
+	op.ArgsLower, err = decodeArguments[float64](argumentsLower)
+	if err != nil {
+		return nil, err
+	}
+	op.ArgsUpper, err = decodeArguments[float64](argumentsUpper)
+	if err != nil {
+		return nil, err
+	}
+
 	if result.Valid {
 		val := result.Float64
 		op.Result = &val
@@ -113,6 +276,11 @@ func GetOperationByID(id int64) (*Operation, error) {
 
 	op.IsRootExpression = isRoot
 
+	if sourceStart.Valid && sourceEnd.Valid {
+		start, end := int(sourceStart.Int64), int(sourceEnd.Int64)
+		op.SourceStart, op.SourceEnd = &start, &end
+	}
+
 	op.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
 	if err != nil {
 		return nil, err
@@ -126,115 +294,135 @@ func GetOperationByID(id int64) (*Operation, error) {
 	return &op, nil
 }
 
-// GetOperationsByExpressionID получает все операции для выражения
-func GetOperationsByExpressionID(expressionID int64) ([]*Operation, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	rows, err := DB.Query(
-		`SELECT id, expression_id, parent_operation_id, child_position, left_value, right_value,
-		operator, status, result, error_message, is_root_expression, created_at, updated_at
-		FROM operations WHERE expression_id = ?`,
-		expressionID,
-	)
+// encodeArguments кодирует аргументы функции в JSON для колонок arguments, arguments_exact,
+// arguments_lower и arguments_upper
+func encodeArguments[T any](args []*T) (any, error) {
+	if args == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(args)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to encode arguments: %w", err)
 	}
-	defer rows.Close()
-
-	var operations []*Operation
-
-	for rows.Next() {
-		var op Operation
-		var createdAtStr, updatedAtStr string
-		var parentOpID sql.NullInt64
-		var childPosition sql.NullString
-		var leftValue, rightValue, result sql.NullFloat64
-		var errorMessage sql.NullString
-		var isRoot bool
-
-		err := rows.Scan(
-			&op.ID, &op.ExpressionID, &parentOpID, &childPosition, &leftValue, &rightValue,
-			&op.Operator, &op.Status, &result, &errorMessage, &isRoot, &createdAtStr, &updatedAtStr,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if parentOpID.Valid {
-			val := parentOpID.Int64
-			op.ParentOpID = &val
-		}
-
-		if leftValue.Valid {
-			val := leftValue.Float64
-			op.LeftValue = &val
-		}
-
-		if rightValue.Valid {
-			val := rightValue.Float64
-			op.RightValue = &val
-		}
-
-		if childPosition.Valid {
-			val := childPosition.String
-			op.ChildPosition = &val
-		}
-
-		if result.Valid {
-			val := result.Float64
-			op.Result = &val
-		}
-
-		if errorMessage.Valid {
-			val := errorMessage.String
-			op.ErrorMessage = &val
-		}
-
-		op.IsRootExpression = isRoot
-
-		op.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
-		if err != nil {
-			return nil, err
-		}
-
-		op.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
-		if err != nil {
-			return nil, err
-		}
+	return string(data), nil
+}
 
-		operations = append(operations, &op)
+// decodeArguments разбирает JSON-массив аргументов функции
+func decodeArguments[T any](arguments sql.NullString) ([]*T, error) {
+	if !arguments.Valid {
+		return nil, nil
 	}
+	var args []*T
+	if err := json.Unmarshal([]byte(arguments.String), &args); err != nil {
+		return nil, fmt.Errorf("failed to decode arguments: %w", err)
+	}
+	return args, nil
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+// nullString возвращает значение колонки или nil для NULL
+func nullString(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
 	}
+	return &value.String
+}
 
-	return operations, nil
+// nullFloat возвращает значение колонки или nil для NULL
+func nullFloat(value sql.NullFloat64) *float64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Float64
 }
 
 // UpdateOperationStatus обновляет статус операции
 func UpdateOperationStatus(id int64, status string) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	_, err := DB.Exec(
+	return active().UpdateOperationStatus(id, status)
+}
+
+func (s *sqlStore) UpdateOperationStatus(id int64, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.exec(
 		"UPDATE operations SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
 		status, id,
 	)
 	return err
 }
 
+// MarkOperationReady переводит ожидающую операцию в статус "ready".
+// Возвращает false, если операция уже не ожидает операндов (выдана агенту, отменена и т.п.)
+func MarkOperationReady(id int64) (bool, error) {
+	return active().MarkOperationReady(id)
+}
+
+func (s *sqlStore) MarkOperationReady(id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.exec(
+		"UPDATE operations SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		StatusReady, id, StatusPending,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
 // SetOperationResult устанавливает только результат операции, не изменяя статус
 func SetOperationResult(id int64, result float64) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+	return active().SetOperationResult(id, result)
+}
 
-	_, err := DB.Exec(
+func (s *sqlStore) SetOperationResult(id int64, result float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.exec(
 		"UPDATE operations SET result = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
 		result, id,
 	)
 	return err
 }
 
+// SetOperationExactResult сохраняет точный результат операции в режиме rational или decimal
+func SetOperationExactResult(id int64, exact string) error {
+	return active().SetOperationExactResult(id, exact)
+}
+
+func (s *sqlStore) SetOperationExactResult(id int64, exact string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.exec(
+		"UPDATE operations SET result_exact = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		exact, id,
+	)
+	return err
+}
+
+// SetOperationIntervalResult сохраняет границы результата операции в режиме interval
+func SetOperationIntervalResult(id int64, lower, upper float64) error {
+	return active().SetOperationIntervalResult(id, lower, upper)
+}
+
+func (s *sqlStore) SetOperationIntervalResult(id int64, lower, upper float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.exec(
+		"UPDATE operations SET result_lower = ?, result_upper = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		lower, upper, id,
+	)
+	return err
+}
+
 // OperationInfo содержит основную информацию об операции
 type OperationInfo struct {
 	ID               int64
@@ -245,10 +433,14 @@ type OperationInfo struct {
 
 // SetOperationError устанавливает ошибку для операции и обновляет её статус
 func SetOperationError(operationID int64, errorMsg string) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+	return active().SetOperationError(operationID, errorMsg)
+}
+
+func (s *sqlStore) SetOperationError(operationID int64, errorMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	_, err := DB.Exec(
+	_, err := s.exec(
 		"UPDATE operations SET status = ?, error_message = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
 		StatusError, errorMsg, operationID,
 	)
@@ -257,11 +449,12 @@ func SetOperationError(operationID int64, errorMsg string) error {
 
 // GetOperationInfo получает основную информацию об операции
 func GetOperationInfo(id int64) (*OperationInfo, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+	return active().GetOperationInfo(id)
+}
 
+func (s *sqlStore) GetOperationInfo(id int64) (*OperationInfo, error) {
 	var info OperationInfo
-	err := DB.QueryRow(
+	err := s.queryRow(
 		"SELECT id, expression_id, is_root_expression, status FROM operations WHERE id = ?",
 		id,
 	).Scan(&info.ID, &info.ExpressionID, &info.IsRootExpression, &info.Status)
@@ -273,43 +466,41 @@ func GetOperationInfo(id int64) (*OperationInfo, error) {
 	return &info, nil
 }
 
-// CancelOperationsByExpressionID отменяет все операции по expressionID
+// CancelOperationsByExpressionID отменяет незавершенные операции по expressionID.
+// Вычисленные и завершенные с ошибкой операции сохраняют статус, чтобы по дереву операций
+// было видно, как шло вычисление
 func CancelOperationsByExpressionID(expressionID int64) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+	return active().CancelOperationsByExpressionID(expressionID)
+}
 
-	_, err := DB.Exec(
-		"UPDATE operations SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE expression_id = ?",
-		StatusCanceled, expressionID,
+func (s *sqlStore) CancelOperationsByExpressionID(expressionID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Аренда снимается, чтобы операция не вернулась в очередь после истечения срока
+	_, err := s.exec(
+		`UPDATE operations
+		 SET status = ?, lease_owner = NULL, lease_id = NULL, lease_expires_at = NULL,
+		 updated_at = CURRENT_TIMESTAMP
+		 WHERE expression_id = ? AND status IN (?, ?, ?)`,
+		StatusCanceled, expressionID, StatusPending, StatusReady, StatusProcessing,
 	)
 	return err
 }
 
-// GetReadyOperation получает одну операцию, которая готова к обработке
+// GetReadyOperation получает одну операцию, которая готова к обработке, не меняя её статус.
+// Для выдачи операции агенту используется ClaimReadyOperation
 func GetReadyOperation() (*Operation, error) {
-	// Используем write lock, т.к. сразу после получения операции мы обновим её статус
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-
-	var op Operation
-	var createdAtStr, updatedAtStr string
-	var parentOpID sql.NullInt64
-	var childPosition sql.NullString
-	var leftValue, rightValue, result sql.NullFloat64
-	var errorMessage sql.NullString
-	var isRoot bool
+	return active().GetReadyOperation()
+}
 
-	err := DB.QueryRow(
-		`SELECT id, expression_id, parent_operation_id, child_position, left_value, right_value,
-		operator, status, result, error_message, is_root_expression, created_at, updated_at
+func (s *sqlStore) GetReadyOperation() (*Operation, error) {
+	op, err := scanOperation(s.queryRow(
+		`SELECT `+operationColumns+`
 		FROM operations 
 		WHERE status = ? LIMIT 1`,
 		StatusReady,
-	).Scan(
-		&op.ID, &op.ExpressionID, &parentOpID, &childPosition, &leftValue, &rightValue,
-		&op.Operator, &op.Status, &result, &errorMessage, &isRoot, &createdAtStr, &updatedAtStr,
-	)
-
+	))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -317,64 +508,48 @@ func GetReadyOperation() (*Operation, error) {
 		return nil, err
 	}
 
-	if parentOpID.Valid {
-		val := parentOpID.Int64
-		op.ParentOpID = &val
-	}
-
-	if leftValue.Valid {
-		val := leftValue.Float64
-		op.LeftValue = &val
-	}
-
-	if rightValue.Valid {
-		val := rightValue.Float64
-		op.RightValue = &val
-	}
+	return op, nil
+}
 
-	if childPosition.Valid {
-		val := childPosition.String
-		op.ChildPosition = &val
-	}
+// UpdateOperation обновляет операцию в базе данных
+func UpdateOperation(op *Operation) error {
+	return active().UpdateOperation(op)
+}
 
-	if result.Valid {
-		val := result.Float64
-		op.Result = &val
+func (s *sqlStore) UpdateOperation(op *Operation) error {
+	arguments, err := encodeArguments(op.Args)
+	if err != nil {
+		return err
 	}
-
-	if errorMessage.Valid {
-		val := errorMessage.String
-		op.ErrorMessage = &val
+	argumentsExact, err := encodeArguments(op.ArgsExact)
+	if err != nil {
+		return err
 	}
-
-	op.IsRootExpression = isRoot
-
-	op.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	argumentsLower, err := encodeArguments(op.ArgsLower)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	op.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
+	argumentsUpper, err := encodeArguments(op.ArgsUpper)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &op, nil
-}
-
-// UpdateOperation обновляет операцию в базе данных
-func UpdateOperation(op *Operation) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	_, err := DB.Exec(
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.exec(
 		`UPDATE operations 
 		 SET parent_operation_id = ?, child_position = ?, left_value = ?, right_value = ?, 
-		 operator = ?, status = ?, result = ?, 
-		 error_message = ?, is_root_expression = ?
+		 operator = ?, arguments = ?, status = ?, result = ?, 
+		 error_message = ?, is_root_expression = ?,
+		 left_exact = ?, right_exact = ?, arguments_exact = ?, result_exact = ?,
+		 left_lower = ?, left_upper = ?, right_lower = ?, right_upper = ?,
+		 arguments_lower = ?, arguments_upper = ?, result_lower = ?, result_upper = ?
 		 WHERE id = ?`,
 		op.ParentOpID, op.ChildPosition, op.LeftValue, op.RightValue,
-		op.Operator, op.Status, op.Result, op.ErrorMessage,
-		op.IsRootExpression, op.ID,
+		op.Operator, arguments, op.Status, op.Result, op.ErrorMessage,
+		op.IsRootExpression, op.LeftExact, op.RightExact, argumentsExact, op.ResultExact,
+		op.LeftLower, op.LeftUpper, op.RightLower, op.RightUpper,
+		argumentsLower, argumentsUpper, op.ResultLower, op.ResultUpper, op.ID,
 	)
 
 	return err
@@ -382,10 +557,14 @@ func UpdateOperation(op *Operation) error {
 
 // UpdateOperationLeftValue устанавливает левый операнд операции
 func UpdateOperationLeftValue(operationID int64, value float64) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+	return active().UpdateOperationLeftValue(operationID, value)
+}
+
+func (s *sqlStore) UpdateOperationLeftValue(operationID int64, value float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	_, err := DB.Exec(
+	_, err := s.exec(
 		`UPDATE operations 
 		 SET left_value = ?, updated_at = CURRENT_TIMESTAMP 
 		 WHERE id = ?`,
@@ -396,10 +575,14 @@ func UpdateOperationLeftValue(operationID int64, value float64) error {
 
 // UpdateOperationRightValue устанавливает правый операнд операции
 func UpdateOperationRightValue(operationID int64, value float64) error {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+	return active().UpdateOperationRightValue(operationID, value)
+}
 
-	_, err := DB.Exec(
+func (s *sqlStore) UpdateOperationRightValue(operationID int64, value float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.exec(
 		`UPDATE operations 
 		 SET right_value = ?, updated_at = CURRENT_TIMESTAMP 
 		 WHERE id = ?`,
@@ -407,3 +590,162 @@ func UpdateOperationRightValue(operationID int64, value float64) error {
 	)
 	return err
 }
+
+// UpdateOperationArgument устанавливает аргумент index операции-функции
+func UpdateOperationArgument(operationID int64, index int, value float64) error {
+	return active().UpdateOperationArgument(operationID, index, value)
+}
+
+func (s *sqlStore) UpdateOperationArgument(operationID int64, index int, value float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return updateArgument(s, "arguments", operationID, index, value)
+}
+
+// SetOperationExactOperand сохраняет точное значение операнда в позиции position
+// ("left", "right" или "arg<N>") операции в режиме rational. Приближенное значение
+// записывается UpdateOperationLeftValue, UpdateOperationRightValue или UpdateOperationArgument
+func SetOperationExactOperand(operationID int64, position string, exact string) error {
+	return active().SetOperationExactOperand(operationID, position, exact)
+}
+
+func (s *sqlStore) SetOperationExactOperand(operationID int64, position string, exact string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var column string
+	switch position {
+	case "left":
+		column = "left_exact"
+	case "right":
+		column = "right_exact"
+	default:
+		index, ok := ArgumentIndex(position)
+		if !ok {
+			return fmt.Errorf("unknown operand position: %s", position)
+		}
+		return updateArgument(s, "arguments_exact", operationID, index, exact)
+	}
+
+	_, err := s.exec(
+		`UPDATE operations 
+		 SET `+column+` = ?, updated_at = CURRENT_TIMESTAMP 
+		 WHERE id = ?`,
+		exact, operationID,
+	)
+	return err
+}
+
+// SetOperationIntervalOperand сохраняет границы операнда в позиции position ("left", "right"
+// или "arg<N>") операции в режиме interval. Середина интервала записывается UpdateOperationLeftValue,
+// UpdateOperationRightValue или UpdateOperationArgument
+func SetOperationIntervalOperand(operationID int64, position string, lower, upper float64) error {
+	return active().SetOperationIntervalOperand(operationID, position, lower, upper)
+}
+
+func (s *sqlStore) SetOperationIntervalOperand(operationID int64, position string, lower, upper float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prefix string
+	switch position {
+	case "left", "right":
+		prefix = position
+	default:
+		index, ok := ArgumentIndex(position)
+		if !ok {
+			return fmt.Errorf("unknown operand position: %s", position)
+		}
+		if err := updateArgument(s, "arguments_lower", operationID, index, lower); err != nil {
+			return err
+		}
+		return updateArgument(s, "arguments_upper", operationID, index, upper)
+	}
+
+	_, err := s.exec(
+		`UPDATE operations 
+		 SET `+prefix+`_lower = ?, `+prefix+`_upper = ?, updated_at = CURRENT_TIMESTAMP 
+		 WHERE id = ?`,
+		lower, upper, operationID,
+	)
+	return err
+}
+
+// updateArgument записывает аргумент index в JSON-массив column (arguments, arguments_exact,
+// arguments_lower или arguments_upper)
+func updateArgument[T any](s *sqlStore, column string, operationID int64, index int, value T) error {
+	// Аргументы хранятся одним JSON-массивом. Массив записывается только если не изменился
+	// с момента чтения, иначе аргумент параллельно записал другой оркестратор и чтение повторяется
+	for {
+		var arguments sql.NullString
+		err := s.queryRow("SELECT "+column+" FROM operations WHERE id = ?", operationID).Scan(&arguments)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrOperationNotFound
+			}
+			return err
+		}
+
+		args, err := decodeArguments[T](arguments)
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= len(args) {
+			return fmt.Errorf("argument %d out of range for operation %d", index, operationID)
+		}
+		args[index] = &value
+
+		encoded, err := encodeArguments(args)
+		if err != nil {
+			return err
+		}
+
+		res, err := s.exec(
+			`UPDATE operations 
+			 SET `+column+` = ?, updated_at = CURRENT_TIMESTAMP 
+			 WHERE id = ? AND `+column+` = ?`,
+			encoded, operationID, arguments.String,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected > 0 {
+			return nil
+		}
+	}
+}
+
+// CountOperationsByStatus возвращает число операций в каждом статусе
+func CountOperationsByStatus() (map[string]int64, error) {
+	return active().CountOperationsByStatus()
+}
+
+func (s *sqlStore) CountOperationsByStatus() (map[string]int64, error) {
+	rows, err := s.query("SELECT status, COUNT(*) FROM operations GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -702,6 +702,322 @@ func TestUpdateOperationRightValue(t *testing.T) {
 }
 
 // Вспомогательные функции для создания указателей на базовые типы
+// TestCreateUnaryOperation проверяет создание унарной операции
+func TestCreateUnaryOperation(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "-(2+3)")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op, err := CreateUnaryOperation(expr.ID, nil, "-", nil, true, nil, StatusPending)
+	if err != nil {
+		t.Fatalf("CreateUnaryOperation() error = %v", err)
+	}
+
+	if op.OperandsReady() {
+		t.Errorf("OperandsReady() = true for unary operation without operand")
+	}
+
+	if err := UpdateOperationLeftValue(op.ID, 5.0); err != nil {
+		t.Fatalf("UpdateOperationLeftValue() error = %v", err)
+	}
+
+	savedOp, err := GetOperationByID(op.ID)
+	if err != nil {
+		t.Fatalf("GetOperationByID() error = %v", err)
+	}
+
+	if savedOp.Kind != KindUnary {
+		t.Errorf("Operation kind = %v, want %v", savedOp.Kind, KindUnary)
+	}
+
+	if !savedOp.OperandsReady() {
+		t.Errorf("OperandsReady() = false for unary operation with operand")
+	}
+}
+
+// TestCreateFunctionOperation проверяет хранение аргументов функции и их заполнение
+func TestCreateFunctionOperation(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "max(1, 2+3, 4)")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op, err := CreateFunctionOperation(expr.ID, nil, "max",
+		[]*float64{floatPtr(1), nil, floatPtr(4)}, true, nil, StatusPending)
+	if err != nil {
+		t.Fatalf("CreateFunctionOperation() error = %v", err)
+	}
+
+	if op.OperandsReady() {
+		t.Errorf("OperandsReady() = true for function with missing argument")
+	}
+
+	if err := UpdateOperationArgument(op.ID, 1, 5.0); err != nil {
+		t.Fatalf("UpdateOperationArgument() error = %v", err)
+	}
+
+	if err := UpdateOperationArgument(op.ID, 3, 5.0); err == nil {
+		t.Errorf("UpdateOperationArgument() expected error for argument out of range")
+	}
+
+	savedOp, err := GetOperationByID(op.ID)
+	if err != nil {
+		t.Fatalf("GetOperationByID() error = %v", err)
+	}
+
+	if savedOp.Kind != KindFunction || savedOp.Operator != "max" {
+		t.Errorf("Operation = %v %v, want %v max", savedOp.Kind, savedOp.Operator, KindFunction)
+	}
+
+	if !savedOp.OperandsReady() {
+		t.Errorf("OperandsReady() = false for function with all arguments")
+	}
+
+	want := []float64{1, 5, 4}
+	if len(savedOp.Args) != len(want) {
+		t.Fatalf("Operation args = %v, want %v", savedOp.Args, want)
+	}
+	for i, arg := range savedOp.Args {
+		if arg == nil || *arg != want[i] {
+			t.Errorf("Argument %d = %v, want %v", i, arg, want[i])
+		}
+	}
+
+	// Позиция аргумента функции проходит проверку схемы
+	child, err := CreateOperation(expr.ID, &op.ID, "+", floatPtr(2), floatPtr(3),
+		false, strPtr(ArgumentPosition(1)), StatusReady)
+	if err != nil {
+		t.Fatalf("CreateOperation() for function argument error = %v", err)
+	}
+	if index, ok := ArgumentIndex(*child.ChildPosition); !ok || index != 1 {
+		t.Errorf("ArgumentIndex(%q) = %v, %v, want 1, true", *child.ChildPosition, index, ok)
+	}
+}
+
+// TestOperationExactValues проверяет сохранение точных значений операции режима rational
+func TestOperationExactValues(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "min(1/3, 0.5)")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op := &Operation{
+		ExpressionID:     expr.ID,
+		Operator:         "min",
+		Kind:             KindFunction,
+		Mode:             ModeRational,
+		Args:             []*float64{nil, floatPtr(0.5)},
+		ArgsExact:        []*string{nil, strPtr("1/2")},
+		IsRootExpression: true,
+		Status:           StatusPending,
+	}
+	if err := active().CreateOperation(op); err != nil {
+		t.Fatalf("CreateOperation() error = %v", err)
+	}
+
+	if err := SetOperationExactOperand(op.ID, ArgumentPosition(0), "1/3"); err != nil {
+		t.Fatalf("SetOperationExactOperand() error = %v", err)
+	}
+	if err := SetOperationExactOperand(op.ID, "middle", "1/3"); err == nil {
+		t.Errorf("SetOperationExactOperand() expected error for unknown position")
+	}
+	if err := SetOperationExactResult(op.ID, "1/3"); err != nil {
+		t.Fatalf("SetOperationExactResult() error = %v", err)
+	}
+
+	savedOp, err := GetOperationByID(op.ID)
+	if err != nil {
+		t.Fatalf("GetOperationByID() error = %v", err)
+	}
+	if savedOp.Mode != ModeRational {
+		t.Errorf("Operation mode = %q, want %q", savedOp.Mode, ModeRational)
+	}
+	want := []string{"1/3", "1/2"}
+	if len(savedOp.ArgsExact) != len(want) {
+		t.Fatalf("Operation exact args = %v, want %v", savedOp.ArgsExact, want)
+	}
+	for i, arg := range savedOp.ArgsExact {
+		if arg == nil || *arg != want[i] {
+			t.Errorf("Exact argument %d = %v, want %v", i, arg, want[i])
+		}
+	}
+	if savedOp.ResultExact == nil || *savedOp.ResultExact != "1/3" {
+		t.Errorf("Operation exact result = %v, want 1/3", savedOp.ResultExact)
+	}
+
+	// Операция режима по умолчанию
+	floatOp, err := CreateOperation(expr.ID, nil, "+", floatPtr(1), floatPtr(2), false, nil, StatusReady)
+	if err != nil {
+		t.Fatalf("CreateOperation() error = %v", err)
+	}
+	if floatOp, err = GetOperationByID(floatOp.ID); err != nil || floatOp.Mode != ModeFloat || floatOp.LeftExact != nil {
+		t.Errorf("Default operation = %+v (err %v), want float mode without exact values", floatOp, err)
+	}
+}
+
+// TestOperationIntervalValues проверяет сохранение границ операндов и результата режима interval
+func TestOperationIntervalValues(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "max([1, 2] * 3, [0, 1])")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	op := &Operation{
+		ExpressionID:     expr.ID,
+		Operator:         "max",
+		Kind:             KindFunction,
+		Mode:             ModeInterval,
+		Args:             []*float64{nil, floatPtr(0.5)},
+		ArgsLower:        []*float64{nil, floatPtr(0)},
+		ArgsUpper:        []*float64{nil, floatPtr(1)},
+		IsRootExpression: true,
+		Status:           StatusPending,
+	}
+	if err := active().CreateOperation(op); err != nil {
+		t.Fatalf("CreateOperation() error = %v", err)
+	}
+
+	child := &Operation{
+		ExpressionID:  expr.ID,
+		ParentOpID:    &op.ID,
+		ChildPosition: strPtr(ArgumentPosition(0)),
+		Operator:      "*",
+		Kind:          KindBinary,
+		Mode:          ModeInterval,
+		LeftValue:     floatPtr(1.5),
+		RightValue:    floatPtr(3),
+		LeftLower:     floatPtr(1),
+		LeftUpper:     floatPtr(2),
+		RightLower:    floatPtr(3),
+		RightUpper:    floatPtr(3),
+		Status:        StatusReady,
+	}
+	if err := active().CreateOperation(child); err != nil {
+		t.Fatalf("CreateOperation() error = %v", err)
+	}
+	savedChild, err := GetOperationByID(child.ID)
+	if err != nil {
+		t.Fatalf("GetOperationByID() error = %v", err)
+	}
+	if savedChild.LeftLower == nil || *savedChild.LeftLower != 1 || savedChild.RightUpper == nil || *savedChild.RightUpper != 3 {
+		t.Errorf("Operand bounds = %v..%v, %v..%v, want 1..2, 3..3",
+			savedChild.LeftLower, savedChild.LeftUpper, savedChild.RightLower, savedChild.RightUpper)
+	}
+
+	if err := SetOperationIntervalOperand(op.ID, ArgumentPosition(0), 3, 6); err != nil {
+		t.Fatalf("SetOperationIntervalOperand() error = %v", err)
+	}
+	if err := SetOperationIntervalOperand(op.ID, "middle", 3, 6); err == nil {
+		t.Errorf("SetOperationIntervalOperand() expected error for unknown position")
+	}
+	if err := SetOperationIntervalResult(op.ID, 3, 6); err != nil {
+		t.Fatalf("SetOperationIntervalResult() error = %v", err)
+	}
+	if err := SetExpressionIntervalResult(expr.ID, 3, 6); err != nil {
+		t.Fatalf("SetExpressionIntervalResult() error = %v", err)
+	}
+
+	savedOp, err := GetOperationByID(op.ID)
+	if err != nil {
+		t.Fatalf("GetOperationByID() error = %v", err)
+	}
+	wantLower, wantUpper := []float64{3, 0}, []float64{6, 1}
+	if len(savedOp.ArgsLower) != 2 || len(savedOp.ArgsUpper) != 2 {
+		t.Fatalf("Argument bounds = %v, %v, want two arguments", savedOp.ArgsLower, savedOp.ArgsUpper)
+	}
+	for i := range wantLower {
+		if savedOp.ArgsLower[i] == nil || *savedOp.ArgsLower[i] != wantLower[i] ||
+			savedOp.ArgsUpper[i] == nil || *savedOp.ArgsUpper[i] != wantUpper[i] {
+			t.Errorf("Argument %d bounds = %v..%v, want %v..%v",
+				i, savedOp.ArgsLower[i], savedOp.ArgsUpper[i], wantLower[i], wantUpper[i])
+		}
+	}
+	if savedOp.ResultLower == nil || *savedOp.ResultLower != 3 || savedOp.ResultUpper == nil || *savedOp.ResultUpper != 6 {
+		t.Errorf("Result bounds = %v..%v, want 3..6", savedOp.ResultLower, savedOp.ResultUpper)
+	}
+
+	savedExpr, err := GetExpressionByID(expr.ID)
+	if err != nil {
+		t.Fatalf("GetExpressionByID() error = %v", err)
+	}
+	if savedExpr.ResultLower == nil || *savedExpr.ResultLower != 3 || savedExpr.ResultUpper == nil || *savedExpr.ResultUpper != 6 {
+		t.Errorf("Expression result bounds = %v..%v, want 3..6", savedExpr.ResultLower, savedExpr.ResultUpper)
+	}
+}
+
+// TestCountOperationsByStatus проверяет подсчет операций по статусам
+func TestCountOperationsByStatus(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpression(user.ID, "(1+2)*(3+4)")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	for _, status := range []string{StatusPending, StatusReady, StatusReady} {
+		if _, err := CreateOperation(expr.ID, nil, "+", floatPtr(1), floatPtr(2), false, nil, status); err != nil {
+			t.Fatalf("CreateOperation() error = %v", err)
+		}
+	}
+
+	counts, err := CountOperationsByStatus()
+	if err != nil {
+		t.Fatalf("CountOperationsByStatus() error = %v", err)
+	}
+	if len(counts) != 2 || counts[StatusPending] != 1 || counts[StatusReady] != 2 {
+		t.Errorf("CountOperationsByStatus() = %v, want pending: 1, ready: 2", counts)
+	}
+
+	// Запись в SQLite учитывается в метрике ожидания блокировки
+	if dbLockWait.Count() == 0 {
+		t.Error("Expected DB lock wait to be observed")
+	}
+}
+
 func intPtr(i int64) *int64 {
 	return &i
 }
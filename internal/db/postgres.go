@@ -0,0 +1,58 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresStore хранит данные в PostgreSQL. Глобальная блокировка не используется:
+// согласованность обеспечивают транзакции и условные UPDATE, поэтому с одной базой
+// могут одновременно работать несколько оркестраторов
+type PostgresStore struct {
+	*sqlStore
+}
+
+// NewPostgresStore создает хранилище поверх открытого соединения PostgreSQL
+func NewPostgresStore(conn *sql.DB) *PostgresStore {
+	return &PostgresStore{&sqlStore{
+		conn:       conn,
+		q:          conn,
+		mu:         noLock{},
+		rebind:     numberPlaceholders,
+		skipLocked: " FOR UPDATE SKIP LOCKED",
+		driver:     DriverPostgres,
+	}}
+}
+
+// Cleanup очищает все таблицы и сбрасывает последовательности идентификаторов
+func (s *PostgresStore) Cleanup() error {
+	_, err := s.conn.Exec("TRUNCATE webhook_deliveries, operations, variables, expressions, batches, users, agents RESTART IDENTITY CASCADE")
+	if err != nil {
+		return fmt.Errorf("failed to clean up tables: %w", err)
+	}
+	return nil
+}
+
+// numberPlaceholders заменяет плейсхолдеры "?" на нумерованные "$1", "$2", ...
+func numberPlaceholders(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var _ Store = (*PostgresStore)(nil)
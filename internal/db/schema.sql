@@ -1,22 +1,59 @@
+-- Изменяя схему, увеличьте SchemaVersion и добавьте шаг обновления существующих баз в migrations.go
+
 -- Таблица пользователей
 CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     login TEXT UNIQUE NOT NULL,
     password_hash TEXT NOT NULL,
+    webhook_secret TEXT DEFAULT NULL, -- ключ подписи webhook, создается при первом обращении
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Таблица пакетов выражений
+CREATE TABLE IF NOT EXISTS batches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 -- Таблица выражений
 CREATE TABLE IF NOT EXISTS expressions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
+    batch_id INTEGER DEFAULT NULL,
     original_expression TEXT NOT NULL,
     status TEXT NOT NULL DEFAULT 'pending',
     result NUMERIC DEFAULT NULL,
+    mode TEXT NOT NULL DEFAULT 'float', -- числовой режим: float, rational, decimal или interval
+    decimal_precision INTEGER DEFAULT NULL, -- знаков после запятой результата в режиме decimal
+    decimal_rounding TEXT DEFAULT NULL, -- способ округления в режиме decimal: half_even, half_up или down
+    exact_result TEXT DEFAULT NULL, -- точный результат: "p/q" в режиме rational, десятичная запись в режиме decimal
+    result_lower NUMERIC DEFAULT NULL, -- границы результата в режиме interval
+    result_upper NUMERIC DEFAULT NULL,
     error_message TEXT DEFAULT NULL,
+    callback_url TEXT DEFAULT NULL,
+    request_id TEXT DEFAULT NULL,
+    traceparent TEXT DEFAULT NULL,
+    error_operation_id INTEGER DEFAULT NULL, -- операция, ошибка которой завершила выражение
+    error_start INTEGER DEFAULT NULL, -- границы подвыражения этой операции в исходном выражении (байты)
+    error_end INTEGER DEFAULT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (batch_id) REFERENCES batches(id) ON DELETE CASCADE
+);
+
+-- Таблица переменных пользователей
+CREATE TABLE IF NOT EXISTS variables (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    value NUMERIC NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (user_id, name)
 );
 
 -- Таблица операций
@@ -28,14 +65,67 @@ CREATE TABLE IF NOT EXISTS operations (
     left_value NUMERIC,
     right_value NUMERIC,
     operator TEXT,
+    operator_kind TEXT NOT NULL DEFAULT 'binary',
+    mode TEXT NOT NULL DEFAULT 'float',
+    decimal_precision INTEGER DEFAULT NULL,
+    decimal_rounding TEXT DEFAULT NULL,
+    arguments TEXT DEFAULT NULL, -- JSON-массив аргументов функции, null для еще не вычисленных
     status TEXT DEFAULT 'pending',
     result NUMERIC DEFAULT NULL,
+    left_exact TEXT DEFAULT NULL, -- точные значения операндов и результата в режимах rational и decimal
+    right_exact TEXT DEFAULT NULL,
+    arguments_exact TEXT DEFAULT NULL, -- JSON-массив точных аргументов функции
+    result_exact TEXT DEFAULT NULL,
+    left_lower NUMERIC DEFAULT NULL, -- границы операндов и результата в режиме interval
+    left_upper NUMERIC DEFAULT NULL,
+    right_lower NUMERIC DEFAULT NULL,
+    right_upper NUMERIC DEFAULT NULL,
+    arguments_lower TEXT DEFAULT NULL, -- JSON-массивы границ аргументов функции
+    arguments_upper TEXT DEFAULT NULL,
+    result_lower NUMERIC DEFAULT NULL,
+    result_upper NUMERIC DEFAULT NULL,
     error_message TEXT DEFAULT NULL,
     is_root_expression BOOLEAN NOT NULL DEFAULT 0,
+    source_start INTEGER DEFAULT NULL, -- границы подвыражения операции в исходном выражении (байты)
+    source_end INTEGER DEFAULT NULL,
+    lease_owner TEXT DEFAULT NULL,
+    lease_id TEXT DEFAULT NULL,
+    lease_expires_at INTEGER DEFAULT NULL, -- окончание аренды в миллисекундах Unix
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (expression_id) REFERENCES expressions(id) ON DELETE CASCADE,
     FOREIGN KEY (parent_operation_id) REFERENCES operations(id) ON DELETE CASCADE,
     CHECK (status IN ('pending', 'ready', 'processing', 'completed', 'error', 'canceled')),
-    CHECK (child_position IN ('left', 'right', NULL))
-);
\ No newline at end of file
+    CHECK (child_position IN ('left', 'right') OR child_position LIKE 'arg%'),
+    CHECK (operator_kind IN ('binary', 'unary', 'function'))
+);
+
+-- Таблица агентов
+CREATE TABLE IF NOT EXISTS agents (
+    id TEXT PRIMARY KEY, -- AGENT_ID агента
+    hostname TEXT NOT NULL DEFAULT '',
+    computing_power INTEGER NOT NULL DEFAULT 0,
+    version TEXT NOT NULL DEFAULT '',
+    last_seen_at INTEGER NOT NULL, -- время последнего обращения в миллисекундах Unix
+    tasks_completed INTEGER NOT NULL DEFAULT 0,
+    tasks_failed INTEGER NOT NULL DEFAULT 0,
+    registered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица доставок webhook о завершении выражений
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    expression_id INTEGER NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER DEFAULT NULL,
+    last_error TEXT DEFAULT NULL,
+    next_attempt_at INTEGER NOT NULL, -- время следующей попытки в миллисекундах Unix
+    delivered_at INTEGER DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (expression_id) REFERENCES expressions(id) ON DELETE CASCADE,
+    CHECK (status IN ('pending', 'delivered', 'failed'))
+);
@@ -0,0 +1,131 @@
+-- Схема для PostgreSQL, соответствует schema.sql
+-- Изменяя схему, увеличьте SchemaVersion и добавьте шаг обновления существующих баз в migrations.go
+
+-- Таблица пользователей
+CREATE TABLE IF NOT EXISTS users (
+    id BIGSERIAL PRIMARY KEY,
+    login TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    webhook_secret TEXT DEFAULT NULL, -- ключ подписи webhook, создается при первом обращении
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица пакетов выражений
+CREATE TABLE IF NOT EXISTS batches (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица выражений
+CREATE TABLE IF NOT EXISTS expressions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    batch_id BIGINT DEFAULT NULL REFERENCES batches(id) ON DELETE CASCADE,
+    original_expression TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    result DOUBLE PRECISION DEFAULT NULL,
+    mode TEXT NOT NULL DEFAULT 'float', -- числовой режим: float, rational, decimal или interval
+    decimal_precision INTEGER DEFAULT NULL, -- знаков после запятой результата в режиме decimal
+    decimal_rounding TEXT DEFAULT NULL, -- способ округления в режиме decimal: half_even, half_up или down
+    exact_result TEXT DEFAULT NULL, -- точный результат: "p/q" в режиме rational, десятичная запись в режиме decimal
+    result_lower DOUBLE PRECISION DEFAULT NULL, -- границы результата в режиме interval
+    result_upper DOUBLE PRECISION DEFAULT NULL,
+    error_message TEXT DEFAULT NULL,
+    callback_url TEXT DEFAULT NULL,
+    request_id TEXT DEFAULT NULL,
+    traceparent TEXT DEFAULT NULL,
+    error_operation_id BIGINT DEFAULT NULL, -- операция, ошибка которой завершила выражение
+    error_start INTEGER DEFAULT NULL, -- границы подвыражения этой операции в исходном выражении (байты)
+    error_end INTEGER DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица переменных пользователей
+CREATE TABLE IF NOT EXISTS variables (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- Таблица операций
+CREATE TABLE IF NOT EXISTS operations (
+    id BIGSERIAL PRIMARY KEY,
+    expression_id BIGINT NOT NULL REFERENCES expressions(id) ON DELETE CASCADE,
+    parent_operation_id BIGINT REFERENCES operations(id) ON DELETE CASCADE,
+    child_position TEXT,
+    left_value DOUBLE PRECISION,
+    right_value DOUBLE PRECISION,
+    operator TEXT,
+    operator_kind TEXT NOT NULL DEFAULT 'binary',
+    mode TEXT NOT NULL DEFAULT 'float',
+    decimal_precision INTEGER DEFAULT NULL,
+    decimal_rounding TEXT DEFAULT NULL,
+    arguments TEXT DEFAULT NULL, -- JSON-массив аргументов функции, null для еще не вычисленных
+    status TEXT DEFAULT 'pending',
+    result DOUBLE PRECISION DEFAULT NULL,
+    left_exact TEXT DEFAULT NULL, -- точные значения операндов и результата в режимах rational и decimal
+    right_exact TEXT DEFAULT NULL,
+    arguments_exact TEXT DEFAULT NULL, -- JSON-массив точных аргументов функции
+    result_exact TEXT DEFAULT NULL,
+    left_lower DOUBLE PRECISION DEFAULT NULL, -- границы операндов и результата в режиме interval
+    left_upper DOUBLE PRECISION DEFAULT NULL,
+    right_lower DOUBLE PRECISION DEFAULT NULL,
+    right_upper DOUBLE PRECISION DEFAULT NULL,
+    arguments_lower TEXT DEFAULT NULL, -- JSON-массивы границ аргументов функции
+    arguments_upper TEXT DEFAULT NULL,
+    result_lower DOUBLE PRECISION DEFAULT NULL,
+    result_upper DOUBLE PRECISION DEFAULT NULL,
+    error_message TEXT DEFAULT NULL,
+    is_root_expression BOOLEAN NOT NULL DEFAULT FALSE,
+    source_start INTEGER DEFAULT NULL, -- границы подвыражения операции в исходном выражении (байты)
+    source_end INTEGER DEFAULT NULL,
+    lease_owner TEXT DEFAULT NULL,
+    lease_id TEXT DEFAULT NULL,
+    lease_expires_at BIGINT DEFAULT NULL, -- окончание аренды в миллисекундах Unix
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (status IN ('pending', 'ready', 'processing', 'completed', 'error', 'canceled')),
+    CHECK (child_position IN ('left', 'right') OR child_position LIKE 'arg%'),
+    CHECK (operator_kind IN ('binary', 'unary', 'function'))
+);
+
+-- Таблица агентов
+CREATE TABLE IF NOT EXISTS agents (
+    id TEXT PRIMARY KEY, -- AGENT_ID агента
+    hostname TEXT NOT NULL DEFAULT '',
+    computing_power INTEGER NOT NULL DEFAULT 0,
+    version TEXT NOT NULL DEFAULT '',
+    last_seen_at BIGINT NOT NULL, -- время последнего обращения в миллисекундах Unix
+    tasks_completed BIGINT NOT NULL DEFAULT 0,
+    tasks_failed BIGINT NOT NULL DEFAULT 0,
+    registered_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица доставок webhook о завершении выражений
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    expression_id BIGINT NOT NULL UNIQUE REFERENCES expressions(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER DEFAULT NULL,
+    last_error TEXT DEFAULT NULL,
+    next_attempt_at BIGINT NOT NULL, -- время следующей попытки в миллисекундах Unix
+    delivered_at BIGINT DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_expressions_user_id ON expressions(user_id);
+CREATE INDEX IF NOT EXISTS idx_expressions_batch_id ON expressions(batch_id);
+CREATE INDEX IF NOT EXISTS idx_operations_expression_id ON operations(expression_id);
+CREATE INDEX IF NOT EXISTS idx_operations_status ON operations(status);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt ON webhook_deliveries(status, next_attempt_at);
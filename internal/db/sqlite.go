@@ -0,0 +1,52 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore хранит данные в SQLite. Все запросы выполняются под DbMutex,
+// поскольку SQLite не допускает параллельной записи
+type SQLiteStore struct {
+	*sqlStore
+}
+
+// NewSQLiteStore создает хранилище поверх открытого соединения SQLite
+func NewSQLiteStore(conn *sql.DB) *SQLiteStore {
+	return &SQLiteStore{&sqlStore{
+		conn:   conn,
+		q:      conn,
+		mu:     timedLock{&DbMutex},
+		rebind: func(query string) string { return query },
+		driver: DriverSQLite,
+	}}
+}
+
+// Cleanup очищает все таблицы и сбрасывает автоинкрементные счетчики
+func (s *SQLiteStore) Cleanup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tables := []string{"webhook_deliveries", "operations", "variables", "expressions", "batches", "users", "agents"}
+
+	for _, table := range tables {
+		_, err := s.conn.Exec("DELETE FROM " + table)
+		if err != nil {
+			return fmt.Errorf("failed to clean up table %s: %w", table, err)
+		}
+	}
+
+	// Сбрасываем автоинкрементные счетчики
+	for _, table := range tables {
+		_, err := s.conn.Exec("DELETE FROM sqlite_sequence WHERE name=?", table)
+		if err != nil {
+			return fmt.Errorf("failed to reset auto-increment for table %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+var _ Store = (*SQLiteStore)(nil)
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// UserStore хранит пользователей
+type UserStore interface {
+	CreateUser(login, passwordHash string) (*User, error)
+	GetUserByID(id int64) (*User, error)
+	GetUserByLogin(login string) (*User, error)
+}
+
+// ExpressionStore хранит выражения
+type ExpressionStore interface {
+	CreateExpression(expr *Expression) error
+	GetExpressionByID(id int64) (*Expression, error)
+	UpdateExpressionStatus(id int64, status string) error
+	SetExpressionResult(id int64, result float64) error
+	CompleteExpression(id int64, result float64) (bool, error)
+	SetExpressionExactResult(id int64, exact string) error
+	SetExpressionIntervalResult(id int64, lower, upper float64) error
+	SetExpressionError(id int64, errorMessage string) error
+	SetExpressionOperationError(op *Operation, errorMessage string) error
+	GetUserExpressions(userID int64) ([]*Expression, error)
+	CancelExpression(id int64) error
+
+	CreateBatch(userID int64) (*Batch, error)
+	GetBatchByID(id int64) (*Batch, error)
+	GetBatchExpressions(batchID int64) ([]*Expression, error)
+}
+
+// VariableStore хранит переменные пользователей
+type VariableStore interface {
+	SetVariable(userID int64, name string, value float64) (*Variable, error)
+	GetVariable(userID int64, name string) (*Variable, error)
+	GetUserVariables(userID int64) ([]*Variable, error)
+	DeleteVariable(userID int64, name string) error
+}
+
+// WebhookStore хранит ключи подписи и доставки webhook
+type WebhookStore interface {
+	EnsureWebhookSecret(userID int64, secret string) (string, error)
+	SetWebhookSecret(userID int64, secret string) error
+	CreateWebhookDelivery(delivery *WebhookDelivery) (bool, error)
+	ClaimWebhookDelivery(now, until time.Time) (*WebhookDelivery, error)
+	UpdateWebhookDelivery(delivery *WebhookDelivery) error
+	GetExpressionWebhookDeliveries(expressionID int64) ([]*WebhookDelivery, error)
+}
+
+// AgentStore хранит зарегистрированных агентов
+type AgentStore interface {
+	RegisterAgent(agent *Agent) error
+	TouchAgent(agentID string, now time.Time) (bool, error)
+	RecordAgentTask(agentID string, failed bool, now time.Time) error
+	GetAgents() ([]*Agent, error)
+	GetActiveLeases() ([]*Lease, error)
+}
+
+// OperationStore хранит операции выражений и их аренды агентами
+type OperationStore interface {
+	CreateOperation(op *Operation) error
+	GetOperationByID(id int64) (*Operation, error)
+	GetOperationsByExpressionID(expressionID int64) ([]*Operation, error)
+	UpdateOperationStatus(id int64, status string) error
+	MarkOperationReady(id int64) (bool, error)
+	SetOperationResult(id int64, result float64) error
+	SetOperationExactResult(id int64, exact string) error
+	SetOperationIntervalResult(id int64, lower, upper float64) error
+	SetOperationError(operationID int64, errorMsg string) error
+	GetOperationInfo(id int64) (*OperationInfo, error)
+	CancelOperationsByExpressionID(expressionID int64) error
+	GetReadyOperation() (*Operation, error)
+	UpdateOperation(op *Operation) error
+	UpdateOperationLeftValue(operationID int64, value float64) error
+	UpdateOperationRightValue(operationID int64, value float64) error
+	UpdateOperationArgument(operationID int64, index int, value float64) error
+	SetOperationExactOperand(operationID int64, position string, exact string) error
+	SetOperationIntervalOperand(operationID int64, position string, lower, upper float64) error
+
+	ClaimReadyOperation(owner, leaseID string, leaseUntil func(op *Operation) time.Time) (*Operation, error)
+	LeaseOperation(operationID int64, owner, leaseID string, expiresAt time.Time) error
+	GetOperationLease(operationID int64) (*Lease, error)
+	ReleaseLease(operationID int64, leaseID string) error
+	RequeueExpiredLeases(now time.Time) (int64, error)
+	RequeueLeasedOperation(operationID int64, leaseID string) error
+	CountOperationsByStatus() (map[string]int64, error)
+}
+
+// TxStore — операции хранилища, выполняемые внутри транзакции InTx
+type TxStore interface {
+	UserStore
+	ExpressionStore
+	VariableStore
+	OperationStore
+	WebhookStore
+	AgentStore
+}
+
+// Store — хранилище данных калькулятора. Реализации: SQLiteStore и PostgresStore
+type Store interface {
+	TxStore
+
+	// InTx выполняет fn в одной транзакции: при ошибке fn все изменения откатываются.
+	// Внутри fn хранилище используется только через tx
+	InTx(fn func(tx TxStore) error) error
+
+	// Conn возвращает соединение с базой данных
+	Conn() *sql.DB
+	// ApplySchema создает схему хранилища или обновляет схему существующей базы до SchemaVersion
+	ApplySchema(schema string) error
+	// Cleanup очищает все таблицы (используется для тестирования)
+	Cleanup() error
+	Close() error
+}
+
+// Хранилище, выбранное в InitDB или SetStore
+var current Store
+
+// SetStore делает store текущим хранилищем для функций пакета.
+// nil возвращает хранилище SQLite поверх глобального соединения DB
+func SetStore(store Store) {
+	current = store
+	if store != nil {
+		DB = store.Conn()
+	}
+}
+
+// InTx выполняет fn в одной транзакции текущего хранилища
+func InTx(fn func(tx TxStore) error) error {
+	return active().InTx(fn)
+}
+
+// active возвращает текущее хранилище. Если хранилище не выбрано,
+// используется SQLite поверх DB (так база инициализируется в тестах)
+func active() Store {
+	if current != nil {
+		return current
+	}
+	return NewSQLiteStore(DB)
+}
+
+// querier — общий интерфейс *sql.DB и *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// sqlStore содержит общую для SQL-хранилищ реализацию.
+// Запросы пишутся с плейсхолдерами "?" и приводятся к синтаксису СУБД через rebind.
+// mu сериализует только запись: чтение выполняется без блокировки
+type sqlStore struct {
+	conn       *sql.DB
+	q          querier // conn или транзакция InTx
+	mu         sync.Locker
+	rebind     func(query string) string
+	skipLocked string // окончание подзапроса выбора операции, пропускающее строки, заблокированные другими транзакциями
+	driver     string // DriverSQLite или DriverPostgres
+}
+
+func (s *sqlStore) Conn() *sql.DB {
+	return s.conn
+}
+
+func (s *sqlStore) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+func (s *sqlStore) exec(query string, args ...any) (sql.Result, error) {
+	return s.q.Exec(s.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(query string, args ...any) *sql.Row {
+	return s.q.QueryRow(s.rebind(query), args...)
+}
+
+func (s *sqlStore) query(query string, args ...any) (*sql.Rows, error) {
+	return s.q.Query(s.rebind(query), args...)
+}
+
+// InTx выполняет fn в транзакции. Блокировка записи удерживается до конца транзакции,
+// поэтому хранилище tx ее не использует
+func (s *sqlStore) InTx(fn func(tx TxStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txStore := &sqlStore{
+		conn:       s.conn,
+		q:          tx,
+		mu:         noLock{},
+		rebind:     s.rebind,
+		skipLocked: s.skipLocked,
+		driver:     s.driver,
+	}
+	if err := fn(txStore); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insert выполняет INSERT ... RETURNING id и возвращает идентификатор новой записи
+func (s *sqlStore) insert(query string, args ...any) (int64, error) {
+	var id int64
+	err := s.queryRow(query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// noLock используется хранилищами, которые сами обеспечивают согласованность параллельных запросов
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// rowScanner — общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSQLiteStore прогоняет общий набор тестов хранилища на SQLite
+func TestSQLiteStore(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "calculator.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	runStoreSuite(t, NewSQLiteStore(conn), "schema.sql")
+}
+
+// runStoreSuite проверяет основные сценарии работы с хранилищем store.
+// Один и тот же набор выполняется для каждого поддерживаемого драйвера
+func runStoreSuite(t *testing.T, store Store, schemaFile string) {
+	previousDB := DB
+	SetStore(store)
+	defer func() {
+		CloseDB()
+		SetStore(nil)
+		DB = previousDB
+	}()
+
+	if err := ApplySchema(filepath.Join("../../internal/db", schemaFile)); err != nil {
+		t.Fatalf("ApplySchema() error = %v", err)
+	}
+	if err := CleanupDB(); err != nil {
+		t.Fatalf("CleanupDB() error = %v", err)
+	}
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	t.Run("Users", func(t *testing.T) {
+		if _, err := CreateUser("testuser", "testpass"); err != ErrUserAlreadyExists {
+			t.Errorf("CreateUser() duplicate error = %v, want %v", err, ErrUserAlreadyExists)
+		}
+		if _, err := AuthenticateUser("testuser", "testpass"); err != nil {
+			t.Errorf("AuthenticateUser() error = %v", err)
+		}
+	})
+
+	t.Run("Operations", func(t *testing.T) {
+		expr, err := CreateExpression(user.ID, "(2+3)*4")
+		if err != nil {
+			t.Fatalf("CreateExpression() error = %v", err)
+		}
+
+		root, err := CreateOperation(expr.ID, nil, "*", nil, floatPtr(4.0), true, nil, StatusPending)
+		if err != nil {
+			t.Fatalf("CreateOperation() error = %v", err)
+		}
+		child, err := CreateOperation(expr.ID, &root.ID, "+", floatPtr(2.0), floatPtr(3.0), false, strPtr("left"), StatusReady)
+		if err != nil {
+			t.Fatalf("CreateOperation() error = %v", err)
+		}
+
+		ready, err := GetReadyOperation()
+		if err != nil || ready == nil || ready.ID != child.ID {
+			t.Fatalf("GetReadyOperation() = %+v, %v, want operation %d", ready, err, child.ID)
+		}
+
+		if err := LeaseOperation(child.ID, "agent-1", "lease-1", time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("LeaseOperation() error = %v", err)
+		}
+		if err := ReleaseLease(child.ID, "lease-1"); err != nil {
+			t.Fatalf("ReleaseLease() error = %v", err)
+		}
+		if err := SetOperationResult(child.ID, 5); err != nil {
+			t.Fatalf("SetOperationResult() error = %v", err)
+		}
+		if err := UpdateOperationLeftValue(root.ID, 5); err != nil {
+			t.Fatalf("UpdateOperationLeftValue() error = %v", err)
+		}
+
+		operations, err := GetOperationsByExpressionID(expr.ID)
+		if err != nil {
+			t.Fatalf("GetOperationsByExpressionID() error = %v", err)
+		}
+		if len(operations) != 2 {
+			t.Fatalf("GetOperationsByExpressionID() returned %d operations, want 2", len(operations))
+		}
+
+		updatedRoot, err := GetOperationByID(root.ID)
+		if err != nil {
+			t.Fatalf("GetOperationByID() error = %v", err)
+		}
+		if !updatedRoot.OperandsReady() || !updatedRoot.IsRootExpression {
+			t.Errorf("Root operation = %+v, want root with both operands", updatedRoot)
+		}
+
+		if err := CancelExpression(expr.ID); err != nil {
+			t.Fatalf("CancelExpression() error = %v", err)
+		}
+		// Отмененное выражение не завершается результатом
+		if completed, err := CompleteExpression(expr.ID, 20); err != nil || completed {
+			t.Errorf("CompleteExpression() on canceled = %v, %v, want false", completed, err)
+		}
+
+		expressions, err := GetUserExpressions(user.ID)
+		if err != nil {
+			t.Fatalf("GetUserExpressions() error = %v", err)
+		}
+		if len(expressions) != 1 || expressions[0].Status != StatusCanceled {
+			t.Errorf("GetUserExpressions() = %+v, want one canceled expression", expressions)
+		}
+	})
+
+	t.Run("Leases", func(t *testing.T) {
+		expr, err := CreateExpression(user.ID, "1+1")
+		if err != nil {
+			t.Fatalf("CreateExpression() error = %v", err)
+		}
+		op, err := CreateOperation(expr.ID, nil, "+", floatPtr(1.0), floatPtr(1.0), true, nil, StatusReady)
+		if err != nil {
+			t.Fatalf("CreateOperation() error = %v", err)
+		}
+
+		if err := LeaseOperation(op.ID, "agent-1", "lease-expired", time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("LeaseOperation() error = %v", err)
+		}
+		if err := LeaseOperation(op.ID, "agent-2", "lease-other", time.Now().Add(time.Minute)); err != ErrLeaseNotHeld {
+			t.Errorf("LeaseOperation() on leased operation error = %v, want %v", err, ErrLeaseNotHeld)
+		}
+		if requeued, err := RequeueExpiredLeases(time.Now()); err != nil || requeued != 1 {
+			t.Errorf("RequeueExpiredLeases() = %d, %v, want 1", requeued, err)
+		}
+		if err := ReleaseLease(op.ID, "lease-expired"); err != ErrLeaseNotHeld {
+			t.Errorf("ReleaseLease() with expired lease error = %v, want %v", err, ErrLeaseNotHeld)
+		}
+
+		if completed, err := CompleteExpression(expr.ID, 2); err != nil || !completed {
+			t.Fatalf("CompleteExpression() = %v, %v, want true", completed, err)
+		}
+		saved, err := GetExpressionByID(expr.ID)
+		if err != nil {
+			t.Fatalf("GetExpressionByID() error = %v", err)
+		}
+		if saved.Status != StatusCompleted || saved.Result == nil || *saved.Result != 2 {
+			t.Errorf("Completed expression = %+v, want completed with result 2", saved)
+		}
+	})
+
+	t.Run("Variables", func(t *testing.T) {
+		if _, err := SetVariable(user.ID, "x", 1); err != nil {
+			t.Fatalf("SetVariable() error = %v", err)
+		}
+		// Повторная запись заменяет значение
+		if _, err := SetVariable(user.ID, "x", 2); err != nil {
+			t.Fatalf("SetVariable() update error = %v", err)
+		}
+		variable, err := GetVariable(user.ID, "x")
+		if err != nil || variable.Value != 2 {
+			t.Errorf("GetVariable() = %+v, %v, want value 2", variable, err)
+		}
+		if err := DeleteVariable(user.ID, "x"); err != nil {
+			t.Fatalf("DeleteVariable() error = %v", err)
+		}
+		if _, err := GetVariable(user.ID, "x"); err != ErrVariableNotFound {
+			t.Errorf("GetVariable() after delete error = %v, want %v", err, ErrVariableNotFound)
+		}
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		expr, err := CreateExpressionWithCallback(user.ID, "2+2", "http://localhost/hook")
+		if err != nil {
+			t.Fatalf("CreateExpressionWithCallback() error = %v", err)
+		}
+
+		delivery := &WebhookDelivery{ExpressionID: expr.ID, URL: "http://localhost/hook", Payload: []byte(`{}`), NextAttemptAt: time.Now()}
+		if created, err := CreateWebhookDelivery(delivery); err != nil || !created {
+			t.Fatalf("CreateWebhookDelivery() = %v, %v, want true", created, err)
+		}
+		// Для выражения создается не более одной доставки
+		if created, err := CreateWebhookDelivery(&WebhookDelivery{ExpressionID: expr.ID, URL: "http://localhost/hook", Payload: []byte(`{}`)}); err != nil || created {
+			t.Errorf("CreateWebhookDelivery() duplicate = %v, %v, want false", created, err)
+		}
+
+		claimed, err := ClaimWebhookDelivery(time.Now(), time.Now().Add(time.Minute))
+		if err != nil || claimed == nil || claimed.ID != delivery.ID {
+			t.Fatalf("ClaimWebhookDelivery() = %+v, %v, want delivery %d", claimed, err, delivery.ID)
+		}
+		// Выбранная доставка отложена и повторно не выбирается
+		if again, err := ClaimWebhookDelivery(time.Now(), time.Now().Add(time.Minute)); err != nil || again != nil {
+			t.Errorf("ClaimWebhookDelivery() second claim = %+v, %v, want nil", again, err)
+		}
+	})
+}
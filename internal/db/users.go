@@ -16,11 +16,21 @@ var (
 
 // CreateUser создает нового пользователя в базе данных
 func CreateUser(login, password string) (*User, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
+	// Хешируем пароль
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return active().CreateUser(login, string(passwordHash))
+}
+
+func (s *sqlStore) CreateUser(login, passwordHash string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	// Проверяем, что пользователь уже существует
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM users WHERE login = ?", login).Scan(&count)
+	err := s.queryRow("SELECT COUNT(*) FROM users WHERE login = ?", login).Scan(&count)
 	if err != nil {
 		return nil, err
 	}
@@ -28,73 +38,53 @@ func CreateUser(login, password string) (*User, error) {
 		return nil, ErrUserAlreadyExists
 	}
 
-	// Хешируем пароль
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
-	}
-
 	// Добавляем нового пользователя
-	result, err := DB.Exec(
+	id, err := s.insert(
 		"INSERT INTO users (login, password_hash) VALUES (?, ?)",
-		login, string(passwordHash),
+		login, passwordHash,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-
 	return &User{
 		ID:           id,
 		Login:        login,
-		PasswordHash: string(passwordHash),
+		PasswordHash: passwordHash,
 		CreatedAt:    time.Now(),
 	}, nil
 }
 
 // GetUserByID получает пользователя по ID
 func GetUserByID(id int64) (*User, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	var user User
-	var createdAtStr string
+	return active().GetUserByID(id)
+}
 
-	err := DB.QueryRow(
+func (s *sqlStore) GetUserByID(id int64) (*User, error) {
+	return scanUser(s.queryRow(
 		"SELECT id, login, password_hash, created_at FROM users WHERE id = ?",
 		id,
-	).Scan(&user.ID, &user.Login, &user.PasswordHash, &createdAtStr)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrUserNotFound
-		}
-		return nil, err
-	}
-
-	user.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
+	))
 }
 
 // GetUserByLogin получает пользователя по логину
 func GetUserByLogin(login string) (*User, error) {
-	DbMutex.Lock()
-	defer DbMutex.Unlock()
-	var user User
-	var createdAtStr string
+	return active().GetUserByLogin(login)
+}
 
-	err := DB.QueryRow(
+func (s *sqlStore) GetUserByLogin(login string) (*User, error) {
+	return scanUser(s.queryRow(
 		"SELECT id, login, password_hash, created_at FROM users WHERE login = ?",
 		login,
-	).Scan(&user.ID, &user.Login, &user.PasswordHash, &createdAtStr)
+	))
+}
+
+// scanUser читает пользователя из результата запроса
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	var createdAtStr string
 
+	err := row.Scan(&user.ID, &user.Login, &user.PasswordHash, &createdAtStr)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrVariableNotFound = errors.New("variable not found")
+)
+
+// Колонки переменной в порядке, ожидаемом scanVariable
+const variableColumns = `id, user_id, name, value, created_at, updated_at`
+
+// SetVariable создает переменную пользователя или обновляет значение существующей
+func SetVariable(userID int64, name string, value float64) (*Variable, error) {
+	return active().SetVariable(userID, name, value)
+}
+
+func (s *sqlStore) SetVariable(userID int64, name string, value float64) (*Variable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.exec(
+		`INSERT INTO variables (user_id, name, value) VALUES (?, ?, ?)
+		 ON CONFLICT (user_id, name) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		userID, name, value,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetVariable(userID, name)
+}
+
+// GetVariable получает переменную пользователя по имени
+func GetVariable(userID int64, name string) (*Variable, error) {
+	return active().GetVariable(userID, name)
+}
+
+func (s *sqlStore) GetVariable(userID int64, name string) (*Variable, error) {
+	variable, err := scanVariable(s.queryRow(
+		`SELECT `+variableColumns+` FROM variables WHERE user_id = ? AND name = ?`,
+		userID, name,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrVariableNotFound
+		}
+		return nil, err
+	}
+	return variable, nil
+}
+
+// GetUserVariables получает все переменные пользователя, упорядоченные по имени
+func GetUserVariables(userID int64) ([]*Variable, error) {
+	return active().GetUserVariables(userID)
+}
+
+func (s *sqlStore) GetUserVariables(userID int64) ([]*Variable, error) {
+	rows, err := s.query(
+		`SELECT `+variableColumns+` FROM variables WHERE user_id = ? ORDER BY name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variables []*Variable
+	for rows.Next() {
+		variable, err := scanVariable(rows)
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, variable)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return variables, nil
+}
+
+// DeleteVariable удаляет переменную пользователя
+func DeleteVariable(userID int64, name string) error {
+	return active().DeleteVariable(userID, name)
+}
+
+func (s *sqlStore) DeleteVariable(userID int64, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.exec("DELETE FROM variables WHERE user_id = ? AND name = ?", userID, name)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVariableNotFound
+	}
+	return nil
+}
+
+// scanVariable читает переменную из результата запроса по колонкам variableColumns
+func scanVariable(row rowScanner) (*Variable, error) {
+	var variable Variable
+	var createdAtStr, updatedAtStr string
+
+	err := row.Scan(
+		&variable.ID, &variable.UserID, &variable.Name, &variable.Value,
+		&createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	variable.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	variable.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &variable, nil
+}
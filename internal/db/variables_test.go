@@ -0,0 +1,70 @@
+package db
+
+import "testing"
+
+// TestVariables проверяет создание, изменение, получение и удаление переменных пользователя
+func TestVariables(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	other, err := CreateUser("otheruser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create other user: %v", err)
+	}
+
+	if _, err := SetVariable(user.ID, "rate", 0.13); err != nil {
+		t.Fatalf("SetVariable() error = %v", err)
+	}
+
+	// Повторная запись изменяет значение существующей переменной
+	variable, err := SetVariable(user.ID, "rate", 0.2)
+	if err != nil {
+		t.Fatalf("SetVariable() update error = %v", err)
+	}
+	if variable.Name != "rate" || variable.Value != 0.2 {
+		t.Errorf("Variable = %s %v, want rate 0.2", variable.Name, variable.Value)
+	}
+
+	if _, err := SetVariable(user.ID, "base", 100); err != nil {
+		t.Fatalf("SetVariable() error = %v", err)
+	}
+	if _, err := SetVariable(other.ID, "rate", 1); err != nil {
+		t.Fatalf("SetVariable() for other user error = %v", err)
+	}
+
+	variables, err := GetUserVariables(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserVariables() error = %v", err)
+	}
+	if len(variables) != 2 || variables[0].Name != "base" || variables[1].Name != "rate" {
+		t.Fatalf("GetUserVariables() = %v, want base and rate", variables)
+	}
+	if variables[1].Value != 0.2 {
+		t.Errorf("Variable rate = %v, want 0.2", variables[1].Value)
+	}
+
+	// Переменные разных пользователей независимы
+	otherRate, err := GetVariable(other.ID, "rate")
+	if err != nil {
+		t.Fatalf("GetVariable() error = %v", err)
+	}
+	if otherRate.Value != 1 {
+		t.Errorf("Other user's rate = %v, want 1", otherRate.Value)
+	}
+
+	if err := DeleteVariable(user.ID, "rate"); err != nil {
+		t.Fatalf("DeleteVariable() error = %v", err)
+	}
+	if _, err := GetVariable(user.ID, "rate"); err != ErrVariableNotFound {
+		t.Errorf("GetVariable() after delete error = %v, want %v", err, ErrVariableNotFound)
+	}
+	if err := DeleteVariable(user.ID, "rate"); err != ErrVariableNotFound {
+		t.Errorf("DeleteVariable() of missing variable error = %v, want %v", err, ErrVariableNotFound)
+	}
+}
@@ -0,0 +1,250 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Колонки доставки webhook в порядке, ожидаемом scanWebhookDelivery
+const webhookDeliveryColumns = `id, expression_id, url, payload, status, attempts, response_code,
+         last_error, next_attempt_at, delivered_at, created_at, updated_at`
+
+// EnsureWebhookSecret сохраняет secret как ключ подписи webhook пользователя, если ключ еще не задан,
+// и возвращает действующий ключ
+func EnsureWebhookSecret(userID int64, secret string) (string, error) {
+	return active().EnsureWebhookSecret(userID, secret)
+}
+
+func (s *sqlStore) EnsureWebhookSecret(userID int64, secret string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.exec(
+		"UPDATE users SET webhook_secret = ? WHERE id = ? AND webhook_secret IS NULL",
+		secret, userID,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var current sql.NullString
+	err = s.queryRow("SELECT webhook_secret FROM users WHERE id = ?", userID).Scan(&current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+	return current.String, nil
+}
+
+// SetWebhookSecret заменяет ключ подписи webhook пользователя
+func SetWebhookSecret(userID int64, secret string) error {
+	return active().SetWebhookSecret(userID, secret)
+}
+
+func (s *sqlStore) SetWebhookSecret(userID int64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.exec("UPDATE users SET webhook_secret = ? WHERE id = ?", secret, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CreateWebhookDelivery ставит доставку в очередь. Для выражения создается не более одной доставки:
+// если она уже есть, возвращает false
+func CreateWebhookDelivery(delivery *WebhookDelivery) (bool, error) {
+	return active().CreateWebhookDelivery(delivery)
+}
+
+func (s *sqlStore) CreateWebhookDelivery(delivery *WebhookDelivery) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.insert(
+		`INSERT INTO webhook_deliveries (expression_id, url, payload, status, next_attempt_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (expression_id) DO NOTHING`,
+		delivery.ExpressionID, delivery.URL, string(delivery.Payload), StatusPending, delivery.NextAttemptAt.UnixMilli(),
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	delivery.ID = id
+	delivery.Status = StatusPending
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = delivery.CreatedAt
+	return true, nil
+}
+
+// ClaimWebhookDelivery атомарно выбирает доставку, время попытки которой наступило к now,
+// и откладывает ее следующую попытку до until, чтобы ее не выбрал другой оркестратор.
+// Возвращает nil, если таких доставок нет
+func ClaimWebhookDelivery(now, until time.Time) (*WebhookDelivery, error) {
+	return active().ClaimWebhookDelivery(now, until)
+}
+
+func (s *sqlStore) ClaimWebhookDelivery(now, until time.Time) (*WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(s.rebind(
+		`UPDATE webhook_deliveries
+		 SET next_attempt_at = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = (SELECT id FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ?
+		             ORDER BY next_attempt_at, id LIMIT 1`+s.skipLocked+`)
+		 AND status = ? AND next_attempt_at <= ?
+		 RETURNING id`),
+		until.UnixMilli(), StatusPending, now.UnixMilli(), StatusPending, now.UnixMilli(),
+	).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	delivery, err := scanWebhookDelivery(tx.QueryRow(s.rebind(
+		`SELECT `+webhookDeliveryColumns+`
+		 FROM webhook_deliveries WHERE id = ?`),
+		id,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// UpdateWebhookDelivery сохраняет результат попытки доставки: статус, число попыток,
+// ответ получателя и время следующей попытки
+func UpdateWebhookDelivery(delivery *WebhookDelivery) error {
+	return active().UpdateWebhookDelivery(delivery)
+}
+
+func (s *sqlStore) UpdateWebhookDelivery(delivery *WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deliveredAt *int64
+	if delivery.DeliveredAt != nil {
+		val := delivery.DeliveredAt.UnixMilli()
+		deliveredAt = &val
+	}
+
+	_, err := s.exec(
+		`UPDATE webhook_deliveries
+		 SET status = ?, attempts = ?, response_code = ?, last_error = ?, next_attempt_at = ?,
+		     delivered_at = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`,
+		delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.LastError,
+		delivery.NextAttemptAt.UnixMilli(), deliveredAt, delivery.ID,
+	)
+	return err
+}
+
+// GetExpressionWebhookDeliveries получает доставки webhook выражения
+func GetExpressionWebhookDeliveries(expressionID int64) ([]*WebhookDelivery, error) {
+	return active().GetExpressionWebhookDeliveries(expressionID)
+}
+
+func (s *sqlStore) GetExpressionWebhookDeliveries(expressionID int64) ([]*WebhookDelivery, error) {
+	rows, err := s.query(
+		`SELECT `+webhookDeliveryColumns+`
+		 FROM webhook_deliveries WHERE expression_id = ? ORDER BY id`,
+		expressionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// scanWebhookDelivery читает доставку webhook из результата запроса по колонкам webhookDeliveryColumns
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload string
+	var responseCode, deliveredAt sql.NullInt64
+	var lastError sql.NullString
+	var nextAttemptAt int64
+	var createdAtStr, updatedAtStr string
+
+	err := row.Scan(
+		&delivery.ID, &delivery.ExpressionID, &delivery.URL, &payload, &delivery.Status,
+		&delivery.Attempts, &responseCode, &lastError, &nextAttemptAt, &deliveredAt,
+		&createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = []byte(payload)
+	delivery.NextAttemptAt = time.UnixMilli(nextAttemptAt)
+
+	if responseCode.Valid {
+		val := int(responseCode.Int64)
+		delivery.ResponseCode = &val
+	}
+
+	if lastError.Valid {
+		val := lastError.String
+		delivery.LastError = &val
+	}
+
+	if deliveredAt.Valid {
+		val := time.UnixMilli(deliveredAt.Int64)
+		delivery.DeliveredAt = &val
+	}
+
+	delivery.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWebhookSecret проверяет создание и замену ключа подписи webhook
+func TestWebhookSecret(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	secret, err := EnsureWebhookSecret(user.ID, "first")
+	if err != nil || secret != "first" {
+		t.Fatalf("EnsureWebhookSecret() = %q, %v, want first", secret, err)
+	}
+
+	// Заданный ключ не перезаписывается
+	if secret, _ := EnsureWebhookSecret(user.ID, "second"); secret != "first" {
+		t.Errorf("EnsureWebhookSecret() = %q, want existing secret first", secret)
+	}
+
+	if err := SetWebhookSecret(user.ID, "rotated"); err != nil {
+		t.Fatalf("SetWebhookSecret() error = %v", err)
+	}
+	if secret, _ := EnsureWebhookSecret(user.ID, "second"); secret != "rotated" {
+		t.Errorf("EnsureWebhookSecret() after rotation = %q, want rotated", secret)
+	}
+
+	if err := SetWebhookSecret(user.ID+1, "x"); err != ErrUserNotFound {
+		t.Errorf("SetWebhookSecret() for missing user error = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+// TestWebhookDeliveries проверяет очередь доставок webhook
+func TestWebhookDeliveries(t *testing.T) {
+	InitTest(t)
+
+	defer CleanupDB()
+
+	user, err := CreateUser("testuser", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := CreateExpressionWithCallback(user.ID, "2+2", "http://localhost/hook")
+	if err != nil {
+		t.Fatalf("CreateExpressionWithCallback() error = %v", err)
+	}
+
+	saved, err := GetExpressionByID(expr.ID)
+	if err != nil {
+		t.Fatalf("GetExpressionByID() error = %v", err)
+	}
+	if saved.CallbackURL == nil || *saved.CallbackURL != "http://localhost/hook" {
+		t.Errorf("Expression callback URL = %v, want http://localhost/hook", saved.CallbackURL)
+	}
+
+	now := time.Now()
+	delivery := &WebhookDelivery{ExpressionID: expr.ID, URL: "http://localhost/hook", Payload: []byte(`{"id":1}`), NextAttemptAt: now}
+	created, err := CreateWebhookDelivery(delivery)
+	if err != nil || !created {
+		t.Fatalf("CreateWebhookDelivery() = %v, %v, want created", created, err)
+	}
+
+	// Для выражения создается только одна доставка
+	created, err = CreateWebhookDelivery(&WebhookDelivery{ExpressionID: expr.ID, URL: "http://localhost/hook", Payload: []byte(`{}`), NextAttemptAt: now})
+	if err != nil || created {
+		t.Errorf("Second CreateWebhookDelivery() = %v, %v, want not created", created, err)
+	}
+
+	// Доставка еще не готова к попытке
+	if claimed, err := ClaimWebhookDelivery(now.Add(-time.Second), now.Add(time.Minute)); err != nil || claimed != nil {
+		t.Fatalf("ClaimWebhookDelivery() before next attempt = %v, %v, want nil", claimed, err)
+	}
+
+	claimed, err := ClaimWebhookDelivery(now, now.Add(time.Minute))
+	if err != nil || claimed == nil {
+		t.Fatalf("ClaimWebhookDelivery() = %v, %v, want delivery", claimed, err)
+	}
+	if claimed.ID != delivery.ID || string(claimed.Payload) != `{"id":1}` {
+		t.Errorf("Claimed delivery = %+v, want %+v", claimed, delivery)
+	}
+
+	// Выбранная доставка отложена и повторно не выбирается
+	if again, _ := ClaimWebhookDelivery(now, now.Add(time.Minute)); again != nil {
+		t.Errorf("Delivery claimed twice")
+	}
+
+	code := 500
+	message := "unexpected response status 500"
+	claimed.Attempts = 1
+	claimed.ResponseCode = &code
+	claimed.LastError = &message
+	claimed.NextAttemptAt = now.Add(time.Second)
+	if err := UpdateWebhookDelivery(claimed); err != nil {
+		t.Fatalf("UpdateWebhookDelivery() error = %v", err)
+	}
+
+	deliveries, err := GetExpressionWebhookDeliveries(expr.ID)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("GetExpressionWebhookDeliveries() = %v, %v, want one delivery", deliveries, err)
+	}
+	got := deliveries[0]
+	if got.Status != StatusPending || got.Attempts != 1 || got.ResponseCode == nil || *got.ResponseCode != 500 ||
+		got.LastError == nil || *got.LastError != message || got.NextAttemptAt.UnixMilli() != now.Add(time.Second).UnixMilli() {
+		t.Errorf("Delivery after failed attempt = %+v", got)
+	}
+
+	delivered := now.Add(2 * time.Second)
+	got.Status = StatusDelivered
+	got.Attempts = 2
+	got.DeliveredAt = &delivered
+	if err := UpdateWebhookDelivery(got); err != nil {
+		t.Fatalf("UpdateWebhookDelivery() error = %v", err)
+	}
+
+	// Доставленная доставка больше не выбирается
+	if claimed, _ := ClaimWebhookDelivery(now.Add(time.Hour), now.Add(2*time.Hour)); claimed != nil {
+		t.Errorf("Delivered delivery claimed again")
+	}
+
+	deliveries, _ = GetExpressionWebhookDeliveries(expr.ID)
+	if deliveries[0].DeliveredAt == nil || deliveries[0].DeliveredAt.UnixMilli() != delivered.UnixMilli() {
+		t.Errorf("Delivered at = %v, want %v", deliveries[0].DeliveredAt, delivered)
+	}
+}
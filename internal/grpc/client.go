@@ -3,18 +3,30 @@ package grpc
 import (
 	"context"
 	"errors"
+	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/numeric"
+	"parallel-calculator/internal/tracing"
 	"parallel-calculator/proto"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
+// ErrStreamingUnsupported возвращается, если оркестратор не поддерживает потоковое получение задач
+var ErrStreamingUnsupported = errors.New("task streaming is not supported by orchestrator")
+
+// ErrRegistrationUnsupported возвращается, если оркестратор не поддерживает регистрацию агентов
+var ErrRegistrationUnsupported = errors.New("agent registration is not supported by orchestrator")
+
 // GRPCTaskClient представляет gRPC клиент для взаимодействия с оркестратором
 type GRPCTaskClient struct {
-	conn   *grpc.ClientConn
-	client proto.TaskServiceClient
+	conn    *grpc.ClientConn
+	client  proto.TaskServiceClient
+	agentID string
 }
 
 // NewGRPCTaskClient создает новый gRPC клиент для взаимодействия с оркестратором
@@ -27,9 +39,16 @@ func NewGRPCTaskClient(address string) (*GRPCTaskClient, error) {
 	// Создаем клиент
 	client := proto.NewTaskServiceClient(conn)
 
+	// Идентификатор агента передается оркестратору для закрепления аренды операций
+	var agentID string
+	if config.AppConfig != nil {
+		agentID = config.AppConfig.AgentID
+	}
+
 	return &GRPCTaskClient{
-		conn:   conn,
-		client: client,
+		conn:    conn,
+		client:  client,
+		agentID: agentID,
 	}, nil
 }
 
@@ -44,59 +63,268 @@ func (c *GRPCTaskClient) Close() error {
 // GetTask запрашивает задачу от оркестратора
 // Возвращает структуру Task для агента
 func (c *GRPCTaskClient) GetTask() (*Task, error) {
-	logger.INFO.Println("Отправка запроса на получение задачи через gRPC")
-
 	// Создаем контекст с таймаутом
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	logger.Debug(ctx, "Отправка запроса на получение задачи через gRPC")
+
 	// Отправляем запрос
-	resp, err := c.client.GetTask(ctx, &proto.GetTaskRequest{})
+	resp, err := c.client.GetTask(ctx, &proto.GetTaskRequest{
+		AgentId: c.agentID,
+	})
 	if err != nil {
-		logger.ERROR.Println("Ошибка при получении задачи: ", err)
+		logger.Error(ctx, "Ошибка при получении задачи", "error", err)
 		return nil, err
 	}
 
 	if !resp.HasTask {
-		logger.INFO.Println("Нет доступных задач")
+		logger.Debug(ctx, "Нет доступных задач")
 		return nil, nil
 	}
 
-	task := &Task{
+	task := taskFromResponse(resp)
+
+	logger.Info(logger.With(ctx, task.logOf().fields()...), "Получена задача", "operator", task.Operator)
+	return task, nil
+}
+
+// taskFromResponse преобразует ответ оркестратора в задачу для агента
+func taskFromResponse(resp *proto.GetTaskResponse) *Task {
+	kind := TaskKindBinary
+	switch resp.Kind {
+	case proto.OperationKind_OPERATION_KIND_UNARY:
+		kind = TaskKindUnary
+	case proto.OperationKind_OPERATION_KIND_FUNCTION:
+		kind = TaskKindFunction
+	}
+
+	return &Task{
 		ID:            resp.Id,
 		LeftValue:     resp.LeftValue,
 		RightValue:    resp.RightValue,
 		Operator:      resp.Operator,
+		Kind:          kind,
+		Args:          resp.Args,
 		OperationTime: time.Duration(resp.OperationTimeNs),
+		LeaseID:       resp.LeaseId,
+		RequestID:     resp.RequestId,
+		UserID:        resp.UserId,
+		ExpressionID:  resp.ExpressionId,
+		Traceparent:   resp.Traceparent,
+		Mode:          resp.Mode,
+		LeftExact:     resp.LeftExact,
+		RightExact:    resp.RightExact,
+		ArgsExact:     resp.ArgsExact,
+		Precision:     int(resp.Precision),
+		Rounding:      resp.Rounding,
+		LeftInterval:  taskInterval(resp.LeftInterval),
+		RightInterval: taskInterval(resp.RightInterval),
+		ArgsInterval:  taskIntervals(resp.ArgsInterval),
+	}
+}
+
+// taskInterval преобразует интервал из ответа оркестратора
+func taskInterval(interval *proto.Interval) *numeric.Interval {
+	if interval == nil {
+		return nil
 	}
+	return &numeric.Interval{Lower: interval.Lower, Upper: interval.Upper}
+}
 
-	logger.INFO.Println("Получена задача: ", task)
+// taskIntervals преобразует интервальные аргументы функции из ответа оркестратора
+func taskIntervals(intervals []*proto.Interval) []numeric.Interval {
+	if intervals == nil {
+		return nil
+	}
+	values := make([]numeric.Interval, len(intervals))
+	for i, interval := range intervals {
+		values[i] = numeric.Interval{Lower: interval.GetLower(), Upper: interval.GetUpper()}
+	}
+	return values
+}
+
+// resultInterval преобразует границы результата задачи для gRPC
+func resultInterval(interval *numeric.Interval) *proto.Interval {
+	if interval == nil {
+		return nil
+	}
+	return &proto.Interval{Lower: interval.Lower, Upper: interval.Upper}
+}
+
+// TaskStream представляет поток задач от оркестратора
+type TaskStream struct {
+	stream  proto.TaskService_StreamTasksClient
+	agentID string
+	cancel  context.CancelFunc
+}
+
+// StreamTasks открывает поток задач. Задачи начинают поступать после вызова RequestTasks
+func (c *GRPCTaskClient) StreamTasks(ctx context.Context) (*TaskStream, error) {
+	logger.Info(ctx, "Открытие потока задач через gRPC")
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.client.StreamTasks(ctx)
+	if err != nil {
+		cancel()
+		return nil, streamError(err)
+	}
+
+	return &TaskStream{
+		stream:  stream,
+		agentID: c.agentID,
+		cancel:  cancel,
+	}, nil
+}
+
+// RequestTasks сообщает оркестратору, что освободилось n воркеров
+func (s *TaskStream) RequestTasks(n int) error {
+	err := s.stream.Send(&proto.TaskStreamRequest{
+		AgentId:   s.agentID,
+		FreeSlots: int32(n),
+	})
+	return streamError(err)
+}
+
+// Recv ожидает следующую задачу из потока
+func (s *TaskStream) Recv() (*Task, error) {
+	resp, err := s.stream.Recv()
+	if err != nil {
+		return nil, streamError(err)
+	}
+
+	task := taskFromResponse(resp)
+	logger.Info(logger.With(s.stream.Context(), task.logOf().fields()...), "Получена задача из потока", "operator", task.Operator)
 	return task, nil
 }
 
+// Close закрывает поток задач
+func (s *TaskStream) Close() error {
+	err := s.stream.CloseSend()
+	s.cancel()
+	return err
+}
+
+// streamError заменяет ошибку сервера, не поддерживающего потоковое получение задач, на ErrStreamingUnsupported
+func streamError(err error) error {
+	if status.Code(err) == codes.Unimplemented {
+		return ErrStreamingUnsupported
+	}
+	return err
+}
+
 // SendTaskResult отправляет результат выполнения задачи оркестратору
 func (c *GRPCTaskClient) SendTaskResult(taskResult TaskResult) error {
-	logger.INFO.Println("Отправка результата задачи через gRPC: ", taskResult)
+	// Создаем контекст с таймаутом. Поля журнала задачи передаются оркестратору в метаданных
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = taskResult.logOf().outgoing(logger.With(ctx, taskResult.logOf().fields()...))
+
+	// Спан вызова — дочерний к спану агента, выполнившего задачу
+	ctx, span := startClientSpan(ctx, proto.TaskService_SendTaskResult_FullMethodName, taskResult.Traceparent)
+	defer span.End()
+
+	logger.Debug(ctx, "Отправка результата задачи через gRPC", "result", taskResult.Result, "task_error", taskResult.Error)
+
+	resp, err := c.client.SendTaskResult(ctx, &proto.TaskResultRequest{
+		Id:             taskResult.ID,
+		Result:         taskResult.Result,
+		Error:          taskResult.Error,
+		AgentId:        c.agentID,
+		LeaseId:        taskResult.LeaseID,
+		ExactResult:    taskResult.Exact,
+		IntervalResult: resultInterval(taskResult.Interval),
+	})
+	if err != nil {
+		logger.Error(ctx, "Ошибка при отправке результата задачи", "error", err)
+		span.RecordError(err)
+		return err
+	}
 
+	if !resp.Success {
+		logger.Error(ctx, "Сервер отклонил результат задачи", "error", resp.Error)
+		span.SetStatus(tracing.StatusError, resp.Error)
+		return errors.New(resp.Error)
+	}
+
+	logger.Info(ctx, "Результат задачи успешно отправлен")
+	return nil
+}
+
+// ReleaseTask возвращает оркестратору полученную, но не начатую задачу, чтобы ее выполнил другой агент
+func (c *GRPCTaskClient) ReleaseTask(task Task) error {
 	// Создаем контекст с таймаутом
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	ctx = task.logOf().outgoing(logger.With(ctx, task.logOf().fields()...))
 
-	resp, err := c.client.SendTaskResult(ctx, &proto.TaskResultRequest{
-		Id:     taskResult.ID,
-		Result: taskResult.Result,
-		Error:  taskResult.Error,
+	logger.Info(ctx, "Возврат задачи через gRPC")
+
+	resp, err := c.client.ReleaseTask(ctx, &proto.ReleaseTaskRequest{
+		Id:      task.ID,
+		AgentId: c.agentID,
+		LeaseId: task.LeaseID,
 	})
 	if err != nil {
-		logger.ERROR.Println("Ошибка при отправке результата задачи: ", err)
+		logger.Error(ctx, "Ошибка при возврате задачи", "error", err)
 		return err
 	}
 
 	if !resp.Success {
-		logger.ERROR.Println("Сервер сообщил об ошибке: ", resp.Error)
+		logger.Error(ctx, "Сервер отклонил возврат задачи", "error", resp.Error)
 		return errors.New(resp.Error)
 	}
 
-	logger.INFO.Println("Результат задачи успешно отправлен")
 	return nil
 }
+
+// RegisterAgent регистрирует агента в оркестраторе и возвращает период Heartbeat
+func (c *GRPCTaskClient) RegisterAgent(hostname string, computingPower int, version string) (time.Duration, error) {
+	// Создаем контекст с таймаутом
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logger.Info(ctx, "Регистрация агента через gRPC", "agent_id", c.agentID)
+
+	resp, err := c.client.RegisterAgent(ctx, &proto.RegisterAgentRequest{
+		AgentId:        c.agentID,
+		Hostname:       hostname,
+		ComputingPower: int32(computingPower),
+		Version:        version,
+	})
+	if err != nil {
+		return 0, registrationError(err)
+	}
+
+	if !resp.Success {
+		logger.Error(ctx, "Сервер отклонил регистрацию агента", "error", resp.Error)
+		return 0, errors.New(resp.Error)
+	}
+
+	return time.Duration(resp.HeartbeatIntervalMs) * time.Millisecond, nil
+}
+
+// Heartbeat сообщает оркестратору, что агент работает.
+// Возвращает false, если оркестратор не знает агента и его нужно зарегистрировать заново
+func (c *GRPCTaskClient) Heartbeat() (bool, error) {
+	// Создаем контекст с таймаутом
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.client.Heartbeat(ctx, &proto.HeartbeatRequest{
+		AgentId: c.agentID,
+	})
+	if err != nil {
+		return false, registrationError(err)
+	}
+
+	return resp.Registered, nil
+}
+
+// registrationError заменяет ошибку сервера, не поддерживающего регистрацию агентов, на ErrRegistrationUnsupported
+func registrationError(err error) error {
+	if status.Code(err) == codes.Unimplemented {
+		return ErrRegistrationUnsupported
+	}
+	return err
+}
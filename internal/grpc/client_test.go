@@ -1,10 +1,10 @@
 package grpc
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
 	"net"
 	"path/filepath"
 	"testing"
@@ -13,6 +13,7 @@ import (
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/db"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/orchestrator"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -23,10 +24,9 @@ func InitTest(t *testing.T) {
 
 	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
 
-	// Инициализация логгеров с заглушкой вместо вывода
-	// Используем ioutil.Discard, который просто отбрасывает все записи
-	logger.INFO = log.New(ioutil.Discard, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	logger.ERROR = log.New(ioutil.Discard, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	// Инициализация логгера с заглушкой вместо вывода
+	// Используем io.Discard, который просто отбрасывает все записи
+	logger.SetOutput(io.Discard)
 }
 
 // setupTestEnvironment создает тестовое окружение и запускает сервер
@@ -334,6 +334,9 @@ func TestSendTaskResult(t *testing.T) {
 	defer cleanup()
 
 	testTaskID := operationID
+	if err := db.LeaseOperation(testTaskID, "agent-1", "lease-result", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to lease test operation: %v", err)
+	}
 
 	// Даем серверу время на запуск
 	time.Sleep(100 * time.Millisecond)
@@ -347,8 +350,9 @@ func TestSendTaskResult(t *testing.T) {
 
 	// Создаем результат задачи
 	taskResult := TaskResult{
-		ID:     uint32(testTaskID),
-		Result: 5.0,
+		ID:      uint32(testTaskID),
+		Result:  5.0,
+		LeaseID: "lease-result",
 	}
 
 	// Отправляем результат
@@ -374,3 +378,215 @@ func TestSendTaskResult(t *testing.T) {
 		t.Errorf("Expected result 5.0, got %v", resultValue)
 	}
 }
+
+func TestStreamTasks(t *testing.T) {
+	// Инициализируем тестовое окружение
+	InitTest(t)
+
+	// Очищаем базу данных до и после теста
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+	defer db.CleanupDB()
+
+	result, err := db.DB.Exec(`
+		INSERT INTO users (login, password_hash)
+		VALUES ('testuser_stream', 'hashpwd');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to insert test user: %v", err)
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		t.Fatalf("Failed to get last inserted user ID: %v", err)
+	}
+
+	// Выражение с одной готовой операцией
+	operationExprID, err := orchestrator.ProcessExpression("2+3", userID)
+	if err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	ops, err := db.GetOperationsByExpressionID(*operationExprID)
+	if err != nil || len(ops) != 1 {
+		t.Fatalf("Expected one operation, got %d (err %v)", len(ops), err)
+	}
+	operationID := ops[0].ID
+
+	// Запускаем gRPC сервер на свободном порту
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	serverAddr := fmt.Sprintf("localhost:%d", port)
+
+	server, err := StartGRPCServer(fmt.Sprintf(":%d", port))
+	if err != nil {
+		t.Fatalf("Failed to start gRPC server: %v", err)
+	}
+	defer server.Stop()
+
+	// Даем серверу время на запуск
+	time.Sleep(100 * time.Millisecond)
+
+	client, err := NewGRPCTaskClient(serverAddr)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	stream, err := client.StreamTasks(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open task stream: %v", err)
+	}
+	defer stream.Close()
+
+	// Один свободный воркер - оркестратор отправляет готовую операцию
+	if err := stream.RequestTasks(1); err != nil {
+		t.Fatalf("Failed to request tasks: %v", err)
+	}
+
+	task, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive task: %v", err)
+	}
+
+	if task.ID != uint32(operationID) {
+		t.Errorf("Expected ID %d, got %d", operationID, task.ID)
+	}
+
+	if task.LeaseID == "" {
+		t.Error("Expected task to carry lease id")
+	}
+
+	// Новая операция отправляется сразу после появления, без ожидания опроса
+	if err := stream.RequestTasks(1); err != nil {
+		t.Fatalf("Failed to request tasks: %v", err)
+	}
+
+	received := make(chan *Task, 1)
+	go func() {
+		task, err := stream.Recv()
+		if err == nil {
+			received <- task
+		}
+	}()
+
+	exprID, err := orchestrator.ProcessExpression("7*6", userID)
+	if err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	select {
+	case task := <-received:
+		if task.Operator != "*" || task.LeftValue != 7 || task.RightValue != 6 {
+			t.Errorf("Expected task 7*6 of expression %d, got %+v", *exprID, task)
+		}
+	case <-time.After(streamPollInterval / 2):
+		t.Fatal("Task was not pushed to the stream after it became ready")
+	}
+}
+
+func TestReleaseTaskAndShutdown(t *testing.T) {
+	// Инициализируем тестовое окружение
+	InitTest(t)
+
+	// Очищаем базу данных до и после теста
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+	defer db.CleanupDB()
+
+	user, err := db.CreateUser("testuser_release", "hashpwd")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	exprID, err := orchestrator.ProcessExpression("2+3", user.ID)
+	if err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	ops, err := db.GetOperationsByExpressionID(*exprID)
+	if err != nil || len(ops) != 1 {
+		t.Fatalf("Expected one operation, got %d (err %v)", len(ops), err)
+	}
+
+	// Запускаем gRPC сервер на свободном порту
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	server, err := StartGRPCServer(fmt.Sprintf(":%d", port))
+	if err != nil {
+		t.Fatalf("Failed to start gRPC server: %v", err)
+	}
+	defer server.Stop()
+
+	// Даем серверу время на запуск
+	time.Sleep(100 * time.Millisecond)
+
+	client, err := NewGRPCTaskClient(fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	task, err := client.GetTask()
+	if err != nil || task == nil {
+		t.Fatalf("Expected task, got %v (err %v)", task, err)
+	}
+
+	// Агент возвращает задачу, не начав ее выполнять
+	if err := client.ReleaseTask(*task); err != nil {
+		t.Fatalf("ReleaseTask failed: %v", err)
+	}
+
+	op, err := db.GetOperationByID(ops[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get operation: %v", err)
+	}
+	if op.Status != db.StatusReady {
+		t.Errorf("Expected released operation status %s, got %s", db.StatusReady, op.Status)
+	}
+
+	// Повторный возврат по той же аренде отклоняется
+	if err := client.ReleaseTask(*task); err == nil {
+		t.Error("Expected error when releasing task without lease")
+	}
+
+	// Остановка сервера закрывает открытый поток задач и не ждет истечения таймаута
+	stream, err := client.StreamTasks(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open task stream: %v", err)
+	}
+	defer stream.Close()
+
+	if err := stream.RequestTasks(0); err != nil {
+		t.Fatalf("Failed to request tasks: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown took %v, expected open streams to be closed", elapsed)
+	}
+
+	if _, err := stream.Recv(); err == nil {
+		t.Error("Expected stream to be closed after shutdown")
+	}
+}
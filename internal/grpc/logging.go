@@ -0,0 +1,105 @@
+package grpc
+
+import (
+	"context"
+	"parallel-calculator/internal/logger"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Ключи метаданных gRPC, в которых агент передает оркестратору поля журнала задачи
+const (
+	metadataRequestID    = "x-request-id"
+	metadataUserID       = "x-user-id"
+	metadataExpressionID = "x-expression-id"
+	metadataOperationID  = "x-operation-id"
+)
+
+// taskLog — поля журнала задачи, общие для записей оркестратора и агента
+type taskLog struct {
+	requestID    string
+	userID       int64
+	expressionID int64
+	operationID  uint32
+}
+
+// fields возвращает непустые поля в виде пар ключ-значение для logger.With
+func (l taskLog) fields() []any {
+	var args []any
+	if l.requestID != "" {
+		args = append(args, logger.KeyRequestID, l.requestID)
+	}
+	if l.userID != 0 {
+		args = append(args, logger.KeyUserID, l.userID)
+	}
+	if l.expressionID != 0 {
+		args = append(args, logger.KeyExpressionID, l.expressionID)
+	}
+	if l.operationID != 0 {
+		args = append(args, logger.KeyOperationID, l.operationID)
+	}
+	return args
+}
+
+// outgoing добавляет поля в исходящие метаданные вызова
+func (l taskLog) outgoing(ctx context.Context) context.Context {
+	var kv []string
+	if l.requestID != "" {
+		kv = append(kv, metadataRequestID, l.requestID)
+	}
+	if l.userID != 0 {
+		kv = append(kv, metadataUserID, strconv.FormatInt(l.userID, 10))
+	}
+	if l.expressionID != 0 {
+		kv = append(kv, metadataExpressionID, strconv.FormatInt(l.expressionID, 10))
+	}
+	if l.operationID != 0 {
+		kv = append(kv, metadataOperationID, strconv.FormatUint(uint64(l.operationID), 10))
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// incomingTaskLog читает поля журнала из входящих метаданных вызова.
+// Некорректные числовые значения пропускаются
+func incomingTaskLog(ctx context.Context) taskLog {
+	var l taskLog
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return l
+	}
+
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	l.requestID = first(metadataRequestID)
+	l.userID, _ = strconv.ParseInt(first(metadataUserID), 10, 64)
+	l.expressionID, _ = strconv.ParseInt(first(metadataExpressionID), 10, 64)
+	if id, err := strconv.ParseUint(first(metadataOperationID), 10, 32); err == nil {
+		l.operationID = uint32(id)
+	}
+	return l
+}
+
+// loggingInterceptor добавляет в контекст унарного вызова поля журнала из метаданных агента
+func loggingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if fields := incomingTaskLog(ctx).fields(); len(fields) > 0 {
+		ctx = logger.With(ctx, fields...)
+	}
+	return handler(ctx, req)
+}
+
+// logOf возвращает поля журнала задачи
+func (t Task) logOf() taskLog {
+	return taskLog{requestID: t.RequestID, userID: t.UserID, expressionID: t.ExpressionID, operationID: t.ID}
+}
+
+// logOf возвращает поля журнала задачи, результат которой отправляется
+func (r TaskResult) logOf() taskLog {
+	return taskLog{requestID: r.RequestID, userID: r.UserID, expressionID: r.ExpressionID, operationID: r.ID}
+}
@@ -0,0 +1,114 @@
+package grpc
+
+import (
+	"context"
+	"parallel-calculator/internal/metrics"
+	"parallel-calculator/internal/tracing"
+	"path"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// dispatchTTL — сколько хранится время передачи операции, результат которой так и не пришел
+const dispatchTTL = time.Hour
+
+// dispatchSweepInterval — как часто record ищет операции, устаревшие по dispatchTTL
+const dispatchSweepInterval = time.Minute
+
+var (
+	grpcRequestDuration = metrics.NewHistogram(
+		"calculator_grpc_request_duration_seconds",
+		"Duration of unary gRPC calls handled by the orchestrator.",
+		metrics.DefBuckets,
+		"method", "code",
+	)
+	dispatchToResult = metrics.NewHistogram(
+		"calculator_operation_dispatch_to_result_seconds",
+		"Time from handing an operation to an agent to accepting its result.",
+		[]float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+		"operator",
+	)
+)
+
+// RegisterServerMetrics добавляет метрики gRPC сервера оркестратора в реестр
+func RegisterServerMetrics(registry *metrics.Registry) {
+	registry.MustRegister(grpcRequestDuration, dispatchToResult)
+}
+
+// metricsInterceptor измеряет длительность унарных вызовов по методу и коду ответа
+func metricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	grpcRequestDuration.Observe(time.Since(start).Seconds(), path.Base(info.FullMethod), status.Code(err).String())
+	return resp, err
+}
+
+// dispatch — операция, переданная агенту и ожидающая результата
+type dispatch struct {
+	operator string
+	at       time.Time
+	span     *tracing.Span // спан передачи операции, завершается вместе с арендой
+}
+
+// dispatchTracker запоминает время передачи операций агентам по идентификатору аренды
+type dispatchTracker struct {
+	mu        sync.Mutex
+	pending   map[string]dispatch
+	lastSweep time.Time // время последнего поиска устаревших операций
+}
+
+var dispatches = &dispatchTracker{pending: make(map[string]dispatch)}
+
+// record запоминает передачу операции. Не чаще раза в dispatchSweepInterval
+// забывает операции, результат которых не пришел за dispatchTTL
+func (t *dispatchTracker) record(leaseID, operator string, now time.Time, span *tracing.Span) {
+	t.mu.Lock()
+	var expired []dispatch
+	if now.Sub(t.lastSweep) >= dispatchSweepInterval {
+		t.lastSweep = now
+		for id, d := range t.pending {
+			if now.Sub(d.at) > dispatchTTL {
+				expired = append(expired, d)
+				delete(t.pending, id)
+			}
+		}
+	}
+	t.pending[leaseID] = dispatch{operator: operator, at: now, span: span}
+	t.mu.Unlock()
+
+	for _, d := range expired {
+		d.span.SetStatus(tracing.StatusError, "result not received")
+		d.span.End()
+	}
+}
+
+// finish учитывает время от передачи операции до приема ее результата
+func (t *dispatchTracker) finish(leaseID string, now time.Time) {
+	t.mu.Lock()
+	d, ok := t.pending[leaseID]
+	delete(t.pending, leaseID)
+	t.mu.Unlock()
+
+	if ok {
+		dispatchToResult.Observe(now.Sub(d.at).Seconds(), d.operator)
+		d.span.SetAttributes("dispatch.outcome", "completed")
+		d.span.End()
+	}
+}
+
+// forget забывает операцию, которая вернулась в очередь или результат которой отклонен.
+// outcome сохраняется в спане передачи операции
+func (t *dispatchTracker) forget(leaseID, outcome string) {
+	t.mu.Lock()
+	d, ok := t.pending[leaseID]
+	delete(t.pending, leaseID)
+	t.mu.Unlock()
+
+	if ok {
+		d.span.SetAttributes("dispatch.outcome", outcome)
+		d.span.End()
+	}
+}
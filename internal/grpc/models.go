@@ -1,6 +1,16 @@
 package grpc
 
-import "time"
+import (
+	"parallel-calculator/internal/numeric"
+	"time"
+)
+
+// Виды задач: унарная задача использует только LeftValue, функция — Args
+const (
+	TaskKindBinary   = "binary"
+	TaskKindUnary    = "unary"
+	TaskKindFunction = "function"
+)
 
 // Task представляет собой задачу для вычислений
 type Task struct {
@@ -8,12 +18,43 @@ type Task struct {
 	LeftValue     float64       `json:"arg1"`
 	RightValue    float64       `json:"arg2"`
 	Operator      string        `json:"operation"`
+	Kind          string        `json:"kind"`           // TaskKindBinary, TaskKindUnary или TaskKindFunction
+	Args          []float64     `json:"args,omitempty"` // аргументы функции, Operator — её имя
 	OperationTime time.Duration `json:"operation_time"`
+	LeaseID       string        `json:"lease_id"`
+	// Поля журнала: запрос и пользователь, создавшие выражение операции
+	RequestID    string `json:"request_id,omitempty"`
+	UserID       int64  `json:"user_id,omitempty"`
+	ExpressionID int64  `json:"expression_id,omitempty"`
+	// Спан передачи операции, родитель спанов агента по задаче
+	Traceparent string `json:"traceparent,omitempty"`
+	// Числовой режим, точные операнды в режимах rational и decimal, параметры режима decimal
+	Mode       string   `json:"mode,omitempty"`
+	LeftExact  string   `json:"left_exact,omitempty"`
+	RightExact string   `json:"right_exact,omitempty"`
+	ArgsExact  []string `json:"args_exact,omitempty"`
+	Precision  int      `json:"precision,omitempty"`
+	Rounding   string   `json:"rounding,omitempty"`
+	// Операнды в режиме interval; LeftValue, RightValue и Args содержат их середины
+	LeftInterval  *numeric.Interval  `json:"left_interval,omitempty"`
+	RightInterval *numeric.Interval  `json:"right_interval,omitempty"`
+	ArgsInterval  []numeric.Interval `json:"args_interval,omitempty"`
 }
 
 // TaskResult представляет собой результат выполнения задачи
 type TaskResult struct {
-	ID     uint32  `json:"id"`
-	Result float64 `json:"result"`
-	Error  string  `json:"error"`
+	ID      uint32  `json:"id"`
+	Result  float64 `json:"result"`
+	Error   string  `json:"error"`
+	LeaseID string  `json:"lease_id"`
+	// Поля журнала из Task, передаются оркестратору в метаданных вызова
+	RequestID    string `json:"request_id,omitempty"`
+	UserID       int64  `json:"user_id,omitempty"`
+	ExpressionID int64  `json:"expression_id,omitempty"`
+	// Спан агента, в котором отправляется результат
+	Traceparent string `json:"traceparent,omitempty"`
+	// Точный результат в режиме rational или decimal
+	Exact string `json:"exact,omitempty"`
+	// Границы результата в режиме interval
+	Interval *numeric.Interval `json:"interval,omitempty"`
 }
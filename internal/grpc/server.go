@@ -2,48 +2,173 @@ package grpc
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net"
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/db"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/numeric"
 	"parallel-calculator/internal/orchestrator"
+	"parallel-calculator/internal/tracing"
 	"parallel-calculator/proto"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
+// ErrLeaseReassigned возвращается агенту, чья аренда операции истекла и была передана другому агенту
+var ErrLeaseReassigned = errors.New("lease expired or reassigned")
+
+// streamPollInterval — период проверки готовых операций в потоке задач в отсутствие оповещений
+const streamPollInterval = time.Second
+
 // OrchestratorService имплементирует TaskServiceServer из сгенерированного кода
 type OrchestratorService struct {
 	proto.UnimplementedTaskServiceServer
+
+	stopping chan struct{} // закрывается при остановке сервера, чтобы завершить потоки задач
 }
 
 // GetTask возвращает задачу для обработки агентом
 func (s *OrchestratorService) GetTask(ctx context.Context, req *proto.GetTaskRequest) (*proto.GetTaskResponse, error) {
-	logger.INFO.Println("gRPC: Запрос на получение задачи от агента")
-	// Получаем одну готовую к обработке операцию из БД
-	readyOp, err := db.GetReadyOperation()
+	logger.Debug(ctx, "gRPC: Запрос на получение задачи от агента")
+
+	task, err := leaseTask(ctx, agentIdentity(ctx, req.AgentId))
 	if err != nil {
-		logger.LogERROR("Ошибка получения операции: " + err.Error())
+		logger.Error(ctx, "Failed to lease task", "error", err)
 		return &proto.GetTaskResponse{
 			HasTask: false,
 		}, nil
 	}
 
 	// Проверяем, есть ли операция
-	if readyOp == nil {
+	if task == nil {
 		return &proto.GetTaskResponse{
 			HasTask: false,
 		}, nil
 	}
 
-	// Обновляем статус операции на "обрабатывается"
-	err = db.UpdateOperationStatus(readyOp.ID, db.StatusProcessing)
+	return task, nil
+}
+
+// StreamTasks отправляет агенту операции по мере их готовности, пока у агента есть свободные воркеры
+func (s *OrchestratorService) StreamTasks(stream proto.TaskService_StreamTasksServer) error {
+	ctx := stream.Context()
+
+	// Первое сообщение агента содержит его идентификатор и число свободных воркеров
+	first, err := stream.Recv()
 	if err != nil {
-		logger.LogERROR("Ошибка обновления статуса операции: " + err.Error())
-		return &proto.GetTaskResponse{
-			HasTask: false,
-		}, nil
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	owner := agentIdentity(ctx, first.AgentId)
+	freeSlots := first.FreeSlots
+	logCtx := logger.With(ctx, "agent_id", owner)
+	logger.Info(logCtx, "gRPC: Агент подключился к потоку задач", "free_slots", freeSlots)
+
+	slots := make(chan int32)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case slots <- msg.FreeSlots:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ready, unsubscribe := orchestrator.SubscribeReady()
+	defer unsubscribe()
+
+	// Периодическая проверка на случай, если операции стали готовы в другом процессе
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for freeSlots > 0 {
+			task, err := leaseTask(logCtx, owner)
+			if err != nil {
+				logger.Error(logCtx, "Failed to lease task", "error", err)
+				break
+			}
+			if task == nil {
+				break
+			}
+
+			// Задача не дошла до агента: сразу возвращаем ее в очередь, не дожидаясь истечения аренды
+			if err := stream.Send(task); err != nil {
+				dispatches.forget(task.LeaseId, "undelivered")
+				if returnErr := orchestrator.ReturnOperation(int64(task.Id), task.LeaseId); returnErr != nil {
+					logger.Error(logCtx, "Failed to return undelivered task", logger.KeyOperationID, task.Id, "error", returnErr)
+				}
+				return err
+			}
+			freeSlots--
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.stopping:
+			logger.Info(logCtx, "gRPC: Поток задач агента закрыт: оркестратор останавливается")
+			return status.Error(codes.Unavailable, "orchestrator is shutting down")
+		case err := <-recvErr:
+			if err == io.EOF {
+				logger.Info(logCtx, "gRPC: Агент закрыл поток задач")
+				return nil
+			}
+			return err
+		case n := <-slots:
+			freeSlots += n
+		case <-ready:
+		case <-ticker.C:
+		}
+	}
+}
+
+// leaseTask арендует одну готовую операцию для агента owner.
+// Возвращает nil, если готовых операций нет
+func leaseTask(ctx context.Context, owner string) (*proto.GetTaskResponse, error) {
+	leaseID, err := newLeaseID()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации идентификатора аренды: %w", err)
+	}
+
+	// Атомарно забираем готовую операцию, переводим её в статус "обрабатывается"
+	// и закрепляем за агентом на время операции с запасом
+	var (
+		opTime    time.Duration
+		expiresAt time.Time
+	)
+	readyOp, err := db.ClaimReadyOperation(owner, leaseID, func(op *db.Operation) time.Time {
+		opTime = operationTime(op)
+		expiresAt = time.Now().Add(opTime + config.AppConfig.LeaseSlack)
+		return expiresAt
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения операции: %w", err)
+	}
+
+	if readyOp == nil {
+		return nil, nil
 	}
 
 	var leftVal, rightVal float64
@@ -54,20 +179,34 @@ func (s *OrchestratorService) GetTask(ctx context.Context, req *proto.GetTaskReq
 		rightVal = *readyOp.RightValue
 	}
 
-	var opTime time.Duration
-	switch readyOp.Operator {
-	case "+":
-		opTime = config.AppConfig.TimeAddition
-	case "-":
-		opTime = config.AppConfig.TimeSubtraction
-	case "*":
-		opTime = config.AppConfig.TimeMultiplication
-	case "/":
-		opTime = config.AppConfig.TimeDivision
-	default:
-		opTime = config.AppConfig.TimeAddition
+	// Поля журнала выражения передаются агенту вместе с задачей
+	var requestID string
+	expression, err := db.GetExpressionByID(readyOp.ExpressionID)
+	if err != nil {
+		logger.Warn(ctx, "Failed to get expression of leased operation", logger.KeyOperationID, readyOp.ID, "error", err)
+		expression = &db.Expression{ID: readyOp.ExpressionID}
+	} else if expression.RequestID != nil {
+		requestID = *expression.RequestID
 	}
 
+	logger.Info(logger.With(orchestrator.ExpressionContext(ctx, expression), logger.KeyOperationID, readyOp.ID),
+		"gRPC: Операция передана агенту", "owner", owner, "expires_at", expiresAt.Format(time.RFC3339))
+	// Спан передачи операции входит в трассу выражения и длится до приема результата или возврата
+	// операции; агент продолжает трассу своими спанами
+	traceCtx := ctx
+	if expression.Traceparent != nil {
+		traceCtx = tracing.ContextWithTraceparent(traceCtx, *expression.Traceparent)
+	}
+	traceCtx, span := tracing.Start(traceCtx, "dispatch operation", tracing.WithKind(tracing.SpanKindProducer),
+		tracing.WithAttributes(
+			"operation.id", readyOp.ID,
+			"expression.id", readyOp.ExpressionID,
+			"operation.operator", readyOp.Operator,
+			"agent.id", owner,
+			"lease.expires_at", expiresAt.Format(time.RFC3339),
+		))
+	dispatches.record(leaseID, readyOp.Operator, time.Now(), span)
+
 	return &proto.GetTaskResponse{
 		HasTask:         true,
 		Id:              uint32(readyOp.ID),
@@ -75,53 +214,325 @@ func (s *OrchestratorService) GetTask(ctx context.Context, req *proto.GetTaskReq
 		RightValue:      rightVal,
 		Operator:        readyOp.Operator,
 		OperationTimeNs: int64(opTime),
+		LeaseId:         leaseID,
+		Kind:            operationKind(readyOp.Kind),
+		Args:            functionArgs(readyOp.Args),
+		RequestId:       requestID,
+		UserId:          expression.UserID,
+		ExpressionId:    expression.ID,
+		Traceparent:     tracing.Traceparent(traceCtx),
+		Mode:            readyOp.Mode,
+		LeftExact:       exactValue(readyOp.LeftExact),
+		RightExact:      exactValue(readyOp.RightExact),
+		ArgsExact:       exactArgs(readyOp.ArgsExact),
+		Precision:       int32(decimalPrecision(readyOp.Precision)),
+		Rounding:        exactValue(readyOp.Rounding),
+		LeftInterval:    intervalValue(readyOp.LeftLower, readyOp.LeftUpper),
+		RightInterval:   intervalValue(readyOp.RightLower, readyOp.RightUpper),
+		ArgsInterval:    intervalArgs(readyOp.ArgsLower, readyOp.ArgsUpper),
 	}, nil
 }
 
 // SendTaskResult обрабатывает результат выполнения задачи
 func (s *OrchestratorService) SendTaskResult(ctx context.Context, req *proto.TaskResultRequest) (*proto.TaskResultResponse, error) {
-	logger.INFO.Printf("gRPC: Получен результат задачи ID=%d", req.Id)
+	ctx = logger.With(ctx, logger.KeyOperationID, req.Id)
+	logger.Info(ctx, "gRPC: Получен результат задачи")
+
 	// Преобразуем запрос в структуру TaskResult для оркестратора
 	taskResult := orchestrator.TaskResult{
 		ID:     int64(req.Id),
 		Result: req.Result,
 		Error:  req.Error,
+		Exact:  req.ExactResult,
+	}
+	if req.IntervalResult != nil {
+		taskResult.Interval = &numeric.Interval{Lower: req.IntervalResult.Lower, Upper: req.IntervalResult.Upper}
+	}
+	// Бесконечность и NaN нельзя сохранить в базу и закодировать в JSON:
+	// такой результат принимается как ошибка переполнения
+	failed := taskResult.Error != "" && taskResult.Error != "nil"
+	if !failed && (math.IsInf(req.Result, 0) || math.IsNaN(req.Result)) {
+		logger.Warn(ctx, "Результат задачи не является конечным числом")
+		taskResult.Result = 0
+		taskResult.Error = "overflow"
 	}
 
-	// Обрабатываем результат через оркестратор
-	err := orchestrator.ProcessExpressionResult(taskResult)
+	// Принимаем результат только от текущего владельца аренды; аренда снимается
+	// в одной транзакции с обработкой результата
+	err := orchestrator.ProcessLeasedResult(ctx, taskResult, req.LeaseId)
 	if err != nil {
-		logger.LogERROR("Ошибка обработки результата: " + err.Error())
+		dispatches.forget(req.LeaseId, "rejected")
+		if errors.Is(err, db.ErrLeaseNotHeld) {
+			// Выражение отменено пользователем, пока агент вычислял операцию
+			if op, opErr := db.GetOperationByID(int64(req.Id)); opErr == nil && op.Status == db.StatusCanceled {
+				logger.Info(ctx, "Результат задачи отброшен: операция отменена")
+				return &proto.TaskResultResponse{
+					Success: false,
+					Error:   orchestrator.ErrOperationCanceled.Error(),
+				}, nil
+			}
+			logger.Warn(ctx, "Результат задачи отклонен: аренда истекла или передана другому агенту",
+				"agent_id", agentIdentity(ctx, req.AgentId))
+			return &proto.TaskResultResponse{
+				Success: false,
+				Error:   ErrLeaseReassigned.Error(),
+			}, nil
+		}
+		logger.Error(ctx, "Ошибка обработки результата", "error", err)
 		return &proto.TaskResultResponse{
 			Success: false,
 			Error:   err.Error(),
 		}, nil
 	}
 
+	dispatches.finish(req.LeaseId, time.Now())
+
+	failed = taskResult.Error != "nil" && taskResult.Error != ""
+	if err := orchestrator.RecordAgentTask(agentIdentity(ctx, req.AgentId), failed); err != nil {
+		logger.Error(ctx, "Failed to record agent task", "error", err)
+	}
+
 	return &proto.TaskResultResponse{
 		Success: true,
 		Error:   "",
 	}, nil
 }
 
+// ReleaseTask возвращает в очередь задачу, которую агент получил, но не начал выполнять
+func (s *OrchestratorService) ReleaseTask(ctx context.Context, req *proto.ReleaseTaskRequest) (*proto.ReleaseTaskResponse, error) {
+	ctx = logger.With(ctx, logger.KeyOperationID, req.Id)
+	logger.Info(ctx, "gRPC: Агент возвращает задачу", "agent_id", agentIdentity(ctx, req.AgentId))
+
+	dispatches.forget(req.LeaseId, "released")
+	err := orchestrator.ReturnOperation(int64(req.Id), req.LeaseId)
+	if err != nil {
+		logger.Error(ctx, "Failed to return task", "error", err)
+		if errors.Is(err, db.ErrLeaseNotHeld) {
+			return &proto.ReleaseTaskResponse{
+				Success: false,
+				Error:   ErrLeaseReassigned.Error(),
+			}, nil
+		}
+		return &proto.ReleaseTaskResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	return &proto.ReleaseTaskResponse{
+		Success: true,
+	}, nil
+}
+
+// RegisterAgent регистрирует агента и сообщает ему период Heartbeat
+func (s *OrchestratorService) RegisterAgent(ctx context.Context, req *proto.RegisterAgentRequest) (*proto.RegisterAgentResponse, error) {
+	err := orchestrator.RegisterAgent(&db.Agent{
+		ID:             agentIdentity(ctx, req.AgentId),
+		Hostname:       req.Hostname,
+		ComputingPower: int(req.ComputingPower),
+		Version:        req.Version,
+	})
+	if err != nil {
+		logger.Error(ctx, "Failed to register agent", "error", err)
+		return &proto.RegisterAgentResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	return &proto.RegisterAgentResponse{
+		Success:             true,
+		HeartbeatIntervalMs: config.AppConfig.AgentHeartbeatInterval.Milliseconds(),
+	}, nil
+}
+
+// Heartbeat отмечает, что агент работает
+func (s *OrchestratorService) Heartbeat(ctx context.Context, req *proto.HeartbeatRequest) (*proto.HeartbeatResponse, error) {
+	registered, err := orchestrator.AgentHeartbeat(agentIdentity(ctx, req.AgentId))
+	if err != nil {
+		logger.Error(ctx, "Failed to record agent heartbeat", "error", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &proto.HeartbeatResponse{
+		Registered: registered,
+	}, nil
+}
+
+// operationTime возвращает время выполнения операции по оператору или виду операции.
+// Унарный минус вычисляется за время вычитания, функции — за TimeFunction
+func operationTime(op *db.Operation) time.Duration {
+	if op.Kind == db.KindFunction {
+		return config.AppConfig.TimeFunction
+	}
+
+	switch op.Operator {
+	case "+":
+		return config.AppConfig.TimeAddition
+	case "-":
+		return config.AppConfig.TimeSubtraction
+	case "*":
+		return config.AppConfig.TimeMultiplication
+	case "/":
+		return config.AppConfig.TimeDivision
+	case "^":
+		return config.AppConfig.TimePower
+	case "%":
+		return config.AppConfig.TimeModulo
+	case "//":
+		return config.AppConfig.TimeIntDivision
+	default:
+		return config.AppConfig.TimeAddition
+	}
+}
+
+// operationKind преобразует вид операции из БД в вид операции протокола
+func operationKind(kind string) proto.OperationKind {
+	switch kind {
+	case db.KindUnary:
+		return proto.OperationKind_OPERATION_KIND_UNARY
+	case db.KindFunction:
+		return proto.OperationKind_OPERATION_KIND_FUNCTION
+	}
+	return proto.OperationKind_OPERATION_KIND_BINARY
+}
+
+// functionArgs возвращает значения аргументов готовой к выполнению функции
+func functionArgs(args []*float64) []float64 {
+	if args == nil {
+		return nil
+	}
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		if arg != nil {
+			values[i] = *arg
+		}
+	}
+	return values
+}
+
+// exactValue возвращает точное значение операнда или пустую строку, если его нет
+func exactValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// decimalPrecision возвращает число знаков операции режима decimal или 0
+func decimalPrecision(precision *int) int {
+	if precision == nil {
+		return 0
+	}
+	return *precision
+}
+
+// exactArgs преобразует точные аргументы функции для gRPC
+func exactArgs(args []*string) []string {
+	if args == nil {
+		return nil
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = exactValue(arg)
+	}
+	return values
+}
+
+// intervalValue возвращает интервальный операнд или nil, если его границ нет
+func intervalValue(lower, upper *float64) *proto.Interval {
+	if lower == nil || upper == nil {
+		return nil
+	}
+	return &proto.Interval{Lower: *lower, Upper: *upper}
+}
+
+// intervalArgs преобразует интервальные аргументы функции для gRPC
+func intervalArgs(lower, upper []*float64) []*proto.Interval {
+	if lower == nil || len(lower) != len(upper) {
+		return nil
+	}
+	values := make([]*proto.Interval, len(lower))
+	for i := range lower {
+		values[i] = intervalValue(lower[i], upper[i])
+		if values[i] == nil {
+			values[i] = &proto.Interval{}
+		}
+	}
+	return values
+}
+
+// agentIdentity возвращает идентификатор агента из запроса или адрес соединения,
+// если агент не передал свой идентификатор
+func agentIdentity(ctx context.Context, agentID string) string {
+	if agentID != "" {
+		return agentID
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
+
+// newLeaseID генерирует случайный идентификатор аренды
+func newLeaseID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Server — запущенный gRPC сервер оркестратора
+type Server struct {
+	*grpc.Server
+	service  *OrchestratorService
+	stopOnce sync.Once
+}
+
+// Shutdown останавливает сервер: новые вызовы не принимаются, потоки задач закрываются,
+// текущие вызовы (например, прием результатов) завершаются. Если ctx истекает раньше,
+// соединения закрываются принудительно и возвращается ошибка ctx
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.service.stopping)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
 // StartGRPCServer запускает gRPC сервер на указанном адресе и возвращает экземпляр сервера
-func StartGRPCServer(address string) (*grpc.Server, error) {
+func StartGRPCServer(address string) (*Server, error) {
 	// Создаем TCP слушатель
 	lis, err := net.Listen("tcp", address)
 	if err != nil {
 		return nil, err
 	}
 
-	s := grpc.NewServer()
+	service := &OrchestratorService{stopping: make(chan struct{})}
+	s := &Server{Server: grpc.NewServer(grpc.ChainUnaryInterceptor(metricsInterceptor, loggingInterceptor, tracingInterceptor)), service: service}
 
-	proto.RegisterTaskServiceServer(s, &OrchestratorService{})
+	proto.RegisterTaskServiceServer(s, service)
 
 	// Запускаем сервер
-	logger.INFO.Printf("gRPC оркестратор запущен на %s", address)
+	logger.Info(context.Background(), "gRPC оркестратор запущен", "address", address)
 
 	go func() {
 		if err := s.Serve(lis); err != nil && err != grpc.ErrServerStopped {
-			logger.ERROR.Fatalf("Ошибка запуска gRPC оркестратора: %v", err)
+			logger.Fatal(context.Background(), "Ошибка запуска gRPC оркестратора", "error", err)
 		}
 	}()
 
@@ -3,15 +3,27 @@ package grpc
 import (
 	"context"
 	"database/sql"
+	"log/slog"
+	"math"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/numeric"
+	"parallel-calculator/internal/orchestrator"
+	"parallel-calculator/internal/tracing"
 	"parallel-calculator/proto"
 
 	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // TestOrchestratorService_GetTask проверяет обработку запроса на получение задачи
@@ -122,6 +134,47 @@ func TestOrchestratorService_GetTask(t *testing.T) {
 			t.Errorf("Expected status to be %s, got %s", db.StatusProcessing, updatedOp.Status)
 		}
 	})
+
+	t.Run("Function task", func(t *testing.T) {
+		user, err := db.CreateUser("test_function_ops", "password")
+		if err != nil {
+			t.Fatalf("Failed to create test user: %v", err)
+		}
+
+		expr, err := db.CreateExpression(user.ID, "max(2, 7)")
+		if err != nil {
+			t.Fatalf("Failed to create test expression: %v", err)
+		}
+
+		leftValue, rightValue := 2.0, 7.0
+		op, err := db.CreateFunctionOperation(
+			expr.ID, nil, "max", []*float64{&leftValue, &rightValue}, true, nil, db.StatusReady,
+		)
+		if err != nil {
+			t.Fatalf("Failed to create test operation: %v", err)
+		}
+
+		resp, err := service.GetTask(context.Background(), &proto.GetTaskRequest{})
+		if err != nil {
+			t.Fatalf("GetTask failed: %v", err)
+		}
+
+		if !resp.HasTask || resp.Id != uint32(op.ID) {
+			t.Fatalf("Expected task ID %d, got %v", op.ID, resp)
+		}
+
+		if resp.Kind != proto.OperationKind_OPERATION_KIND_FUNCTION || resp.Operator != "max" {
+			t.Errorf("Expected function max, got %v %s", resp.Kind, resp.Operator)
+		}
+
+		if len(resp.Args) != 2 || resp.Args[0] != leftValue || resp.Args[1] != rightValue {
+			t.Errorf("Expected args [%v %v], got %v", leftValue, rightValue, resp.Args)
+		}
+
+		if resp.OperationTimeNs != int64(config.AppConfig.TimeFunction) {
+			t.Errorf("Expected operation time %v, got %v", config.AppConfig.TimeFunction, time.Duration(resp.OperationTimeNs))
+		}
+	})
 }
 
 // TestOrchestratorService_SendTaskResult проверяет обработку результатов задач
@@ -163,18 +216,22 @@ func TestOrchestratorService_SendTaskResult(t *testing.T) {
 			&rightValue,
 			true, // Корневая операция
 			nil,
-			db.StatusProcessing,
+			db.StatusReady,
 		)
 		if err != nil {
 			t.Fatalf("Failed to create test operation: %v", err)
 		}
+		if err := db.LeaseOperation(op.ID, "agent-1", "lease-result", time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to lease test operation: %v", err)
+		}
 
 		// Отправляем результат
 		result := 6.0 // 2 * 3 = 6
 		resp, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
-			Id:     uint32(op.ID),
-			Result: result,
-			Error:  "",
+			Id:      uint32(op.ID),
+			Result:  result,
+			Error:   "",
+			LeaseId: "lease-result",
 		})
 
 		if err != nil {
@@ -246,18 +303,22 @@ func TestOrchestratorService_SendTaskResult(t *testing.T) {
 			&rightValue,
 			true, // Корневая операция
 			nil,
-			db.StatusProcessing,
+			db.StatusReady,
 		)
 		if err != nil {
 			t.Fatalf("Failed to create test operation: %v", err)
 		}
+		if err := db.LeaseOperation(op.ID, "agent-1", "lease-result", time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to lease test operation: %v", err)
+		}
 
 		// Отправляем результат с ошибкой
 		errorMsg := "division by zero"
 		resp, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
-			Id:     uint32(op.ID),
-			Result: 0,
-			Error:  errorMsg,
+			Id:      uint32(op.ID),
+			Result:  0,
+			Error:   errorMsg,
+			LeaseId: "lease-result",
 		})
 
 		if err != nil {
@@ -274,8 +335,8 @@ func TestOrchestratorService_SendTaskResult(t *testing.T) {
 			t.Fatalf("Failed to get updated operation: %v", err)
 		}
 
-		if updatedOp.Status != db.StatusCanceled {
-			t.Errorf("Expected status to be %s, got %s", db.StatusCanceled, updatedOp.Status)
+		if updatedOp.Status != db.StatusError {
+			t.Errorf("Expected status to be %s, got %s", db.StatusError, updatedOp.Status)
 		}
 
 		// Проверяем, что выражение обновилось со статусом ошибки
@@ -296,6 +357,147 @@ func TestOrchestratorService_SendTaskResult(t *testing.T) {
 			t.Errorf("Expected expression error message '%s', got '%s'", errorMsg, *updatedExpr.ErrorMessage)
 		}
 	})
+	t.Run("Infinite result", func(t *testing.T) {
+		user, err := db.CreateUser("test_overflow", "password")
+		if err != nil {
+			t.Fatalf("Failed to create test user: %v", err)
+		}
+
+		expr, err := db.CreateExpression(user.ID, "10^400")
+		if err != nil {
+			t.Fatalf("Failed to create test expression: %v", err)
+		}
+
+		leftValue := 10.0
+		rightValue := 400.0
+		op, err := db.CreateOperation(expr.ID, nil, "^", &leftValue, &rightValue, true, nil, db.StatusReady)
+		if err != nil {
+			t.Fatalf("Failed to create test operation: %v", err)
+		}
+		if err := db.LeaseOperation(op.ID, "agent-1", "lease-overflow", time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to lease test operation: %v", err)
+		}
+
+		// Агент старой версии присылает +Inf без ошибки
+		resp, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
+			Id:      uint32(op.ID),
+			Result:  math.Inf(1),
+			Error:   "nil",
+			LeaseId: "lease-overflow",
+		})
+		if err != nil || !resp.Success {
+			t.Fatalf("SendTaskResult() = %v, %v, want success", resp, err)
+		}
+
+		updatedExpr, err := db.GetExpressionByID(expr.ID)
+		if err != nil {
+			t.Fatalf("Failed to get updated expression: %v", err)
+		}
+		if updatedExpr.Status != db.StatusError || updatedExpr.Result != nil {
+			t.Errorf("Expression = %+v, want error without result", updatedExpr)
+		}
+		if updatedExpr.ErrorMessage == nil || *updatedExpr.ErrorMessage != "overflow" {
+			t.Errorf("Expression error message = %v, want overflow", updatedExpr.ErrorMessage)
+		}
+	})
+}
+
+// TestOrchestratorService_LeaseReassigned проверяет отклонение результата по переданной другому агенту аренде
+func TestOrchestratorService_LeaseReassigned(t *testing.T) {
+	// Инициализируем конфигурацию
+	config.InitConfig("../../.env")
+
+	// Инициализируем тестовую базу данных в памяти
+	db.DB, _ = sql.Open("sqlite3", "file:memdb1?mode=memory&cache=shared")
+	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
+
+	defer db.CloseDB()
+
+	// Убираем операции, оставшиеся от предыдущих тестов
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	service := &OrchestratorService{}
+
+	user, err := db.CreateUser("test_lease", "password")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := db.CreateExpression(user.ID, "4-1")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	leftValue := 4.0
+	rightValue := 1.0
+	op, err := db.CreateOperation(expr.ID, nil, "-", &leftValue, &rightValue, true, nil, db.StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create test operation: %v", err)
+	}
+
+	// Первый агент получает задачу
+	first, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+	if err != nil || !first.HasTask || first.Id != uint32(op.ID) {
+		t.Fatalf("Expected agent-1 to lease operation %d, got %v (err %v)", op.ID, first, err)
+	}
+	if first.LeaseId == "" {
+		t.Fatal("Expected lease id in task response")
+	}
+
+	// Аренда истекает, операция возвращается в очередь и достается второму агенту
+	if _, err := db.RequeueExpiredLeases(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to requeue expired leases: %v", err)
+	}
+	second, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-2"})
+	if err != nil || !second.HasTask || second.Id != uint32(op.ID) {
+		t.Fatalf("Expected agent-2 to lease operation %d, got %v (err %v)", op.ID, second, err)
+	}
+
+	lease, err := db.GetOperationLease(op.ID)
+	if err != nil {
+		t.Fatalf("Failed to get operation lease: %v", err)
+	}
+	if lease.Owner != "agent-2" {
+		t.Errorf("Expected lease owner agent-2, got %s", lease.Owner)
+	}
+
+	// Опоздавший результат первого агента отклоняется
+	resp, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
+		Id:      first.Id,
+		Result:  3,
+		AgentId: "agent-1",
+		LeaseId: first.LeaseId,
+	})
+	if err != nil {
+		t.Fatalf("SendTaskResult failed: %v", err)
+	}
+	if resp.Success {
+		t.Error("Expected result from reassigned lease to be rejected")
+	}
+
+	// Результат текущего владельца принимается
+	resp, err = service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
+		Id:      second.Id,
+		Result:  3,
+		AgentId: "agent-2",
+		LeaseId: second.LeaseId,
+	})
+	if err != nil {
+		t.Fatalf("SendTaskResult failed: %v", err)
+	}
+	if !resp.Success {
+		t.Errorf("Expected success for current lease owner, got error: %s", resp.Error)
+	}
+
+	updatedExpr, err := db.GetExpressionByID(expr.ID)
+	if err != nil {
+		t.Fatalf("Failed to get updated expression: %v", err)
+	}
+	if updatedExpr.Status != db.StatusCompleted {
+		t.Errorf("Expected expression status to be %s, got %s", db.StatusCompleted, updatedExpr.Status)
+	}
 }
 
 // TestStartGRPCServer проверяет запуск gRPC сервера
@@ -323,3 +525,587 @@ func TestStartGRPCServer(t *testing.T) {
 	// Даем время на graceful shutdown
 	time.Sleep(100 * time.Millisecond)
 }
+
+// TestOrchestratorService_CanceledResultDiscarded проверяет, что результат отмененной операции не попадает в родителя
+func TestOrchestratorService_CanceledResultDiscarded(t *testing.T) {
+	// Инициализируем конфигурацию
+	config.InitConfig("../../.env")
+
+	// Инициализируем тестовую базу данных в памяти
+	db.DB, _ = sql.Open("sqlite3", "file:memdb1?mode=memory&cache=shared")
+	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
+
+	defer db.CloseDB()
+
+	// Убираем операции, оставшиеся от предыдущих тестов
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	service := &OrchestratorService{}
+
+	user, err := db.CreateUser("test_cancel", "password")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	expr, err := db.CreateExpression(user.ID, "(4-1)*2")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	rightValue := 2.0
+	root, err := db.CreateOperation(expr.ID, nil, "*", nil, &rightValue, true, nil, db.StatusPending)
+	if err != nil {
+		t.Fatalf("Failed to create root operation: %v", err)
+	}
+
+	leftValue := 4.0
+	childRight := 1.0
+	position := "left"
+	child, err := db.CreateOperation(expr.ID, &root.ID, "-", &leftValue, &childRight, false, &position, db.StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create child operation: %v", err)
+	}
+
+	task, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+	if err != nil || !task.HasTask || task.Id != uint32(child.ID) {
+		t.Fatalf("Expected agent-1 to lease operation %d, got %v (err %v)", child.ID, task, err)
+	}
+
+	// Пользователь отменяет выражение, пока агент вычисляет операцию
+	if err := orchestrator.CancelExpression(expr.ID); err != nil {
+		t.Fatalf("CancelExpression failed: %v", err)
+	}
+
+	resp, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
+		Id:      task.Id,
+		Result:  3,
+		AgentId: "agent-1",
+		LeaseId: task.LeaseId,
+	})
+	if err != nil {
+		t.Fatalf("SendTaskResult failed: %v", err)
+	}
+	if resp.Success || resp.Error != orchestrator.ErrOperationCanceled.Error() {
+		t.Errorf("Expected result to be discarded with %q, got %+v", orchestrator.ErrOperationCanceled, resp)
+	}
+
+	parent, err := db.GetOperationByID(root.ID)
+	if err != nil {
+		t.Fatalf("Failed to get root operation: %v", err)
+	}
+	if parent.Status != db.StatusCanceled || parent.LeftValue != nil {
+		t.Errorf("Expected canceled root without left value, got status %s, left %v", parent.Status, parent.LeftValue)
+	}
+
+	updatedExpr, err := db.GetExpressionByID(expr.ID)
+	if err != nil {
+		t.Fatalf("Failed to get expression: %v", err)
+	}
+	if updatedExpr.Status != db.StatusCanceled {
+		t.Errorf("Expected expression status %s, got %s", db.StatusCanceled, updatedExpr.Status)
+	}
+}
+
+// TestOrchestratorService_AgentRegistry проверяет регистрацию агентов, Heartbeat и учет выполненных задач
+func TestOrchestratorService_AgentRegistry(t *testing.T) {
+	// Инициализируем конфигурацию
+	config.InitConfig("../../.env")
+
+	// Инициализируем тестовую базу данных в памяти
+	db.DB, _ = sql.Open("sqlite3", "file:memdb1?mode=memory&cache=shared")
+	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
+
+	defer db.CloseDB()
+
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	service := &OrchestratorService{}
+
+	// Агент, не прошедший регистрацию, должен зарегистрироваться
+	hb, err := service.Heartbeat(context.Background(), &proto.HeartbeatRequest{AgentId: "agent-1"})
+	if err != nil || hb.Registered {
+		t.Fatalf("Expected unregistered agent, got %v (err %v)", hb, err)
+	}
+
+	reg, err := service.RegisterAgent(context.Background(), &proto.RegisterAgentRequest{
+		AgentId:        "agent-1",
+		Hostname:       "host-1",
+		ComputingPower: 3,
+		Version:        "1.0",
+	})
+	if err != nil || !reg.Success {
+		t.Fatalf("RegisterAgent failed: %v (err %v)", reg, err)
+	}
+	if reg.HeartbeatIntervalMs != config.AppConfig.AgentHeartbeatInterval.Milliseconds() {
+		t.Errorf("Expected heartbeat interval %v, got %d ms", config.AppConfig.AgentHeartbeatInterval, reg.HeartbeatIntervalMs)
+	}
+
+	hb, err = service.Heartbeat(context.Background(), &proto.HeartbeatRequest{AgentId: "agent-1"})
+	if err != nil || !hb.Registered {
+		t.Fatalf("Expected registered agent, got %v (err %v)", hb, err)
+	}
+
+	// Принятые результаты учитываются за агентом
+	user, err := db.CreateUser("test_agents", "password")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	for _, expression := range []string{"1+2", "1/0"} {
+		if _, err := orchestrator.ProcessExpression(expression, user.ID); err != nil {
+			t.Fatalf("Failed to process expression %s: %v", expression, err)
+		}
+
+		task, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+		if err != nil || !task.HasTask {
+			t.Fatalf("Expected task for %s, got %v (err %v)", expression, task, err)
+		}
+
+		resultErr := "nil"
+		if task.RightValue == 0 {
+			resultErr = "division by zero"
+		}
+
+		resp, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
+			Id:      task.Id,
+			Result:  task.LeftValue + task.RightValue,
+			Error:   resultErr,
+			AgentId: "agent-1",
+			LeaseId: task.LeaseId,
+		})
+		if err != nil || !resp.Success {
+			t.Fatalf("SendTaskResult failed: %v (err %v)", resp, err)
+		}
+	}
+
+	agents, err := db.GetAgents()
+	if err != nil || len(agents) != 1 {
+		t.Fatalf("Expected one agent, got %d (err %v)", len(agents), err)
+	}
+
+	agent := agents[0]
+	if agent.ID != "agent-1" || agent.Hostname != "host-1" || agent.ComputingPower != 3 || agent.Version != "1.0" {
+		t.Errorf("Unexpected agent: %+v", agent)
+	}
+	if agent.TasksCompleted != 1 || agent.TasksFailed != 1 {
+		t.Errorf("Expected 1 completed and 1 failed task, got %d/%d", agent.TasksCompleted, agent.TasksFailed)
+	}
+}
+
+// TestServerMetrics проверяет учет длительности вызовов и времени от передачи операции до результата
+func TestServerMetrics(t *testing.T) {
+	config.InitConfig("../../.env")
+
+	db.DB, _ = sql.Open("sqlite3", "file:memdb1?mode=memory&cache=shared")
+	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
+
+	defer db.CloseDB()
+
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	// Длительность вызова учитывается по имени метода и коду ответа
+	info := &grpc.UnaryServerInfo{FullMethod: "/calculator.TaskService/Heartbeat"}
+	before := grpcRequestDuration.Count("Heartbeat", "NotFound")
+	_, err := metricsInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Interceptor changed error: %v", err)
+	}
+	if got := grpcRequestDuration.Count("Heartbeat", "NotFound") - before; got != 1 {
+		t.Errorf("Expected 1 observation for Heartbeat/NotFound, got %d", got)
+	}
+
+	user, err := db.CreateUser("test_metrics", "password")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	service := &OrchestratorService{}
+	before = dispatchToResult.Count("*")
+
+	// Возвращенная в очередь операция не учитывается, принятый результат — учитывается
+	if _, err := orchestrator.ProcessExpression("6*7", user.ID); err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	task, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+	if err != nil || !task.HasTask {
+		t.Fatalf("Expected task, got %v (err %v)", task, err)
+	}
+	releasedLease := task.LeaseId
+	release, err := service.ReleaseTask(context.Background(), &proto.ReleaseTaskRequest{
+		Id:      task.Id,
+		AgentId: "agent-1",
+		LeaseId: task.LeaseId,
+	})
+	if err != nil || !release.Success {
+		t.Fatalf("ReleaseTask failed: %v (err %v)", release, err)
+	}
+
+	task, err = service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+	if err != nil || !task.HasTask {
+		t.Fatalf("Expected task after release, got %v (err %v)", task, err)
+	}
+	resp, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
+		Id:      task.Id,
+		Result:  42,
+		Error:   "nil",
+		AgentId: "agent-1",
+		LeaseId: task.LeaseId,
+	})
+	if err != nil || !resp.Success {
+		t.Fatalf("SendTaskResult failed: %v (err %v)", resp, err)
+	}
+
+	if got := dispatchToResult.Count("*") - before; got != 1 {
+		t.Errorf("Expected 1 dispatch-to-result observation for *, got %d", got)
+	}
+
+	dispatches.mu.Lock()
+	_, releasedPending := dispatches.pending[releasedLease]
+	_, completedPending := dispatches.pending[task.LeaseId]
+	dispatches.mu.Unlock()
+	if releasedPending || completedPending {
+		t.Error("Expected released and completed dispatches to be forgotten")
+	}
+}
+
+// TestDispatchTrackerSweep проверяет, что устаревшие передачи забываются не чаще раза в dispatchSweepInterval
+func TestDispatchTrackerSweep(t *testing.T) {
+	tracker := &dispatchTracker{pending: make(map[string]dispatch)}
+	start := time.Now()
+
+	tracker.record("old", "+", start, nil)
+	// Операция уже устарела, но с последнего поиска прошло меньше dispatchSweepInterval
+	expired := start.Add(dispatchTTL + time.Second)
+	tracker.lastSweep = expired.Add(-dispatchSweepInterval / 2)
+	tracker.record("new", "+", expired, nil)
+	if _, ok := tracker.pending["old"]; !ok {
+		t.Error("Expected expired dispatch to be kept until the next sweep")
+	}
+
+	tracker.record("newer", "+", expired.Add(dispatchSweepInterval), nil)
+	if _, ok := tracker.pending["old"]; ok {
+		t.Error("Expected expired dispatch to be forgotten by the sweep")
+	}
+	if len(tracker.pending) != 2 {
+		t.Errorf("Expected 2 pending dispatches, got %d", len(tracker.pending))
+	}
+}
+
+// TestLogFieldsPropagation проверяет, что поля журнала выражения передаются агенту вместе с задачей
+// и возвращаются оркестратору в метаданных вызова
+func TestLogFieldsPropagation(t *testing.T) {
+	config.InitConfig("../../.env")
+
+	db.DB, _ = sql.Open("sqlite3", "file:memdb1?mode=memory&cache=shared")
+	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
+
+	defer db.CloseDB()
+
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	user, err := db.CreateUser("test_log_fields", "password")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	ctx := logger.With(context.Background(), logger.KeyRequestID, "req-42")
+	exprID, err := orchestrator.ProcessExpressionContext(ctx, "6*7", user.ID, "")
+	if err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	service := &OrchestratorService{}
+	resp, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+	if err != nil || !resp.HasTask {
+		t.Fatalf("Expected task, got %v (err %v)", resp, err)
+	}
+	if resp.RequestId != "req-42" || resp.UserId != user.ID || resp.ExpressionId != *exprID {
+		t.Fatalf("Unexpected log fields in task: request_id=%q user_id=%d expression_id=%d",
+			resp.RequestId, resp.UserId, resp.ExpressionId)
+	}
+
+	// Агент передает поля задачи в метаданных, оркестратор добавляет их в контекст вызова
+	task := taskFromResponse(resp)
+	md, _ := metadata.FromOutgoingContext(task.logOf().outgoing(context.Background()))
+
+	var fields []slog.Attr
+	_, err = loggingInterceptor(metadata.NewIncomingContext(context.Background(), md), nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req any) (any, error) {
+			fields = logger.Fields(ctx)
+			return nil, nil
+		})
+	if err != nil {
+		t.Fatalf("Interceptor returned error: %v", err)
+	}
+
+	expected := map[string]string{
+		logger.KeyRequestID:    "req-42",
+		logger.KeyUserID:       strconv.FormatInt(user.ID, 10),
+		logger.KeyExpressionID: strconv.FormatInt(*exprID, 10),
+		logger.KeyOperationID:  strconv.FormatUint(uint64(resp.Id), 10),
+	}
+	got := make(map[string]string)
+	for _, field := range fields {
+		got[field.Key] = field.Value.String()
+	}
+	for key, want := range expected {
+		if got[key] != want {
+			t.Errorf("Field %s = %q, want %q", key, got[key], want)
+		}
+	}
+}
+
+// TestRationalTaskRoundTrip проверяет передачу точных операндов агенту и точного результата оркестратору
+func TestRationalTaskRoundTrip(t *testing.T) {
+	config.InitConfig("../../.env")
+
+	db.DB, _ = sql.Open("sqlite3", "file:memdb1?mode=memory&cache=shared")
+	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
+
+	defer db.CloseDB()
+
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	user, err := db.CreateUser("test_rational_task", "password")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "max(0.1, 1e-1, 2.5e-1)", user.ID,
+		orchestrator.ExpressionOptions{Mode: "rational"})
+	if err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	service := &OrchestratorService{}
+	resp, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+	if err != nil || !resp.HasTask {
+		t.Fatalf("Expected task, got %v (err %v)", resp, err)
+	}
+	task := taskFromResponse(resp)
+	if task.Mode != "rational" || len(task.ArgsExact) != 3 || task.ArgsExact[2] != "1/4" || task.Args[2] != 0.25 {
+		t.Fatalf("Unexpected rational task: mode=%q args_exact=%v args=%v", task.Mode, task.ArgsExact, task.Args)
+	}
+
+	result, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
+		Id:          resp.Id,
+		Result:      0.25,
+		Error:       "nil",
+		AgentId:     "agent-1",
+		LeaseId:     resp.LeaseId,
+		ExactResult: "2/8",
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("SendTaskResult() = %v, %v", result, err)
+	}
+
+	expr, err := db.GetExpressionByID(*exprID)
+	if err != nil {
+		t.Fatalf("Failed to get expression: %v", err)
+	}
+	if expr.Status != db.StatusCompleted || expr.ExactResult == nil || *expr.ExactResult != "1/4" {
+		t.Errorf("Expression = %s %v, want completed with exact result 1/4", expr.Status, expr.ExactResult)
+	}
+}
+
+// spanRecorder запоминает экспортированные спаны
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(service string, spans []tracing.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Close() error {
+	return nil
+}
+
+// TestIntervalTaskRoundTrip проверяет передачу границ операндов и результата в режиме interval
+func TestIntervalTaskRoundTrip(t *testing.T) {
+	config.InitConfig("../../.env")
+
+	db.DB, _ = sql.Open("sqlite3", "file:memdb1?mode=memory&cache=shared")
+	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
+
+	defer db.CloseDB()
+
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	user, err := db.CreateUser("test_interval_task", "password")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "[1, 2] / (4 ± 1)", user.ID,
+		orchestrator.ExpressionOptions{Mode: "interval"})
+	if err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	service := &OrchestratorService{}
+	resp, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+	if err != nil || !resp.HasTask {
+		t.Fatalf("Expected task, got %v (err %v)", resp, err)
+	}
+	task := taskFromResponse(resp)
+	if task.Mode != "interval" || task.LeftInterval == nil || *task.LeftInterval != (numeric.Interval{Lower: 1, Upper: 2}) ||
+		task.RightInterval == nil || *task.RightInterval != (numeric.Interval{Lower: 3, Upper: 5}) {
+		t.Fatalf("Unexpected interval task: mode=%q left=%v right=%v", task.Mode, task.LeftInterval, task.RightInterval)
+	}
+
+	result, err := service.SendTaskResult(context.Background(), &proto.TaskResultRequest{
+		Id:             resp.Id,
+		Result:         0.4,
+		Error:          "nil",
+		AgentId:        "agent-1",
+		LeaseId:        resp.LeaseId,
+		IntervalResult: &proto.Interval{Lower: 0.2, Upper: 2.0 / 3},
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("SendTaskResult() = %v, %v", result, err)
+	}
+
+	expr, err := db.GetExpressionByID(*exprID)
+	if err != nil {
+		t.Fatalf("Failed to get expression: %v", err)
+	}
+	if expr.Status != db.StatusCompleted || expr.ResultLower == nil || *expr.ResultLower != 0.2 ||
+		expr.ResultUpper == nil || *expr.ResultUpper != 2.0/3 {
+		t.Errorf("Expression = %s %v..%v, want completed 0.2..2/3", expr.Status, expr.ResultLower, expr.ResultUpper)
+	}
+}
+
+// TestTracePropagation проверяет, что выдача задачи, ее выполнение агентом и обработка результата
+// попадают в трассу запроса /calculate
+func TestTracePropagation(t *testing.T) {
+	config.InitConfig("../../.env")
+
+	db.DB, _ = sql.Open("sqlite3", "file:memdb1?mode=memory&cache=shared")
+	db.ApplySchema(filepath.Join("../../internal/db", "schema.sql"))
+
+	defer db.CloseDB()
+
+	if err := db.CleanupDB(); err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	recorder := &spanRecorder{}
+	stopTracing := tracing.Init("test", recorder)
+	defer stopTracing(context.Background())
+
+	user, err := db.CreateUser("test_tracing", "password")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	ctx, root := tracing.Start(context.Background(), "POST /api/v1/calculate", tracing.WithKind(tracing.SpanKindServer))
+	if _, err := orchestrator.ProcessExpressionContext(ctx, "6*7", user.ID, ""); err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+	root.End()
+
+	service := &OrchestratorService{}
+	resp, err := service.GetTask(context.Background(), &proto.GetTaskRequest{AgentId: "agent-1"})
+	if err != nil || !resp.HasTask {
+		t.Fatalf("Expected task, got %v (err %v)", resp, err)
+	}
+
+	// Агент выполняет задачу в спане, дочернем к выдаче, и отправляет результат с его контекстом
+	workerCtx, worker := tracing.Start(tracing.ContextWithTraceparent(context.Background(), resp.Traceparent),
+		"execute operation", tracing.WithKind(tracing.SpanKindConsumer))
+	callCtx, call := startClientSpan(workerCtx, proto.TaskService_SendTaskResult_FullMethodName, tracing.Traceparent(workerCtx))
+	md, _ := metadata.FromOutgoingContext(callCtx)
+
+	info := &grpc.UnaryServerInfo{FullMethod: proto.TaskService_SendTaskResult_FullMethodName}
+	_, err = tracingInterceptor(metadata.NewIncomingContext(context.Background(), md), nil, info,
+		func(ctx context.Context, req any) (any, error) {
+			return service.SendTaskResult(ctx, &proto.TaskResultRequest{
+				Id:      resp.Id,
+				Result:  42,
+				Error:   "nil",
+				LeaseId: resp.LeaseId,
+			})
+		})
+	if err != nil {
+		t.Fatalf("Interceptor returned error: %v", err)
+	}
+	call.End()
+	worker.End()
+
+	if err := stopTracing(context.Background()); err != nil {
+		t.Fatalf("Failed to stop tracing: %v", err)
+	}
+
+	spans := make(map[string]tracing.SpanData)
+	for _, span := range recorder.spans {
+		if span.SpanContext.TraceID != root.SpanContext().TraceID {
+			t.Errorf("Span %q belongs to another trace", span.Name)
+		}
+		spans[span.Name] = span
+	}
+
+	// Клиентский и серверный спаны вызова SendTaskResult называются одинаково
+	method := proto.TaskService_SendTaskResult_FullMethodName[1:]
+	var client, server tracing.SpanData
+	for _, span := range recorder.spans {
+		if span.Name != method {
+			continue
+		}
+		if span.Kind == tracing.SpanKindClient {
+			client = span
+		} else {
+			server = span
+		}
+	}
+	if client.Parent != spans["execute operation"].SpanContext.SpanID || server.Parent != client.SpanContext.SpanID {
+		t.Errorf("SendTaskResult spans are not linked: client %+v, server %+v", client, server)
+	}
+	spans[method] = server
+
+	// Родитель каждого спана в цепочке от запроса до обработки результата
+	parents := map[string]string{
+		"ProcessExpression":       "POST /api/v1/calculate",
+		"parse":                   "ProcessExpression",
+		"ParseAST":                "ProcessExpression",
+		"db.InsertExpression":     "ProcessExpression",
+		"dispatch operation":      "ProcessExpression",
+		"execute operation":       "dispatch operation",
+		"ProcessExpressionResult": method,
+		"db.SetOperationResult":   "ProcessExpressionResult",
+		"db.FinalizeExpression":   "ProcessExpressionResult",
+	}
+	for name, parent := range parents {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("Span %q not exported", name)
+			continue
+		}
+		if span.Parent != spans[parent].SpanContext.SpanID {
+			t.Errorf("Span %q is not a child of %q", name, parent)
+		}
+	}
+
+	if spans["dispatch operation"].StatusCode == tracing.StatusError {
+		t.Errorf("Unexpected dispatch status: %q", spans["dispatch operation"].StatusMessage)
+	}
+}
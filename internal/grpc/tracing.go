@@ -0,0 +1,55 @@
+package grpc
+
+import (
+	"context"
+	"parallel-calculator/internal/tracing"
+	"path"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Ключ метаданных gRPC с контекстом спана вызывающей стороны (W3C traceparent)
+const metadataTraceparent = "traceparent"
+
+// tracingInterceptor создает серверный спан унарного вызова, дочерний к спану агента из метаданных.
+// Вызовы без traceparent (опрос задач, Heartbeat) не относятся к выражению и не трассируются
+func tracingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(metadataTraceparent)
+	if len(values) == 0 {
+		return handler(ctx, req)
+	}
+
+	ctx = tracing.ContextWithTraceparent(ctx, values[0])
+	if !tracing.SpanContextFromContext(ctx).IsValid() {
+		return handler(ctx, req)
+	}
+
+	ctx, span := tracing.Start(ctx, info.FullMethod[1:], tracing.WithKind(tracing.SpanKindServer), tracing.WithAttributes(
+		"rpc.system", "grpc",
+		"rpc.method", path.Base(info.FullMethod),
+	))
+	defer span.End()
+
+	resp, err := handler(ctx, req)
+	span.SetAttributes("rpc.grpc.status_code", status.Code(err).String())
+	span.RecordError(err)
+	return resp, err
+}
+
+// startClientSpan создает клиентский спан вызова fullMethod, дочерний к спану traceparent,
+// и добавляет его контекст в исходящие метаданные. Без traceparent вызов не трассируется
+func startClientSpan(ctx context.Context, fullMethod, traceparent string) (context.Context, *tracing.Span) {
+	parent := tracing.ContextWithTraceparent(ctx, traceparent)
+	if !tracing.SpanContextFromContext(parent).IsValid() {
+		return ctx, nil
+	}
+
+	ctx, span := tracing.Start(parent, fullMethod[1:], tracing.WithKind(tracing.SpanKindClient),
+		tracing.WithAttributes("rpc.system", "grpc", "rpc.method", path.Base(fullMethod)))
+
+	// При выключенной трассировке дальше передается контекст родителя
+	return metadata.AppendToOutgoingContext(ctx, metadataTraceparent, tracing.Traceparent(ctx)), span
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+// Ключи полей корреляции
+const (
+	KeyRequestID    = "request_id"
+	KeyUserID       = "user_id"
+	KeyExpressionID = "expression_id"
+	KeyOperationID  = "operation_id"
+)
+
+type fieldsKey struct{}
+
+// With возвращает контекст, записи с которым содержат поля args (пары ключ-значение или slog.Attr).
+// Поле с уже добавленным ключом заменяется
+func With(ctx context.Context, args ...any) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	fields := Fields(ctx)
+	for _, attr := range slog.Group("", args...).Value.Group() {
+		replaced := false
+		for i := range fields {
+			if fields[i].Key == attr.Key {
+				fields[i] = attr
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			fields = append(fields, attr)
+		}
+	}
+
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// Fields возвращает копию полей, добавленных в контекст через With
+func Fields(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]slog.Attr)
+	return append([]slog.Attr(nil), fields...)
+}
+
+// RequestID возвращает идентификатор запроса из контекста или пустую строку
+func RequestID(ctx context.Context) string {
+	for _, attr := range Fields(ctx) {
+		if attr.Key == KeyRequestID {
+			return attr.Value.String()
+		}
+	}
+	return ""
+}
+
+// NewRequestID создает случайный идентификатор запроса
+func NewRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// contextHandler добавляет к записи поля корреляции из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if fields := Fields(ctx); len(fields) > 0 {
+		r.AddAttrs(fields...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
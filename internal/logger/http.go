@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader — заголовок с идентификатором запроса. Если клиент передал корректный
+// идентификатор, он используется в журнале, иначе создается новый; ответ всегда содержит заголовок
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware добавляет в контекст запроса request_id и записывает в журнал итог каждого запроса
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := With(r.Context(), KeyRequestID, requestID)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		// Запись об итоге запроса не содержит user_id: его добавляет в контекст обработчика
+		// middleware аутентификации, а записи обработчика содержат оба поля
+		Info(ctx, "HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+// validRequestID допускает идентификаторы из печатных ASCII-символов длиной до 128
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder запоминает код ответа. Flush и Unwrap нужны потоку событий SSE
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *statusRecorder) Flush() {
+	r.wroteHeader = true
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -1,41 +1,120 @@
+// Package logger ведет структурированный журнал на основе log/slog.
+// Поля корреляции (request_id, user_id, expression_id, operation_id), добавленные в контекст
+// через With, автоматически попадают в каждую запись, сделанную с этим контекстом
 package logger
 
 import (
+	"context"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"parallel-calculator/internal/config"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
-	fileMutex sync.Mutex
-	INFO      *log.Logger
-	ERROR     *log.Logger
-	logFile   *os.File
+	fileMutex sync.Mutex // защищает logFile
+	logFile   *rotatingFile
+
+	// До инициализации записи пишутся в stderr в текстовом формате
+	current atomic.Pointer[slog.Logger]
 )
 
-func LogINFO(s string) {
-	if INFO == nil {
+func init() {
+	current.Store(slog.New(newHandler(os.Stderr, "text", slog.LevelInfo)))
+}
+
+// Debug пишет отладочную запись. args — пары ключ-значение или slog.Attr
+func Debug(ctx context.Context, msg string, args ...any) {
+	write(ctx, slog.LevelDebug, msg, args...)
+}
+
+// Info пишет информационную запись
+func Info(ctx context.Context, msg string, args ...any) {
+	write(ctx, slog.LevelInfo, msg, args...)
+}
+
+// Warn пишет предупреждение
+func Warn(ctx context.Context, msg string, args ...any) {
+	write(ctx, slog.LevelWarn, msg, args...)
+}
+
+// Error пишет запись об ошибке
+func Error(ctx context.Context, msg string, args ...any) {
+	write(ctx, slog.LevelError, msg, args...)
+}
+
+// Fatal пишет запись об ошибке и завершает процесс
+func Fatal(ctx context.Context, msg string, args ...any) {
+	write(ctx, slog.LevelError, msg, args...)
+	CloseLogger()
+	os.Exit(1)
+}
+
+// write создает запись с местом вызова функции логирования, а не этого пакета
+func write(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	l := current.Load()
+	if !l.Enabled(ctx, level) {
 		return
 	}
-	INFO.Println(s)
+
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // runtime.Callers, write, Info/Error/...
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	_ = l.Handler().Handle(ctx, r)
 }
 
-func LogERROR(s string) {
-	if ERROR == nil {
-		return
+// SetOutput направляет записи в w с форматом и уровнем из конфигурации (или text/info до ее загрузки)
+func SetOutput(w io.Writer) {
+	format, level := "text", slog.LevelInfo
+	if config.AppConfig != nil {
+		format, level = config.AppConfig.LogFormat, config.AppConfig.LogLevel
 	}
-	ERROR.Println(s)
+	current.Store(slog.New(newHandler(w, format, level)))
 }
 
-type lockedFile struct {
-	file *os.File
+// newHandler создает обработчик записей в формате format, добавляющий поля корреляции из контекста
+func newHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       level,
+		ReplaceAttr: shortSource,
+	}
+
+	if format == "json" {
+		return &contextHandler{slog.NewJSONHandler(w, opts)}
+	}
+	return &contextHandler{slog.NewTextHandler(w, opts)}
 }
 
-func (lf *lockedFile) Write(p []byte) (n int, err error) {
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
-	return lf.file.Write(p)
+// shortSource сокращает место вызова до имени файла и строки, как log.Lshortfile
+func shortSource(groups []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.SourceKey || len(groups) > 0 {
+		return a
+	}
+	if src, ok := a.Value.Any().(*slog.Source); ok {
+		a.Value = slog.StringValue(filepath.Base(src.File) + ":" + strconv.Itoa(src.Line))
+	}
+	return a
+}
+
+// output возвращает writer для записей: файл и, если включено LOG_STDOUT, стандартный вывод
+func output(file io.Writer) io.Writer {
+	if config.AppConfig.LogStdout {
+		return io.MultiWriter(file, os.Stdout)
+	}
+	return file
 }
 
 func InitAgentLogger() {
@@ -45,17 +124,7 @@ func InitAgentLogger() {
 		log.Fatal("agent log file path not set")
 	}
 
-	logFile, err := os.OpenFile(config.AgentLogFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		log.Printf("Failed to open log file: %v. We will use standard output", err)
-		INFO = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-		ERROR = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-		return
-	}
-
-	writer := &lockedFile{file: logFile}
-	INFO = log.New(writer, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ERROR = log.New(writer, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	initFileLogger(config.AgentLogFilePath)
 }
 
 func InitClientLogger() {
@@ -65,21 +134,52 @@ func InitClientLogger() {
 		log.Fatal("client log file path not set")
 	}
 
-	logFile, err := os.OpenFile(config.ClientLogFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	initFileLogger(config.ClientLogFilePath)
+}
+
+// initFileLogger направляет записи в файл path с ротацией по параметрам конфигурации
+func initFileLogger(path string) {
+	file, err := openRotatingFile(path, rotation{
+		maxSize:    int64(config.AppConfig.LogMaxSizeMB) << 20,
+		interval:   config.AppConfig.LogRotateInterval,
+		maxBackups: config.AppConfig.LogMaxBackups,
+		compress:   config.AppConfig.LogCompress,
+	})
 	if err != nil {
 		log.Printf("Failed to open log file: %v. We will use standard output", err)
-		INFO = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-		ERROR = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+		SetOutput(os.Stdout)
 		return
 	}
 
-	writer := &lockedFile{file: logFile}
-	INFO = log.New(writer, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ERROR = log.New(writer, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	fileMutex.Lock()
+	logFile = file
+	fileMutex.Unlock()
+
+	SetOutput(output(file))
+}
+
+// Reopen открывает файл журнала заново по тому же пути, например после того,
+// как внешний logrotate переместил его
+func Reopen() error {
+	fileMutex.Lock()
+	file := logFile
+	fileMutex.Unlock()
+
+	if file == nil {
+		return nil
+	}
+	return file.Reopen()
 }
 
+// CloseLogger закрывает файл журнала. Последующие записи направляются в stderr
 func CloseLogger() {
-	if logFile != nil {
-		logFile.Close()
+	fileMutex.Lock()
+	file := logFile
+	logFile = nil
+	fileMutex.Unlock()
+
+	if file != nil {
+		SetOutput(os.Stderr)
+		file.Close()
 	}
 }
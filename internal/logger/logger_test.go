@@ -0,0 +1,145 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureJSON направляет записи в буфер в формате JSON с уровнем level и восстанавливает логгер после теста
+func captureJSON(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+
+	prev := current.Load()
+	t.Cleanup(func() { current.Store(prev) })
+
+	var buf bytes.Buffer
+	current.Store(slog.New(newHandler(&buf, "json", level)))
+	return &buf
+}
+
+// records разбирает записи JSON из буфера
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var list []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid JSON record %q: %v", line, err)
+		}
+		list = append(list, record)
+	}
+	return list
+}
+
+// TestContextFields проверяет, что поля корреляции из контекста попадают в записи
+func TestContextFields(t *testing.T) {
+	buf := captureJSON(t, slog.LevelInfo)
+
+	ctx := With(context.Background(), KeyRequestID, "req-1", KeyUserID, int64(7))
+	ctx = With(ctx, KeyExpressionID, int64(42), KeyUserID, int64(8))
+	Info(ctx, "Expression created", "status", "pending")
+
+	list := records(t, buf)
+	if len(list) != 1 {
+		t.Fatalf("Expected 1 record, got %d: %s", len(list), buf.String())
+	}
+
+	record := list[0]
+	expected := map[string]any{
+		"msg":           "Expression created",
+		"level":         "INFO",
+		"status":        "pending",
+		KeyRequestID:    "req-1",
+		KeyUserID:       float64(8), // поле с тем же ключом заменяется
+		KeyExpressionID: float64(42),
+	}
+	for key, want := range expected {
+		if record[key] != want {
+			t.Errorf("Field %s = %v, want %v", key, record[key], want)
+		}
+	}
+
+	if source, _ := record["source"].(string); !strings.HasPrefix(source, "logger_test.go:") {
+		t.Errorf("Source = %q, want caller location in logger_test.go", record["source"])
+	}
+
+	if RequestID(ctx) != "req-1" {
+		t.Errorf("RequestID() = %q, want req-1", RequestID(ctx))
+	}
+}
+
+// TestLevel проверяет, что записи ниже заданного уровня отбрасываются
+func TestLevel(t *testing.T) {
+	buf := captureJSON(t, slog.LevelWarn)
+
+	Debug(context.Background(), "debug")
+	Info(context.Background(), "info")
+	Warn(context.Background(), "warn")
+	Error(context.Background(), "error")
+
+	list := records(t, buf)
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %s", len(list), buf.String())
+	}
+	if list[0]["msg"] != "warn" || list[1]["msg"] != "error" {
+		t.Errorf("Unexpected records: %v", list)
+	}
+}
+
+// TestMiddleware проверяет назначение request_id запросу и запись об итоге запроса
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		reuse    bool
+	}{
+		{name: "reuses client id", incoming: "client-request-1", reuse: true},
+		{name: "generates missing id", incoming: ""},
+		{name: "replaces invalid id", incoming: "bad id\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureJSON(t, slog.LevelInfo)
+
+			var handlerID string
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerID = RequestID(r.Context())
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			req := httptest.NewRequest("GET", "/api/v1/expressions", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			responseID := rr.Header().Get(RequestIDHeader)
+			if responseID == "" || responseID != handlerID {
+				t.Fatalf("Response id %q does not match handler id %q", responseID, handlerID)
+			}
+			if tt.reuse != (responseID == tt.incoming) {
+				t.Errorf("Response id = %q, incoming %q, reuse expected: %v", responseID, tt.incoming, tt.reuse)
+			}
+
+			list := records(t, buf)
+			if len(list) != 1 {
+				t.Fatalf("Expected 1 record, got %d: %s", len(list), buf.String())
+			}
+			if list[0][KeyRequestID] != responseID || list[0]["status"] != float64(http.StatusTeapot) {
+				t.Errorf("Unexpected request record: %v", list[0])
+			}
+		})
+	}
+}
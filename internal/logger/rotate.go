@@ -0,0 +1,310 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Формат времени ротации в имени ротированного файла (UTC)
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotation — параметры ротации файла журнала
+type rotation struct {
+	maxSize    int64         // размер файла в байтах, после которого он ротируется; 0 — без ограничения
+	interval   time.Duration // период ротации по времени; 0 — не ротировать по времени
+	maxBackups int           // число хранимых ротированных файлов; 0 — хранить все
+	compress   bool          // сжимать ротированные файлы gzip
+}
+
+// rotatingFile — файл журнала с ротацией по размеру и времени. Ротированный файл переименовывается
+// в <имя>-<время ротации><расширение>, затем в фоне сжимается, а самые старые ротированные файлы
+// сверх maxBackups удаляются. Границы периодов ротации по времени отсчитываются в UTC
+type rotatingFile struct {
+	path string
+	rotation
+	now func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time // начало периода ротации, в котором была сделана последняя запись
+	closed bool
+
+	millMu sync.Mutex // сжатие и удаление старых файлов выполняются по одному
+	millWG sync.WaitGroup
+}
+
+// openRotatingFile открывает файл журнала path для дозаписи
+func openRotatingFile(path string, r rotation) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, rotation: r, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open открывает файл path. Если последняя запись в существующий файл была сделана в прошлом периоде,
+// файл ротируется при следующей записи. Вызывается под f.mu
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.period = f.periodOf(info.ModTime())
+	return nil
+}
+
+// periodOf возвращает начало периода ротации по времени, которому принадлежит t
+func (f *rotatingFile) periodOf(t time.Time) time.Time {
+	if f.interval <= 0 {
+		return time.Time{}
+	}
+	return t.Truncate(f.interval)
+}
+
+// Write записывает p, предварительно ротируя файл, если запись превысит maxSize
+// или начался новый период. Если ротация не удалась, запись продолжается в текущий файл
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	now := f.now()
+	if f.shouldRotate(int64(len(p)), now) {
+		if err := f.rotate(now); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: rotate %s: %v\n", f.path, err)
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	f.period = f.periodOf(now)
+	return n, err
+}
+
+// shouldRotate сообщает, нужно ли ротировать файл перед записью n байт. Пустой файл не ротируется
+func (f *rotatingFile) shouldRotate(n int64, now time.Time) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+n > f.maxSize {
+		return true
+	}
+	return f.interval > 0 && !f.periodOf(now).Equal(f.period)
+}
+
+// rotate переименовывает текущий файл и открывает новый. Вызывается под f.mu
+func (f *rotatingFile) rotate(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	backup := f.backupName(now)
+	renameErr := os.Rename(f.path, backup)
+
+	// Если переименовать не удалось, запись продолжается в прежний файл
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	f.millWG.Add(1)
+	go f.mill(backup)
+	return nil
+}
+
+// backupName возвращает имя ротированного файла для времени ротации now
+func (f *rotatingFile) backupName(now time.Time) string {
+	dir, prefix, ext := f.nameParts()
+	name := filepath.Join(dir, prefix+now.UTC().Format(backupTimeFormat)+ext)
+
+	// Две ротации в одну миллисекунду не перезаписывают друг друга
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = filepath.Join(dir, fmt.Sprintf("%s%s-%d%s", prefix, now.UTC().Format(backupTimeFormat), i, ext))
+	}
+	return name
+}
+
+// nameParts разбивает путь файла журнала на каталог, префикс имен ротированных файлов и расширение
+func (f *rotatingFile) nameParts() (dir, prefix, ext string) {
+	base := filepath.Base(f.path)
+	ext = filepath.Ext(base)
+	return filepath.Dir(f.path), strings.TrimSuffix(base, ext) + "-", ext
+}
+
+func fileExists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// mill сжимает ротированный файл backup и удаляет ротированные файлы сверх maxBackups
+func (f *rotatingFile) mill(backup string) {
+	defer f.millWG.Done()
+
+	f.millMu.Lock()
+	defer f.millMu.Unlock()
+
+	if f.compress {
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: compress %s: %v\n", backup, err)
+		}
+	}
+
+	if err := f.removeOldBackups(); err != nil {
+		fmt.Fprintf(os.Stderr, "logger: remove old backups of %s: %v\n", f.path, err)
+	}
+}
+
+// backups возвращает ротированные файлы журнала, от новых к старым
+func (f *rotatingFile) backups() ([]string, error) {
+	dir, prefix, ext := f.nameParts()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimPrefix(name, prefix)
+		switch {
+		case strings.HasSuffix(stamp, ext+".gz"):
+			stamp = strings.TrimSuffix(stamp, ext+".gz")
+		case strings.HasSuffix(stamp, ext):
+			stamp = strings.TrimSuffix(stamp, ext)
+		default:
+			continue
+		}
+		if len(stamp) < len(backupTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, stamp[:len(backupTimeFormat)]); err != nil {
+			continue
+		}
+		names = append(names, filepath.Join(dir, name))
+	}
+
+	// Время ротации в имени упорядочивает файлы так же, как строки
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// removeOldBackups удаляет самые старые ротированные файлы сверх maxBackups
+func (f *rotatingFile) removeOldBackups() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+
+	names, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names[min(f.maxBackups, len(names)):] {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressFile сжимает файл name в name.gz и удаляет исходный файл
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Сжатый файл появляется под своим именем только целиком
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	src.Close()
+	return os.Remove(name)
+}
+
+// Reopen закрывает файл и открывает его заново по тому же пути. Нужен, когда внешняя ротация
+// (logrotate) переместила файл: дальнейшие записи попадут в новый файл
+func (f *rotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close закрывает файл и дожидается завершения сжатия и удаления старых файлов
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if !f.closed && f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.closed = true
+	f.mu.Unlock()
+
+	f.millWG.Wait()
+	return err
+}
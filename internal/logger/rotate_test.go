@@ -0,0 +1,165 @@
+package logger
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"parallel-calculator/internal/config"
+)
+
+// readFile возвращает содержимое файла журнала, распаковывая сжатые файлы
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", name, err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("Failed to read gzip %s: %v", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+// TestRotateBySize проверяет ротацию по размеру, сжатие ротированных файлов и их число
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+
+	f, err := openRotatingFile(path, rotation{maxSize: 10, maxBackups: 2, compress: true})
+	if err != nil {
+		t.Fatalf("openRotatingFile() error = %v", err)
+	}
+
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	f.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) error = %v", line, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if got := readFile(t, path); got != "fourth\n" {
+		t.Errorf("Current file = %q, want %q", got, "fourth\n")
+	}
+
+	// Каждая запись превышает лимит вместе с предыдущей: три ротации, самая старая удалена
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatalf("backups() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %v", backups)
+	}
+
+	for i, want := range []string{"third\n", "second\n"} {
+		if !strings.HasSuffix(backups[i], ".log.gz") {
+			t.Errorf("Backup %s is not compressed", backups[i])
+		}
+		if got := readFile(t, backups[i]); got != want {
+			t.Errorf("Backup %s = %q, want %q", backups[i], got, want)
+		}
+	}
+
+	if _, err := f.Write([]byte("late\n")); err != os.ErrClosed {
+		t.Errorf("Write() after Close error = %v, want %v", err, os.ErrClosed)
+	}
+}
+
+// TestRotateByInterval проверяет ротацию при наступлении нового периода
+func TestRotateByInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.log")
+
+	f, err := openRotatingFile(path, rotation{interval: time.Hour})
+	if err != nil {
+		t.Fatalf("openRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+
+	clock := time.Date(2026, 1, 2, 10, 30, 0, 0, time.UTC)
+	f.now = func() time.Time { return clock }
+
+	f.Write([]byte("10:30\n"))
+	clock = clock.Add(20 * time.Minute)
+	f.Write([]byte("10:50\n"))
+	clock = clock.Add(20 * time.Minute)
+	f.Write([]byte("11:10\n"))
+	f.millWG.Wait()
+
+	if got := readFile(t, path); got != "11:10\n" {
+		t.Errorf("Current file = %q, want %q", got, "11:10\n")
+	}
+
+	backup := filepath.Join(filepath.Dir(path), "client-2026-01-02T11-10-00.000.log")
+	if got := readFile(t, backup); got != "10:30\n10:50\n" {
+		t.Errorf("Backup = %q, want %q", got, "10:30\n10:50\n")
+	}
+}
+
+// TestLoggerReopenAndClose проверяет переоткрытие файла после внешней ротации и закрытие журнала
+func TestLoggerReopenAndClose(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+
+	prevConfig, prevLogger := config.AppConfig, current.Load()
+	t.Cleanup(func() {
+		config.AppConfig = prevConfig
+		current.Store(prevLogger)
+	})
+	config.AppConfig = &config.Config{AgentLogFilePath: path, LogFormat: "text"}
+
+	InitAgentLogger()
+	Info(context.Background(), "before logrotate")
+
+	// Внешний logrotate перемещает файл и отправляет SIGHUP
+	moved := filepath.Join(dir, "agent.log.1")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatalf("Failed to move log file: %v", err)
+	}
+	if err := Reopen(); err != nil {
+		t.Fatalf("Reopen() error = %v", err)
+	}
+	Info(context.Background(), "after logrotate")
+
+	file := logFile
+	CloseLogger()
+
+	if logFile != nil {
+		t.Error("Expected CloseLogger to reset log file")
+	}
+	if _, err := file.Write([]byte("x")); err != os.ErrClosed {
+		t.Errorf("Log file is not closed: write error = %v", err)
+	}
+
+	if got := readFile(t, moved); !strings.Contains(got, "before logrotate") || strings.Contains(got, "after logrotate") {
+		t.Errorf("Unexpected moved file content: %q", got)
+	}
+	if got := readFile(t, path); !strings.Contains(got, "after logrotate") {
+		t.Errorf("Unexpected reopened file content: %q", got)
+	}
+}
@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ReopenOnSIGHUP переоткрывает файл журнала при получении SIGHUP, чтобы внешний logrotate мог
+// переместить файл без перезапуска процесса. Возвращает функцию, прекращающую обработку сигнала
+func ReopenOnSIGHUP() func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				if err := Reopen(); err != nil {
+					Error(context.Background(), "Failed to reopen log file", "error", err)
+					continue
+				}
+				Info(context.Background(), "Log file reopened on SIGHUP")
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
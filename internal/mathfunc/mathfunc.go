@@ -0,0 +1,118 @@
+// Package mathfunc содержит встроенные функции калькулятора. Оркестратор проверяет
+// по реестру имя и число аргументов вызова, агент вычисляет функцию
+package mathfunc
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Ошибки области определения функций
+var (
+	ErrSqrtNegative   = errors.New("sqrt of negative number")
+	ErrLogNonPositive = errors.New("log of non-positive number")
+	ErrOverflow       = errors.New("overflow")
+)
+
+// Function описывает встроенную функцию. MaxArgs < 0 означает неограниченное число аргументов
+type Function struct {
+	Name    string
+	MinArgs int
+	MaxArgs int
+	Eval    func(args []float64) (float64, error)
+}
+
+// Разрешенные в выражениях функции
+var registry = map[string]*Function{
+	"sqrt": unary("sqrt", func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, ErrSqrtNegative
+		}
+		return math.Sqrt(x), nil
+	}),
+	"abs": unary("abs", pure(math.Abs)),
+	"sin": unary("sin", pure(math.Sin)),
+	"cos": unary("cos", pure(math.Cos)),
+	"tan": unary("tan", pure(math.Tan)),
+	"log": unary("log", func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, ErrLogNonPositive
+		}
+		return math.Log(x), nil
+	}),
+	"exp":   unary("exp", pure(math.Exp)),
+	"floor": unary("floor", pure(math.Floor)),
+	"ceil":  unary("ceil", pure(math.Ceil)),
+	"round": unary("round", pure(math.Round)),
+	"min": {Name: "min", MinArgs: 1, MaxArgs: -1, Eval: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	}},
+	"max": {Name: "max", MinArgs: 1, MaxArgs: -1, Eval: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	}},
+}
+
+// Lookup возвращает функцию по имени
+func Lookup(name string) (*Function, bool) {
+	fn, ok := registry[name]
+	return fn, ok
+}
+
+// Names возвращает отсортированные имена всех функций
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AcceptsArgs сообщает, допустимо ли для функции n аргументов
+func (f *Function) AcceptsArgs(n int) bool {
+	return n >= f.MinArgs && (f.MaxArgs < 0 || n <= f.MaxArgs)
+}
+
+// Call проверяет число аргументов и вычисляет функцию.
+// Бесконечный результат возвращается как ErrOverflow
+func Call(name string, args []float64) (float64, error) {
+	fn, ok := Lookup(name)
+	if !ok {
+		return 0, errors.New("unknown function: " + name)
+	}
+	if !fn.AcceptsArgs(len(args)) {
+		return 0, errors.New("wrong number of arguments for " + name)
+	}
+	result, err := fn.Eval(args)
+	if err != nil {
+		return 0, err
+	}
+	// Результат за пределами float64 (например, exp(1000)) считается переполнением
+	if math.IsInf(result, 0) {
+		return 0, ErrOverflow
+	}
+	return result, nil
+}
+
+// unary описывает функцию одного аргумента
+func unary(name string, eval func(x float64) (float64, error)) *Function {
+	return &Function{Name: name, MinArgs: 1, MaxArgs: 1, Eval: func(args []float64) (float64, error) {
+		return eval(args[0])
+	}}
+}
+
+// pure оборачивает функцию, определенную на всей числовой прямой
+func pure(f func(float64) float64) func(float64) (float64, error) {
+	return func(x float64) (float64, error) {
+		return f(x), nil
+	}
+}
@@ -0,0 +1,53 @@
+package mathfunc_test
+
+import (
+	"errors"
+	"math"
+	"parallel-calculator/internal/mathfunc"
+	"testing"
+)
+
+// TestCall проверяет вычисление функций, число аргументов и ошибки области определения
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      string
+		args    []float64
+		want    float64
+		wantErr error
+	}{
+		{name: "sqrt", fn: "sqrt", args: []float64{16}, want: 4},
+		{name: "abs", fn: "abs", args: []float64{-2.5}, want: 2.5},
+		{name: "min of many", fn: "min", args: []float64{3, -1, 2}, want: -1},
+		{name: "max of one", fn: "max", args: []float64{7}, want: 7},
+		{name: "sin", fn: "sin", args: []float64{0}, want: 0},
+		{name: "log", fn: "log", args: []float64{math.E}, want: 1},
+		{name: "round", fn: "round", args: []float64{2.5}, want: 3},
+		{name: "sqrt of negative", fn: "sqrt", args: []float64{-1}, wantErr: mathfunc.ErrSqrtNegative},
+		{name: "log of zero", fn: "log", args: []float64{0}, wantErr: mathfunc.ErrLogNonPositive},
+		{name: "exp overflow", fn: "exp", args: []float64{1000}, wantErr: mathfunc.ErrOverflow},
+		{name: "max of infinity", fn: "max", args: []float64{1, math.Inf(1)}, wantErr: mathfunc.ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mathfunc.Call(tt.fn, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Call() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("Call() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := mathfunc.Call("sqrt", []float64{1, 2}); err == nil {
+		t.Errorf("Call() expected error for wrong number of arguments")
+	}
+	if _, err := mathfunc.Call("max", nil); err == nil {
+		t.Errorf("Call() expected error for max without arguments")
+	}
+	if _, err := mathfunc.Call("system", []float64{1}); err == nil {
+		t.Errorf("Call() expected error for unknown function")
+	}
+}
@@ -0,0 +1,393 @@
+// Package metrics реализует счетчики, измерители и гистограммы и их вывод
+// в текстовом формате Prometheus (text exposition format 0.0.4)
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets — границы гистограммы по умолчанию, в секундах
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector — метрика, которую можно зарегистрировать в Registry
+type Collector interface {
+	metricName() string
+	write(w *bufio.Writer) error
+}
+
+// Registry хранит метрики процесса и выводит их значения
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+	names      map[string]bool
+}
+
+// NewRegistry создает пустой реестр метрик
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// MustRegister добавляет метрики в реестр. Повторная регистрация имени — ошибка программы
+func (r *Registry) MustRegister(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range collectors {
+		if r.names[c.metricName()] {
+			panic("metrics: duplicate metric " + c.metricName())
+		}
+		r.names[c.metricName()] = true
+		r.collectors = append(r.collectors, c)
+	}
+}
+
+// Write выводит все метрики реестра в текстовом формате Prometheus
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].metricName() < collectors[j].metricName()
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		if err := c.write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler возвращает HTTP-обработчик, отдающий метрики реестра.
+// Если значение какой-либо метрики получить не удалось, отвечает кодом 500
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		if err := r.Write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf.WriteTo(w)
+	})
+}
+
+// series — значения метрики для одного набора значений меток
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64 // только для гистограмм: число наблюдений в каждом интервале
+	sum         float64
+	count       uint64
+}
+
+// vec содержит общую для всех типов метрик часть: описание и значения по наборам меток
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, typ string, labels []string) vec {
+	return vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+func (v *vec) metricName() string {
+	return v.name
+}
+
+// get возвращает значения для набора меток, создавая их при первом обращении. Вызывается под v.mu
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sortedSeries возвращает копии значений, упорядоченные по значениям меток
+func (v *vec) sortedSeries() []series {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	list := make([]series, 0, len(v.series))
+	for _, s := range v.series {
+		c := *s
+		c.buckets = append([]uint64(nil), s.buckets...)
+		list = append(list, c)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].labelValues, "\xff") < strings.Join(list[j].labelValues, "\xff")
+	})
+	return list
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+// writeSimple выводит метрику, у которой для набора меток одно значение
+func (v *vec) writeSimple(w *bufio.Writer) error {
+	v.writeHeader(w)
+	for _, s := range v.sortedSeries() {
+		writeSample(w, v.name, v.labels, s.labelValues, "", "", s.value)
+	}
+	return nil
+}
+
+// Counter — монотонно растущий счетчик
+type Counter struct {
+	vec
+}
+
+// NewCounter создает счетчик с заданными метками. Имя счетчика по соглашению оканчивается на _total
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newVec(name, help, "counter", labels)}
+}
+
+// Inc увеличивает счетчик на 1
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add увеличивает счетчик на delta. Отрицательное delta — ошибка программы
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+	c.mu.Lock()
+	c.get(labelValues).value += delta
+	c.mu.Unlock()
+}
+
+// Value возвращает текущее значение счетчика
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(labelValues).value
+}
+
+func (c *Counter) write(w *bufio.Writer) error {
+	return c.writeSimple(w)
+}
+
+// Gauge — значение, которое может как расти, так и уменьшаться
+type Gauge struct {
+	vec
+}
+
+// NewGauge создает измеритель с заданными метками
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newVec(name, help, "gauge", labels)}
+}
+
+// Set устанавливает значение
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value = value
+	g.mu.Unlock()
+}
+
+// Add изменяет значение на delta
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value += delta
+	g.mu.Unlock()
+}
+
+// Inc увеличивает значение на 1
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec уменьшает значение на 1
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Value возвращает текущее значение
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.get(labelValues).value
+}
+
+func (g *Gauge) write(w *bufio.Writer) error {
+	return g.writeSimple(w)
+}
+
+// GaugeFunc — измеритель, значения которого вычисляются при каждом выводе метрик
+type GaugeFunc struct {
+	name  string
+	help  string
+	label string
+	fn    func() (map[string]float64, error)
+}
+
+// NewGaugeFunc создает измеритель с одной меткой label. fn возвращает значения по значениям метки;
+// если fn вернул ошибку, вывод метрик прерывается
+func NewGaugeFunc(name, help, label string, fn func() (map[string]float64, error)) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, label: label, fn: fn}
+}
+
+func (g *GaugeFunc) metricName() string {
+	return g.name
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) error {
+	values, err := g.fn()
+	if err != nil {
+		return fmt.Errorf("metrics: %s: %w", g.name, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, escapeHelp(g.help))
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+	for _, k := range keys {
+		writeSample(w, g.name, []string{g.label}, []string{k}, "", "", values[k])
+	}
+	return nil
+}
+
+// Histogram распределяет наблюдения по интервалам
+type Histogram struct {
+	vec
+	upperBounds []float64
+}
+
+// NewHistogram создает гистограмму с верхними границами интервалов buckets (по возрастанию)
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{
+		vec:         newVec(name, help, "histogram", labels),
+		upperBounds: buckets,
+	}
+}
+
+// Observe добавляет наблюдение
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.upperBounds))
+	}
+	for i, bound := range h.upperBounds {
+		if value <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Count возвращает число наблюдений
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.get(labelValues).count
+}
+
+func (h *Histogram) write(w *bufio.Writer) error {
+	h.writeHeader(w)
+	for _, s := range h.sortedSeries() {
+		var cumulative uint64
+		for i, bound := range h.upperBounds {
+			if s.buckets != nil {
+				cumulative += s.buckets[i]
+			}
+			writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, "", "", s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, "", "", float64(s.count))
+	}
+	return nil
+}
+
+// writeSample выводит строку значения. extraLabel (например, le) добавляется после меток метрики
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, escapeLabelValue(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
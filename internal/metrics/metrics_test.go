@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRegistryWrite проверяет вывод метрик в текстовом формате Prometheus
+func TestRegistryWrite(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := NewCounter("test_requests_total", "Number of requests.", "method", "code")
+	requests.Inc("GET", "200")
+	requests.Add(2, "GET", "200")
+	requests.Inc("POST", "500")
+
+	busy := NewGauge("test_busy", "Busy workers.")
+	busy.Inc()
+	busy.Inc()
+	busy.Dec()
+
+	latency := NewHistogram("test_latency_seconds", "Request latency.", []float64{0.1, 1}, "op")
+	latency.Observe(0.05, "+")
+	latency.Observe(0.5, "+")
+	latency.Observe(3, "+")
+
+	queue := NewGaugeFunc("test_queue", "Queue depth.", "status", func() (map[string]float64, error) {
+		return map[string]float64{"ready": 2, "pending": 1}, nil
+	})
+
+	registry.MustRegister(requests, busy, latency, queue)
+
+	var out strings.Builder
+	if err := registry.Write(&out); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	expected := `# HELP test_busy Busy workers.
+# TYPE test_busy gauge
+test_busy 1
+# HELP test_latency_seconds Request latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{op="+",le="0.1"} 1
+test_latency_seconds_bucket{op="+",le="1"} 2
+test_latency_seconds_bucket{op="+",le="+Inf"} 3
+test_latency_seconds_sum{op="+"} 3.55
+test_latency_seconds_count{op="+"} 3
+# HELP test_queue Queue depth.
+# TYPE test_queue gauge
+test_queue{status="pending"} 1
+test_queue{status="ready"} 2
+# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 3
+test_requests_total{method="POST",code="500"} 1
+`
+	if out.String() != expected {
+		t.Errorf("Write() output:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+// TestLabelEscaping проверяет экранирование значений меток и описания
+func TestLabelEscaping(t *testing.T) {
+	registry := NewRegistry()
+
+	errorsTotal := NewCounter("test_errors_total", "Errors\nby \\ message.", "message")
+	errorsTotal.Inc("say \"hi\"\n")
+	registry.MustRegister(errorsTotal)
+
+	var out strings.Builder
+	if err := registry.Write(&out); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if !strings.Contains(out.String(), `# HELP test_errors_total Errors\nby \\ message.`) {
+		t.Errorf("Help is not escaped:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `test_errors_total{message="say \"hi\"\n"} 1`) {
+		t.Errorf("Label value is not escaped:\n%s", out.String())
+	}
+}
+
+// TestHandler проверяет HTTP-обработчик метрик и ошибку вычисляемой метрики
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	counter := NewCounter("test_total", "Test counter.")
+	counter.Inc()
+	registry.MustRegister(counter)
+
+	rr := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rr.Body.String(), "test_total 1\n") {
+		t.Errorf("Unexpected body:\n%s", rr.Body.String())
+	}
+
+	failing := NewRegistry()
+	failing.MustRegister(NewGaugeFunc("test_failing", "Failing gauge.", "status", func() (map[string]float64, error) {
+		return nil, errors.New("db is down")
+	}))
+
+	rr = httptest.NewRecorder()
+	failing.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Status for failing gauge = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+// TestMustRegisterDuplicate проверяет, что имя метрики нельзя зарегистрировать дважды
+func TestMustRegisterDuplicate(t *testing.T) {
+	registry := NewRegistry()
+	registry.MustRegister(NewCounter("test_total", "Test counter."))
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on duplicate registration")
+		}
+	}()
+	registry.MustRegister(NewGauge("test_total", "Test gauge."))
+}
@@ -0,0 +1,112 @@
+package numeric
+
+import (
+	"math/big"
+	"parallel-calculator/internal/mathfunc"
+	"strings"
+)
+
+// Способы округления режима decimal
+const (
+	RoundHalfEven = "half_even" // половина округляется к четной цифре, по умолчанию
+	RoundHalfUp   = "half_up"   // половина округляется от нуля
+	RoundDown     = "down"      // отбрасывание лишних знаков, округление к нулю
+
+	// roundSticky — округление промежуточных значений: лишние знаки отбрасываются, а если они
+	// были ненулевыми, последняя цифра делается нечетной. Такое значение не попадает точно на
+	// половину и на границу меньшего числа знаков, поэтому окончательное округление до Precision
+	// любым способом дает тот же результат, что и округление точного значения
+	roundSticky = "sticky"
+)
+
+// Параметры режима decimal
+const (
+	DefaultDecimalPrecision = 2  // число знаков после запятой, если оно не задано
+	MaxDecimalPrecision     = 50 // наибольшее допустимое число знаков после запятой
+	// DecimalGuardDigits — сколько знаков сверх Precision хранят промежуточные значения.
+	// Для округления roundSticky без двойного округления достаточно двух
+	DecimalGuardDigits = 10
+)
+
+// ValidRounding сообщает, известен ли способ округления
+func ValidRounding(rounding string) bool {
+	switch rounding {
+	case RoundHalfEven, RoundHalfUp, RoundDown:
+		return true
+	}
+	return false
+}
+
+// RoundDecimal округляет r до scale знаков после запятой способом rounding
+func RoundDecimal(r *big.Rat, scale int, rounding string) *big.Rat {
+	unit := pow10(scale)
+	// q — целая часть r * 10^scale с отброшенной дробью, rem — остаток того же знака
+	num := new(big.Int).Mul(r.Num(), unit)
+	q, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if rem.Sign() != 0 && rounding == roundSticky {
+		if q.Bit(0) == 0 {
+			q.Add(q, big.NewInt(int64(r.Sign())))
+		}
+	} else if rem.Sign() != 0 && rounding != RoundDown {
+		// Сравниваем отброшенную дробь |rem| / den с половиной
+		half := new(big.Int).Abs(rem)
+		half.Lsh(half, 1)
+		switch cmp := half.Cmp(r.Denom()); {
+		case cmp > 0, cmp == 0 && rounding == RoundHalfUp, cmp == 0 && q.Bit(0) == 1:
+			q.Add(q, big.NewInt(int64(r.Sign())))
+		}
+	}
+	return new(big.Rat).SetFrac(q, unit)
+}
+
+// FormatDecimal записывает r, у которого не больше scale знаков после запятой. При fixed запись
+// содержит ровно scale знаков, иначе незначащие нули в конце отбрасываются
+func FormatDecimal(r *big.Rat, scale int, fixed bool) string {
+	s := r.FloatString(scale)
+	if !fixed && strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// decimalSqrt вычисляет квадратный корень из x, округленный до scale знаков способом rounding.
+// Корень вычисляется в целых числах: floor(sqrt(x) * 10^scale) = isqrt(num * 10^(2*scale) * den) / den
+func decimalSqrt(x *big.Rat, scale int, rounding string) (*big.Rat, error) {
+	if x.Sign() < 0 {
+		return nil, mathfunc.ErrSqrtNegative
+	}
+	unit := pow10(scale)
+	// n = x * 10^(2*scale) * den^2, корень из n равен sqrt(x) * 10^scale * den
+	n := new(big.Int).Mul(x.Num(), new(big.Int).Mul(unit, unit))
+	n.Mul(n, x.Denom())
+	if n.BitLen() > 2*MaxRationalBits {
+		return nil, ErrRationalTooLarge
+	}
+	q := new(big.Int).Sqrt(n)
+	q.Quo(q, x.Denom())
+
+	// Корень точен, если q^2 = x * 10^(2*scale); иначе сравниваем его с q + 1/2:
+	// (2q + 1)^2 * den и 4 * num * 10^(2*scale)
+	scaled := new(big.Int).Mul(x.Num(), new(big.Int).Mul(unit, unit))
+	exact := new(big.Int).Mul(new(big.Int).Mul(q, q), x.Denom()).Cmp(scaled) == 0
+	if !exact && rounding == roundSticky {
+		if q.Bit(0) == 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	} else if !exact && rounding != RoundDown {
+		twice := new(big.Int).Lsh(q, 1)
+		twice.Add(twice, big.NewInt(1))
+		left := new(big.Int).Mul(new(big.Int).Mul(twice, twice), x.Denom())
+		right := new(big.Int).Lsh(scaled, 2)
+		switch cmp := right.Cmp(left); {
+		case cmp > 0, cmp == 0 && rounding == RoundHalfUp, cmp == 0 && q.Bit(0) == 1:
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return new(big.Rat).SetFrac(q, unit), nil
+}
+
+// pow10 возвращает 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
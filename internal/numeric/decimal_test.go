@@ -0,0 +1,129 @@
+package numeric_test
+
+import (
+	"errors"
+	"math/big"
+	"parallel-calculator/internal/mathfunc"
+	"parallel-calculator/internal/numeric"
+	"testing"
+)
+
+// TestRoundDecimal проверяет способы округления
+func TestRoundDecimal(t *testing.T) {
+	tests := []struct {
+		value    string
+		scale    int
+		rounding string
+		want     string
+	}{
+		{"2.675", 2, numeric.RoundHalfEven, "2.68"},
+		{"2.665", 2, numeric.RoundHalfEven, "2.66"},
+		{"2.665", 2, numeric.RoundHalfUp, "2.67"},
+		{"-2.665", 2, numeric.RoundHalfUp, "-2.67"},
+		{"-2.665", 2, numeric.RoundHalfEven, "-2.66"},
+		{"2.6651", 2, numeric.RoundHalfEven, "2.67"},
+		{"2.679", 2, numeric.RoundDown, "2.67"},
+		{"-2.679", 2, numeric.RoundDown, "-2.67"},
+		{"1/3", 4, numeric.RoundHalfUp, "0.3333"},
+		{"2/3", 4, numeric.RoundDown, "0.6666"},
+		{"-0.004", 2, numeric.RoundHalfEven, "0.00"},
+		{"5/2", 0, numeric.RoundHalfEven, "2"},
+	}
+
+	for _, tt := range tests {
+		got := numeric.FormatDecimal(numeric.RoundDecimal(rat(t, tt.value), tt.scale, tt.rounding), tt.scale, true)
+		if got != tt.want {
+			t.Errorf("RoundDecimal(%s, %d, %s) = %s, want %s", tt.value, tt.scale, tt.rounding, got, tt.want)
+		}
+	}
+}
+
+// TestDecimalSettings проверяет вычисления в режиме decimal
+func TestDecimalSettings(t *testing.T) {
+	settings := numeric.Settings{Mode: numeric.ModeDecimal, Precision: 2, Rounding: numeric.RoundHalfEven}
+
+	// Промежуточные значения хранят Precision + DecimalGuardDigits знаков
+	third, err := settings.Binary("/", rat(t, "1"), rat(t, "3"))
+	if err != nil {
+		t.Fatalf("Binary() error = %v", err)
+	}
+	if got := settings.Format(third); got != "0.333333333333" {
+		t.Errorf("1/3 = %s, want 0.333333333333", got)
+	}
+	one, err := settings.Binary("*", third, rat(t, "3"))
+	if err != nil {
+		t.Fatalf("Binary() error = %v", err)
+	}
+	if value, result, err := settings.Result(one); err != nil || value != 1 || result != "1.00" {
+		t.Errorf("Result(1/3 * 3) = %v, %s, want 1, 1.00", value, result)
+	}
+
+	if got := settings.Format(rat(t, "1.50")); got != "1.5" {
+		t.Errorf("Format(1.50) = %s, want 1.5", got)
+	}
+
+	sqrt := func(x string, rounding string) string {
+		s := numeric.Settings{Mode: numeric.ModeDecimal, Precision: 0, Rounding: rounding}
+		r, err := s.Function("sqrt", []*big.Rat{rat(t, x)})
+		if err != nil {
+			t.Fatalf("Function(sqrt, %s) error = %v", x, err)
+		}
+		return numeric.FormatDecimal(r, s.Scale(), true)
+	}
+	// Промежуточный корень усекается, а при потере знаков последняя цифра делается нечетной
+	if got := sqrt("2", numeric.RoundHalfEven); got != "1.4142135623" {
+		t.Errorf("sqrt(2) = %s, want 1.4142135623", got)
+	}
+	if got := sqrt("5", numeric.RoundDown); got != "2.2360679775" {
+		t.Errorf("sqrt(5) = %s, want 2.2360679775", got)
+	}
+	if got := sqrt("6.25", numeric.RoundDown); got != "2.5000000000" {
+		t.Errorf("sqrt(6.25) = %s, want 2.5000000000", got)
+	}
+	// Способ округления применяется только к результату выражения
+	for rounding, want := range map[string]string{numeric.RoundHalfEven: "2", numeric.RoundHalfUp: "3", numeric.RoundDown: "2"} {
+		s := numeric.Settings{Mode: numeric.ModeDecimal, Precision: 0, Rounding: rounding}
+		r, err := s.Function("sqrt", []*big.Rat{rat(t, "6.25")})
+		if err != nil {
+			t.Fatalf("Function(sqrt, 6.25) error = %v", err)
+		}
+		if _, got, _ := s.Result(r); got != want {
+			t.Errorf("Result(sqrt(6.25)) with %s = %s, want %s", rounding, got, want)
+		}
+	}
+	if _, err := settings.Function("sqrt", []*big.Rat{rat(t, "-1")}); !errors.Is(err, mathfunc.ErrSqrtNegative) {
+		t.Errorf("Function(sqrt, -1) error = %v, want %v", err, mathfunc.ErrSqrtNegative)
+	}
+	if settings.FunctionSupported("log") {
+		t.Error("log must not be supported in decimal mode")
+	}
+}
+
+// TestDecimalNoDoubleRounding проверяет, что промежуточное значение не округляется способом
+// Rounding: иначе 0.12499999999999 превратилось бы в 0.125000000000 и затем в 0.13
+func TestDecimalNoDoubleRounding(t *testing.T) {
+	tests := []struct {
+		rounding string
+		x, y     string
+		want     string
+	}{
+		{numeric.RoundHalfUp, "0.125", "0.00000000000001", "0.12"},
+		{numeric.RoundHalfEven, "0.135", "0.00000000000001", "0.13"},
+		{numeric.RoundHalfUp, "-0.125", "-0.00000000000001", "-0.12"},
+		{numeric.RoundDown, "0.13", "0.00000000000001", "0.12"},
+		{numeric.RoundHalfUp, "0.125", "0", "0.13"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rounding+" "+tt.x, func(t *testing.T) {
+			settings := numeric.Settings{Mode: numeric.ModeDecimal, Precision: 2, Rounding: tt.rounding}
+			r, err := settings.Binary("-", rat(t, tt.x), rat(t, tt.y))
+			if err != nil {
+				t.Fatalf("Binary() error = %v", err)
+			}
+			if _, got, _ := settings.Result(r); got != tt.want {
+				t.Errorf("Result(%s - %s) = %s, want %s", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+}
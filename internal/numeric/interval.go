@@ -0,0 +1,307 @@
+package numeric
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"parallel-calculator/internal/mathfunc"
+)
+
+// Ошибки вычислений в режиме interval
+var (
+	ErrIntervalDivisionByZero = errors.New("division by interval containing zero")
+	ErrIntervalOverflow       = errors.New("interval bound overflow")
+	ErrInvalidInterval        = errors.New("invalid interval")
+)
+
+// Interval — замкнутый интервал [Lower, Upper], гарантированно содержащий точное значение.
+// Границы результата каждой операции округляются наружу: нижняя вниз, верхняя вверх
+type Interval struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// Направления округления границ
+const (
+	down = -1
+	up   = 1
+)
+
+// PointInterval возвращает интервал из одного числа x
+func PointInterval(x float64) Interval {
+	return Interval{Lower: x, Upper: x}
+}
+
+// IntervalOf возвращает наименьший интервал с границами float64, содержащий [lower, upper]
+func IntervalOf(lower, upper *big.Rat) (Interval, error) {
+	if lower.Cmp(upper) > 0 {
+		return Interval{}, fmt.Errorf("%w: lower bound is greater than upper", ErrInvalidInterval)
+	}
+	iv := Interval{
+		Lower: roundFloat(new(big.Float).SetPrec(53).SetMode(big.ToNegativeInf).SetRat(lower), down),
+		Upper: roundFloat(new(big.Float).SetPrec(53).SetMode(big.ToPositiveInf).SetRat(upper), up),
+	}
+	return iv, iv.Validate()
+}
+
+// Validate проверяет, что границы интервала конечны и нижняя не больше верхней
+func (iv Interval) Validate() error {
+	if math.IsNaN(iv.Lower) || math.IsNaN(iv.Upper) || iv.Lower > iv.Upper {
+		return fmt.Errorf("%w: [%v, %v]", ErrInvalidInterval, iv.Lower, iv.Upper)
+	}
+	if math.IsInf(iv.Lower, 0) || math.IsInf(iv.Upper, 0) {
+		return ErrIntervalOverflow
+	}
+	return nil
+}
+
+// Mid возвращает середину интервала. Она хранится в колонках float64 операций и выражений
+func (iv Interval) Mid() float64 {
+	if iv.Lower == iv.Upper {
+		return iv.Lower
+	}
+	// Половины складываются, чтобы сумма границ не переполнилась
+	return iv.Lower/2 + iv.Upper/2
+}
+
+// Contains сообщает, лежит ли x в интервале
+func (iv Interval) Contains(x float64) bool {
+	return iv.Lower <= x && x <= iv.Upper
+}
+
+// IntervalOperatorSupported сообщает, вычисляется ли бинарный оператор op в режиме interval.
+// Остаток и целочисленное деление разрывны и в этом режиме не поддерживаются
+func IntervalOperatorSupported(op string) bool {
+	switch op {
+	case "+", "-", "*", "/", "^":
+		return true
+	}
+	return false
+}
+
+// IntervalBinary вычисляет бинарную операцию x op y с округлением границ наружу
+func IntervalBinary(op string, x, y Interval) (Interval, error) {
+	var result Interval
+	switch op {
+	case "+":
+		result = Interval{
+			Lower: roundFloat(newFloat(down).Add(bigFloat(x.Lower), bigFloat(y.Lower)), down),
+			Upper: roundFloat(newFloat(up).Add(bigFloat(x.Upper), bigFloat(y.Upper)), up),
+		}
+	case "-":
+		result = Interval{
+			Lower: roundFloat(newFloat(down).Sub(bigFloat(x.Lower), bigFloat(y.Upper)), down),
+			Upper: roundFloat(newFloat(up).Sub(bigFloat(x.Upper), bigFloat(y.Lower)), up),
+		}
+	case "*":
+		result = corners(x, y, (*big.Float).Mul)
+	case "/":
+		if y.Contains(0) {
+			return Interval{}, ErrIntervalDivisionByZero
+		}
+		result = corners(x, y, (*big.Float).Quo)
+	case "^":
+		var err error
+		result, err = intervalPow(x, y)
+		if err != nil {
+			return Interval{}, err
+		}
+	default:
+		return Interval{}, fmt.Errorf("operator %s is not supported in interval mode", op)
+	}
+	return result, result.Validate()
+}
+
+// corners вычисляет операцию, монотонную по каждому аргументу при фиксированном знаке другого:
+// границы результата — наименьшее и наибольшее значение на концах интервалов
+func corners(x, y Interval, op func(z, a, b *big.Float) *big.Float) Interval {
+	result := Interval{Lower: math.Inf(1), Upper: math.Inf(-1)}
+	for _, a := range []float64{x.Lower, x.Upper} {
+		for _, b := range []float64{y.Lower, y.Upper} {
+			result.Lower = math.Min(result.Lower, roundFloat(op(newFloat(down), bigFloat(a), bigFloat(b)), down))
+			result.Upper = math.Max(result.Upper, roundFloat(op(newFloat(up), bigFloat(a), bigFloat(b)), up))
+		}
+	}
+	return result
+}
+
+// intervalPow возводит x в степень y. Показатель должен быть целым числом, а не интервалом
+func intervalPow(x, y Interval) (Interval, error) {
+	if y.Lower != y.Upper || y.Lower != math.Trunc(y.Lower) || math.Abs(y.Lower) > 1<<53 {
+		return Interval{}, ErrNonIntegerExponent
+	}
+	n := int64(y.Lower)
+	if n == 0 {
+		return PointInterval(1), nil
+	}
+	if n < 0 {
+		power, err := intervalPow(x, PointInterval(-y.Lower))
+		if err != nil {
+			return Interval{}, err
+		}
+		return IntervalBinary("/", PointInterval(1), power)
+	}
+
+	// Нечетная степень монотонна; четная убывает до нуля и возрастает после него
+	switch {
+	case n%2 == 1 || x.Lower >= 0:
+		return Interval{Lower: pow(x.Lower, n, down), Upper: pow(x.Upper, n, up)}, nil
+	case x.Upper <= 0:
+		return Interval{Lower: pow(-x.Upper, n, down), Upper: pow(-x.Lower, n, up)}, nil
+	}
+	return Interval{Lower: 0, Upper: pow(math.Max(-x.Lower, x.Upper), n, up)}, nil
+}
+
+// pow возводит a в натуральную степень n с округлением результата в направлении dir.
+// Отрицательное a допустимо только при нечетном n
+func pow(a float64, n int64, dir int) float64 {
+	if a < 0 {
+		// n нечетна: a^n = -(|a|^n), округление меняет направление
+		return -pow(-a, n, -dir)
+	}
+	// Все множители неотрицательны, поэтому округление каждого произведения
+	// в направлении dir сдвигает результат в том же направлении
+	result, base := newFloat(dir).SetInt64(1), newFloat(dir).SetFloat64(a)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			result.Mul(result, base)
+		}
+		base.Mul(base, base)
+	}
+	value := roundFloat(result, dir)
+	// Порядок big.Float ограничен: слишком малое ненулевое значение обращается в ноль
+	if value == 0 && a != 0 && dir == up {
+		return math.SmallestNonzeroFloat64
+	}
+	return value
+}
+
+// IntervalUnary вычисляет унарную операцию op x
+func IntervalUnary(op string, x Interval) (Interval, error) {
+	switch op {
+	case "-":
+		return Interval{Lower: -x.Upper, Upper: -x.Lower}, nil
+	case "+":
+		return x, nil
+	}
+	return Interval{}, fmt.Errorf("unsupported unary operator: %s", op)
+}
+
+// Функции режима interval. Все они монотонны на участках, поэтому границы результата
+// вычисляются по границам аргументов
+var intervalFunctions = map[string]func(args []Interval) (Interval, error){
+	"abs": func(args []Interval) (Interval, error) {
+		x := args[0]
+		switch {
+		case x.Lower >= 0:
+			return x, nil
+		case x.Upper <= 0:
+			return IntervalUnary("-", x)
+		}
+		return Interval{Lower: 0, Upper: math.Max(-x.Lower, x.Upper)}, nil
+	},
+	"floor": monotone(math.Floor),
+	"ceil":  monotone(math.Ceil),
+	"round": monotone(math.Round),
+	"min":   func(args []Interval) (Interval, error) { return intervalExtremum(args, math.Min), nil },
+	"max":   func(args []Interval) (Interval, error) { return intervalExtremum(args, math.Max), nil },
+	"sqrt": func(args []Interval) (Interval, error) {
+		if args[0].Lower < 0 {
+			return Interval{}, mathfunc.ErrSqrtNegative
+		}
+		return Interval{Lower: sqrt(args[0].Lower, down), Upper: sqrt(args[0].Upper, up)}, nil
+	},
+	// Погрешность math.Exp и math.Log меньше единицы последнего разряда, поэтому
+	// сдвиг результата на один разряд наружу дает гарантированную границу
+	"exp": func(args []Interval) (Interval, error) {
+		lower := math.Max(0, math.Nextafter(math.Exp(args[0].Lower), math.Inf(-1)))
+		return Interval{Lower: lower, Upper: math.Nextafter(math.Exp(args[0].Upper), math.Inf(1))}, nil
+	},
+	"log": func(args []Interval) (Interval, error) {
+		if args[0].Lower <= 0 {
+			return Interval{}, mathfunc.ErrLogNonPositive
+		}
+		return Interval{
+			Lower: math.Nextafter(math.Log(args[0].Lower), math.Inf(-1)),
+			Upper: math.Nextafter(math.Log(args[0].Upper), math.Inf(1)),
+		}, nil
+	},
+}
+
+// IntervalFunctionSupported сообщает, вычисляется ли функция name в режиме interval
+func IntervalFunctionSupported(name string) bool {
+	_, ok := intervalFunctions[name]
+	return ok
+}
+
+// IntervalFunction вычисляет функцию name. Число аргументов проверяется оркестратором
+func IntervalFunction(name string, args []Interval) (Interval, error) {
+	fn, ok := intervalFunctions[name]
+	if !ok {
+		return Interval{}, fmt.Errorf("function %s is not supported in interval mode", name)
+	}
+	if len(args) == 0 {
+		return Interval{}, errors.New("wrong number of arguments for " + name)
+	}
+	result, err := fn(args)
+	if err != nil {
+		return Interval{}, err
+	}
+	return result, result.Validate()
+}
+
+// monotone описывает неубывающую функцию, точно вычисляемую в float64
+func monotone(f func(float64) float64) func(args []Interval) (Interval, error) {
+	return func(args []Interval) (Interval, error) {
+		return Interval{Lower: f(args[0].Lower), Upper: f(args[0].Upper)}, nil
+	}
+}
+
+// intervalExtremum применяет min или max к нижним и к верхним границам аргументов
+func intervalExtremum(args []Interval, f func(x, y float64) float64) Interval {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = Interval{Lower: f(result.Lower, arg.Lower), Upper: f(result.Upper, arg.Upper)}
+	}
+	return result
+}
+
+// sqrt вычисляет квадратный корень из неотрицательного a с округлением в направлении dir.
+// math.Sqrt округляет к ближайшему, поэтому достаточно сравнить квадрат результата с a
+func sqrt(a float64, dir int) float64 {
+	root := math.Sqrt(a)
+	// Квадрат числа из 53 бит точно представим со 106 битами
+	square := new(big.Float).SetPrec(106).Mul(bigFloat(root), bigFloat(root))
+	// Нижняя граница не должна превышать корень (квадрат больше a), верхняя — быть меньше его
+	if square.Cmp(bigFloat(a)) == -dir {
+		root = math.Nextafter(root, math.Inf(dir))
+	}
+	return root
+}
+
+// newFloat возвращает big.Float с точностью float64 и округлением в направлении dir.
+// Порядок big.Float не ограничен диапазоном float64, поэтому промежуточные значения не переполняются
+func newFloat(dir int) *big.Float {
+	mode := big.ToNegativeInf
+	if dir == up {
+		mode = big.ToPositiveInf
+	}
+	return new(big.Float).SetPrec(53).SetMode(mode)
+}
+
+// bigFloat возвращает точное значение x
+func bigFloat(x float64) *big.Float {
+	return new(big.Float).SetFloat64(x)
+}
+
+// roundFloat приводит f к float64 с округлением в направлении dir. Значение за пределами float64
+// становится бесконечностью в направлении dir или наибольшим конечным числом в обратном
+func roundFloat(f *big.Float, dir int) float64 {
+	value, acc := f.Float64()
+	switch {
+	case dir == down && acc == big.Above, dir == up && acc == big.Below:
+		value = math.Nextafter(value, math.Inf(dir))
+	}
+	return value
+}
@@ -0,0 +1,157 @@
+package numeric_test
+
+import (
+	"errors"
+	"math"
+	"parallel-calculator/internal/mathfunc"
+	"parallel-calculator/internal/numeric"
+	"testing"
+)
+
+func interval(t *testing.T, lower, upper string) numeric.Interval {
+	t.Helper()
+	iv, err := numeric.IntervalOf(rat(t, lower), rat(t, upper))
+	if err != nil {
+		t.Fatalf("IntervalOf(%s, %s) error = %v", lower, upper, err)
+	}
+	return iv
+}
+
+// TestIntervalOf проверяет округление границ литерала наружу
+func TestIntervalOf(t *testing.T) {
+	// 0.1 не представимо в float64: границы — соседние числа вокруг него
+	tenth := interval(t, "0.1", "0.1")
+	if tenth.Lower >= tenth.Upper || !tenth.Contains(0.1) || math.Nextafter(tenth.Lower, 1) != tenth.Upper {
+		t.Errorf("IntervalOf(0.1) = %v, want the two floats around 0.1", tenth)
+	}
+	if got := interval(t, "1.9", "2.1"); got.Lower > 1.9 || got.Upper < 2.1 {
+		t.Errorf("IntervalOf(1.9, 2.1) = %v, want it to contain [1.9, 2.1]", got)
+	}
+	if got := interval(t, "2", "3"); got != (numeric.Interval{Lower: 2, Upper: 3}) {
+		t.Errorf("IntervalOf(2, 3) = %v, want exact bounds", got)
+	}
+
+	if _, err := numeric.IntervalOf(rat(t, "3"), rat(t, "2")); !errors.Is(err, numeric.ErrInvalidInterval) {
+		t.Errorf("IntervalOf(3, 2) error = %v, want %v", err, numeric.ErrInvalidInterval)
+	}
+	if _, err := numeric.IntervalOf(rat(t, "0"), rat(t, "1e400")); !errors.Is(err, numeric.ErrIntervalOverflow) {
+		t.Errorf("IntervalOf(0, 1e400) error = %v, want %v", err, numeric.ErrIntervalOverflow)
+	}
+}
+
+// TestIntervalBinary проверяет бинарные операции над интервалами и их ошибки
+func TestIntervalBinary(t *testing.T) {
+	tests := []struct {
+		x  numeric.Interval
+		op string
+		y  numeric.Interval
+		// want — результат или nil, если границы проверяются отдельно
+		want    *numeric.Interval
+		wantErr error
+	}{
+		{numeric.Interval{Lower: 1, Upper: 2}, "+", numeric.Interval{Lower: 3, Upper: 5}, &numeric.Interval{Lower: 4, Upper: 7}, nil},
+		{numeric.Interval{Lower: 1, Upper: 2}, "-", numeric.Interval{Lower: 3, Upper: 5}, &numeric.Interval{Lower: -4, Upper: -1}, nil},
+		{numeric.Interval{Lower: -1, Upper: 2}, "*", numeric.Interval{Lower: -3, Upper: 4}, &numeric.Interval{Lower: -6, Upper: 8}, nil},
+		{numeric.Interval{Lower: 1, Upper: 2}, "/", numeric.Interval{Lower: 4, Upper: 8}, &numeric.Interval{Lower: 0.125, Upper: 0.5}, nil},
+		{numeric.Interval{Lower: 1, Upper: 2}, "/", numeric.Interval{Lower: -1, Upper: 1}, nil, numeric.ErrIntervalDivisionByZero},
+		{numeric.Interval{Lower: 1, Upper: 2}, "/", numeric.Interval{Lower: 0, Upper: 1}, nil, numeric.ErrIntervalDivisionByZero},
+		{numeric.Interval{Lower: -2, Upper: 3}, "^", numeric.PointInterval(2), &numeric.Interval{Lower: 0, Upper: 9}, nil},
+		{numeric.Interval{Lower: -3, Upper: -2}, "^", numeric.PointInterval(2), &numeric.Interval{Lower: 4, Upper: 9}, nil},
+		{numeric.Interval{Lower: -2, Upper: 3}, "^", numeric.PointInterval(3), &numeric.Interval{Lower: -8, Upper: 27}, nil},
+		{numeric.Interval{Lower: 2, Upper: 4}, "^", numeric.PointInterval(-1), &numeric.Interval{Lower: 0.25, Upper: 0.5}, nil},
+		{numeric.Interval{Lower: -1, Upper: 1}, "^", numeric.PointInterval(-2), nil, numeric.ErrIntervalDivisionByZero},
+		{numeric.Interval{Lower: 2, Upper: 3}, "^", numeric.Interval{Lower: 1, Upper: 2}, nil, numeric.ErrNonIntegerExponent},
+		{numeric.Interval{Lower: 2, Upper: 3}, "^", numeric.PointInterval(0.5), nil, numeric.ErrNonIntegerExponent},
+		{numeric.Interval{Lower: 2, Upper: 3}, "^", numeric.PointInterval(2000), nil, numeric.ErrIntervalOverflow},
+		{numeric.PointInterval(math.MaxFloat64), "*", numeric.PointInterval(2), nil, numeric.ErrIntervalOverflow},
+	}
+
+	for _, tt := range tests {
+		got, err := numeric.IntervalBinary(tt.op, tt.x, tt.y)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("IntervalBinary(%v %s %v) error = %v, want %v", tt.x, tt.op, tt.y, err, tt.wantErr)
+			continue
+		}
+		if tt.want != nil && got != *tt.want {
+			t.Errorf("IntervalBinary(%v %s %v) = %v, want %v", tt.x, tt.op, tt.y, got, *tt.want)
+		}
+	}
+
+	if _, err := numeric.IntervalBinary("%", numeric.PointInterval(7), numeric.PointInterval(2)); err == nil {
+		t.Error("IntervalBinary(%) expected error")
+	}
+}
+
+// TestIntervalOutwardRounding проверяет, что округленные границы содержат точный результат
+func TestIntervalOutwardRounding(t *testing.T) {
+	// [0.1] + [0.2] содержит 0.3, хотя 0.1 + 0.2 в float64 больше 0.3
+	sum, err := numeric.IntervalBinary("+", interval(t, "0.1", "0.1"), interval(t, "0.2", "0.2"))
+	if err != nil {
+		t.Fatalf("IntervalBinary() error = %v", err)
+	}
+	if !sum.Contains(0.3) || sum.Lower == sum.Upper {
+		t.Errorf("0.1 + 0.2 = %v, want an interval containing 0.3", sum)
+	}
+
+	// 1/3 не представима: границы различаются на единицу последнего разряда
+	third, err := numeric.IntervalBinary("/", numeric.PointInterval(1), numeric.PointInterval(3))
+	if err != nil {
+		t.Fatalf("IntervalBinary() error = %v", err)
+	}
+	if math.Nextafter(third.Lower, 1) != third.Upper || !third.Contains(1.0/3) {
+		t.Errorf("1 / 3 = %v, want adjacent bounds around 1/3", third)
+	}
+
+	// Обратная операция возвращает интервал, содержащий исходное число
+	one, err := numeric.IntervalBinary("*", third, numeric.PointInterval(3))
+	if err != nil {
+		t.Fatalf("IntervalBinary() error = %v", err)
+	}
+	if !one.Contains(1) {
+		t.Errorf("(1 / 3) * 3 = %v, want it to contain 1", one)
+	}
+}
+
+// TestIntervalFunction проверяет функции режима interval
+func TestIntervalFunction(t *testing.T) {
+	tests := []struct {
+		fn   string
+		args []numeric.Interval
+		want numeric.Interval
+	}{
+		{"abs", []numeric.Interval{{Lower: -3, Upper: 2}}, numeric.Interval{Lower: 0, Upper: 3}},
+		{"abs", []numeric.Interval{{Lower: -3, Upper: -2}}, numeric.Interval{Lower: 2, Upper: 3}},
+		{"floor", []numeric.Interval{{Lower: -1.5, Upper: 2.5}}, numeric.Interval{Lower: -2, Upper: 2}},
+		{"min", []numeric.Interval{{Lower: 1, Upper: 5}, {Lower: 2, Upper: 3}}, numeric.Interval{Lower: 1, Upper: 3}},
+		{"max", []numeric.Interval{{Lower: 1, Upper: 5}, {Lower: 2, Upper: 3}}, numeric.Interval{Lower: 2, Upper: 5}},
+		{"sqrt", []numeric.Interval{{Lower: 4, Upper: 9}}, numeric.Interval{Lower: 2, Upper: 3}},
+	}
+
+	for _, tt := range tests {
+		got, err := numeric.IntervalFunction(tt.fn, tt.args)
+		if err != nil {
+			t.Fatalf("IntervalFunction(%s) error = %v", tt.fn, err)
+		}
+		if got != tt.want {
+			t.Errorf("IntervalFunction(%s, %v) = %v, want %v", tt.fn, tt.args, got, tt.want)
+		}
+	}
+
+	root, err := numeric.IntervalFunction("sqrt", []numeric.Interval{numeric.PointInterval(2)})
+	if err != nil {
+		t.Fatalf("IntervalFunction(sqrt) error = %v", err)
+	}
+	if root.Lower*root.Lower > 2 || math.Nextafter(root.Lower, 3) != root.Upper {
+		t.Errorf("sqrt(2) = %v, want adjacent bounds around sqrt(2)", root)
+	}
+
+	if _, err := numeric.IntervalFunction("sqrt", []numeric.Interval{{Lower: -1, Upper: 4}}); !errors.Is(err, mathfunc.ErrSqrtNegative) {
+		t.Errorf("IntervalFunction(sqrt, [-1, 4]) error = %v, want %v", err, mathfunc.ErrSqrtNegative)
+	}
+	if _, err := numeric.IntervalFunction("log", []numeric.Interval{{Lower: 0, Upper: 1}}); !errors.Is(err, mathfunc.ErrLogNonPositive) {
+		t.Errorf("IntervalFunction(log, [0, 1]) error = %v, want %v", err, mathfunc.ErrLogNonPositive)
+	}
+	if numeric.IntervalFunctionSupported("sin") {
+		t.Error("sin must not be supported in interval mode")
+	}
+}
@@ -0,0 +1,128 @@
+// Package numeric содержит числовые режимы вычисления выражений. Оркестратор разбирает
+// литералы и хранит значения операций в записи режима, агент вычисляет операции в этом режиме
+package numeric
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Числовые режимы выражения
+const (
+	ModeFloat    = "float"    // float64, режим по умолчанию
+	ModeRational = "rational" // точные рациональные числа big.Rat
+	ModeDecimal  = "decimal"  // десятичные дроби с заданным числом знаков и способом округления
+	ModeInterval = "interval" // интервалы float64 с округлением границ наружу
+)
+
+// ValidMode сообщает, известен ли режим. Пустой режим означает ModeFloat
+func ValidMode(mode string) bool {
+	switch mode {
+	case "", ModeFloat, ModeRational, ModeDecimal, ModeInterval:
+		return true
+	}
+	return false
+}
+
+// Exact сообщает, хранятся ли значения режима в точной строковой записи
+func Exact(mode string) bool {
+	return mode == ModeRational || mode == ModeDecimal
+}
+
+// Settings описывает числовой режим выражения. Precision и Rounding используются только в режиме ModeDecimal
+type Settings struct {
+	Mode      string
+	Precision int    // число знаков после запятой в результате выражения
+	Rounding  string // RoundHalfEven, RoundHalfUp или RoundDown
+}
+
+// Scale возвращает число знаков после запятой промежуточных значений режима decimal:
+// результат выражения округляется до Precision знаков способом Rounding один раз, в конце
+func (s Settings) Scale() int {
+	return s.Precision + DecimalGuardDigits
+}
+
+// Normalize приводит точное значение к значению режима: в режиме decimal отбрасывает знаки
+// сверх Scale с признаком потерянных знаков (roundSticky), не применяя способ Rounding
+func (s Settings) Normalize(r *big.Rat) *big.Rat {
+	if s.Mode == ModeDecimal {
+		return RoundDecimal(r, s.Scale(), roundSticky)
+	}
+	return r
+}
+
+// Format возвращает запись значения режима: дробь "p/q" в режиме rational,
+// десятичную запись без незначащих нулей в режиме decimal
+func (s Settings) Format(r *big.Rat) string {
+	if s.Mode == ModeDecimal {
+		return FormatDecimal(r, s.Scale(), false)
+	}
+	return FormatRational(r)
+}
+
+// Result возвращает приближение и запись результата выражения. В режиме decimal результат
+// округляется до Precision знаков способом Rounding и записывается ровно с Precision знаками.
+// Результат за пределами float64 возвращается как ErrOverflow
+func (s Settings) Result(r *big.Rat) (float64, string, error) {
+	if s.Mode == ModeDecimal {
+		r = RoundDecimal(r, s.Precision, s.Rounding)
+	}
+	value, err := RationalFloat(r)
+	if err != nil {
+		return 0, "", err
+	}
+	if s.Mode == ModeDecimal {
+		return value, FormatDecimal(r, s.Precision, true), nil
+	}
+	return value, FormatRational(r), nil
+}
+
+// FunctionSupported сообщает, вычисляется ли функция name в точном режиме или режиме interval
+func (s Settings) FunctionSupported(name string) bool {
+	switch s.Mode {
+	case ModeInterval:
+		return IntervalFunctionSupported(name)
+	case ModeDecimal:
+		if name == "sqrt" {
+			return true
+		}
+	}
+	return RationalFunctionSupported(name)
+}
+
+// Binary вычисляет бинарную операцию x op y в режиме s
+func (s Settings) Binary(op string, x, y *big.Rat) (*big.Rat, error) {
+	result, err := RationalBinary(op, x, y)
+	if err != nil {
+		return nil, err
+	}
+	return s.Normalize(result), nil
+}
+
+// Unary вычисляет унарную операцию op x в режиме s
+func (s Settings) Unary(op string, x *big.Rat) (*big.Rat, error) {
+	result, err := RationalUnary(op, x)
+	if err != nil {
+		return nil, err
+	}
+	return s.Normalize(result), nil
+}
+
+// Function вычисляет функцию name в режиме s
+func (s Settings) Function(name string, args []*big.Rat) (*big.Rat, error) {
+	if !s.FunctionSupported(name) {
+		return nil, fmt.Errorf("function %s is not supported in %s mode", name, s.Mode)
+	}
+	if s.Mode == ModeDecimal && name == "sqrt" {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("wrong number of arguments for %s", name)
+		}
+		return decimalSqrt(args[0], s.Scale(), roundSticky)
+	}
+
+	result, err := RationalFunction(name, args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Normalize(result), nil
+}
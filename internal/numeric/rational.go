@@ -0,0 +1,260 @@
+package numeric
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Ошибки вычислений в режимах rational и decimal. Тексты совпадают с ошибками агента в режиме float
+var (
+	ErrDivisionByZero     = errors.New("division by zero")
+	ErrModuloByZero       = errors.New("modulo by zero")
+	ErrNonIntegerOperand  = errors.New("non-integer operand")
+	ErrNonIntegerExponent = errors.New("non-integer exponent")
+	ErrRationalTooLarge   = errors.New("rational result too large")
+	ErrOverflow           = errors.New("overflow")
+)
+
+// MaxRationalBits ограничивает суммарную длину числителя и знаменателя результата,
+// чтобы степень вроде 10^10^9 не заняла всю память агента
+const MaxRationalBits = 1 << 20
+
+// MaxDecimalDigits — сколько знаков после запятой вычисляется для десятичной записи дроби
+const MaxDecimalDigits = 100
+
+// MaxLiteralExponent ограничивает порядок литерала: 1e1000000000 в точной записи
+// не поместилось бы в память
+const MaxLiteralExponent = 100000
+
+// ParseRational разбирает число в записи литерала выражения ("2.5", ".5", "1e-3")
+// или дроби ("3/10")
+func ParseRational(s string) (*big.Rat, error) {
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, err := strconv.Atoi(s[i+1:])
+		if err != nil || exp > MaxLiteralExponent || exp < -MaxLiteralExponent {
+			return nil, fmt.Errorf("invalid rational value: %q", s)
+		}
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid rational value: %q", s)
+	}
+	return r, nil
+}
+
+// FormatRational возвращает несократимую дробь "p/q" или целое число "p"
+func FormatRational(r *big.Rat) string {
+	return r.RatString()
+}
+
+// RationalFloat возвращает ближайшее к r значение float64. Для значения за пределами float64
+// возвращает ErrOverflow: бесконечность нельзя сохранить в базу и закодировать в JSON
+func RationalFloat(r *big.Rat) (float64, error) {
+	f, _ := r.Float64()
+	if math.IsInf(f, 0) {
+		return 0, ErrOverflow
+	}
+	return f, nil
+}
+
+// RationalDecimal возвращает десятичную запись r. Конечная дробь записывается точно,
+// период бесконечной заключается в скобки: 1/3 = "0.(3)", 1/6 = "0.1(6)".
+// Если за MaxDecimalDigits знаков период не найден, запись округляется и завершается "..."
+func RationalDecimal(r *big.Rat) string {
+	var b strings.Builder
+	if r.Sign() < 0 {
+		b.WriteByte('-')
+	}
+
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	integer, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	b.WriteString(integer.String())
+	if rem.Sign() == 0 {
+		return b.String()
+	}
+
+	// Деление в столбик: повтор остатка означает начало периода
+	seen := make(map[string]int)
+	var digits []byte
+	ten := big.NewInt(10)
+	for rem.Sign() != 0 && len(digits) < MaxDecimalDigits {
+		if start, ok := seen[rem.String()]; ok {
+			return b.String() + "." + string(digits[:start]) + "(" + string(digits[start:]) + ")"
+		}
+		seen[rem.String()] = len(digits)
+
+		digit := new(big.Int)
+		digit.QuoRem(rem.Mul(rem, ten), den, rem)
+		digits = append(digits, byte('0'+digit.Int64()))
+	}
+	if rem.Sign() == 0 {
+		return b.String() + "." + string(digits)
+	}
+	return r.FloatString(MaxDecimalDigits) + "..."
+}
+
+// RationalBinary вычисляет бинарную операцию x op y
+func RationalBinary(op string, x, y *big.Rat) (*big.Rat, error) {
+	var result *big.Rat
+	switch op {
+	case "+":
+		result = new(big.Rat).Add(x, y)
+	case "-":
+		result = new(big.Rat).Sub(x, y)
+	case "*":
+		result = new(big.Rat).Mul(x, y)
+	case "/":
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		result = new(big.Rat).Quo(x, y)
+	case "%":
+		if !x.IsInt() || !y.IsInt() {
+			return nil, ErrNonIntegerOperand
+		}
+		if y.Sign() == 0 {
+			return nil, ErrModuloByZero
+		}
+		// Остаток имеет знак делителя и согласован с "//": x = y*(x // y) + x % y
+		mod := new(big.Int).Mod(x.Num(), y.Num())
+		if mod.Sign() != 0 && y.Sign() < 0 {
+			mod.Add(mod, y.Num())
+		}
+		result = new(big.Rat).SetInt(mod)
+	case "//":
+		if !x.IsInt() || !y.IsInt() {
+			return nil, ErrNonIntegerOperand
+		}
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		result = floor(new(big.Rat).Quo(x, y))
+	case "^":
+		var err error
+		result, err = rationalPow(x, y)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operator: %s", op)
+	}
+	return checkSize(result)
+}
+
+// rationalPow возводит x в целую степень y
+func rationalPow(x, y *big.Rat) (*big.Rat, error) {
+	if !y.IsInt() {
+		return nil, ErrNonIntegerExponent
+	}
+	if x.Sign() == 0 && y.Sign() < 0 {
+		return nil, ErrDivisionByZero
+	}
+	if x.Sign() == 0 {
+		if y.Sign() == 0 {
+			return big.NewRat(1, 1), nil
+		}
+		return new(big.Rat), nil
+	}
+	// |x| = 1: результат равен 1 или -1 при любом показателе, знак определяет его четность
+	if x.IsInt() && x.Num().CmpAbs(big.NewInt(1)) == 0 {
+		if x.Sign() < 0 && y.Num().Bit(0) == 1 {
+			return big.NewRat(-1, 1), nil
+		}
+		return big.NewRat(1, 1), nil
+	}
+
+	// Нижняя оценка длины результата до возведения в степень: a^n занимает не меньше
+	// n*(len(a)-1)+1 бит. Точная длина проверяется после вычисления, в checkSize
+	exp := new(big.Int).Abs(y.Num())
+	bits := new(big.Int).Mul(exp, big.NewInt(int64(x.Num().BitLen()-1+x.Denom().BitLen()-1)))
+	if bits.Cmp(big.NewInt(MaxRationalBits)) > 0 {
+		return nil, ErrRationalTooLarge
+	}
+
+	num := new(big.Int).Exp(x.Num(), exp, nil)
+	den := new(big.Int).Exp(x.Denom(), exp, nil)
+	if y.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// RationalUnary вычисляет унарную операцию op x
+func RationalUnary(op string, x *big.Rat) (*big.Rat, error) {
+	switch op {
+	case "-":
+		return new(big.Rat).Neg(x), nil
+	case "+":
+		return new(big.Rat).Set(x), nil
+	}
+	return nil, fmt.Errorf("unsupported unary operator: %s", op)
+}
+
+// Функции, результат которых на рациональных аргументах рационален и вычисляется точно
+var rationalFunctions = map[string]func(args []*big.Rat) *big.Rat{
+	"abs":   func(args []*big.Rat) *big.Rat { return new(big.Rat).Abs(args[0]) },
+	"floor": func(args []*big.Rat) *big.Rat { return floor(args[0]) },
+	"ceil": func(args []*big.Rat) *big.Rat {
+		return new(big.Rat).Neg(floor(new(big.Rat).Neg(args[0])))
+	},
+	// Половина округляется от нуля, как math.Round
+	"round": func(args []*big.Rat) *big.Rat {
+		abs := floor(new(big.Rat).Add(new(big.Rat).Abs(args[0]), big.NewRat(1, 2)))
+		if args[0].Sign() < 0 {
+			abs.Neg(abs)
+		}
+		return abs
+	},
+	"min": func(args []*big.Rat) *big.Rat { return extremum(args, -1) },
+	"max": func(args []*big.Rat) *big.Rat { return extremum(args, 1) },
+}
+
+// RationalFunctionSupported сообщает, вычисляется ли функция name в режиме rational
+func RationalFunctionSupported(name string) bool {
+	_, ok := rationalFunctions[name]
+	return ok
+}
+
+// RationalFunction вычисляет функцию name. Число аргументов проверяется оркестратором
+func RationalFunction(name string, args []*big.Rat) (*big.Rat, error) {
+	fn, ok := rationalFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("function %s is not supported in rational mode", name)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("wrong number of arguments for " + name)
+	}
+	return fn(args), nil
+}
+
+// floor возвращает наибольшее целое, не превосходящее x
+func floor(x *big.Rat) *big.Rat {
+	// Знаменатель big.Rat положителен, поэтому евклидово деление совпадает с делением с округлением вниз
+	q := new(big.Int).Div(x.Num(), x.Denom())
+	return new(big.Rat).SetInt(q)
+}
+
+// extremum возвращает наименьший (sign < 0) или наибольший (sign > 0) аргумент
+func extremum(args []*big.Rat, sign int) *big.Rat {
+	result := args[0]
+	for _, arg := range args[1:] {
+		if arg.Cmp(result) == sign {
+			result = arg
+		}
+	}
+	return new(big.Rat).Set(result)
+}
+
+// checkSize возвращает ErrRationalTooLarge, если запись результата длиннее MaxRationalBits
+func checkSize(r *big.Rat) (*big.Rat, error) {
+	if r.Num().BitLen()+r.Denom().BitLen() > MaxRationalBits {
+		return nil, ErrRationalTooLarge
+	}
+	return r, nil
+}
@@ -0,0 +1,177 @@
+package numeric_test
+
+import (
+	"errors"
+	"math/big"
+	"parallel-calculator/internal/numeric"
+	"testing"
+)
+
+func rat(t *testing.T, s string) *big.Rat {
+	t.Helper()
+	r, err := numeric.ParseRational(s)
+	if err != nil {
+		t.Fatalf("ParseRational(%q) error = %v", s, err)
+	}
+	return r
+}
+
+// TestParseRational проверяет разбор литералов и дробей
+func TestParseRational(t *testing.T) {
+	tests := map[string]string{
+		"0.1":    "1/10",
+		".5":     "1/2",
+		"1.5e3":  "1500",
+		"2.5E-4": "1/4000",
+		"3/12":   "1/4",
+		"-7":     "-7",
+	}
+	for literal, want := range tests {
+		if got := numeric.FormatRational(rat(t, literal)); got != want {
+			t.Errorf("ParseRational(%q) = %s, want %s", literal, got, want)
+		}
+	}
+
+	for _, invalid := range []string{"1/0", "1e1000000000", "abc"} {
+		if _, err := numeric.ParseRational(invalid); err == nil {
+			t.Errorf("ParseRational(%q) expected error", invalid)
+		}
+	}
+}
+
+// TestRationalBinary проверяет точные бинарные операции и их ошибки
+func TestRationalBinary(t *testing.T) {
+	tests := []struct {
+		x, op, y string
+		want     string
+		wantErr  error
+	}{
+		{"0.1", "+", "0.2", "3/10", nil},
+		{"1/3", "-", "1/2", "-1/6", nil},
+		{"9007199254740993", "*", "1", "9007199254740993", nil},
+		{"1", "/", "3", "1/3", nil},
+		{"1", "/", "0", "", numeric.ErrDivisionByZero},
+		{"-7", "%", "3", "2", nil},
+		{"7", "%", "-3", "-2", nil},
+		{"-7", "%", "-3", "-1", nil},
+		{"-6", "%", "3", "0", nil},
+		{"7", "%", "0", "", numeric.ErrModuloByZero},
+		{"7/2", "%", "2", "", numeric.ErrNonIntegerOperand},
+		{"-7", "//", "2", "-4", nil},
+		{"7", "//", "-2", "-4", nil},
+		{"2/3", "^", "-2", "9/4", nil},
+		{"2", "^", "1/2", "", numeric.ErrNonIntegerExponent},
+		{"0", "^", "-1", "", numeric.ErrDivisionByZero},
+		{"10", "^", "1000000", "", numeric.ErrRationalTooLarge},
+		{"-1", "^", "1000000", "1", nil},
+		{"-1", "^", "1000001", "-1", nil},
+		{"1", "^", "-1000000000000", "1", nil},
+		{"0", "^", "0", "1", nil},
+		{"3", "^", "0", "1", nil},
+		{"1/2", "^", "-3", "8", nil},
+		{"2", "^", "2000000", "", numeric.ErrRationalTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.x+tt.op+tt.y, func(t *testing.T) {
+			got, err := numeric.RationalBinary(tt.op, rat(t, tt.x), rat(t, tt.y))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RationalBinary() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && numeric.FormatRational(got) != tt.want {
+				t.Errorf("RationalBinary() = %s, want %s", numeric.FormatRational(got), tt.want)
+			}
+		})
+	}
+
+	// Длина целой степени оценивается по числителю: 2^1000000 занимает 1000001 бит, меньше MaxRationalBits
+	got, err := numeric.RationalBinary("^", rat(t, "2"), rat(t, "1000000"))
+	if err != nil {
+		t.Fatalf("RationalBinary(2^1000000) error = %v", err)
+	}
+	if !got.IsInt() || got.Num().BitLen() != 1000001 {
+		t.Errorf("RationalBinary(2^1000000) has %d bits, want 1000001", got.Num().BitLen())
+	}
+}
+
+// TestRationalFunction проверяет точные функции
+func TestRationalFunction(t *testing.T) {
+	tests := []struct {
+		fn   string
+		args []string
+		want string
+	}{
+		{"abs", []string{"-1/3"}, "1/3"},
+		{"floor", []string{"-7/2"}, "-4"},
+		{"ceil", []string{"-7/2"}, "-3"},
+		{"round", []string{"5/2"}, "3"},
+		{"round", []string{"-5/2"}, "-3"},
+		{"min", []string{"1/3", "1/4", "1/2"}, "1/4"},
+		{"max", []string{"1/3", "1/4", "1/2"}, "1/2"},
+	}
+
+	for _, tt := range tests {
+		args := make([]*big.Rat, len(tt.args))
+		for i, arg := range tt.args {
+			args[i] = rat(t, arg)
+		}
+		got, err := numeric.RationalFunction(tt.fn, args)
+		if err != nil {
+			t.Fatalf("RationalFunction(%s) error = %v", tt.fn, err)
+		}
+		if numeric.FormatRational(got) != tt.want {
+			t.Errorf("RationalFunction(%s, %v) = %s, want %s", tt.fn, tt.args, numeric.FormatRational(got), tt.want)
+		}
+	}
+
+	if numeric.RationalFunctionSupported("sqrt") {
+		t.Error("sqrt must not be supported in rational mode")
+	}
+}
+
+// TestRationalDecimal проверяет десятичную запись дробей
+func TestRationalDecimal(t *testing.T) {
+	tests := map[string]string{
+		"3/10":  "0.3",
+		"-5/4":  "-1.25",
+		"42":    "42",
+		"1/3":   "0.(3)",
+		"-1/6":  "-0.1(6)",
+		"22/7":  "3.(142857)",
+		"1/128": "0.0078125",
+	}
+	for value, want := range tests {
+		if got := numeric.RationalDecimal(rat(t, value)); got != want {
+			t.Errorf("RationalDecimal(%s) = %s, want %s", value, got, want)
+		}
+	}
+
+	// Период 1/9973 длиннее MaxDecimalDigits
+	got := numeric.RationalDecimal(rat(t, "1/9973"))
+	if len(got) != len("0.")+numeric.MaxDecimalDigits+len("...") {
+		t.Errorf("RationalDecimal(1/9973) = %s, want rounded to %d digits", got, numeric.MaxDecimalDigits)
+	}
+}
+
+// TestRationalFloatOverflow проверяет, что значение за пределами float64 не становится бесконечностью
+func TestRationalFloatOverflow(t *testing.T) {
+	huge := rat(t, "1e400")
+	if _, err := numeric.RationalFloat(huge); !errors.Is(err, numeric.ErrOverflow) {
+		t.Errorf("RationalFloat(1e400) error = %v, want %v", err, numeric.ErrOverflow)
+	}
+	if _, err := numeric.RationalFloat(new(big.Rat).Neg(huge)); !errors.Is(err, numeric.ErrOverflow) {
+		t.Errorf("RationalFloat(-1e400) error = %v, want %v", err, numeric.ErrOverflow)
+	}
+	if value, err := numeric.RationalFloat(rat(t, "1e300")); err != nil || value != 1e300 {
+		t.Errorf("RationalFloat(1e300) = %v, %v, want 1e300", value, err)
+	}
+
+	for _, settings := range []numeric.Settings{
+		{Mode: numeric.ModeRational},
+		{Mode: numeric.ModeDecimal, Precision: 2, Rounding: numeric.RoundHalfEven},
+	} {
+		if _, _, err := settings.Result(huge); !errors.Is(err, numeric.ErrOverflow) {
+			t.Errorf("Result(1e400) in %s mode error = %v, want %v", settings.Mode, err, numeric.ErrOverflow)
+		}
+	}
+}
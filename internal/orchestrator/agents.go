@@ -0,0 +1,131 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"parallel-calculator/internal/config"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/logger"
+	"time"
+)
+
+// Состояния агентов в ответе GET /api/v1/admin/agents
+const (
+	AgentStatusOnline       = "online"
+	AgentStatusOffline      = "offline"      // Heartbeat не приходил дольше трех периодов
+	AgentStatusUnregistered = "unregistered" // агент получает задачи, но не зарегистрирован (старая версия агента)
+)
+
+// AgentOperation — операция, которую сейчас выполняет агент
+type AgentOperation struct {
+	ID             int64     `json:"id"`
+	ExpressionID   int64     `json:"expression_id"`
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+// AgentResponse — описание агента в ответе GET /api/v1/admin/agents
+type AgentResponse struct {
+	*db.Agent
+	Status     string           `json:"status"`
+	Operations []AgentOperation `json:"operations"`
+}
+
+// RegisterAgent регистрирует агента или обновляет его описание при повторной регистрации
+func RegisterAgent(agent *db.Agent) error {
+	agent.LastSeenAt = time.Now()
+	if err := db.RegisterAgent(agent); err != nil {
+		return fmt.Errorf("ошибка при регистрации агента: %w", err)
+	}
+
+	logger.Info(context.Background(), "Агент зарегистрирован",
+		"agent_id", agent.ID, "hostname", agent.Hostname, "computing_power", agent.ComputingPower, "version", agent.Version)
+	return nil
+}
+
+// AgentHeartbeat отмечает, что агент работает. Возвращает false, если агент не зарегистрирован
+func AgentHeartbeat(agentID string) (bool, error) {
+	registered, err := db.TouchAgent(agentID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("ошибка при обновлении времени обращения агента: %w", err)
+	}
+	return registered, nil
+}
+
+// RecordAgentTask учитывает принятый результат задачи агента: успешный или с ошибкой вычисления
+func RecordAgentTask(agentID string, failed bool) error {
+	if err := db.RecordAgentTask(agentID, failed, time.Now()); err != nil {
+		return fmt.Errorf("ошибка при учете задачи агента: %w", err)
+	}
+	return nil
+}
+
+// ListAgents возвращает агентов с их состоянием на момент now и операциями, которые они выполняют.
+// Агенты, не прошедшие регистрацию, но удерживающие операции, возвращаются в конце списка
+func ListAgents(now time.Time) ([]*AgentResponse, error) {
+	agents, err := db.GetAgents()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении агентов: %w", err)
+	}
+
+	leases, err := db.GetActiveLeases()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении аренд операций: %w", err)
+	}
+
+	offlineAfter := 3 * config.AppConfig.AgentHeartbeatInterval
+
+	responses := make([]*AgentResponse, 0, len(agents))
+	byID := make(map[string]*AgentResponse, len(agents))
+	for _, agent := range agents {
+		status := AgentStatusOnline
+		if now.Sub(agent.LastSeenAt) > offlineAfter {
+			status = AgentStatusOffline
+		}
+
+		response := &AgentResponse{Agent: agent, Status: status, Operations: []AgentOperation{}}
+		responses = append(responses, response)
+		byID[agent.ID] = response
+	}
+
+	for _, lease := range leases {
+		response, ok := byID[lease.Owner]
+		if !ok {
+			response = &AgentResponse{
+				Agent:      &db.Agent{ID: lease.Owner},
+				Status:     AgentStatusUnregistered,
+				Operations: []AgentOperation{},
+			}
+			responses = append(responses, response)
+			byID[lease.Owner] = response
+		}
+
+		response.Operations = append(response.Operations, AgentOperation{
+			ID:             lease.OperationID,
+			ExpressionID:   lease.ExpressionID,
+			LeaseExpiresAt: lease.ExpiresAt,
+		})
+	}
+
+	return responses, nil
+}
+
+// HandleGetAgents возвращает агентов, зарегистрированных в оркестраторе, и операции, которые они выполняют
+func HandleGetAgents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	agents, err := ListAgents(time.Now())
+	if err != nil {
+		logger.Error(r.Context(), "Failed to list agents", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(agents)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode agents response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
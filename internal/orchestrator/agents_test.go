@@ -0,0 +1,105 @@
+package orchestrator_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"parallel-calculator/internal/config"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/orchestrator"
+	"testing"
+	"time"
+)
+
+// TestHandleGetAgents проверяет список агентов с их состоянием и выполняемыми операциями
+func TestHandleGetAgents(t *testing.T) {
+	initTestDB(t)
+	defer cleanupTestDB()
+
+	userID, _ := createTestUser(t)
+
+	exprID, err := orchestrator.ProcessExpression("1+2", userID)
+	if err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	ops, err := db.GetOperationsByExpressionID(*exprID)
+	if err != nil || len(ops) != 1 {
+		t.Fatalf("Expected one operation, got %d (err %v)", len(ops), err)
+	}
+
+	// agent-1 работает и выполняет операцию, agent-2 давно не присылал Heartbeat
+	if err := orchestrator.RegisterAgent(&db.Agent{ID: "agent-1", Hostname: "host-1", ComputingPower: 2}); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+	stale := &db.Agent{ID: "agent-2", Hostname: "host-2", ComputingPower: 1,
+		LastSeenAt: time.Now().Add(-4 * config.AppConfig.AgentHeartbeatInterval)}
+	if err := db.RegisterAgent(stale); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	if err := db.LeaseOperation(ops[0].ID, "agent-1", "lease-1", expiresAt); err != nil {
+		t.Fatalf("LeaseOperation failed: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	orchestrator.HandleGetAgents(rr, httptest.NewRequest("GET", "/api/v1/admin/agents", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var agents []orchestrator.AgentResponse
+	if err := json.NewDecoder(rr.Body).Decode(&agents); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(agents) != 2 {
+		t.Fatalf("Expected 2 agents, got %d", len(agents))
+	}
+
+	if agents[0].ID != "agent-1" || agents[0].Status != orchestrator.AgentStatusOnline || agents[0].Hostname != "host-1" {
+		t.Errorf("Unexpected first agent: %+v", agents[0])
+	}
+	if len(agents[0].Operations) != 1 || agents[0].Operations[0].ID != ops[0].ID ||
+		agents[0].Operations[0].ExpressionID != *exprID || !agents[0].Operations[0].LeaseExpiresAt.Equal(expiresAt) {
+		t.Errorf("Expected agent-1 to hold operation %d, got %+v", ops[0].ID, agents[0].Operations)
+	}
+
+	if agents[1].ID != "agent-2" || agents[1].Status != orchestrator.AgentStatusOffline || len(agents[1].Operations) != 0 {
+		t.Errorf("Unexpected second agent: %+v", agents[1])
+	}
+}
+
+// TestListAgentsUnregisteredOwner проверяет, что операции незарегистрированного агента тоже видны
+func TestListAgentsUnregisteredOwner(t *testing.T) {
+	initTestDB(t)
+	defer cleanupTestDB()
+
+	userID, _ := createTestUser(t)
+
+	exprID, err := orchestrator.ProcessExpression("3*4", userID)
+	if err != nil {
+		t.Fatalf("Failed to process expression: %v", err)
+	}
+
+	ops, err := db.GetOperationsByExpressionID(*exprID)
+	if err != nil || len(ops) != 1 {
+		t.Fatalf("Expected one operation, got %d (err %v)", len(ops), err)
+	}
+
+	if err := db.LeaseOperation(ops[0].ID, "legacy-agent", "lease-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("LeaseOperation failed: %v", err)
+	}
+
+	agents, err := orchestrator.ListAgents(time.Now())
+	if err != nil {
+		t.Fatalf("ListAgents failed: %v", err)
+	}
+
+	if len(agents) != 1 || agents[0].ID != "legacy-agent" || agents[0].Status != orchestrator.AgentStatusUnregistered ||
+		len(agents[0].Operations) != 1 || agents[0].Operations[0].ID != ops[0].ID {
+		t.Errorf("Expected unregistered legacy-agent holding operation %d, got %+v", ops[0].ID, agents)
+	}
+}
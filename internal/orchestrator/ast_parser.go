@@ -1,12 +1,14 @@
 package orchestrator
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
-	"go/ast"
-	"go/token"
+	"math/big"
 	"parallel-calculator/internal/db"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/mathfunc"
+	"parallel-calculator/internal/numeric"
+	"parallel-calculator/internal/syntax"
 	"strconv"
 )
 
@@ -24,107 +26,203 @@ const (
 var ErrInvalidExpression = fmt.Errorf("invalid expression")
 
 // ParseAST парсит AST и создает операции в базе данных
-func ParseAST(expressionID int64, node ast.Node) error {
-	if err := validateAST(node); err != nil {
+func ParseAST(expressionID int64, node syntax.Node) error {
+	return parseAST(expressionID, node, numeric.Settings{Mode: numeric.ModeFloat})
+}
+
+// parseAST парсит AST и создает операции выражения в числовом режиме settings
+func parseAST(expressionID int64, node syntax.Node, settings numeric.Settings) error {
+	if err := validateAST(node, settings); err != nil {
 		return err
 	}
 
-	tx, err := db.DB.Begin()
+	// Второй проход: сохранение в БД с транзакцией
+	var rootID int64
+	err := db.InTx(func(tx db.TxStore) error {
+		var err error
+		rootID, err = saveASTToDB(tx, expressionID, settings, node, nil, "nil")
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
 
-	// Второй проход: сохранение в БД с транзакцией
-	if _, err := saveASTToDB(tx, expressionID, node, nil, "nil"); err != nil {
-		return err
+	// Выражение из одного числа вычислено без операций
+	if rootID == 0 {
+		expressionFinished(db.StatusCompleted)
 	}
 
-	return tx.Commit()
+	// Листовые операции выражения сразу готовы к выполнению
+	notifyReady()
+	return nil
 }
 
-// validateAST проверяет корректность AST без сохранения в БД
-func validateAST(node ast.Node) error {
+// validateAST проверяет корректность AST в числовом режиме settings без сохранения в БД
+func validateAST(node syntax.Node, settings numeric.Settings) error {
 	if node == nil {
 		return ErrInvalidExpression
 	}
 
 	switch n := node.(type) {
-	case *ast.BinaryExpr:
+	case *syntax.Binary:
 		switch n.Op {
-		case token.ADD, token.SUB, token.MUL, token.QUO:
+		case syntax.Add, syntax.Sub, syntax.Mul, syntax.Div, syntax.Mod, syntax.IntDiv, syntax.Pow:
 		default:
 			return fmt.Errorf("unsupported operator: %s", n.Op)
 		}
+		if settings.Mode == numeric.ModeInterval && !numeric.IntervalOperatorSupported(n.Op.String()) {
+			return fmt.Errorf("operator %s is not supported in %s mode", n.Op, settings.Mode)
+		}
 
-		if err := validateAST(n.X); err != nil {
+		if err := validateAST(n.X, settings); err != nil {
 			return err
 		}
 
-		if err := validateAST(n.Y); err != nil {
+		if err := validateAST(n.Y, settings); err != nil {
 			return err
 		}
 
 		return nil
 
-	case *ast.ParenExpr:
+	case *syntax.Paren:
 		// Проверяем содержимое скобок
-		return validateAST(n.X)
+		return validateAST(n.X, settings)
 
-	case *ast.BasicLit:
-		if n.Kind != token.INT && n.Kind != token.FLOAT {
-			return fmt.Errorf("unsupported literal type: %s", n.Kind)
+	case *syntax.Unary:
+		switch n.Op {
+		case syntax.Add, syntax.Sub:
+		default:
+			return fmt.Errorf("unsupported unary operator: %s", n.Op)
+		}
+
+		return validateAST(n.X, settings)
+
+	case *syntax.Call:
+		fn, ok := mathfunc.Lookup(n.Fun.Name)
+		if !ok {
+			return fmt.Errorf("unknown function: %s", n.Fun.Name)
+		}
+		if !fn.AcceptsArgs(len(n.Args)) {
+			return fmt.Errorf("wrong number of arguments for %s: %d", n.Fun.Name, len(n.Args))
+		}
+		if (numeric.Exact(settings.Mode) || settings.Mode == numeric.ModeInterval) && !settings.FunctionSupported(n.Fun.Name) {
+			return fmt.Errorf("function %s is not supported in %s mode", n.Fun.Name, settings.Mode)
 		}
 
-		_, err := strconv.ParseFloat(n.Value, 64)
+		for _, arg := range n.Args {
+			if err := validateAST(arg, settings); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *syntax.Number:
+		var err error
+		switch {
+		case settings.Mode == numeric.ModeInterval:
+			_, err = intervalValue(n)
+		case numeric.Exact(settings.Mode):
+			// Приближение значения хранится в колонках float64, поэтому литерал
+			// за пределами float64 отклоняется и в точных режимах
+			var r *big.Rat
+			if r, err = numeric.ParseRational(n.Value); err == nil {
+				_, err = numeric.RationalFloat(r)
+			}
+		default:
+			_, err = strconv.ParseFloat(n.Value, 64)
+		}
 		if err != nil {
 			return fmt.Errorf("invalid numeric value: %s - %v", n.Value, err)
 		}
 		return nil
 
+	case *syntax.Interval, *syntax.Tolerance:
+		if settings.Mode != numeric.ModeInterval {
+			return fmt.Errorf("interval literals require %s mode", numeric.ModeInterval)
+		}
+		_, err := intervalValue(n)
+		return err
+
 	default:
-		logger.LogINFO(fmt.Sprintf("Неизвестный тип узла AST: %T", n))
+		logger.Debug(context.Background(), "Неизвестный тип узла AST", "type", fmt.Sprintf("%T", n))
 		return fmt.Errorf("unsupported expression element: %T", n)
 	}
 }
 
-// saveASTToDB сохраняет AST в базу данных, возвращает ID корневой операции
-func saveASTToDB(tx *sql.Tx, expressionID int64, node ast.Node, parentOpID *int64, childPosition string) (int64, error) {
+// saveASTToDB сохраняет AST выражения в режиме settings в базу данных в транзакции tx,
+// возвращает ID корневой операции
+func saveASTToDB(tx db.TxStore, expressionID int64, settings numeric.Settings, node syntax.Node, parentOpID *int64, childPosition string) (int64, error) {
+	return saveNode(tx, expressionID, settings, node, node, parentOpID, childPosition)
+}
+
+// saveNode сохраняет узел node. source — узел, границы которого в исходном выражении запоминаются
+// в операции: сам node или окружающие его скобки, чтобы подвыражение показывалось вместе с ними
+func saveNode(tx db.TxStore, expressionID int64, settings numeric.Settings, node, source syntax.Node, parentOpID *int64, childPosition string) (int64, error) {
+	start, end := source.Pos(), source.End()
+
 	switch n := node.(type) {
-	case *ast.BasicLit:
-		value, _ := strconv.ParseFloat(n.Value, 64)
+	case *syntax.Number, *syntax.Interval, *syntax.Tolerance:
+		value, _ := literalValue(n, settings)
+		return 0, setConstantResult(tx, expressionID, settings, value)
 
-		err := db.UpdateExpressionStatus(
-			expressionID, StatusCompleted,
-		)
-		if err != nil {
+	case *syntax.Paren:
+		return saveNode(tx, expressionID, settings, n.X, source, parentOpID, childPosition)
+
+	case *syntax.Unary:
+		// Унарный минус над литералом сворачивается в отрицательное число
+		if value, ok := literalValue(n, settings); ok {
+			return 0, setConstantResult(tx, expressionID, settings, value)
+		}
+
+		// Унарный плюс не меняет значение, операция для него не нужна
+		if n.Op == syntax.Add {
+			return saveNode(tx, expressionID, settings, n.X, n.X, parentOpID, childPosition)
+		}
+
+		var childPos *string
+		if parentOpID != nil {
+			childPos = &childPosition
+		}
+
+		op := &db.Operation{
+			ExpressionID:     expressionID,
+			ParentOpID:       parentOpID,
+			ChildPosition:    childPos,
+			Operator:         n.Op.String(),
+			Kind:             db.KindUnary,
+			Status:           StatusPending,
+			IsRootExpression: parentOpID == nil,
+			SourceStart:      &start,
+			SourceEnd:        &end,
+		}
+		applySettings(op, settings)
+		if err := tx.CreateOperation(op); err != nil {
 			return 0, err
 		}
-		err = db.SetExpressionResult(expressionID, value)
-		return 0, err
 
-	case *ast.ParenExpr:
-		return saveASTToDB(tx, expressionID, n.X, parentOpID, childPosition)
+		if _, err := saveNode(tx, expressionID, settings, n.X, n.X, &op.ID, "left"); err != nil {
+			return 0, err
+		}
+
+		return op.ID, nil
 
-	case *ast.BinaryExpr:
+	case *syntax.Binary:
 		var (
-			leftVal, rightVal *float64
-			childPos          *string
+			leftVal, rightVal     *float64
+			leftExact, rightExact *string
+			left, right           literal
+			childPos              *string
 		)
 
 		if parentOpID != nil {
 			childPos = &childPosition
 		}
 
-		if value, ok := IsLiteralOnly(n.X); ok {
-			leftVal = &value
+		if value, ok := literalValue(n.X, settings); ok {
+			leftVal, leftExact, left = &value.value, value.exact, value
 		}
-		if value, ok := IsLiteralOnly(n.Y); ok {
-			rightVal = &value
+		if value, ok := literalValue(n.Y, settings); ok {
+			rightVal, rightExact, right = &value.value, value.exact, value
 		}
 
 		status := StatusPending
@@ -132,22 +230,98 @@ func saveASTToDB(tx *sql.Tx, expressionID int64, node ast.Node, parentOpID *int6
 			status = StatusReady
 		}
 
-		op, err := db.CreateOperation(
-			expressionID, parentOpID, n.Op.String(),
-			leftVal, rightVal, parentOpID == nil, childPos, status,
-		)
-		if err != nil {
+		op := &db.Operation{
+			ExpressionID:     expressionID,
+			ParentOpID:       parentOpID,
+			ChildPosition:    childPos,
+			LeftValue:        leftVal,
+			RightValue:       rightVal,
+			Operator:         n.Op.String(),
+			Kind:             db.KindBinary,
+			LeftExact:        leftExact,
+			RightExact:       rightExact,
+			Status:           status,
+			IsRootExpression: parentOpID == nil,
+			SourceStart:      &start,
+			SourceEnd:        &end,
+		}
+		op.LeftLower, op.LeftUpper = left.bounds()
+		op.RightLower, op.RightUpper = right.bounds()
+		applySettings(op, settings)
+		if err := tx.CreateOperation(op); err != nil {
 			return 0, err
 		}
 
 		if leftVal == nil {
-			if _, err := saveASTToDB(tx, expressionID, n.X, &op.ID, "left"); err != nil {
+			if _, err := saveNode(tx, expressionID, settings, n.X, n.X, &op.ID, "left"); err != nil {
 				return 0, err
 			}
 		}
 
 		if rightVal == nil {
-			if _, err := saveASTToDB(tx, expressionID, n.Y, &op.ID, "right"); err != nil {
+			if _, err := saveNode(tx, expressionID, settings, n.Y, n.Y, &op.ID, "right"); err != nil {
+				return 0, err
+			}
+		}
+
+		return op.ID, nil
+
+	case *syntax.Call:
+		var childPos *string
+		if parentOpID != nil {
+			childPos = &childPosition
+		}
+
+		// Литеральные аргументы сохраняются сразу, остальные заполнят дочерние операции
+		args := make([]*float64, len(n.Args))
+		var argsExact []*string
+		var argsLower, argsUpper []*float64
+		if numeric.Exact(settings.Mode) {
+			argsExact = make([]*string, len(n.Args))
+		}
+		if settings.Mode == numeric.ModeInterval {
+			argsLower, argsUpper = make([]*float64, len(n.Args)), make([]*float64, len(n.Args))
+		}
+		status := StatusReady
+		for i, arg := range n.Args {
+			if value, ok := literalValue(arg, settings); ok {
+				args[i] = &value.value
+				if argsExact != nil {
+					argsExact[i] = value.exact
+				}
+				if argsLower != nil {
+					argsLower[i], argsUpper[i] = value.bounds()
+				}
+			} else {
+				status = StatusPending
+			}
+		}
+
+		op := &db.Operation{
+			ExpressionID:     expressionID,
+			ParentOpID:       parentOpID,
+			ChildPosition:    childPos,
+			Operator:         n.Fun.Name,
+			Kind:             db.KindFunction,
+			Args:             args,
+			ArgsExact:        argsExact,
+			ArgsLower:        argsLower,
+			ArgsUpper:        argsUpper,
+			Status:           status,
+			IsRootExpression: parentOpID == nil,
+			SourceStart:      &start,
+			SourceEnd:        &end,
+		}
+		applySettings(op, settings)
+		if err := tx.CreateOperation(op); err != nil {
+			return 0, err
+		}
+
+		for i, arg := range n.Args {
+			if args[i] != nil {
+				continue
+			}
+			if _, err := saveNode(tx, expressionID, settings, arg, arg, &op.ID, db.ArgumentPosition(i)); err != nil {
 				return 0, err
 			}
 		}
@@ -159,17 +333,186 @@ func saveASTToDB(tx *sql.Tx, expressionID int64, node ast.Node, parentOpID *int6
 	}
 }
 
+// literal — значение литерала выражения: число float64, в точных режимах также само
+// значение и его запись в режиме выражения, в режиме interval — интервал, серединой которого является value
+type literal struct {
+	value    float64
+	exact    *string
+	rat      *big.Rat
+	interval *numeric.Interval
+}
+
+// bounds возвращает границы интервала литерала или nil вне режима interval
+func (l literal) bounds() (*float64, *float64) {
+	if l.interval == nil {
+		return nil, nil
+	}
+	return &l.interval.Lower, &l.interval.Upper
+}
+
+// literalValue возвращает значение узла-литерала в режиме settings.
+// В режиме decimal литерал округляется до числа знаков промежуточных значений
+func literalValue(node syntax.Node, settings numeric.Settings) (literal, bool) {
+	if settings.Mode == numeric.ModeInterval {
+		iv, ok := intervalLiteral(node)
+		if !ok {
+			return literal{}, false
+		}
+		return literal{value: iv.Mid(), interval: &iv}, true
+	}
+	if !numeric.Exact(settings.Mode) {
+		value, ok := IsLiteralOnly(node)
+		return literal{value: value}, ok
+	}
+
+	r, ok := exactLiteral(node)
+	if !ok {
+		return literal{}, false
+	}
+	r = settings.Normalize(r)
+	exact := settings.Format(r)
+	// Литерал за пределами float64 отклоняется в validateAST
+	value, _ := numeric.RationalFloat(r)
+	return literal{value: value, exact: &exact, rat: r}, true
+}
+
+// applySettings заполняет числовой режим операции op
+func applySettings(op *db.Operation, settings numeric.Settings) {
+	op.Mode = settings.Mode
+	if settings.Mode == numeric.ModeDecimal {
+		op.Precision, op.Rounding = &settings.Precision, &settings.Rounding
+	}
+}
+
+// setConstantResult завершает выражение, которое состоит из одного литерала.
+// Результат округляется так же, как результат вычисленного выражения в FinalizeExpression
+func setConstantResult(tx db.TxStore, expressionID int64, settings numeric.Settings, value literal) error {
+	err := tx.UpdateExpressionStatus(
+		expressionID, StatusCompleted,
+	)
+	if err != nil {
+		return err
+	}
+	if value.rat != nil {
+		var exact string
+		value.value, exact, err = settings.Result(value.rat)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetExpressionExactResult(expressionID, exact); err != nil {
+			return err
+		}
+	}
+	if value.interval != nil {
+		if err := tx.SetExpressionIntervalResult(expressionID, value.interval.Lower, value.interval.Upper); err != nil {
+			return err
+		}
+	}
+	return tx.SetExpressionResult(expressionID, value.value)
+}
+
+// exactLiteral проверяет, является ли узел AST литералом, и возвращает его точное значение
+func exactLiteral(node syntax.Node) (*big.Rat, bool) {
+	switch n := node.(type) {
+	case *syntax.Number:
+		r, err := numeric.ParseRational(n.Value)
+		return r, err == nil
+	case *syntax.Paren:
+		return exactLiteral(n.X)
+	case *syntax.Unary:
+		r, ok := exactLiteral(n.X)
+		if !ok {
+			return nil, false
+		}
+		switch n.Op {
+		case syntax.Add:
+			return r, true
+		case syntax.Sub:
+			return r.Neg(r), true
+		}
+	}
+	return nil, false
+}
+
+// intervalLiteral проверяет, является ли узел AST литералом в режиме interval, и возвращает его интервал
+func intervalLiteral(node syntax.Node) (numeric.Interval, bool) {
+	switch n := node.(type) {
+	case *syntax.Number, *syntax.Interval, *syntax.Tolerance:
+		iv, err := intervalValue(n)
+		return iv, err == nil
+	case *syntax.Paren:
+		return intervalLiteral(n.X)
+	case *syntax.Unary:
+		iv, ok := intervalLiteral(n.X)
+		if !ok {
+			return numeric.Interval{}, false
+		}
+		iv, err := numeric.IntervalUnary(n.Op.String(), iv)
+		return iv, err == nil
+	}
+	return numeric.Interval{}, false
+}
+
+// intervalValue возвращает наименьший интервал с границами float64, содержащий число,
+// интервальный литерал или число с допуском
+func intervalValue(node syntax.Node) (numeric.Interval, error) {
+	switch n := node.(type) {
+	case *syntax.Number:
+		r, err := numeric.ParseRational(n.Value)
+		if err != nil {
+			return numeric.Interval{}, err
+		}
+		return numeric.IntervalOf(r, r)
+
+	case *syntax.Interval:
+		lo, ok := exactLiteral(n.Lo)
+		if !ok {
+			return numeric.Interval{}, fmt.Errorf("%w: invalid bound", numeric.ErrInvalidInterval)
+		}
+		hi, ok := exactLiteral(n.Hi)
+		if !ok {
+			return numeric.Interval{}, fmt.Errorf("%w: invalid bound", numeric.ErrInvalidInterval)
+		}
+		return numeric.IntervalOf(lo, hi)
+
+	case *syntax.Tolerance:
+		x, err := numeric.ParseRational(n.X.Value)
+		if err != nil {
+			return numeric.Interval{}, err
+		}
+		delta, err := numeric.ParseRational(n.Delta.Value)
+		if err != nil {
+			return numeric.Interval{}, err
+		}
+		return numeric.IntervalOf(new(big.Rat).Sub(x, delta), new(big.Rat).Add(x, delta))
+	}
+	return numeric.Interval{}, fmt.Errorf("unsupported expression element: %T", node)
+}
+
 // IsLiteralOnly проверяет, является ли узел AST литералом и возвращает его значение
-func IsLiteralOnly(node ast.Node) (float64, bool) {
+func IsLiteralOnly(node syntax.Node) (float64, bool) {
 	switch n := node.(type) {
-	case *ast.BasicLit:
+	case *syntax.Number:
 		value, err := strconv.ParseFloat(n.Value, 64)
 		if err != nil {
 			return 0, false
 		}
 		return value, true
-	case *ast.ParenExpr:
+	case *syntax.Paren:
 		return IsLiteralOnly(n.X)
+	case *syntax.Unary:
+		value, ok := IsLiteralOnly(n.X)
+		if !ok {
+			return 0, false
+		}
+		switch n.Op {
+		case syntax.Add:
+			return value, true
+		case syntax.Sub:
+			return -value, true
+		default:
+			return 0, false
+		}
 	default:
 		return 0, false
 	}
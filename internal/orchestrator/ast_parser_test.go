@@ -1,17 +1,15 @@
 package orchestrator_test
 
 import (
-	"go/ast"
-	"go/parser"
 	"parallel-calculator/internal/db"
 	"parallel-calculator/internal/orchestrator"
+	"parallel-calculator/internal/syntax"
 	"testing"
 )
 
 // prepareASTNode подготавливает AST узел для тестирования
-func prepareASTNode(t *testing.T, expr string) ast.Node {
-	// Создаем файловый набор для парсинга
-	node, err := parser.ParseExpr(expr)
+func prepareASTNode(t *testing.T, expr string) syntax.Node {
+	node, err := syntax.Parse(expr)
 	if err != nil {
 		t.Fatalf("Failed to parse expression '%s': %v", expr, err)
 	}
@@ -191,3 +189,360 @@ func TestParseAST_ComplexExpression(t *testing.T) {
 		}
 	}
 }
+
+// TestParseAST_UnaryExpression проверяет обработку унарных минуса и плюса
+func TestParseAST_UnaryExpression(t *testing.T) {
+	// Инициализируем БД
+	initTestDB(t)
+
+	// Создаем тестового пользователя
+	user, err := db.CreateUser("testuser_unary", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	t.Run("Negative literal folding", func(t *testing.T) {
+		expr, err := db.CreateExpression(user.ID, "-(+5)")
+		if err != nil {
+			t.Fatalf("Failed to create test expression: %v", err)
+		}
+
+		if err := orchestrator.ParseAST(expr.ID, prepareASTNode(t, "-(+5)")); err != nil {
+			t.Fatalf("ParseAST() error = %v", err)
+		}
+
+		updatedExpr, err := db.GetExpressionByID(expr.ID)
+		if err != nil {
+			t.Fatalf("GetExpressionByID() error = %v", err)
+		}
+
+		if updatedExpr.Status != orchestrator.StatusCompleted {
+			t.Errorf("Expression status = %v, want %v", updatedExpr.Status, orchestrator.StatusCompleted)
+		}
+
+		if updatedExpr.Result == nil || *updatedExpr.Result != -5.0 {
+			t.Errorf("Expression result = %v, want %v", updatedExpr.Result, -5.0)
+		}
+	})
+
+	t.Run("Negative literal operand", func(t *testing.T) {
+		expr, err := db.CreateExpression(user.ID, "-3 * (2 + 1)")
+		if err != nil {
+			t.Fatalf("Failed to create test expression: %v", err)
+		}
+
+		if err := orchestrator.ParseAST(expr.ID, prepareASTNode(t, "-3 * (2 + 1)")); err != nil {
+			t.Fatalf("ParseAST() error = %v", err)
+		}
+
+		ops, err := db.GetOperationsByExpressionID(expr.ID)
+		if err != nil {
+			t.Fatalf("GetOperationsByExpressionID() error = %v", err)
+		}
+
+		if len(ops) != 2 {
+			t.Fatalf("Expected 2 operations, got %d", len(ops))
+		}
+
+		for _, op := range ops {
+			if op.Kind != db.KindBinary {
+				t.Errorf("Operation %s kind = %v, want %v", op.Operator, op.Kind, db.KindBinary)
+			}
+			if op.IsRootExpression && (op.LeftValue == nil || *op.LeftValue != -3.0) {
+				t.Errorf("Root operation left value = %v, want %v", op.LeftValue, -3.0)
+			}
+		}
+	})
+
+	t.Run("Negation of subexpression", func(t *testing.T) {
+		expr, err := db.CreateExpression(user.ID, "-(2+3)")
+		if err != nil {
+			t.Fatalf("Failed to create test expression: %v", err)
+		}
+
+		if err := orchestrator.ParseAST(expr.ID, prepareASTNode(t, "-(2+3)")); err != nil {
+			t.Fatalf("ParseAST() error = %v", err)
+		}
+
+		ops, err := db.GetOperationsByExpressionID(expr.ID)
+		if err != nil {
+			t.Fatalf("GetOperationsByExpressionID() error = %v", err)
+		}
+
+		if len(ops) != 2 {
+			t.Fatalf("Expected 2 operations, got %d", len(ops))
+		}
+
+		var root, child *db.Operation
+		for _, op := range ops {
+			if op.IsRootExpression {
+				root = op
+			} else {
+				child = op
+			}
+		}
+
+		if root == nil || child == nil {
+			t.Fatalf("Expected root and child operations, got %v", ops)
+		}
+
+		if root.Kind != db.KindUnary || root.Operator != "-" || root.Status != db.StatusPending {
+			t.Errorf("Root operation = %s %s %s, want unary - pending", root.Kind, root.Operator, root.Status)
+		}
+
+		// После вычисления дочерней операции унарная операция становится готовой
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: child.ID, Result: 5, Error: "nil"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		root, err = db.GetOperationByID(root.ID)
+		if err != nil {
+			t.Fatalf("GetOperationByID() error = %v", err)
+		}
+
+		if root.Status != db.StatusReady {
+			t.Errorf("Root operation status = %v, want %v", root.Status, db.StatusReady)
+		}
+
+		if root.LeftValue == nil || *root.LeftValue != 5.0 {
+			t.Errorf("Root operation operand = %v, want %v", root.LeftValue, 5.0)
+		}
+	})
+
+	t.Run("Unsupported unary operator", func(t *testing.T) {
+		expr, err := db.CreateExpression(user.ID, "^5")
+		if err != nil {
+			t.Fatalf("Failed to create test expression: %v", err)
+		}
+
+		// Грамматика не допускает такой узел, поэтому он строится вручную
+		node := &syntax.Unary{Op: syntax.Pow, X: &syntax.Number{ValuePos: 1, ValueEnd: 2, Value: "5"}}
+		if err := orchestrator.ParseAST(expr.ID, node); err == nil {
+			t.Errorf("ParseAST() expected error for unsupported unary operator")
+		}
+	})
+}
+
+// TestParseAST_ExtendedOperators проверяет операции степени, остатка и целочисленного деления
+func TestParseAST_ExtendedOperators(t *testing.T) {
+	// Инициализируем БД
+	initTestDB(t)
+
+	// Создаем тестового пользователя
+	user, err := db.CreateUser("testuser_extended", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	// parseOperations разбирает выражение и возвращает корневую и остальные операции
+	parseOperations := func(t *testing.T, expression string) (*db.Operation, []*db.Operation) {
+		expr, err := db.CreateExpression(user.ID, expression)
+		if err != nil {
+			t.Fatalf("Failed to create test expression: %v", err)
+		}
+
+		node, err := orchestrator.CreateAST(expression)
+		if err != nil {
+			t.Fatalf("CreateAST() error = %v", err)
+		}
+
+		if err := orchestrator.ParseAST(expr.ID, node); err != nil {
+			t.Fatalf("ParseAST() error = %v", err)
+		}
+
+		ops, err := db.GetOperationsByExpressionID(expr.ID)
+		if err != nil {
+			t.Fatalf("GetOperationsByExpressionID() error = %v", err)
+		}
+
+		var root *db.Operation
+		var children []*db.Operation
+		for _, op := range ops {
+			if op.IsRootExpression {
+				root = op
+			} else {
+				children = append(children, op)
+			}
+		}
+		if root == nil {
+			t.Fatalf("Root operation not found in %v", ops)
+		}
+		return root, children
+	}
+
+	t.Run("Operator symbols", func(t *testing.T) {
+		for expression, operator := range map[string]string{
+			"7 % 3":  "%",
+			"7 // 2": "//",
+			"2 ^ 10": "^",
+			"2**10":  "^",
+		} {
+			root, children := parseOperations(t, expression)
+			if len(children) != 0 {
+				t.Errorf("%s: expected 1 operation, got %d", expression, len(children)+1)
+			}
+			if root.Operator != operator || root.Kind != db.KindBinary {
+				t.Errorf("%s: operation = %s %s, want binary %s", expression, root.Kind, root.Operator, operator)
+			}
+		}
+	})
+
+	t.Run("Right-associative power", func(t *testing.T) {
+		root, children := parseOperations(t, "2^3^2")
+		if len(children) != 1 {
+			t.Fatalf("Expected 2 operations, got %d", len(children)+1)
+		}
+
+		// 2^(3^2): у корня известен левый операнд, правый вычисляется дочерней операцией
+		if root.LeftValue == nil || *root.LeftValue != 2.0 || root.RightValue != nil {
+			t.Errorf("Root operation operands = %v, %v, want 2 and pending", root.LeftValue, root.RightValue)
+		}
+
+		child := children[0]
+		if child.Operator != "^" || child.LeftValue == nil || *child.LeftValue != 3.0 ||
+			child.RightValue == nil || *child.RightValue != 2.0 {
+			t.Errorf("Child operation = %v %s %v, want 3 ^ 2", child.LeftValue, child.Operator, child.RightValue)
+		}
+	})
+
+	t.Run("Power binds tighter than unary minus", func(t *testing.T) {
+		root, children := parseOperations(t, "-2^2")
+		if len(children) != 1 {
+			t.Fatalf("Expected 2 operations, got %d", len(children)+1)
+		}
+
+		if root.Kind != db.KindUnary || root.Operator != "-" {
+			t.Errorf("Root operation = %s %s, want unary -", root.Kind, root.Operator)
+		}
+		if children[0].Operator != "^" {
+			t.Errorf("Child operation = %s, want ^", children[0].Operator)
+		}
+	})
+
+	t.Run("Modulo has multiplicative precedence", func(t *testing.T) {
+		root, children := parseOperations(t, "1 + 7 % 3")
+		if len(children) != 1 {
+			t.Fatalf("Expected 2 operations, got %d", len(children)+1)
+		}
+
+		if root.Operator != "+" || children[0].Operator != "%" {
+			t.Errorf("Operations = %s, %s, want + at root and %% below", root.Operator, children[0].Operator)
+		}
+	})
+}
+
+// TestParseAST_FunctionCalls проверяет операции вызова функций и передачу их аргументов
+func TestParseAST_FunctionCalls(t *testing.T) {
+	// Инициализируем БД
+	initTestDB(t)
+
+	// Создаем тестового пользователя
+	user, err := db.CreateUser("testuser_functions", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	// parse создает выражение и сохраняет его операции
+	parse := func(t *testing.T, expression string) (int64, error) {
+		expr, err := db.CreateExpression(user.ID, expression)
+		if err != nil {
+			t.Fatalf("Failed to create test expression: %v", err)
+		}
+
+		node, err := orchestrator.CreateAST(expression)
+		if err != nil {
+			t.Fatalf("CreateAST() error = %v", err)
+		}
+
+		return expr.ID, orchestrator.ParseAST(expr.ID, node)
+	}
+
+	t.Run("Nested arguments", func(t *testing.T) {
+		exprID, err := parse(t, "sqrt(16) + max(2, 3*4)")
+		if err != nil {
+			t.Fatalf("ParseAST() error = %v", err)
+		}
+
+		ops, err := db.GetOperationsByExpressionID(exprID)
+		if err != nil {
+			t.Fatalf("GetOperationsByExpressionID() error = %v", err)
+		}
+
+		byOperator := make(map[string]*db.Operation)
+		for _, op := range ops {
+			byOperator[op.Operator] = op
+		}
+		if len(ops) != 4 || byOperator["sqrt"] == nil || byOperator["max"] == nil || byOperator["*"] == nil {
+			t.Fatalf("Expected +, sqrt, max and * operations, got %v", ops)
+		}
+
+		sqrt, max, mul := byOperator["sqrt"], byOperator["max"], byOperator["*"]
+		if sqrt.Kind != db.KindFunction || sqrt.Status != db.StatusReady || len(sqrt.Args) != 1 || *sqrt.Args[0] != 16 {
+			t.Errorf("sqrt operation = %s %s %v, want ready function with argument 16", sqrt.Kind, sqrt.Status, sqrt.Args)
+		}
+		if max.Status != db.StatusPending || len(max.Args) != 2 || max.Args[1] != nil {
+			t.Errorf("max operation = %s %v, want pending with missing second argument", max.Status, max.Args)
+		}
+		if mul.ChildPosition == nil || *mul.ChildPosition != db.ArgumentPosition(1) {
+			t.Errorf("* operation position = %v, want %s", mul.ChildPosition, db.ArgumentPosition(1))
+		}
+
+		// Результат умножения становится вторым аргументом max
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: mul.ID, Result: 12, Error: "nil"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		max, err = db.GetOperationByID(max.ID)
+		if err != nil {
+			t.Fatalf("GetOperationByID() error = %v", err)
+		}
+		if max.Status != db.StatusReady || max.Args[1] == nil || *max.Args[1] != 12 {
+			t.Errorf("max operation = %s %v, want ready with second argument 12", max.Status, max.Args)
+		}
+
+		// Дерево операций включает аргументы функции
+		root, err := orchestrator.BuildOperationTree(ops)
+		if err != nil {
+			t.Fatalf("BuildOperationTree() error = %v", err)
+		}
+		if root.Right == nil || len(root.Right.Arguments) != 2 || root.Right.Arguments[1] == nil ||
+			root.Right.Arguments[1].ID != mul.ID {
+			t.Errorf("max node arguments = %v, want * as second argument", root.Right)
+		}
+	})
+
+	t.Run("Domain error", func(t *testing.T) {
+		exprID, err := parse(t, "sqrt(-4)")
+		if err != nil {
+			t.Fatalf("ParseAST() error = %v", err)
+		}
+
+		ops, err := db.GetOperationsByExpressionID(exprID)
+		if err != nil || len(ops) != 1 {
+			t.Fatalf("GetOperationsByExpressionID() = %v, %v, want one operation", ops, err)
+		}
+
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: ops[0].ID, Error: "sqrt of negative number"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		expr, err := db.GetExpressionByID(exprID)
+		if err != nil {
+			t.Fatalf("GetExpressionByID() error = %v", err)
+		}
+		if expr.Status != db.StatusError || expr.ErrorMessage == nil || *expr.ErrorMessage != "sqrt of negative number" {
+			t.Errorf("Expression = %s %v, want error with domain error message", expr.Status, expr.ErrorMessage)
+		}
+	})
+
+	for _, expression := range []string{"foo(1)", "sqrt(1, 2)", "max()", "pi"} {
+		t.Run("Invalid "+expression, func(t *testing.T) {
+			if _, err := parse(t, expression); err == nil {
+				t.Errorf("ParseAST(%q) expected error", expression)
+			}
+		})
+	}
+}
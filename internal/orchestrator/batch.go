@@ -0,0 +1,324 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/numeric"
+	"parallel-calculator/internal/syntax"
+	"parallel-calculator/internal/tracing"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxBatchSize — максимальное число выражений в одном пакете
+const MaxBatchSize = 10000
+
+// BatchCalculateRequest — тело запроса на вычисление пакета выражений
+type BatchCalculateRequest struct {
+	Expressions []string `json:"expressions"`
+	Mode        string   `json:"mode,omitempty"`      // числовой режим всех выражений пакета, по умолчанию "float"
+	Precision   *int     `json:"precision,omitempty"` // знаков после запятой результата в режиме decimal
+	Rounding    string   `json:"rounding,omitempty"`  // способ округления в режиме decimal
+}
+
+// BatchItem — результат приема одного выражения пакета: ID сохраненного выражения или ошибка
+type BatchItem struct {
+	Index int    `json:"index"`
+	ID    *int64 `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// BatchCalculateResponse — ответ на запрос вычисления пакета
+type BatchCalculateResponse struct {
+	BatchID int64       `json:"batch_id"`
+	Items   []BatchItem `json:"items"`
+}
+
+// BatchStatusResponse описывает состояние пакета выражений
+type BatchStatusResponse struct {
+	ID          int64                `json:"id"`
+	Status      string               `json:"status"` // pending, пока есть невычисленные выражения, иначе completed
+	Total       int                  `json:"total"`
+	Counts      map[string]int       `json:"counts"` // число выражений в каждом статусе
+	Expressions []ExpressionResponse `json:"expressions"`
+	CreatedAt   time.Time            `json:"created_at"`
+}
+
+// ProcessBatch разбирает выражения пакета и сохраняет корректные выражения и их операции
+// в одной транзакции. Некорректные выражения не сохраняются, их ошибки возвращаются в BatchItem.
+// request_id и спан обработки пакета из ctx сохраняются вместе с выражениями
+func ProcessBatch(ctx context.Context, expressions []string, userID int64) (*db.Batch, []BatchItem, error) {
+	return ProcessBatchOptions(ctx, expressions, userID, ExpressionOptions{})
+}
+
+// ProcessBatchOptions обрабатывает пакет так же, как ProcessBatch, вычисляя все выражения
+// в числовом режиме из opts. Неизвестный режим возвращает ErrInvalidMode, неверные параметры
+// режима decimal — ErrInvalidDecimal. Webhook для выражений пакета не поддерживается:
+// непустой opts.CallbackURL возвращает ErrInvalidCallbackURL
+func ProcessBatchOptions(ctx context.Context, expressions []string, userID int64, opts ExpressionOptions) (_ *db.Batch, _ []BatchItem, err error) {
+	settings, err := expressionSettings(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.CallbackURL != "" {
+		return nil, nil, fmt.Errorf("%w: callback_url is not supported for batches", ErrInvalidCallbackURL)
+	}
+
+	ctx, span := tracing.Start(ctx, "ProcessBatch", tracing.WithAttributes(
+		"user.id", userID,
+		"batch.size", len(expressions),
+		"batch.mode", settings.Mode,
+	))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	items := make([]BatchItem, len(expressions))
+	nodes := make([]syntax.Node, len(expressions))
+
+	// Разбор и подстановка ссылок выполняются до транзакции: они только читают БД
+	_, parseSpan := tracing.Start(ctx, "parse")
+	for i, expression := range expressions {
+		items[i].Index = i
+
+		node, err := prepareExpression(expression, userID, settings)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidExpression) && !errors.Is(err, ErrUnresolvedReference) {
+				parseSpan.RecordError(err)
+				parseSpan.End()
+				return nil, nil, err
+			}
+			items[i].Error = err.Error()
+			continue
+		}
+		nodes[i] = node
+	}
+	parseSpan.End()
+
+	var requestID, traceparent *string
+	if id := logger.RequestID(ctx); id != "" {
+		requestID = &id
+	}
+	if tp := tracing.Traceparent(ctx); tp != "" {
+		traceparent = &tp
+	}
+
+	var batch *db.Batch
+	var created, constants int
+	create := func(tx db.TxStore) error {
+		created, constants = 0, 0
+		var err error
+		batch, err = tx.CreateBatch(userID)
+		if err != nil {
+			return fmt.Errorf("ошибка создания пакета: %w", err)
+		}
+
+		for i, node := range nodes {
+			if node == nil {
+				continue
+			}
+
+			expr := &db.Expression{
+				UserID:      userID,
+				BatchID:     &batch.ID,
+				Expression:  expressions[i],
+				Mode:        settings.Mode,
+				RequestID:   requestID,
+				Traceparent: traceparent,
+			}
+			if settings.Mode == numeric.ModeDecimal {
+				expr.Precision, expr.Rounding = &settings.Precision, &settings.Rounding
+			}
+			if err := tx.CreateExpression(expr); err != nil {
+				return fmt.Errorf("ошибка создания выражения в БД: %w", err)
+			}
+			created++
+
+			rootID, err := saveASTToDB(tx, expr.ID, settings, node, nil, "nil")
+			if err != nil {
+				return fmt.Errorf("ошибка сохранения операций выражения %d: %w", i, err)
+			}
+			items[i].ID = &expr.ID
+			if rootID == 0 {
+				constants++
+			}
+		}
+		return nil
+	}
+
+	err = traceDB(ctx, "CreateBatch", func() error {
+		return db.InTx(create)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Info(ctx, "Batch created", "batch_id", batch.ID, "expressions", created)
+	expressionsCreated.Add(float64(created))
+	// Выражения из одного числа вычислены без операций
+	expressionsFinished.Add(float64(constants), db.StatusCompleted)
+
+	notifyReady()
+	return batch, items, nil
+}
+
+// prepareExpression разбирает выражение, подставляет ссылки и проверяет AST в режиме settings.
+// Ошибки выражения оборачивают ErrInvalidExpression или ErrUnresolvedReference
+func prepareExpression(expression string, userID int64, settings numeric.Settings) (syntax.Node, error) {
+	node, err := CreateAST(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := resolveReferences(node, userID, settings.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateAST(resolved, settings); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+	return resolved, nil
+}
+
+// GetBatchStatus собирает состояние пакета по его выражениям
+func GetBatchStatus(batch *db.Batch) (*BatchStatusResponse, error) {
+	expressions, err := db.GetBatchExpressions(batch.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении выражений пакета: %w", err)
+	}
+
+	response := &BatchStatusResponse{
+		ID:          batch.ID,
+		Status:      StatusCompleted,
+		Total:       len(expressions),
+		Counts:      make(map[string]int),
+		Expressions: make([]ExpressionResponse, len(expressions)),
+		CreatedAt:   batch.CreatedAt,
+	}
+
+	for i, expr := range expressions {
+		response.Counts[expr.Status]++
+		response.Expressions[i] = newExpressionResponse(expr)
+
+		if !isFinalStatus(expr.Status) {
+			response.Status = StatusPending
+		}
+	}
+
+	return response, nil
+}
+
+// HandleCalculateBatch принимает пакет выражений на вычисление
+func HandleCalculateBatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := GetUserIDFromToken(r)
+	if err != nil {
+		logger.Warn(r.Context(), "Authentication error", "error", err)
+		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
+		return
+	}
+
+	var request BatchCalculateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Warn(r.Context(), "Failed to decode batch request", "error", err)
+		http.Error(w, "Неверный формат запроса", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if len(request.Expressions) == 0 || len(request.Expressions) > MaxBatchSize {
+		logger.Warn(r.Context(), "Invalid batch size", "size", len(request.Expressions))
+		http.Error(w, fmt.Sprintf("Пакет должен содержать от 1 до %d выражений", MaxBatchSize), http.StatusUnprocessableEntity)
+		return
+	}
+
+	logger.Info(r.Context(), "Received batch", "size", len(request.Expressions))
+
+	batch, items, err := ProcessBatchOptions(r.Context(), request.Expressions, userID, ExpressionOptions{
+		Mode:      request.Mode,
+		Precision: request.Precision,
+		Rounding:  request.Rounding,
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidMode) {
+			logger.Warn(r.Context(), "Invalid numeric mode", "error", err)
+			http.Error(w, "Неверный mode", http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, ErrInvalidDecimal) {
+			logger.Warn(r.Context(), "Invalid decimal options", "error", err)
+			http.Error(w, "Неверные precision или rounding", http.StatusUnprocessableEntity)
+			return
+		}
+		logger.Error(r.Context(), "Failed to process batch", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(BatchCalculateResponse{BatchID: batch.ID, Items: items})
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode batch response", "error", err)
+		return
+	}
+}
+
+// HandleGetBatch возвращает состояние пакета выражений пользователя
+func HandleGetBatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := GetUserIDFromToken(r)
+	if err != nil {
+		logger.Warn(r.Context(), "Authentication error", "error", err)
+		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		logger.Warn(r.Context(), "Invalid batch ID format", "error", err)
+		http.Error(w, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+
+	batch, err := db.GetBatchByID(id)
+	if err != nil {
+		if errors.Is(err, db.ErrBatchNotFound) {
+			logger.Warn(r.Context(), "Batch not found", "batch_id", id)
+			http.Error(w, "Пакет не найден", http.StatusNotFound)
+			return
+		}
+		logger.Error(r.Context(), "Failed to get batch", "batch_id", id, "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	if batch.UserID != userID {
+		logger.Warn(r.Context(), "Unauthorized access to batch", "batch_id", id)
+		http.Error(w, "Нет доступа к этому пакету", http.StatusForbidden)
+		return
+	}
+
+	response, err := GetBatchStatus(batch)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to get batch status", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode batch response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
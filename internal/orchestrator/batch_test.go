@@ -0,0 +1,164 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"parallel-calculator/internal/auth"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/orchestrator"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestHandleCalculateBatch проверяет прием пакета выражений и получение его состояния
+func TestHandleCalculateBatch(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+
+	_, token := createTestUser(t)
+
+	calculateBatch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/calculate/batch", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		orchestrator.HandleCalculateBatch(rr, req)
+		return rr
+	}
+
+	getBatch := func(id int64, token string) *httptest.ResponseRecorder {
+		idStr := strconv.FormatInt(id, 10)
+		req := httptest.NewRequest("GET", "/batches/"+idStr, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req = mux.SetURLVars(req, map[string]string{"id": idStr})
+		rr := httptest.NewRecorder()
+		orchestrator.HandleGetBatch(rr, req)
+		return rr
+	}
+
+	rr := calculateBatch(`{"expressions": ["2+2", "2+", "42", "missing*2", "sqrt(1, 2)"]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var response orchestrator.BatchCalculateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.Items) != 5 {
+		t.Fatalf("Expected 5 items, got %d", len(response.Items))
+	}
+	for i, wantValid := range []bool{true, false, true, false, false} {
+		item := response.Items[i]
+		if item.Index != i {
+			t.Errorf("Item %d index = %d", i, item.Index)
+		}
+		if wantValid && (item.ID == nil || item.Error != "") {
+			t.Errorf("Item %d = %+v, want stored expression", i, item)
+		}
+		if !wantValid && (item.ID != nil || item.Error == "") {
+			t.Errorf("Item %d = %+v, want validation error", i, item)
+		}
+	}
+
+	t.Run("Status", func(t *testing.T) {
+		rr := getBatch(response.BatchID, token)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var status orchestrator.BatchStatusResponse
+		if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		// "42" вычисляется сразу, "2+2" ожидает агента
+		if status.Total != 2 || status.Counts[db.StatusCompleted] != 1 || status.Counts[db.StatusPending] != 1 {
+			t.Errorf("Batch total = %d, counts = %v, want 1 completed and 1 pending", status.Total, status.Counts)
+		}
+		if status.Status != db.StatusPending {
+			t.Errorf("Batch status = %v, want %v", status.Status, db.StatusPending)
+		}
+		if len(status.Expressions) != 2 || status.Expressions[0].ID != *response.Items[0].ID {
+			t.Errorf("Batch expressions = %v, want items 0 and 2 in order", status.Expressions)
+		}
+	})
+
+	t.Run("Other user", func(t *testing.T) {
+		other, err := db.CreateUser("otheruser", "password123")
+		if err != nil {
+			t.Fatalf("Failed to create other user: %v", err)
+		}
+		otherToken, err := auth.GenerateToken(other)
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+
+		if rr := getBatch(response.BatchID, otherToken); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		if rr := getBatch(response.BatchID+100, token); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("Decimal mode", func(t *testing.T) {
+		rr := calculateBatch(`{"expressions": ["0.125", "1/3", "sqrt(2.25)", "log(2)"], "mode": "decimal", "precision": 2, "rounding": "half_up"}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		var response orchestrator.BatchCalculateResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		// Функция log в режиме decimal отклоняется так же, как в POST /calculate
+		for i, wantValid := range []bool{true, true, true, false} {
+			if got := response.Items[i].ID != nil; got != wantValid {
+				t.Errorf("Item %d = %+v, want valid = %v", i, response.Items[i], wantValid)
+			}
+		}
+
+		rr = getBatch(response.BatchID, token)
+		var status orchestrator.BatchStatusResponse
+		if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		for _, expr := range status.Expressions {
+			if expr.Mode != "decimal" || expr.Precision == nil || *expr.Precision != 2 || expr.Rounding == nil || *expr.Rounding != "half_up" {
+				t.Errorf("Expression %d mode = %s, precision = %v, rounding = %v, want decimal 2 half_up", expr.ID, expr.Mode, expr.Precision, expr.Rounding)
+			}
+		}
+		// Константа округляется способом пакета при сохранении
+		if first := status.Expressions[0]; first.ExactResult == nil || *first.ExactResult != "0.13" {
+			t.Errorf("Exact result of 0.125 = %v, want 0.13", first.ExactResult)
+		}
+	})
+
+	t.Run("Invalid mode", func(t *testing.T) {
+		for _, body := range []string{
+			`{"expressions": ["1"], "mode": "complex"}`,
+			`{"expressions": ["1"], "precision": 2}`,
+			`{"expressions": ["1"], "mode": "decimal", "rounding": "up"}`,
+		} {
+			if rr := calculateBatch(body); rr.Code != http.StatusUnprocessableEntity {
+				t.Errorf("%s: expected status code %d, got %d", body, http.StatusUnprocessableEntity, rr.Code)
+			}
+		}
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		for _, body := range []string{`{"expressions": []}`, `{"expressions": "2+2"}`, `not json`} {
+			if rr := calculateBatch(body); rr.Code != http.StatusUnprocessableEntity {
+				t.Errorf("%s: expected status code %d, got %d", body, http.StatusUnprocessableEntity, rr.Code)
+			}
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"parallel-calculator/internal/auth"
 	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/numeric"
 )
 
 // GetUserIDFromRequest извлекает ID пользователя из запроса с JWT-токеном
@@ -64,26 +65,83 @@ func UpdateOperationStatusInDB(operationID int64, status string) error {
 
 // SetOperationResultInDB устанавливает результат операции
 func SetOperationResultInDB(operationID int64, result float64) error {
+	return inTx(func(tx db.TxStore, fx *effects) error {
+		return setOperationResult(tx, fx, operationID, result)
+	})
+}
+
+func setOperationResult(tx db.TxStore, fx *effects, operationID int64, result float64) error {
 	// Вызываем базовую функцию для установки результата операции
-	err := db.SetOperationResult(operationID, result)
+	err := tx.SetOperationResult(operationID, result)
 	if err != nil {
 		return err
 	}
 
 	// Проверяем, является ли это корневой операцией
-	operationInfo, err := db.GetOperationInfo(operationID)
+	operationInfo, err := tx.GetOperationInfo(operationID)
 	if err != nil {
 		return err
 	}
 
-	// Если это корневая операция, обновляем результат выражения
+	// Если это корневая операция, обновляем результат выражения, если оно не отменено
+	// и не завершено с ошибкой
 	if operationInfo.IsRootExpression && operationInfo.ExpressionID > 0 {
-		return db.SetExpressionResult(operationInfo.ExpressionID, result)
+		completed, err := tx.CompleteExpression(operationInfo.ExpressionID, result)
+		if err != nil {
+			return err
+		}
+		if completed {
+			fx.updated(operationInfo.ExpressionID)
+		}
 	}
 
 	return nil
 }
 
+// SetOperationExactResultInDB сохраняет точный результат операции op и передает его
+// точным операндом родительской операции или точным результатом выражения
+func SetOperationExactResultInDB(op *db.Operation, exact string) error {
+	return db.InTx(func(tx db.TxStore) error {
+		return setOperationExactResult(tx, op, exact)
+	})
+}
+
+func setOperationExactResult(tx db.TxStore, op *db.Operation, exact string) error {
+	if err := tx.SetOperationExactResult(op.ID, exact); err != nil {
+		return err
+	}
+
+	if op.IsRootExpression {
+		return tx.SetExpressionExactResult(op.ExpressionID, exact)
+	}
+	if op.ParentOpID != nil && op.ChildPosition != nil {
+		return tx.SetOperationExactOperand(*op.ParentOpID, *op.ChildPosition, exact)
+	}
+	return nil
+}
+
+// SetOperationIntervalResultInDB сохраняет границы результата операции op и передает их
+// границами операнда родительской операции или границами результата выражения
+func SetOperationIntervalResultInDB(op *db.Operation, result numeric.Interval) error {
+	return db.InTx(func(tx db.TxStore) error {
+		return setOperationIntervalResult(tx, op, result)
+	})
+}
+
+func setOperationIntervalResult(tx db.TxStore, op *db.Operation, result numeric.Interval) error {
+	if err := tx.SetOperationIntervalResult(op.ID, result.Lower, result.Upper); err != nil {
+		return err
+	}
+
+	if op.IsRootExpression {
+		return tx.SetExpressionIntervalResult(op.ExpressionID, result.Lower, result.Upper)
+	}
+	if op.ParentOpID != nil && op.ChildPosition != nil {
+		return tx.SetOperationIntervalOperand(*op.ParentOpID, *op.ChildPosition, result.Lower, result.Upper)
+	}
+	return nil
+}
+
 // HandleOperationErrorInDB обрабатывает ошибку операции
 func HandleOperationErrorInDB(operationID int64, errorMsg string) error {
 	// Получаем операцию, чтобы узнать выражение
@@ -98,43 +156,95 @@ func HandleOperationErrorInDB(operationID int64, errorMsg string) error {
 		return fmt.Errorf("ошибка при установке ошибки операции: %w", err)
 	}
 
-	// Устанавливаем ошибку для выражения
-	err = db.SetExpressionError(op.ExpressionID, errorMsg)
+	// Устанавливаем ошибку для выражения и запоминаем вызвавшую ее операцию
+	err = db.SetExpressionOperationError(op, errorMsg)
 	if err != nil {
 		return fmt.Errorf("ошибка при установке ошибки выражения: %w", err)
 	}
+	expressionFinished(db.StatusError)
+	expressionUpdated(op.ExpressionID)
 
 	return nil
 }
 
 // HandleOperationErrorWithCancellation обрабатывает ошибку операции и отменяет все связанные операции
 func HandleOperationErrorWithCancellation(operationID int64, errorMsg string) error {
+	return inTx(func(tx db.TxStore, fx *effects) error {
+		return handleOperationError(tx, fx, operationID, errorMsg)
+	})
+}
+
+func handleOperationError(tx db.TxStore, fx *effects, operationID int64, errorMsg string) error {
 	// Сначала получаем операцию, чтобы узнать выражение
-	op, err := db.GetOperationByID(operationID)
+	op, err := tx.GetOperationByID(operationID)
 	if err != nil {
 		return fmt.Errorf("ошибка при получении операции: %w", err)
 	}
 
-	// Устанавливаем ошибку для выражения
-	err = db.SetExpressionError(op.ExpressionID, errorMsg)
+	// Устанавливаем ошибку для операции, чтобы она показывалась в дереве операций
+	err = tx.SetOperationError(op.ID, errorMsg)
+	if err != nil {
+		return fmt.Errorf("ошибка при установке ошибки операции: %w", err)
+	}
+
+	// Устанавливаем ошибку для выражения и запоминаем вызвавшую ее операцию
+	err = tx.SetExpressionOperationError(op, errorMsg)
 	if err != nil {
 		return fmt.Errorf("ошибка при установке ошибки выражения: %w", err)
 	}
 
-	// Отменяем все остальные операции выражения
-	err = db.CancelOperationsByExpressionID(op.ExpressionID)
+	// Отменяем остальные незавершенные операции выражения
+	err = tx.CancelOperationsByExpressionID(op.ExpressionID)
 	if err != nil {
 		return fmt.Errorf("ошибка при отмене операций: %w", err)
 	}
+	fx.finished(db.StatusError)
+	fx.updated(op.ExpressionID)
 
 	return nil
 }
 
+// failExpression завершает ошибкой errorMsg выражение expr, все операции которого уже вычислены,
+// если оно не отменено и не завершено с ошибкой раньше
+func failExpression(tx db.TxStore, fx *effects, expr *db.Expression, errorMsg string) error {
+	if expr.Status == db.StatusCanceled || expr.Status == db.StatusError {
+		return nil
+	}
+	if err := tx.SetExpressionError(expr.ID, errorMsg); err != nil {
+		return fmt.Errorf("ошибка при установке ошибки выражения: %w", err)
+	}
+	fx.finished(db.StatusError)
+	fx.updated(expr.ID)
+	return nil
+}
+
+// CancelExpression отменяет выражение и все его незавершенные операции
+func CancelExpression(expressionID int64) error {
+	err := db.CancelExpression(expressionID)
+	if err != nil {
+		switch err {
+		case db.ErrExpressionNotFound:
+			return ErrExpressionNotFound
+		case db.ErrExpressionNotCancelable:
+			return ErrExpressionNotCancelable
+		}
+		return fmt.Errorf("ошибка при отмене выражения: %w", err)
+	}
+	expressionFinished(db.StatusCanceled)
+	expressionUpdated(expressionID)
+	return nil
+}
+
 // GetExpressionsByUserID получает все выражения пользователя
 func GetExpressionsByUserID(userID int64) ([]*db.Expression, error) {
 	return db.GetUserExpressions(userID)
 }
 
+// GetOperationsByExpressionID получает все операции выражения
+func GetOperationsByExpressionID(expressionID int64) ([]*db.Operation, error) {
+	return db.GetOperationsByExpressionID(expressionID)
+}
+
 // GetExpressionByID получает выражение по ID
 func GetExpressionByID(id int64) (*db.Expression, error) {
 	expr, err := db.GetExpressionByID(id)
@@ -150,6 +260,12 @@ func GetExpressionByID(id int64) (*db.Expression, error) {
 
 // UpdateParentOperation обновляет аргументы родительской операции
 func UpdateParentOperation(op *db.Operation, result float64) error {
+	return inTx(func(tx db.TxStore, fx *effects) error {
+		return updateParentOperation(tx, fx, op, result)
+	})
+}
+
+func updateParentOperation(tx db.TxStore, fx *effects, op *db.Operation, result float64) error {
 	if op.ParentOpID == nil || op.ChildPosition == nil {
 		return fmt.Errorf("operation has no parent or position")
 	}
@@ -158,32 +274,45 @@ func UpdateParentOperation(op *db.Operation, result float64) error {
 	switch *op.ChildPosition {
 	case "left":
 		// Обновляем левый аргумент родителя
-		err := db.UpdateOperationLeftValue(*op.ParentOpID, result)
+		err := tx.UpdateOperationLeftValue(*op.ParentOpID, result)
 		if err != nil {
 			return fmt.Errorf("ошибка при обновлении левого аргумента родителя: %w", err)
 		}
 	case "right":
 		// Обновляем правый аргумент родителя
-		err := db.UpdateOperationRightValue(*op.ParentOpID, result)
+		err := tx.UpdateOperationRightValue(*op.ParentOpID, result)
 		if err != nil {
 			return fmt.Errorf("ошибка при обновлении правого аргумента родителя: %w", err)
 		}
 	default:
-		return fmt.Errorf("неизвестная позиция операнда: %s", *op.ChildPosition)
+		// Аргумент родительской функции
+		index, ok := db.ArgumentIndex(*op.ChildPosition)
+		if !ok {
+			return fmt.Errorf("неизвестная позиция операнда: %s", *op.ChildPosition)
+		}
+		err := tx.UpdateOperationArgument(*op.ParentOpID, index, result)
+		if err != nil {
+			return fmt.Errorf("ошибка при обновлении аргумента %d родителя: %w", index, err)
+		}
 	}
 
-	// Проверяем, есть ли у родителя оба значения
-	parentOp, err := db.GetOperationByID(*op.ParentOpID)
+	// Проверяем, есть ли у родителя все значения
+	parentOp, err := tx.GetOperationByID(*op.ParentOpID)
 	if err != nil {
 		return fmt.Errorf("ошибка при получении родительской операции: %w", err)
 	}
 
-	if parentOp.LeftValue != nil && parentOp.RightValue != nil {
-		// Если оба аргумента заполнены, устанавливаем статус "ready"
-		err = db.UpdateOperationStatus(*op.ParentOpID, db.StatusReady)
+	if parentOp.OperandsReady() {
+		// Если все аргументы заполнены, устанавливаем статус "ready".
+		// Статус меняется только у ожидающей операции: родитель отмененного выражения
+		// или уже выданный агенту родитель в очередь не возвращается
+		marked, err := tx.MarkOperationReady(*op.ParentOpID)
 		if err != nil {
 			return fmt.Errorf("ошибка при обновлении статуса родительской операции: %w", err)
 		}
+		if marked {
+			fx.ready()
+		}
 	}
 
 	return nil
@@ -196,17 +325,50 @@ func GetReadyOperationFromDB() (*db.Operation, error) {
 
 // FinalizeExpression устанавливает результат выражения и обновляет его статус на "completed"
 func FinalizeExpression(expressionID int64, result float64) error {
-	// 1. Устанавливаем результат выражения
-	err := db.SetExpressionResult(expressionID, result)
+	return inTx(func(tx db.TxStore, fx *effects) error {
+		return finalizeExpression(tx, fx, expressionID, result)
+	})
+}
+
+func finalizeExpression(tx db.TxStore, fx *effects, expressionID int64, result float64) error {
+	// В режиме decimal промежуточные значения хранят лишние знаки: результат
+	// округляется до заданного числа знаков один раз, при завершении выражения
+	expr, err := tx.GetExpressionByID(expressionID)
 	if err != nil {
-		return fmt.Errorf("ошибка при установке результата выражения: %w", err)
+		return fmt.Errorf("ошибка при получении выражения: %w", err)
+	}
+	var rounded *string
+	if expr.Mode == numeric.ModeDecimal && expr.ExactResult != nil {
+		exact, err := numeric.ParseRational(*expr.ExactResult)
+		if err != nil {
+			return fmt.Errorf("ошибка при разборе точного результата выражения: %w", err)
+		}
+		var s string
+		result, s, err = settingsOf(expr.Mode, expr.Precision, expr.Rounding).Result(exact)
+		if err != nil {
+			return failExpression(tx, fx, expr, err.Error())
+		}
+		rounded = &s
 	}
 
-	// 2. Обновляем статус выражения на "completed"
-	err = db.UpdateExpressionStatus(expressionID, db.StatusCompleted)
+	// Устанавливаем результат и статус "completed", если выражение не отменено и не завершено
+	// с ошибкой: такое выражение уже завершено, а его webhook уже отправлен
+	completed, err := tx.CompleteExpression(expressionID, result)
 	if err != nil {
-		return fmt.Errorf("ошибка при обновлении статуса выражения: %w", err)
+		return fmt.Errorf("ошибка при установке результата выражения: %w", err)
+	}
+	if !completed {
+		// Результат отмененного выражения отбрасывается так же, как результат отмененной операции
+		return nil
+	}
+
+	if rounded != nil {
+		if err := tx.SetExpressionExactResult(expressionID, *rounded); err != nil {
+			return fmt.Errorf("ошибка при установке точного результата выражения: %w", err)
+		}
 	}
+	fx.finished(db.StatusCompleted)
+	fx.updated(expressionID)
 
 	return nil
 }
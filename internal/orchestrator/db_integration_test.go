@@ -346,7 +346,7 @@ func TestHandleOperationErrorWithCancellation(t *testing.T) {
 		t.Fatalf("Failed to create root operation: %v", err)
 	}
 
-	// Левая операция - сложение
+	// Левая операция - сложение, уже вычисленная
 	leftPos := "left"
 	left, err := db.CreateOperation(
 		expr.ID,
@@ -355,7 +355,7 @@ func TestHandleOperationErrorWithCancellation(t *testing.T) {
 		nil, nil,
 		false,
 		&leftPos,
-		db.StatusPending,
+		db.StatusCompleted,
 	)
 	if err != nil {
 		t.Fatalf("Failed to create left operation: %v", err)
@@ -400,7 +400,7 @@ func TestHandleOperationErrorWithCancellation(t *testing.T) {
 		t.Errorf("Expression error message = %v, want %v", *updatedExpr.ErrorMessage, errorMsg)
 	}
 
-	// Проверяем, что все операции были отменены
+	// Проверяем, что отменены только незавершенные операции
 	updatedRoot, err := db.GetOperationByID(root.ID)
 	if err != nil {
 		t.Errorf("Failed to get updated root operation: %v", err)
@@ -424,12 +424,16 @@ func TestHandleOperationErrorWithCancellation(t *testing.T) {
 		t.Errorf("Root operation status = %v, want %v", updatedRoot.Status, db.StatusCanceled)
 	}
 
-	if updatedLeft.Status != db.StatusCanceled {
-		t.Errorf("Left operation status = %v, want %v", updatedLeft.Status, db.StatusCanceled)
+	if updatedLeft.Status != db.StatusCompleted {
+		t.Errorf("Left operation status = %v, want %v", updatedLeft.Status, db.StatusCompleted)
 	}
 
-	if updatedRight.Status != db.StatusCanceled {
-		t.Errorf("Right operation status = %v, want %v", updatedRight.Status, db.StatusCanceled)
+	// Операция с ошибкой хранит статус "error" и сообщение
+	if updatedRight.Status != db.StatusError {
+		t.Errorf("Right operation status = %v, want %v", updatedRight.Status, db.StatusError)
+	}
+	if updatedRight.ErrorMessage == nil || *updatedRight.ErrorMessage != errorMsg {
+		t.Errorf("Right operation error message = %v, want %v", updatedRight.ErrorMessage, errorMsg)
 	}
 }
 
@@ -482,6 +486,59 @@ func TestFinalizeExpression(t *testing.T) {
 	}
 }
 
+// TestFinalizeExpression_Finished проверяет, что результат не завершает отмененное
+// или завершенное с ошибкой выражение и не отправляет webhook о его завершении
+func TestFinalizeExpression_Finished(t *testing.T) {
+	initTestDB(t)
+	defer cleanupTestDB()
+
+	user, err := db.CreateUser("testuser_finalize_finished", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		finish func(id int64) error
+		status string
+	}{
+		{name: "Canceled", finish: db.CancelExpression, status: db.StatusCanceled},
+		{name: "Error", finish: func(id int64) error { return db.SetExpressionError(id, "division by zero") }, status: db.StatusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callbackURL := "http://127.0.0.1:1/hook"
+			expr := &db.Expression{UserID: user.ID, Expression: "5+7", CallbackURL: &callbackURL}
+			if err := db.InsertExpression(expr); err != nil {
+				t.Fatalf("Failed to create test expression: %v", err)
+			}
+			if err := tt.finish(expr.ID); err != nil {
+				t.Fatalf("Failed to finish expression: %v", err)
+			}
+
+			if err := orchestrator.FinalizeExpression(expr.ID, 12); err != nil {
+				t.Fatalf("FinalizeExpression() error = %v", err)
+			}
+
+			updated, err := db.GetExpressionByID(expr.ID)
+			if err != nil {
+				t.Fatalf("Failed to get expression: %v", err)
+			}
+			if updated.Status != tt.status || updated.Result != nil {
+				t.Errorf("Expression status = %s, result = %v, want %s without result", updated.Status, updated.Result, tt.status)
+			}
+			deliveries, err := db.GetExpressionWebhookDeliveries(expr.ID)
+			if err != nil {
+				t.Fatalf("GetExpressionWebhookDeliveries() error = %v", err)
+			}
+			if len(deliveries) != 0 {
+				t.Errorf("Webhook deliveries = %d, want none for a discarded result", len(deliveries))
+			}
+		})
+	}
+}
+
 // TestCreateExpressionInDB проверяет создание выражения в базе данных
 func TestCreateExpressionInDB(t *testing.T) {
 	// Инициализируем БД
@@ -4,51 +4,93 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"parallel-calculator/internal/auth"
+	"parallel-calculator/internal/db"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/numeric"
+	"parallel-calculator/internal/syntax"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type CalculateRequest struct {
-	Expression string `json:"expression"`
+	Expression  string `json:"expression"`
+	CallbackURL string `json:"callback_url,omitempty"` // адрес для webhook о завершении выражения
+	Mode        string `json:"mode,omitempty"`         // числовой режим: "float" (по умолчанию), "rational", "decimal" или "interval"
+	Precision   *int   `json:"precision,omitempty"`    // знаков после запятой результата в режиме decimal
+	Rounding    string `json:"rounding,omitempty"`     // способ округления в режиме decimal: "half_even", "half_up" или "down"
 }
 
 type CalculateResponse struct {
 	ID int64 `json:"id"`
 }
 
+// SyntaxErrorResponse — тело ответа 422 на выражение с синтаксической ошибкой
+type SyntaxErrorResponse struct {
+	Error    string   `json:"error"`
+	Message  string   `json:"message"` // что не так в выражении
+	Offset   int      `json:"offset"`  // смещение ошибки в байтах от начала выражения
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Expected []string `json:"expected,omitempty"` // что допустимо в позиции ошибки
+}
+
 func HandleCalculate(w http.ResponseWriter, r *http.Request) {
 	var request CalculateRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		logger.LogERROR(fmt.Sprintf("Failed to decode calculate request: %v", err))
+		logger.Warn(r.Context(), "Failed to decode calculate request", "error", err)
 		http.Error(w, "Неверный формат запроса", http.StatusUnprocessableEntity)
 		return
 	}
 
-	logger.LogINFO(fmt.Sprintf("Received calculate request: %v", request.Expression))
+	logger.Info(r.Context(), "Received calculate request", "expression", request.Expression)
 
 	// Получаем ID пользователя из запроса с JWT-токеном
 	userID, err := GetUserIDFromToken(r)
 	if err != nil {
-		logger.LogERROR(fmt.Sprintf("Authentication error: %v", err))
+		logger.Warn(r.Context(), "Authentication error", "error", err)
 		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
 		return
 	}
 
 	// Обрабатываем выражение
-	id, err := ProcessExpression(request.Expression, userID)
+	id, err := ProcessExpressionOptions(r.Context(), request.Expression, userID, ExpressionOptions{
+		CallbackURL: request.CallbackURL,
+		Mode:        request.Mode,
+		Precision:   request.Precision,
+		Rounding:    request.Rounding,
+	})
 	if err != nil {
-		if err == ErrInvalidExpression {
-			logger.LogERROR(fmt.Sprintf("Invalid expression: %v", err))
-			http.Error(w, "Неверное выражение", http.StatusUnprocessableEntity)
+		if errors.Is(err, ErrInvalidMode) {
+			logger.Warn(r.Context(), "Invalid numeric mode", "error", err)
+			http.Error(w, "Неверный mode", http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, ErrInvalidDecimal) {
+			logger.Warn(r.Context(), "Invalid decimal options", "error", err)
+			http.Error(w, "Неверные precision или rounding", http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, ErrInvalidCallbackURL) {
+			logger.Warn(r.Context(), "Invalid callback url", "error", err)
+			http.Error(w, "Неверный callback_url", http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, ErrInvalidExpression) {
+			logger.Warn(r.Context(), "Invalid expression", "error", err)
+			writeSyntaxError(w, err)
+			return
+		}
+		if errors.Is(err, ErrUnresolvedReference) {
+			logger.Warn(r.Context(), "Invalid expression reference", "error", err)
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
-		logger.LogERROR(fmt.Sprintf("Failed to process expression: %v", err))
+		logger.Error(r.Context(), "Failed to process expression", "error", err)
 		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
 		return
 	}
@@ -66,10 +108,115 @@ func HandleCalculate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writeSyntaxError отвечает 422 с позицией синтаксической ошибки выражения
+func writeSyntaxError(w http.ResponseWriter, err error) {
+	var syntaxErr *syntax.Error
+	if !errors.As(err, &syntaxErr) {
+		http.Error(w, "Неверное выражение", http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(SyntaxErrorResponse{
+		Error:    "Неверное выражение",
+		Message:  syntaxErr.Msg,
+		Offset:   syntaxErr.Offset,
+		Line:     syntaxErr.Line,
+		Column:   syntaxErr.Column,
+		Expected: syntaxErr.Expected,
+	})
+}
+
+// ExpressionResponse описывает выражение в ответах API.
+// Result равен null, пока выражение не вычислено или если при вычислении произошла ошибка.
+// В режимах rational и decimal Result — приближение точного результата ExactResult,
+// в режиме interval — середина интервала Interval
 type ExpressionResponse struct {
-	ID     int64   `json:"id"`
-	Status string  `json:"status"`
-	Result float64 `json:"result"`
+	ID            int64             `json:"id"`
+	Expression    string            `json:"expression"`
+	Mode          string            `json:"mode"`
+	Precision     *int              `json:"precision,omitempty"` // знаков после запятой результата в режиме decimal
+	Rounding      *string           `json:"rounding,omitempty"`  // способ округления в режиме decimal
+	Status        string            `json:"status"`
+	Result        *float64          `json:"result"`
+	ExactResult   *string           `json:"exact_result,omitempty"`   // дробь "p/q" в режиме rational, ровно precision знаков в режиме decimal
+	DecimalResult *string           `json:"decimal_result,omitempty"` // десятичная запись ExactResult, период в скобках
+	Interval      *numeric.Interval `json:"interval,omitempty"`       // гарантированные границы результата в режиме interval
+	ErrorMessage  *string           `json:"error_message"`
+	ErrorLocation *ErrorLocation    `json:"error_location"` // подвыражение, вычисление которого завершилось ошибкой
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// ErrorLocation указывает подвыражение, операция которого завершила выражение ошибкой
+type ErrorLocation struct {
+	OperationID int64  `json:"operation_id"`
+	Start       int    `json:"start"` // смещение подвыражения в байтах от начала выражения
+	End         int    `json:"end"`   // смещение байта, следующего за подвыражением
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	Text        string `json:"text"`   // текст подвыражения, например "(4 / (2 - 2))"
+	Marker      string `json:"marker"` // строка выражения и под ней "^" под подвыражением
+}
+
+// newExpressionResponse формирует ответ API по выражению из базы данных
+func newExpressionResponse(expr *db.Expression) ExpressionResponse {
+	response := ExpressionResponse{
+		ID:            expr.ID,
+		Expression:    expr.Expression,
+		Mode:          expr.Mode,
+		Precision:     expr.Precision,
+		Rounding:      expr.Rounding,
+		Status:        expr.Status,
+		Result:        expr.Result,
+		ErrorMessage:  expr.ErrorMessage,
+		ErrorLocation: newErrorLocation(expr),
+		CreatedAt:     expr.CreatedAt,
+		UpdatedAt:     expr.UpdatedAt,
+	}
+
+	// Точный результат показывается только у завершенного выражения: в режиме decimal
+	// до завершения он еще не округлен до заданного числа знаков
+	if expr.ExactResult != nil && expr.Status == db.StatusCompleted {
+		switch expr.Mode {
+		case numeric.ModeDecimal:
+			response.ExactResult, response.DecimalResult = expr.ExactResult, expr.ExactResult
+		default:
+			if exact, err := numeric.ParseRational(*expr.ExactResult); err == nil {
+				decimal := numeric.RationalDecimal(exact)
+				response.ExactResult, response.DecimalResult = expr.ExactResult, &decimal
+			}
+		}
+	}
+	if expr.Status == db.StatusCompleted {
+		response.Interval = bounds(expr.ResultLower, expr.ResultUpper)
+	}
+	return response
+}
+
+// newErrorLocation возвращает подвыражение, вызвавшее ошибку выражения, или nil,
+// если ошибка не связана с операцией или ее границы неизвестны
+func newErrorLocation(expr *db.Expression) *ErrorLocation {
+	if expr.ErrorOperationID == nil || expr.ErrorStart == nil || expr.ErrorEnd == nil {
+		return nil
+	}
+
+	start, end := *expr.ErrorStart, *expr.ErrorEnd
+	if start < 0 || start > end || end > len(expr.Expression) {
+		return nil
+	}
+
+	line, column := syntax.Position(expr.Expression, start)
+	return &ErrorLocation{
+		OperationID: *expr.ErrorOperationID,
+		Start:       start,
+		End:         end,
+		Line:        line,
+		Column:      column,
+		Text:        expr.Expression[start:end],
+		Marker:      syntax.Highlight(expr.Expression, start, end),
+	}
 }
 
 // GetUserIDFromToken извлекает ID пользователя из JWT-токена
@@ -92,12 +239,12 @@ func GetUserIDFromToken(r *http.Request) (int64, error) {
 func HandleGetExpressions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	logger.LogINFO("Received get expressions request")
+	logger.Info(r.Context(), "Received get expressions request")
 
 	// Получаем ID пользователя из токена
 	userID, err := GetUserIDFromToken(r)
 	if err != nil {
-		logger.LogERROR(fmt.Sprintf("Authentication error: %v", err))
+		logger.Warn(r.Context(), "Authentication error", "error", err)
 		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
 		return
 	}
@@ -105,95 +252,185 @@ func HandleGetExpressions(w http.ResponseWriter, r *http.Request) {
 	// Получаем выражения пользователя из базы данных
 	expressions, err := GetExpressionsByUserID(userID)
 	if err != nil {
-		logger.LogERROR(fmt.Sprintf("Failed to get expressions: %v", err))
+		logger.Error(r.Context(), "Failed to get expressions", "error", err)
 		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
 		return
 	}
 
 	expressionsResponse := make([]ExpressionResponse, len(expressions))
 	for i, expr := range expressions {
-		response := ExpressionResponse{
-			ID:     expr.ID,
-			Status: expr.Status,
-		}
-		// Добавляем результат, если он существует
-		if expr.Result != nil {
-			response.Result = *expr.Result
-		}
-		expressionsResponse[i] = response
+		expressionsResponse[i] = newExpressionResponse(expr)
 	}
 
 	err = json.NewEncoder(w).Encode(expressionsResponse)
 	if err != nil {
-		logger.LogERROR(fmt.Sprintf("Failed to encode expressions response: %v", err))
+		logger.Error(r.Context(), "Failed to encode expressions response", "error", err)
 		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
 		return
 	}
 }
 
+// HandleGetExpressionByID возвращает выражение пользователя. С параметром wait ждет его завершения
 func HandleGetExpressionByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	expression, ok := loadUserExpression(w, r)
+	if !ok {
+		return
+	}
+
+	// Long-poll: ?wait=30s откладывает ответ до завершения выражения или истечения времени
+	if waitParam := r.URL.Query().Get("wait"); waitParam != "" {
+		wait, err := parseWait(waitParam)
+		if err != nil {
+			logger.Warn(r.Context(), "Invalid wait parameter", "wait", waitParam)
+			http.Error(w, "Неверный формат параметра wait", http.StatusBadRequest)
+			return
+		}
+
+		expression, err = WaitExpression(r.Context(), expression, wait)
+		if err != nil {
+			logger.Error(r.Context(), "Failed to wait for expression", "error", err)
+			http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := json.NewEncoder(w).Encode(newExpressionResponse(expression))
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode expression response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleGetExpressionOperations возвращает дерево операций выражения
+func HandleGetExpressionOperations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	expression, ok := loadUserExpression(w, r)
+	if !ok {
+		return
+	}
+
+	operations, err := GetOperationsByExpressionID(expression.ID)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to get expression operations", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	root, err := BuildOperationTree(operations)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to build operation tree", logger.KeyExpressionID, expression.ID, "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	response := ExpressionTreeResponse{
+		ID:         expression.ID,
+		Expression: expression.Expression,
+		Mode:       expression.Mode,
+		Status:     expression.Status,
+		Root:       root,
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode expression operations response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleCancelExpression отменяет выражение пользователя, которое еще вычисляется
+func HandleCancelExpression(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	expression, ok := loadUserExpression(w, r)
+	if !ok {
+		return
+	}
+
+	logger.Info(r.Context(), "Processing cancel expression request", logger.KeyExpressionID, expression.ID)
+
+	err := CancelExpression(expression.ID)
+	if err != nil {
+		if errors.Is(err, ErrExpressionNotCancelable) {
+			logger.Warn(r.Context(), "Expression is already finished", logger.KeyExpressionID, expression.ID, "status", expression.Status)
+			http.Error(w, "Выражение уже завершено", http.StatusConflict)
+			return
+		}
+		logger.Error(r.Context(), "Failed to cancel expression", logger.KeyExpressionID, expression.ID, "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	expression, err = GetExpressionByID(expression.ID)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to get canceled expression", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(newExpressionResponse(expression))
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode expression response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
+
+// loadUserExpression получает выражение по ID из URL и проверяет, что оно принадлежит пользователю из JWT-токена.
+// При ошибке записывает ответ и возвращает false
+func loadUserExpression(w http.ResponseWriter, r *http.Request) (*db.Expression, bool) {
 	// Получаем ID пользователя из JWT-токена
 	userID, err := GetUserIDFromToken(r)
 	if err != nil {
-		logger.LogERROR(fmt.Sprintf("Authentication error: %v", err))
+		logger.Warn(r.Context(), "Authentication error", "error", err)
 		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
-		return
+		return nil, false
 	}
 
 	vars := mux.Vars(r)
 	idStr := vars["id"] // получаем параметр id из URL
 
-	logger.LogINFO(fmt.Sprintf("Received get expression by id request: %v", idStr))
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		logger.LogERROR(fmt.Sprintf("Invalid expression ID format: %v", err))
+		logger.Warn(r.Context(), "Invalid expression ID format", "error", err)
 		http.Error(w, "Неверный формат ID", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
-	logger.LogINFO(fmt.Sprintf("Processing get expression by id request: %v for user: %v", id, userID))
+	logger.Info(r.Context(), "Processing get expression by id request", logger.KeyExpressionID, id)
 
 	// Получаем выражение по ID через функцию-прокси
 	expression, err := GetExpressionByID(int64(id))
 	if err != nil {
 		if errors.Is(err, ErrExpressionNotFound) || errors.Is(err, sql.ErrNoRows) {
-			logger.LogERROR(fmt.Sprintf("Expression not found: %v", id))
+			logger.Warn(r.Context(), "Expression not found", logger.KeyExpressionID, id)
 			http.Error(w, "Выражение не найдено", http.StatusNotFound)
-			return
+			return nil, false
 		}
-		logger.LogERROR(fmt.Sprintf("Failed to get expression by id: %v", err))
+		logger.Error(r.Context(), "Failed to get expression by id", logger.KeyExpressionID, id, "error", err)
 		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	// Проверяем, что выражение принадлежит этому пользователю
 	if expression.UserID != userID {
-		logger.LogERROR(fmt.Sprintf("Unauthorized access to expression: %v by user: %v", id, userID))
+		logger.Warn(r.Context(), "Unauthorized access to expression", logger.KeyExpressionID, id)
 		http.Error(w, "Нет доступа к этому выражению", http.StatusForbidden)
-		return
-	}
-
-	expressionResponse := ExpressionResponse{
-		ID:     expression.ID,
-		Status: expression.Status,
+		return nil, false
 	}
 
-	if expression.Result != nil {
-		expressionResponse.Result = *expression.Result
-	}
-
-	err = json.NewEncoder(w).Encode(expressionResponse)
-	if err != nil {
-		logger.LogERROR(fmt.Sprintf("Failed to encode expression response: %v", err))
-		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
-		return
-	}
+	return expression, true
 }
 
 type TaskResult struct {
-	ID     int64   `json:"id"`
-	Result float64 `json:"result"`
-	Error  string  `json:"error"`
+	ID       int64             `json:"id"`
+	Result   float64           `json:"result"`
+	Exact    string            `json:"exact,omitempty"`    // точный результат "p/q" операции в режиме rational
+	Interval *numeric.Interval `json:"interval,omitempty"` // границы результата операции в режиме interval
+	Error    string            `json:"error"`
 }
@@ -2,6 +2,7 @@ package orchestrator_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"parallel-calculator/internal/auth"
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/numeric"
 	"parallel-calculator/internal/orchestrator"
 	"strconv"
 	"testing"
@@ -90,6 +92,36 @@ func TestHandleCalculate(t *testing.T) {
 			expectedStatus: http.StatusUnprocessableEntity,
 			withToken:      true,
 		},
+		{
+			name:           "Rational mode",
+			body:           `{"expression": "1/3 + 1/6", "mode": "rational"}`,
+			expectedStatus: http.StatusCreated,
+			withToken:      true,
+		},
+		{
+			name:           "Invalid mode",
+			body:           `{"expression": "2+2", "mode": "complex"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			withToken:      true,
+		},
+		{
+			name:           "Decimal mode",
+			body:           `{"expression": "10 / 3", "mode": "decimal", "precision": 4, "rounding": "half_up"}`,
+			expectedStatus: http.StatusCreated,
+			withToken:      true,
+		},
+		{
+			name:           "Invalid rounding",
+			body:           `{"expression": "10 / 3", "mode": "decimal", "rounding": "up"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			withToken:      true,
+		},
+		{
+			name:           "Precision without decimal mode",
+			body:           `{"expression": "10 / 3", "precision": 2}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			withToken:      true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -143,6 +175,51 @@ func TestHandleCalculate(t *testing.T) {
 	}
 }
 
+// TestHandleCalculate_SyntaxError проверяет позицию синтаксической ошибки в ответе 422
+func TestHandleCalculate_SyntaxError(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	req := httptest.NewRequest("POST", "/calculate", bytes.NewBufferString(`{"expression": "max(1,\n 2 3)"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	orchestrator.HandleCalculate(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status code %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	var response orchestrator.SyntaxErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	expected := orchestrator.SyntaxErrorResponse{
+		Error:    "Неверное выражение",
+		Message:  "unexpected number 3",
+		Offset:   10,
+		Line:     2,
+		Column:   4,
+		Expected: []string{"operator", "','", "')'"},
+	}
+	if fmt.Sprint(response) != fmt.Sprint(expected) {
+		t.Errorf("Response = %+v, want %+v", response, expected)
+	}
+
+	// Выражение сохраняется со статусом ошибки и позицией в сообщении
+	expressions, err := db.GetUserExpressions(userID)
+	if err != nil || len(expressions) != 1 {
+		t.Fatalf("GetUserExpressions() = %v, %v, want one expression", expressions, err)
+	}
+	message := expressions[0].ErrorMessage
+	if expressions[0].Status != db.StatusError || message == nil ||
+		*message != "Invalid expression syntax: 2:4: unexpected number 3, expected operator, ',' or ')'" {
+		t.Errorf("Expression = %s %v, want syntax error", expressions[0].Status, message)
+	}
+}
+
 // TestHandleGetExpressions проверяет получение списка выражений пользователя
 func TestHandleGetExpressions(t *testing.T) {
 	// Инициализируем конфигурацию
@@ -335,11 +412,539 @@ func TestHandleGetExpressionByID(t *testing.T) {
 				if response.ID != idInt {
 					t.Errorf("Expected expression ID %d, got %d", idInt, response.ID)
 				}
+				if response.Expression != "5+5" {
+					t.Errorf("Expected expression text %q, got %q", "5+5", response.Expression)
+				}
+				// Выражение еще не вычислено, результат должен отсутствовать
+				if response.Result != nil {
+					t.Errorf("Expected null result for pending expression, got %v", *response.Result)
+				}
+				if response.CreatedAt.IsZero() {
+					t.Error("Expected created_at to be set")
+				}
+			}
+		})
+	}
+}
+
+// TestHandleGetExpressions_ErrorAndResult проверяет различие между нулевым результатом и ошибкой вычисления
+func TestHandleGetExpressions_ErrorAndResult(t *testing.T) {
+	initTestDB(t)
+
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	zeroExpr, err := db.CreateExpression(userID, "2-2")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	if err := db.SetExpressionResult(zeroExpr.ID, 0); err != nil {
+		t.Fatalf("Failed to set expression result: %v", err)
+	}
+
+	failedExpr, err := db.CreateExpression(userID, "1/0")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	if err := db.SetExpressionError(failedExpr.ID, "division by zero"); err != nil {
+		t.Fatalf("Failed to set expression error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/expressions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+
+	orchestrator.HandleGetExpressions(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var response []orchestrator.ExpressionResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	byID := make(map[int64]orchestrator.ExpressionResponse, len(response))
+	for _, expr := range response {
+		byID[expr.ID] = expr
+	}
+
+	zero, ok := byID[zeroExpr.ID]
+	if !ok {
+		t.Fatalf("Expression %d not found in response", zeroExpr.ID)
+	}
+	if zero.Result == nil || *zero.Result != 0 {
+		t.Errorf("Expected result 0, got %v", zero.Result)
+	}
+	if zero.ErrorMessage != nil {
+		t.Errorf("Expected no error message, got %q", *zero.ErrorMessage)
+	}
+
+	failed, ok := byID[failedExpr.ID]
+	if !ok {
+		t.Fatalf("Expression %d not found in response", failedExpr.ID)
+	}
+	if failed.Status != db.StatusError {
+		t.Errorf("Expected status %s, got %s", db.StatusError, failed.Status)
+	}
+	if failed.Result != nil {
+		t.Errorf("Expected null result for failed expression, got %v", *failed.Result)
+	}
+	if failed.ErrorMessage == nil || *failed.ErrorMessage != "division by zero" {
+		t.Errorf("Expected error message %q, got %v", "division by zero", failed.ErrorMessage)
+	}
+	if failed.Expression != "1/0" {
+		t.Errorf("Expected expression text %q, got %q", "1/0", failed.Expression)
+	}
+}
+
+// TestHandleGetExpressionByID_ErrorLocation проверяет, что ответ указывает подвыражение,
+// вычисление которого завершилось ошибкой
+func TestHandleGetExpressionByID_ErrorLocation(t *testing.T) {
+	initTestDB(t)
+
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	expression := "1 + (4 / (2 - 2))"
+	exprID, err := orchestrator.ProcessExpression(expression, userID)
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	operations, err := db.GetOperationsByExpressionID(*exprID)
+	if err != nil {
+		t.Fatalf("Failed to get operations: %v", err)
+	}
+	byOperator := make(map[string]*db.Operation, len(operations))
+	for _, op := range operations {
+		byOperator[op.Operator] = op
+	}
+
+	// 2 - 2 = 0, затем деление на ноль
+	err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: byOperator["-"].ID, Result: 0, Error: "nil"})
+	if err != nil {
+		t.Fatalf("ProcessExpressionResult() error = %v", err)
+	}
+	err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: byOperator["/"].ID, Error: "division by zero"})
+	if err != nil {
+		t.Fatalf("ProcessExpressionResult() error = %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/expressions/{id}", orchestrator.HandleGetExpressionByID)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/expressions/%d", *exprID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var response orchestrator.ExpressionResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Status != db.StatusError {
+		t.Errorf("Expected status %s, got %s", db.StatusError, response.Status)
+	}
+	location := response.ErrorLocation
+	if location == nil {
+		t.Fatal("Expected error location in response")
+	}
+	if location.OperationID != byOperator["/"].ID || location.Start != 4 || location.End != 17 ||
+		location.Line != 1 || location.Column != 5 {
+		t.Errorf("Unexpected error location: %+v", location)
+	}
+	if location.Text != "(4 / (2 - 2))" {
+		t.Errorf("Expected error text %q, got %q", "(4 / (2 - 2))", location.Text)
+	}
+	if want := "1 + (4 / (2 - 2))\n    ^^^^^^^^^^^^^"; location.Marker != want {
+		t.Errorf("Expected marker %q, got %q", want, location.Marker)
+	}
+}
+
+// TestHandleGetExpressionByID_ExactResult проверяет точный результат выражения в режиме rational
+func TestHandleGetExpressionByID_ExactResult(t *testing.T) {
+	initTestDB(t)
+
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "1/3 - 1/2", userID,
+		orchestrator.ExpressionOptions{Mode: "rational"})
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	operations, err := db.GetOperationsByExpressionID(*exprID)
+	if err != nil {
+		t.Fatalf("Failed to get operations: %v", err)
+	}
+	byOperator := make(map[string]*db.Operation, len(operations))
+	for _, op := range operations {
+		byOperator[op.Operator] = op
+	}
+
+	// Агент вычисляет 1/3 и 1/2 дробями, затем их разность
+	for _, op := range operations {
+		if op.Operator == "/" {
+			exact := "1/" + strconv.FormatFloat(*op.RightValue, 'g', -1, 64)
+			err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: op.ID, Result: 1 / *op.RightValue, Error: "nil", Exact: exact})
+			if err != nil {
+				t.Fatalf("ProcessExpressionResult() error = %v", err)
+			}
+		}
+	}
+	err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: byOperator["-"].ID, Result: -1.0 / 6, Error: "nil", Exact: "-1/6"})
+	if err != nil {
+		t.Fatalf("ProcessExpressionResult() error = %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/expressions/{id}", orchestrator.HandleGetExpressionByID)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/expressions/%d", *exprID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var response orchestrator.ExpressionResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Status != db.StatusCompleted || response.Mode != "rational" {
+		t.Fatalf("Expected completed rational expression, got %s %s", response.Status, response.Mode)
+	}
+	if response.ExactResult == nil || *response.ExactResult != "-1/6" {
+		t.Errorf("Expected exact result -1/6, got %v", response.ExactResult)
+	}
+	if response.DecimalResult == nil || *response.DecimalResult != "-0.1(6)" {
+		t.Errorf("Expected decimal result -0.1(6), got %v", response.DecimalResult)
+	}
+}
+
+// TestHandleGetExpressionByID_IntervalResult проверяет границы результата выражения в режиме interval
+func TestHandleGetExpressionByID_IntervalResult(t *testing.T) {
+	initTestDB(t)
+
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "[1, 2] * 3", userID,
+		orchestrator.ExpressionOptions{Mode: "interval"})
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	operations, err := db.GetOperationsByExpressionID(*exprID)
+	if err != nil || len(operations) != 1 {
+		t.Fatalf("Failed to get operations: %v (%d)", err, len(operations))
+	}
+	err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: operations[0].ID, Result: 4.5, Error: "nil",
+		Interval: &numeric.Interval{Lower: 3, Upper: 6}})
+	if err != nil {
+		t.Fatalf("ProcessExpressionResult() error = %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/expressions/{id}", orchestrator.HandleGetExpressionByID)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/expressions/%d", *exprID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var response orchestrator.ExpressionResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Status != db.StatusCompleted || response.Mode != "interval" {
+		t.Fatalf("Expected completed interval expression, got %s %s", response.Status, response.Mode)
+	}
+	if response.Interval == nil || *response.Interval != (numeric.Interval{Lower: 3, Upper: 6}) {
+		t.Errorf("Expected interval [3, 6], got %v", response.Interval)
+	}
+	if response.Result == nil || *response.Result != 4.5 {
+		t.Errorf("Expected midpoint result 4.5, got %v", response.Result)
+	}
+}
+
+// TestHandleGetExpressionOperations проверяет получение дерева операций выражения
+func TestHandleGetExpressionOperations(t *testing.T) {
+	// Инициализируем конфигурацию
+	initTestDB(t)
+
+	defer db.CleanupDB()
+
+	// Создаем тестового пользователя
+	userID, token := createTestUser(t)
+
+	// Создаем тестовые выражения
+	exprID, err := orchestrator.ProcessExpression("(2+3)*4", userID)
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	literalID, err := orchestrator.ProcessExpression("42", userID)
+	if err != nil {
+		t.Fatalf("Failed to create literal expression: %v", err)
+	}
+
+	// Создаем выражение другого пользователя
+	otherUser, err := db.CreateUser("otheruser", "password123")
+	if err != nil {
+		t.Fatalf("Failed to create other user: %v", err)
+	}
+	foreignID, err := orchestrator.ProcessExpression("1+1", otherUser.ID)
+	if err != nil {
+		t.Fatalf("Failed to create foreign expression: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+		expectRoot     bool
+	}{
+		{name: "Expression with operations", id: fmt.Sprintf("%d", *exprID), expectedStatus: http.StatusOK, expectRoot: true},
+		{name: "Literal expression", id: fmt.Sprintf("%d", *literalID), expectedStatus: http.StatusOK},
+		{name: "Invalid ID format", id: "invalid", expectedStatus: http.StatusBadRequest},
+		{name: "Expression not found", id: "999", expectedStatus: http.StatusNotFound},
+		{name: "Foreign expression", id: fmt.Sprintf("%d", *foreignID), expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", fmt.Sprintf("/expressions/%s/operations", tt.id), nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+
+			rr := httptest.NewRecorder()
+			orchestrator.HandleGetExpressionOperations(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response orchestrator.ExpressionTreeResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if !tt.expectRoot {
+				if response.Root != nil {
+					t.Errorf("Expected no operation tree, got %+v", response.Root)
+				}
+				return
+			}
+
+			if response.Expression != "(2+3)*4" {
+				t.Errorf("Expected expression text %q, got %q", "(2+3)*4", response.Expression)
+			}
+			if response.Root == nil || response.Root.Operator != "*" {
+				t.Fatalf("Expected root operator *, got %+v", response.Root)
+			}
+			if response.Root.Left == nil || response.Root.Left.Operator != "+" {
+				t.Fatalf("Expected left child operator +, got %+v", response.Root.Left)
+			}
+			if response.Root.Left.Status != db.StatusReady {
+				t.Errorf("Expected left child status %s, got %s", db.StatusReady, response.Root.Left.Status)
+			}
+			if response.Root.Right != nil {
+				t.Errorf("Expected no right child operation, got %+v", response.Root.Right)
+			}
+			if response.Root.RightValue == nil || *response.Root.RightValue != 4 {
+				t.Errorf("Expected root right value 4, got %v", response.Root.RightValue)
+			}
+
+			// Границы подвыражений операций: скобки входят в подвыражение
+			for _, node := range []*orchestrator.OperationNode{response.Root, response.Root.Left} {
+				if node.SourceStart == nil || node.SourceEnd == nil {
+					t.Fatalf("Expected source span for operation %d", node.ID)
+				}
+			}
+			if got := response.Expression[*response.Root.Left.SourceStart:*response.Root.Left.SourceEnd]; got != "(2+3)" {
+				t.Errorf("Expected left child source %q, got %q", "(2+3)", got)
+			}
+			if *response.Root.SourceStart != 0 || *response.Root.SourceEnd != len(response.Expression) {
+				t.Errorf("Expected root to span whole expression, got [%d, %d)", *response.Root.SourceStart, *response.Root.SourceEnd)
 			}
 		})
 	}
 }
 
+// TestHandleGetExpressionOperations_Failure проверяет дерево операций выражения, завершенного ошибкой:
+// вычисленные операции сохраняют результат, операция с ошибкой показывает ее, остальные отменены
+func TestHandleGetExpressionOperations_Failure(t *testing.T) {
+	initTestDB(t)
+
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	exprID, err := orchestrator.ProcessExpression("1 + (4 / (2 - 2))", userID)
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	operations, err := db.GetOperationsByExpressionID(*exprID)
+	if err != nil {
+		t.Fatalf("Failed to get operations: %v", err)
+	}
+	byOperator := make(map[string]*db.Operation, len(operations))
+	for _, op := range operations {
+		byOperator[op.Operator] = op
+	}
+
+	// 2 - 2 = 0, затем деление на ноль
+	err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: byOperator["-"].ID, Result: 0, Error: "nil"})
+	if err != nil {
+		t.Fatalf("ProcessExpressionResult() error = %v", err)
+	}
+	err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: byOperator["/"].ID, Error: "division by zero"})
+	if err != nil {
+		t.Fatalf("ProcessExpressionResult() error = %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/expressions/{id}/operations", orchestrator.HandleGetExpressionOperations)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/expressions/%d/operations", *exprID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var response orchestrator.ExpressionTreeResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != db.StatusError {
+		t.Errorf("Expected expression status %s, got %s", db.StatusError, response.Status)
+	}
+
+	root := response.Root
+	if root == nil || root.Operator != "+" || root.Status != db.StatusCanceled || root.Error != nil {
+		t.Fatalf("Expected canceled root + without error, got %+v", root)
+	}
+	failed := root.Right
+	if failed == nil || failed.Operator != "/" || failed.Status != db.StatusError {
+		t.Fatalf("Expected failed division node, got %+v", failed)
+	}
+	if failed.Error == nil || *failed.Error != "division by zero" {
+		t.Errorf("Expected division node error %q, got %v", "division by zero", failed.Error)
+	}
+	computed := failed.Right
+	if computed == nil || computed.Operator != "-" || computed.Status != db.StatusCompleted {
+		t.Fatalf("Expected completed subtraction node, got %+v", computed)
+	}
+	if computed.Result == nil || *computed.Result != 0 {
+		t.Errorf("Expected subtraction result 0, got %v", computed.Result)
+	}
+}
+
+// TestHandleCancelExpression проверяет отмену выражения пользователем
+func TestHandleCancelExpression(t *testing.T) {
+	initTestDB(t)
+
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	exprID, err := orchestrator.ProcessExpression("(1+2)*(3+4)", userID)
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	otherUser, err := db.CreateUser("otheruser", "password123")
+	if err != nil {
+		t.Fatalf("Failed to create other user: %v", err)
+	}
+	foreignID, err := orchestrator.ProcessExpression("1+1", otherUser.ID)
+	if err != nil {
+		t.Fatalf("Failed to create foreign expression: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+	}{
+		{name: "Cancel running expression", id: fmt.Sprintf("%d", *exprID), expectedStatus: http.StatusOK},
+		{name: "Cancel already canceled expression", id: fmt.Sprintf("%d", *exprID), expectedStatus: http.StatusConflict},
+		{name: "Foreign expression", id: fmt.Sprintf("%d", *foreignID), expectedStatus: http.StatusForbidden},
+		{name: "Expression not found", id: "999", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", fmt.Sprintf("/expressions/%s/cancel", tt.id), nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+
+			rr := httptest.NewRecorder()
+			orchestrator.HandleCancelExpression(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response orchestrator.ExpressionResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Status != db.StatusCanceled {
+				t.Errorf("Expected status %s, got %s", db.StatusCanceled, response.Status)
+			}
+		})
+	}
+
+	// Ни одна операция отмененного выражения не должна оставаться в очереди
+	operations, err := db.GetOperationsByExpressionID(*exprID)
+	if err != nil {
+		t.Fatalf("Failed to get operations: %v", err)
+	}
+	for _, op := range operations {
+		if op.Status != db.StatusCanceled {
+			t.Errorf("Operation %d status = %s, want %s", op.ID, op.Status, db.StatusCanceled)
+		}
+	}
+
+	// Выражение другого пользователя не затронуто
+	foreign, err := db.GetExpressionByID(*foreignID)
+	if err != nil {
+		t.Fatalf("Failed to get foreign expression: %v", err)
+	}
+	if foreign.Status == db.StatusCanceled {
+		t.Error("Foreign expression must not be canceled")
+	}
+}
+
 // TestGetUserIDFromToken проверяет извлечение ID пользователя из JWT-токена
 func TestGetUserIDFromToken(t *testing.T) {
 	// Инициализируем конфигурацию
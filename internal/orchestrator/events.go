@@ -0,0 +1,136 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/logger"
+	"time"
+)
+
+// MaxLongPollWait — максимальное время ожидания в режиме long-poll (?wait=...)
+const MaxLongPollWait = 60 * time.Second
+
+// Период отправки комментариев в поток SSE, чтобы прокси не закрывали простаивающее соединение
+const sseKeepAliveInterval = 15 * time.Second
+
+// errInvalidWait возвращается parseWait для неверного значения параметра wait
+var errInvalidWait = errors.New("invalid wait duration")
+
+// parseWait разбирает параметр wait ("30s", "1m"). Значения больше MaxLongPollWait ограничиваются
+func parseWait(value string) (time.Duration, error) {
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 {
+		return 0, errInvalidWait
+	}
+	return min(wait, MaxLongPollWait), nil
+}
+
+// WaitExpression ждет, пока выражение не завершится, но не дольше timeout или до отмены ctx.
+// Возвращает последнее состояние выражения
+func WaitExpression(ctx context.Context, expression *db.Expression, timeout time.Duration) (*db.Expression, error) {
+	if isFinalStatus(expression.Status) || timeout <= 0 {
+		return expression, nil
+	}
+
+	changed, unsubscribe := SubscribeExpression(expression.ID)
+	defer unsubscribe()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	id := expression.ID
+	for {
+		// Состояние перечитывается после подписки, чтобы не пропустить изменение между загрузкой и подпиской
+		expression, err := GetExpressionByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if isFinalStatus(expression.Status) {
+			return expression, nil
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return expression, nil
+		case <-ctx.Done():
+			return expression, nil
+		}
+	}
+}
+
+// HandleExpressionEvents отправляет состояние выражения потоком Server-Sent Events:
+// текущее состояние сразу после подключения и новое при каждом изменении.
+// Поток закрывается, когда выражение завершено
+func HandleExpressionEvents(w http.ResponseWriter, r *http.Request) {
+	expression, ok := loadUserExpression(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.Error(r.Context(), "Streaming is not supported by the response writer")
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	changed, unsubscribe := SubscribeExpression(expression.ID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	id := expression.ID
+	lastStatus := ""
+	for {
+		expression, err := GetExpressionByID(id)
+		if err != nil {
+			logger.Error(r.Context(), "Failed to get expression for events", logger.KeyExpressionID, id, "error", err)
+			return
+		}
+
+		if expression.Status != lastStatus {
+			if err := writeExpressionEvent(w, expression); err != nil {
+				logger.Error(r.Context(), "Failed to write expression event", "error", err)
+				return
+			}
+			flusher.Flush()
+			lastStatus = expression.Status
+		}
+
+		if isFinalStatus(expression.Status) {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeExpressionEvent записывает состояние выражения как событие SSE "status"
+func writeExpressionEvent(w http.ResponseWriter, expression *db.Expression) error {
+	data, err := json.Marshal(newExpressionResponse(expression))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+	return err
+}
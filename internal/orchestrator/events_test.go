@@ -0,0 +1,193 @@
+package orchestrator_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/orchestrator"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// completeExpression завершает выражение из одной операции результатом result, как это сделал бы агент
+func completeExpression(t *testing.T, expressionID int64, result float64) {
+	operations, err := db.GetOperationsByExpressionID(expressionID)
+	if err != nil || len(operations) != 1 {
+		t.Errorf("Failed to get operation of expression %d: %v", expressionID, err)
+		return
+	}
+
+	err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: operations[0].ID, Result: result})
+	if err != nil {
+		t.Errorf("ProcessExpressionResult() error = %v", err)
+	}
+}
+
+// TestHandleGetExpressionByID_Wait проверяет режим long-poll получения выражения
+func TestHandleGetExpressionByID_Wait(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	exprID, err := orchestrator.ProcessExpression("2+3", userID)
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	id := fmt.Sprintf("%d", *exprID)
+
+	getExpression := func(wait string) (*httptest.ResponseRecorder, time.Duration) {
+		req := httptest.NewRequest("GET", "/expressions/"+id+"?wait="+wait, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+
+		rr := httptest.NewRecorder()
+		start := time.Now()
+		orchestrator.HandleGetExpressionByID(rr, req)
+		return rr, time.Since(start)
+	}
+
+	decode := func(rr *httptest.ResponseRecorder) orchestrator.ExpressionResponse {
+		var response orchestrator.ExpressionResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	t.Run("Invalid wait", func(t *testing.T) {
+		if rr, _ := getExpression("soon"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		rr, elapsed := getExpression("100ms")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if response := decode(rr); response.Status != db.StatusPending {
+			t.Errorf("Expected status %s, got %s", db.StatusPending, response.Status)
+		}
+		if elapsed < 100*time.Millisecond {
+			t.Errorf("Response returned after %v, before wait expired", elapsed)
+		}
+	})
+
+	t.Run("Completed while waiting", func(t *testing.T) {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			completeExpression(t, *exprID, 5)
+		}()
+
+		rr, elapsed := getExpression("10s")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		response := decode(rr)
+		if response.Status != db.StatusCompleted || response.Result == nil || *response.Result != 5 {
+			t.Errorf("Expected completed expression with result 5, got %+v", response)
+		}
+		if elapsed > 5*time.Second {
+			t.Errorf("Response returned after %v, expected right after completion", elapsed)
+		}
+	})
+
+	t.Run("Already completed", func(t *testing.T) {
+		rr, elapsed := getExpression("10s")
+		if response := decode(rr); response.Status != db.StatusCompleted {
+			t.Errorf("Expected status %s, got %s", db.StatusCompleted, response.Status)
+		}
+		if elapsed > time.Second {
+			t.Errorf("Completed expression returned after %v", elapsed)
+		}
+	})
+}
+
+// TestHandleExpressionEvents проверяет поток SSE изменений состояния выражения
+func TestHandleExpressionEvents(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	exprID, err := orchestrator.ProcessExpression("2*3", userID)
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/expressions/{id}/events", orchestrator.HandleExpressionEvents)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/expressions/%d/events", server.URL, *exprID), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect to events stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// Читаем события "status" до закрытия потока
+	events := make(chan orchestrator.ExpressionResponse)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event orchestrator.ExpressionResponse
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Errorf("Failed to decode event %q: %v", data, err)
+				return
+			}
+			events <- event
+		}
+	}()
+
+	next := func() (orchestrator.ExpressionResponse, bool) {
+		select {
+		case event, ok := <-events:
+			return event, ok
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for event")
+			return orchestrator.ExpressionResponse{}, false
+		}
+	}
+
+	if event, ok := next(); !ok || event.Status != db.StatusPending {
+		t.Fatalf("First event = %+v, want current pending state", event)
+	}
+
+	completeExpression(t, *exprID, 6)
+
+	event, ok := next()
+	if !ok || event.Status != db.StatusCompleted || event.Result == nil || *event.Result != 6 {
+		t.Fatalf("Second event = %+v, want completed expression with result 6", event)
+	}
+
+	// После завершения выражения поток закрывается
+	if _, ok := next(); ok {
+		t.Error("Expected events stream to be closed after completion")
+	}
+}
@@ -0,0 +1,63 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/logger"
+	"time"
+)
+
+// ReapExpiredLeases возвращает в очередь операции, агенты которых не прислали результат до истечения аренды
+func ReapExpiredLeases() (int64, error) {
+	requeued, err := db.RequeueExpiredLeases(time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при возврате операций с истекшей арендой: %w", err)
+	}
+
+	if requeued > 0 {
+		logger.Info(context.Background(), "Возвращены в очередь операции с истекшей арендой", "count", requeued)
+		notifyReady()
+	}
+
+	return requeued, nil
+}
+
+// ReturnOperation возвращает в очередь операцию, которую агент получил, но не начал выполнять
+func ReturnOperation(operationID int64, leaseID string) error {
+	if err := db.RequeueLeasedOperation(operationID, leaseID); err != nil {
+		return fmt.Errorf("ошибка при возврате операции в очередь: %w", err)
+	}
+
+	logger.Info(context.Background(), "Операция возвращена в очередь", logger.KeyOperationID, operationID)
+	notifyReady()
+	return nil
+}
+
+// StartLeaseReaper запускает фоновую проверку истекших аренд с заданным периодом.
+// Возвращает функцию остановки, которая дожидается завершения текущей проверки
+func StartLeaseReaper(interval time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := ReapExpiredLeases(); err != nil {
+					logger.Error(context.Background(), "Lease reaper failed", "error", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
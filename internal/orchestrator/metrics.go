@@ -0,0 +1,45 @@
+package orchestrator
+
+import (
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/metrics"
+)
+
+var (
+	expressionsCreated = metrics.NewCounter(
+		"calculator_expressions_created_total",
+		"Expressions accepted for calculation.",
+	)
+	expressionsFinished = metrics.NewCounter(
+		"calculator_expressions_finished_total",
+		"Expressions finished by this orchestrator, by final status (completed, error, canceled).",
+		"status",
+	)
+	operationsByStatus = metrics.NewGaugeFunc(
+		"calculator_operations",
+		"Operations in the database by status: ready operations are the queue waiting for agents.",
+		"status",
+		func() (map[string]float64, error) {
+			counts, err := db.CountOperationsByStatus()
+			if err != nil {
+				return nil, err
+			}
+
+			values := make(map[string]float64, len(counts))
+			for status, count := range counts {
+				values[status] = float64(count)
+			}
+			return values, nil
+		},
+	)
+)
+
+// RegisterMetrics добавляет метрики оркестратора в реестр
+func RegisterMetrics(registry *metrics.Registry) {
+	registry.MustRegister(expressionsCreated, expressionsFinished, operationsByStatus)
+}
+
+// expressionFinished учитывает выражение, получившее итоговый статус
+func expressionFinished(status string) {
+	expressionsFinished.Inc(status)
+}
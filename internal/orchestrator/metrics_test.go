@@ -0,0 +1,117 @@
+package orchestrator_test
+
+import (
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/metrics"
+	"parallel-calculator/internal/orchestrator"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// metricValue возвращает значение строки метрики series (имя с метками) или 0, если ее нет
+func metricValue(t *testing.T, registry *metrics.Registry, series string) float64 {
+	t.Helper()
+
+	var out strings.Builder
+	if err := registry.Write(&out); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("Invalid value in %q: %v", line, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// TestMetrics проверяет счетчики выражений и число операций по статусам
+func TestMetrics(t *testing.T) {
+	initTestDB(t)
+	defer cleanupTestDB()
+
+	registry := metrics.NewRegistry()
+	orchestrator.RegisterMetrics(registry)
+
+	const (
+		created   = "calculator_expressions_created_total"
+		completed = `calculator_expressions_finished_total{status="completed"}`
+		failed    = `calculator_expressions_finished_total{status="error"}`
+		canceled  = `calculator_expressions_finished_total{status="canceled"}`
+		ready     = `calculator_operations{status="ready"}`
+	)
+	before := map[string]float64{}
+	for _, series := range []string{created, completed, failed, canceled} {
+		before[series] = metricValue(t, registry, series)
+	}
+	delta := func(series string) float64 {
+		return metricValue(t, registry, series) - before[series]
+	}
+
+	user, err := db.CreateUser("testuser_metrics", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	// Выражение из одного числа завершается сразу, некорректное — с ошибкой
+	if _, err := orchestrator.ProcessExpression("5", user.ID); err != nil {
+		t.Fatalf("ProcessExpression() error = %v", err)
+	}
+	if _, err := orchestrator.ProcessExpression("2++2", user.ID); err == nil {
+		t.Fatal("Expected error for invalid expression")
+	}
+
+	sumID, err := orchestrator.ProcessExpression("2+3", user.ID)
+	if err != nil {
+		t.Fatalf("ProcessExpression() error = %v", err)
+	}
+	canceledID, err := orchestrator.ProcessExpression("4*5", user.ID)
+	if err != nil {
+		t.Fatalf("ProcessExpression() error = %v", err)
+	}
+
+	if got := metricValue(t, registry, ready); got != 2 {
+		t.Errorf("Ready operations = %v, want 2", got)
+	}
+
+	// Вычисляем первое выражение и отменяем второе
+	op, err := db.ClaimReadyOperation("agent-metrics", "lease-metrics", func(*db.Operation) time.Time {
+		return time.Now().Add(time.Minute)
+	})
+	if err != nil || op == nil || op.ExpressionID != *sumID {
+		t.Fatalf("ClaimReadyOperation() = %v, %v", op, err)
+	}
+	if got := metricValue(t, registry, `calculator_operations{status="processing"}`); got != 1 {
+		t.Errorf("Processing operations = %v, want 1", got)
+	}
+
+	err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: op.ID, Result: 5, Error: "nil"})
+	if err != nil {
+		t.Fatalf("ProcessExpressionResult() error = %v", err)
+	}
+	if err := orchestrator.CancelExpression(*canceledID); err != nil {
+		t.Fatalf("CancelExpression() error = %v", err)
+	}
+
+	if got := delta(created); got != 4 {
+		t.Errorf("Created expressions delta = %v, want 4", got)
+	}
+	if got := delta(completed); got != 2 {
+		t.Errorf("Completed expressions delta = %v, want 2", got)
+	}
+	if got := delta(failed); got != 1 {
+		t.Errorf("Failed expressions delta = %v, want 1", got)
+	}
+	if got := delta(canceled); got != 1 {
+		t.Errorf("Canceled expressions delta = %v, want 1", got)
+	}
+	if got := metricValue(t, registry, ready); got != 0 {
+		t.Errorf("Ready operations after processing = %v, want 0", got)
+	}
+}
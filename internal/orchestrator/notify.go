@@ -0,0 +1,133 @@
+package orchestrator
+
+import (
+	"parallel-calculator/internal/db"
+	"slices"
+	"sync"
+)
+
+// Подписчики на появление операций в статусе "ready"
+var (
+	readyMutex       sync.Mutex
+	readySubscribers = make(map[chan struct{}]struct{})
+)
+
+// SubscribeReady возвращает канал, в который приходит сигнал при появлении готовых к выполнению операций,
+// и функцию отписки. Сигналы не накапливаются: несколько оповещений подряд дают один сигнал
+func SubscribeReady() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	readyMutex.Lock()
+	readySubscribers[ch] = struct{}{}
+	readyMutex.Unlock()
+
+	return ch, func() {
+		readyMutex.Lock()
+		delete(readySubscribers, ch)
+		readyMutex.Unlock()
+	}
+}
+
+// notifyReady оповещает подписчиков о появлении готовых к выполнению операций
+func notifyReady() {
+	readyMutex.Lock()
+	defer readyMutex.Unlock()
+
+	for ch := range readySubscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Подписчики на изменение состояния выражений, по ID выражения
+var (
+	expressionMutex       sync.Mutex
+	expressionSubscribers = make(map[int64]map[chan struct{}]struct{})
+)
+
+// SubscribeExpression возвращает канал, в который приходит сигнал при изменении состояния
+// выражения expressionID, и функцию отписки. Как и в SubscribeReady, сигналы не накапливаются
+func SubscribeExpression(expressionID int64) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	expressionMutex.Lock()
+	if expressionSubscribers[expressionID] == nil {
+		expressionSubscribers[expressionID] = make(map[chan struct{}]struct{})
+	}
+	expressionSubscribers[expressionID][ch] = struct{}{}
+	expressionMutex.Unlock()
+
+	return ch, func() {
+		expressionMutex.Lock()
+		delete(expressionSubscribers[expressionID], ch)
+		if len(expressionSubscribers[expressionID]) == 0 {
+			delete(expressionSubscribers, expressionID)
+		}
+		expressionMutex.Unlock()
+	}
+}
+
+// notifyExpression оповещает подписчиков об изменении состояния выражения
+func notifyExpression(expressionID int64) {
+	expressionMutex.Lock()
+	defer expressionMutex.Unlock()
+
+	for ch := range expressionSubscribers[expressionID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// effects накапливает оповещения об изменениях, сделанных в транзакции. Они отправляются
+// только после ее фиксации: подписчик не должен прочитать состояние, которое еще может быть откачено
+type effects struct {
+	finishedStatuses []string // статусы завершенных выражений для метрик
+	expressions      []int64  // выражения, состояние которых изменилось
+	readyOperations  bool     // появились готовые к выполнению операции
+}
+
+func (fx *effects) finished(status string) { fx.finishedStatuses = append(fx.finishedStatuses, status) }
+func (fx *effects) ready()                 { fx.readyOperations = true }
+
+// updated запоминает выражение, состояние которого изменилось; каждое выражение оповещается один раз
+func (fx *effects) updated(expressionID int64) {
+	if !slices.Contains(fx.expressions, expressionID) {
+		fx.expressions = append(fx.expressions, expressionID)
+	}
+}
+
+// send отправляет накопленные оповещения
+func (fx *effects) send() {
+	for _, status := range fx.finishedStatuses {
+		expressionFinished(status)
+	}
+	for _, expressionID := range fx.expressions {
+		expressionUpdated(expressionID)
+	}
+	if fx.readyOperations {
+		notifyReady()
+	}
+}
+
+// inTx выполняет fn в одной транзакции и после ее фиксации отправляет накопленные оповещения
+func inTx(fn func(tx db.TxStore, fx *effects) error) error {
+	var fx effects
+	if err := db.InTx(func(tx db.TxStore) error { return fn(tx, &fx) }); err != nil {
+		return err
+	}
+	fx.send()
+	return nil
+}
+
+// isFinalStatus сообщает, завершено ли выражение: после этих статусов состояние больше не меняется
+func isFinalStatus(status string) bool {
+	switch status {
+	case StatusCompleted, StatusError, StatusCanceled:
+		return true
+	}
+	return false
+}
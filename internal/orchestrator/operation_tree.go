@@ -0,0 +1,143 @@
+package orchestrator
+
+import (
+	"fmt"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/numeric"
+	"time"
+)
+
+// OperationNode представляет операцию в дереве вычисления выражения
+type OperationNode struct {
+	ID             int64               `json:"id"`
+	Operator       string              `json:"operator"`
+	Kind           string              `json:"kind"`
+	Status         string              `json:"status"`
+	ChildPosition  *string             `json:"child_position,omitempty"`
+	LeftValue      *float64            `json:"left_value"`
+	RightValue     *float64            `json:"right_value"`
+	Args           []*float64          `json:"args,omitempty"`
+	Result         *float64            `json:"result"`
+	LeftExact      *string             `json:"left_exact,omitempty"` // точные значения в режиме rational ("p/q")
+	RightExact     *string             `json:"right_exact,omitempty"`
+	ArgsExact      []*string           `json:"args_exact,omitempty"`
+	ResultExact    *string             `json:"result_exact,omitempty"`
+	LeftInterval   *numeric.Interval   `json:"left_interval,omitempty"` // границы значений в режиме interval
+	RightInterval  *numeric.Interval   `json:"right_interval,omitempty"`
+	ArgsInterval   []*numeric.Interval `json:"args_interval,omitempty"`
+	ResultInterval *numeric.Interval   `json:"result_interval,omitempty"`
+	Error          *string             `json:"error"`
+	SourceStart    *int                `json:"source_start"` // границы подвыражения операции в исходном выражении (байты)
+	SourceEnd      *int                `json:"source_end"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+	Left           *OperationNode      `json:"left,omitempty"`
+	Right          *OperationNode      `json:"right,omitempty"`
+	// Операции, вычисляющие аргументы функции; nil для литеральных аргументов
+	Arguments []*OperationNode `json:"arguments,omitempty"`
+}
+
+// ExpressionTreeResponse содержит выражение и дерево его операций
+type ExpressionTreeResponse struct {
+	ID         int64          `json:"id"`
+	Expression string         `json:"expression"`
+	Mode       string         `json:"mode"`
+	Status     string         `json:"status"`
+	Root       *OperationNode `json:"root"` // nil, если выражение не требовало операций
+}
+
+// BuildOperationTree собирает дерево операций по ссылкам на родителя.
+// Возвращает nil, если у выражения нет операций
+func BuildOperationTree(operations []*db.Operation) (*OperationNode, error) {
+	nodes := make(map[int64]*OperationNode, len(operations))
+	for _, op := range operations {
+		nodes[op.ID] = &OperationNode{
+			ID:             op.ID,
+			Operator:       op.Operator,
+			Kind:           op.Kind,
+			Status:         op.Status,
+			ChildPosition:  op.ChildPosition,
+			LeftValue:      op.LeftValue,
+			RightValue:     op.RightValue,
+			Args:           op.Args,
+			Result:         op.Result,
+			LeftExact:      op.LeftExact,
+			RightExact:     op.RightExact,
+			ArgsExact:      op.ArgsExact,
+			ResultExact:    op.ResultExact,
+			LeftInterval:   bounds(op.LeftLower, op.LeftUpper),
+			RightInterval:  bounds(op.RightLower, op.RightUpper),
+			ArgsInterval:   argumentBounds(op.ArgsLower, op.ArgsUpper),
+			ResultInterval: bounds(op.ResultLower, op.ResultUpper),
+			Error:          op.ErrorMessage,
+			SourceStart:    op.SourceStart,
+			SourceEnd:      op.SourceEnd,
+			CreatedAt:      op.CreatedAt,
+			UpdatedAt:      op.UpdatedAt,
+		}
+	}
+
+	var root *OperationNode
+	for _, op := range operations {
+		node := nodes[op.ID]
+
+		if op.ParentOpID == nil {
+			if root != nil {
+				return nil, fmt.Errorf("%w: несколько корневых операций", ErrInvalidAST)
+			}
+			root = node
+			continue
+		}
+
+		parent, ok := nodes[*op.ParentOpID]
+		if !ok {
+			return nil, fmt.Errorf("%w: операция %d", ErrParentNotFound, op.ID)
+		}
+
+		if op.ChildPosition == nil {
+			return nil, fmt.Errorf("%w: операция %d", ErrInvalidNodePosition, op.ID)
+		}
+
+		switch *op.ChildPosition {
+		case "left":
+			parent.Left = node
+		case "right":
+			parent.Right = node
+		default:
+			index, ok := db.ArgumentIndex(*op.ChildPosition)
+			if !ok || index >= len(parent.Args) {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidNodePosition, *op.ChildPosition)
+			}
+			if parent.Arguments == nil {
+				parent.Arguments = make([]*OperationNode, len(parent.Args))
+			}
+			parent.Arguments[index] = node
+		}
+	}
+
+	if root == nil && len(operations) > 0 {
+		return nil, fmt.Errorf("%w: нет корневой операции", ErrInvalidAST)
+	}
+
+	return root, nil
+}
+
+// bounds возвращает интервал с границами lower и upper или nil, если границ нет
+func bounds(lower, upper *float64) *numeric.Interval {
+	if lower == nil || upper == nil {
+		return nil
+	}
+	return &numeric.Interval{Lower: *lower, Upper: *upper}
+}
+
+// argumentBounds возвращает интервалы аргументов функции, nil еще не вычисленных
+func argumentBounds(lower, upper []*float64) []*numeric.Interval {
+	if lower == nil || len(lower) != len(upper) {
+		return nil
+	}
+	intervals := make([]*numeric.Interval, len(lower))
+	for i := range lower {
+		intervals[i] = bounds(lower[i], upper[i])
+	}
+	return intervals
+}
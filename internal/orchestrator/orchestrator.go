@@ -1,12 +1,14 @@
 package orchestrator
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"go/ast"
-	"go/parser"
 	"parallel-calculator/internal/db"
 	"parallel-calculator/internal/logger"
+	"parallel-calculator/internal/numeric"
+	"parallel-calculator/internal/syntax"
+	"parallel-calculator/internal/tracing"
 )
 
 // Errors
@@ -20,54 +22,304 @@ var (
 	ErrInvalidChannelCondition = errors.New("invalid channel condition")
 	ErrOnlyOneLiteral          = errors.New("only one literal allowed")
 	ErrInvalidParentId         = errors.New("invalid parent id")
+	ErrExpressionNotCancelable = errors.New("expression is already finished")
+	ErrOperationCanceled       = errors.New("operation canceled")
+	ErrUnresolvedReference     = errors.New("unresolved reference")
+	ErrInvalidCallbackURL      = errors.New("invalid callback url")
+	ErrInvalidVariable         = errors.New("invalid variable")
+	ErrInvalidMode             = errors.New("invalid numeric mode")
+	ErrInvalidDecimal          = errors.New("invalid decimal precision or rounding")
 )
 
-func CreateAST(expression string) (ast.Node, error) {
-	ast, err := parser.ParseExpr(expression)
+// CreateAST разбирает выражение в AST по грамматике калькулятора.
+// Ошибка разбора оборачивает ErrInvalidExpression и *syntax.Error с позицией ошибки
+func CreateAST(expression string) (syntax.Node, error) {
+	node, err := syntax.Parse(expression)
 	if err != nil {
-		logger.LogINFO(fmt.Sprintf("Error after ParseExpr: %v", err))
-		return nil, ErrInvalidExpression
+		logger.Debug(context.Background(), "Error after syntax.Parse", "error", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidExpression, err)
 	}
-	return ast, nil
+	return node, nil
 }
 
 // Обрабатывает выражение. Возвращает id и ошибку
 func ProcessExpression(expr string, userID int64) (*int64, error) {
-	// Добавляем выражение в базу данных
-	expression, err := CreateExpressionInDB(userID, expr)
+	return ProcessExpressionWithCallback(expr, userID, "")
+}
+
+// ProcessExpressionWithCallback обрабатывает выражение, результат которого после завершения
+// будет отправлен на callbackURL. Пустой callbackURL означает, что webhook не нужен
+func ProcessExpressionWithCallback(expr string, userID int64, callbackURL string) (*int64, error) {
+	return ProcessExpressionContext(context.Background(), expr, userID, callbackURL)
+}
+
+// ProcessExpressionContext обрабатывает выражение так же, как ProcessExpressionWithCallback.
+// request_id из ctx сохраняется вместе с выражением и попадает в записи журнала агентов,
+// вычисляющих его операции; спан обработки становится родителем спанов передачи операций агентам
+func ProcessExpressionContext(ctx context.Context, expr string, userID int64, callbackURL string) (*int64, error) {
+	return ProcessExpressionOptions(ctx, expr, userID, ExpressionOptions{CallbackURL: callbackURL})
+}
+
+// ExpressionOptions — необязательные параметры вычисления выражения
+type ExpressionOptions struct {
+	CallbackURL string // адрес webhook о завершении выражения, пустой — webhook не нужен
+	Mode        string // числовой режим: numeric.ModeFloat (по умолчанию), numeric.ModeRational или numeric.ModeDecimal
+	Precision   *int   // знаков после запятой в режиме decimal, nil — numeric.DefaultDecimalPrecision
+	Rounding    string // способ округления в режиме decimal, пустой — numeric.RoundHalfEven
+}
 
+// ProcessExpressionOptions обрабатывает выражение так же, как ProcessExpressionContext, с параметрами opts.
+// Неизвестный режим возвращает ErrInvalidMode, неверные параметры режима decimal — ErrInvalidDecimal
+func ProcessExpressionOptions(ctx context.Context, expr string, userID int64, opts ExpressionOptions) (_ *int64, err error) {
+	settings, err := expressionSettings(opts)
 	if err != nil {
 		return nil, err
 	}
-	astNode, err := CreateAST(expression.Expression)
+	mode := settings.Mode
+
+	ctx, span := tracing.Start(ctx, "ProcessExpression", tracing.WithAttributes("user.id", userID, "expression.mode", mode))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
+	callbackURL := opts.CallbackURL
+	expression := &db.Expression{
+		UserID:     userID,
+		Expression: expr,
+		Mode:       mode,
+	}
+	if mode == numeric.ModeDecimal {
+		expression.Precision, expression.Rounding = &settings.Precision, &settings.Rounding
+	}
+	if callbackURL != "" {
+		if err := validateCallbackURL(callbackURL); err != nil {
+			return nil, err
+		}
+		expression.CallbackURL = &callbackURL
+	}
+	if requestID := logger.RequestID(ctx); requestID != "" {
+		expression.RequestID = &requestID
+	}
+	if traceparent := tracing.Traceparent(ctx); traceparent != "" {
+		expression.Traceparent = &traceparent
+	}
+
+	// Добавляем выражение в базу данных
+	err = traceDB(ctx, "InsertExpression", func() error {
+		return db.InsertExpression(expression)
+	})
 	if err != nil {
+		return nil, fmt.Errorf("ошибка создания выражения в БД: %w", err)
+	}
+	expressionsCreated.Inc()
+	span.SetAttributes("expression.id", expression.ID)
+
+	ctx = logger.With(ctx, logger.KeyUserID, userID, logger.KeyExpressionID, expression.ID)
+	logger.Info(ctx, "Expression created", "expression", expr, "mode", mode)
+
+	// Разбираем выражение и подставляем значения переменных и результаты ранее вычисленных выражений
+	_, parseSpan := tracing.Start(ctx, "parse")
+	astNode, err := CreateAST(expression.Expression)
+	if err == nil {
+		astNode, err = resolveReferences(astNode, userID, mode)
+	}
+	parseSpan.RecordError(err)
+	parseSpan.End()
+
+	if errors.Is(err, ErrInvalidExpression) {
 		// Если произошла ошибка при парсинге, устанавливаем статус ошибки в БД
-		db.SetExpressionError(expression.ID, "Invalid expression syntax: "+err.Error())
-		return nil, ErrInvalidExpression
+		logger.Warn(ctx, "Invalid expression syntax", "error", err)
+		message := "Invalid expression syntax"
+		var syntaxErr *syntax.Error
+		if errors.As(err, &syntaxErr) {
+			message += ": " + syntaxErr.Error()
+		}
+		setExpressionError(ctx, expression.ID, message)
+		return nil, err
+	}
+	if err != nil {
+		logger.Warn(ctx, "Failed to resolve references", "error", err)
+		setExpressionError(ctx, expression.ID, err.Error())
+		return nil, err
 	}
 
 	// Парсим AST и создаем операции в базе данных
-	err = ParseAST(expression.ID, astNode)
+	_, parseASTSpan := tracing.Start(ctx, "ParseAST", tracing.WithAttributes("expression.id", expression.ID))
+	err = parseAST(expression.ID, astNode, settings)
+	parseASTSpan.RecordError(err)
+	parseASTSpan.End()
 	if err != nil {
 		// Обновляем статус ошибки в БД
-		db.SetExpressionError(expression.ID, "Error creating operations: "+err.Error())
-		return &expression.ID, nil
+		logger.Error(ctx, "Error creating operations", "error", err)
+		setExpressionError(ctx, expression.ID, "Error creating operations: "+err.Error())
+	}
+
+	// Выражение из одного числа или с ошибкой построения операций уже завершено
+	if callbackURL != "" {
+		expressionUpdated(expression.ID)
 	}
 
 	return &expression.ID, nil
 }
 
+// expressionSettings проверяет числовой режим из opts и подставляет параметры режима decimal по умолчанию
+func expressionSettings(opts ExpressionOptions) (numeric.Settings, error) {
+	settings := numeric.Settings{Mode: opts.Mode}
+	if settings.Mode == "" {
+		settings.Mode = numeric.ModeFloat
+	}
+	if !numeric.ValidMode(settings.Mode) {
+		return settings, fmt.Errorf("%w: %q", ErrInvalidMode, settings.Mode)
+	}
+	if settings.Mode != numeric.ModeDecimal {
+		if opts.Precision != nil || opts.Rounding != "" {
+			return settings, fmt.Errorf("%w: precision and rounding apply only to decimal mode", ErrInvalidDecimal)
+		}
+		return settings, nil
+	}
+
+	settings.Precision, settings.Rounding = numeric.DefaultDecimalPrecision, numeric.RoundHalfEven
+	if opts.Precision != nil {
+		settings.Precision = *opts.Precision
+	}
+	if opts.Rounding != "" {
+		settings.Rounding = opts.Rounding
+	}
+	if settings.Precision < 0 || settings.Precision > numeric.MaxDecimalPrecision {
+		return settings, fmt.Errorf("%w: precision must be between 0 and %d", ErrInvalidDecimal, numeric.MaxDecimalPrecision)
+	}
+	if !numeric.ValidRounding(settings.Rounding) {
+		return settings, fmt.Errorf("%w: unknown rounding %q", ErrInvalidDecimal, settings.Rounding)
+	}
+	return settings, nil
+}
+
+// settingsOf возвращает числовой режим сохраненного выражения или операции
+func settingsOf(mode string, precision *int, rounding *string) numeric.Settings {
+	settings := numeric.Settings{Mode: mode}
+	if precision != nil {
+		settings.Precision = *precision
+	}
+	if rounding != nil {
+		settings.Rounding = *rounding
+	}
+	return settings
+}
+
+// setExpressionError сохраняет ошибку выражения, не прошедшего разбор или построение операций
+func setExpressionError(ctx context.Context, expressionID int64, message string) {
+	traceDB(ctx, "SetExpressionError", func() error {
+		return db.SetExpressionError(expressionID, message)
+	})
+	expressionFinished(db.StatusError)
+}
+
+// ExpressionContext добавляет в ctx поля журнала выражения: пользователя, ID выражения
+// и request_id запроса, которым оно было создано
+func ExpressionContext(ctx context.Context, expression *db.Expression) context.Context {
+	ctx = logger.With(ctx, logger.KeyUserID, expression.UserID, logger.KeyExpressionID, expression.ID)
+	if expression.RequestID != nil {
+		ctx = logger.With(ctx, logger.KeyRequestID, *expression.RequestID)
+	}
+	return ctx
+}
+
 // ProcessExpressionResult обрабатывает результат выполнения задачи
 func ProcessExpressionResult(result TaskResult) error {
-	op, err := db.GetOperationByID(result.ID)
-	if err != nil {
-		return fmt.Errorf("не удалось получить операцию: %w", err)
+	return ProcessExpressionResultContext(context.Background(), result)
+}
+
+// ProcessExpressionResultContext обрабатывает результат выполнения задачи так же, как ProcessExpressionResult.
+// Записи в БД выполняются в одной транзакции, в спанах, дочерних к спану из ctx
+func ProcessExpressionResultContext(ctx context.Context, result TaskResult) error {
+	return processResult(ctx, result, nil)
+}
+
+// ProcessLeasedResult обрабатывает результат задачи, выданной агенту с арендой leaseID.
+// Аренда снимается в той же транзакции, в которой записывается результат: если запись не удалась,
+// операция остается за агентом и после истечения аренды возвращается в очередь.
+// Возвращает db.ErrLeaseNotHeld, если аренда истекла, передана другому агенту или операция отменена
+func ProcessLeasedResult(ctx context.Context, result TaskResult, leaseID string) error {
+	return processResult(ctx, result, &leaseID)
+}
+
+// processResult записывает результат операции. Если leaseID не nil, результат принимается
+// только от владельца аренды
+func processResult(ctx context.Context, result TaskResult, leaseID *string) (err error) {
+	ctx, span := tracing.Start(ctx, "ProcessExpressionResult", tracing.WithAttributes("operation.id", result.ID))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	return inTx(func(tx db.TxStore, fx *effects) error {
+		if leaseID != nil {
+			err := traceDB(ctx, "ReleaseLease", func() error {
+				return tx.ReleaseLease(result.ID, *leaseID)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		op, err := tx.GetOperationByID(result.ID)
+		if err != nil {
+			return fmt.Errorf("не удалось получить операцию: %w", err)
+		}
+		span.SetAttributes("expression.id", op.ExpressionID)
+
+		return applyResult(ctx, tx, fx, op, result)
+	})
+}
+
+// applyResult записывает результат result операции op в транзакции tx
+func applyResult(ctx context.Context, tx db.TxStore, fx *effects, op *db.Operation, result TaskResult) (err error) {
+	// Результат отмененной операции отбрасывается и не попадает в родительскую операцию
+	if op.Status == db.StatusCanceled {
+		return ErrOperationCanceled
+	}
+
+	// В точном режиме агент возвращает точный результат вместе с приближенным. Результат без точной
+	// записи прислал агент, не поддерживающий режим: его приближение не должно попасть в вычисление
+	failed := result.Error != "nil" && result.Error != ""
+	if !failed && numeric.Exact(op.Mode) {
+		exact, err := numeric.ParseRational(result.Exact)
+		if err != nil {
+			result.Error = fmt.Sprintf("agent returned no exact result in %s mode", op.Mode)
+			failed = true
+		} else {
+			settings := settingsOf(op.Mode, op.Precision, op.Rounding)
+			exact = settings.Normalize(exact)
+			// Результат за пределами float64 завершает выражение ошибкой: его приближение
+			// нельзя сохранить в базу и закодировать в JSON
+			if value, err := numeric.RationalFloat(exact); err != nil {
+				result.Error = err.Error()
+				failed = true
+			} else {
+				result.Result = value
+				result.Exact = settings.Format(exact)
+			}
+		}
+	}
+	// В режиме interval агент возвращает границы результата, а приближенным результатом служит их середина
+	if !failed && op.Mode == numeric.ModeInterval {
+		if result.Interval == nil {
+			result.Error = fmt.Sprintf("agent returned no interval result in %s mode", op.Mode)
+			failed = true
+		} else if err := result.Interval.Validate(); err != nil {
+			result.Error = err.Error()
+			failed = true
+		} else {
+			result.Result = result.Interval.Mid()
+		}
 	}
 
-	if result.Error != "nil" && result.Error != "" {
+	if failed {
 		// Обрабатываем ошибку операции и отменяем все связанные операции
-		err := HandleOperationErrorWithCancellation(result.ID, result.Error)
+		err := traceDB(ctx, "HandleOperationError", func() error {
+			return handleOperationError(tx, fx, result.ID, result.Error)
+		})
 		if err != nil {
 			return fmt.Errorf("ошибка при обработке ошибки операции: %w", err)
 		}
@@ -75,14 +327,38 @@ func ProcessExpressionResult(result TaskResult) error {
 		return nil
 	}
 
+	// Точный результат и границы записываются раньше приближенного: к завершению выражения
+	// или готовности родительской операции они уже сохранены
+	if result.Exact != "" {
+		err = traceDB(ctx, "SetOperationExactResult", func() error {
+			return setOperationExactResult(tx, op, result.Exact)
+		})
+		if err != nil {
+			return fmt.Errorf("ошибка при установке точного результата операции: %w", err)
+		}
+	}
+
+	if op.Mode == numeric.ModeInterval {
+		err = traceDB(ctx, "SetOperationIntervalResult", func() error {
+			return setOperationIntervalResult(tx, op, *result.Interval)
+		})
+		if err != nil {
+			return fmt.Errorf("ошибка при установке границ результата операции: %w", err)
+		}
+	}
+
 	// 1. Устанавливаем результат операции
-	err = SetOperationResultInDB(result.ID, result.Result)
+	err = traceDB(ctx, "SetOperationResult", func() error {
+		return setOperationResult(tx, fx, result.ID, result.Result)
+	})
 	if err != nil {
 		return fmt.Errorf("ошибка при установке результата операции: %w", err)
 	}
 
 	// 2. Обновляем статус операции на "completed"
-	err = UpdateOperationStatusInDB(result.ID, db.StatusCompleted)
+	err = traceDB(ctx, "UpdateOperationStatus", func() error {
+		return tx.UpdateOperationStatus(result.ID, db.StatusCompleted)
+	})
 	if err != nil {
 		return fmt.Errorf("ошибка при обновлении статуса операции: %w", err)
 	}
@@ -90,14 +366,18 @@ func ProcessExpressionResult(result TaskResult) error {
 	// 3. Если это корневая операция выражения, обновляем результат выражения
 	if op.IsRootExpression {
 		// Обновляем результат выражения и устанавливаем статус "completed"
-		err = FinalizeExpression(op.ExpressionID, result.Result)
+		err = traceDB(ctx, "FinalizeExpression", func() error {
+			return finalizeExpression(tx, fx, op.ExpressionID, result.Result)
+		})
 		if err != nil {
 			return fmt.Errorf("ошибка при финализации выражения: %w", err)
 		}
 	} else if op.ParentOpID != nil {
 		// 4. Если это не корневая операция, но у неё есть родитель,
 		// обновляем аргументы родительской операции
-		err = UpdateParentOperation(op, result.Result)
+		err = traceDB(ctx, "UpdateParentOperation", func() error {
+			return updateParentOperation(tx, fx, op, result.Result)
+		})
 		if err != nil {
 			return fmt.Errorf("ошибка при обновлении родительской операции: %w", err)
 		}
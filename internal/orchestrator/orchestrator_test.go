@@ -1,13 +1,17 @@
 package orchestrator_test
 
 import (
+	"context"
 	"database/sql"
-	"go/ast"
+	"errors"
 	"parallel-calculator/internal/config"
 	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/numeric"
 	"parallel-calculator/internal/orchestrator"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 // initTestDB инициализирует тестовую базу данных
@@ -51,6 +55,24 @@ func TestCreateAST(t *testing.T) {
 			wantErr:     true,
 			checkResult: false,
 		},
+		{
+			name:        "Valid extended operators",
+			expression:  "2^3 ** 2 % 5 // 2",
+			wantErr:     false,
+			checkResult: true,
+		},
+		{
+			name:        "Missing exponent",
+			expression:  "2^",
+			wantErr:     true,
+			checkResult: false,
+		},
+		{
+			name:        "Unexpected character",
+			expression:  "2 & 3",
+			wantErr:     true,
+			checkResult: false,
+		},
 		{
 			name:        "Empty expression",
 			expression:  "",
@@ -73,10 +95,9 @@ func TestCreateAST(t *testing.T) {
 					return
 				}
 
-				// Проверяем, что возвращаемый узел действительно является AST-узлом
-				_, ok := node.(ast.Expr)
-				if !ok {
-					t.Errorf("CreateAST() returned node is not ast.Expr")
+				// Проверяем, что корневой узел охватывает все выражение
+				if node.Pos() != 0 || node.End() != len(tt.expression) {
+					t.Errorf("CreateAST() node spans [%d, %d), want whole expression", node.Pos(), node.End())
 				}
 			}
 		})
@@ -349,20 +370,19 @@ func TestProcessExpressionResult(t *testing.T) {
 			return
 		}
 
-		// Проверяем, что статус операции обновился на "canceled", так как HandleOperationErrorWithCancellation
-		// отменяет все операции, связанные с выражением
+		// Проверяем, что операция получила статус "error" и сообщение об ошибке
 		updatedRootOp, err := db.GetOperationByID(rootOpWithError.ID)
 		if err != nil {
 			t.Errorf("Failed to get updated root operation: %v", err)
 			return
 		}
 
-		if updatedRootOp.Status != db.StatusCanceled {
-			t.Errorf("Root operation status = %v, want %v", updatedRootOp.Status, db.StatusCanceled)
+		if updatedRootOp.Status != db.StatusError {
+			t.Errorf("Root operation status = %v, want %v", updatedRootOp.Status, db.StatusError)
+		}
+		if updatedRootOp.ErrorMessage == nil || *updatedRootOp.ErrorMessage != errorResult.Error {
+			t.Errorf("Root operation error message = %v, want %v", updatedRootOp.ErrorMessage, errorResult.Error)
 		}
-
-		// HandleOperationErrorWithCancellation устанавливает сообщение об ошибке для выражения,
-		// но не обязательно для самой операции, поэтому это условие не проверяем
 
 		// Проверяем, что статус выражения обновился на "error"
 		updatedExpr, err := db.GetExpressionByID(exprWithError.ID)
@@ -388,3 +408,397 @@ func TestProcessExpressionResult(t *testing.T) {
 		}
 	})
 }
+
+// TestProcessLeasedResult_Rollback проверяет, что аренда остается за агентом, если результат не удалось записать
+func TestProcessLeasedResult_Rollback(t *testing.T) {
+	initTestDB(t)
+	defer cleanupTestDB()
+
+	user, err := db.CreateUser("testuser_leased_rollback", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	expr, err := db.CreateExpression(user.ID, "(1+2)*3")
+	if err != nil {
+		t.Fatalf("Failed to create test expression: %v", err)
+	}
+	rootOp, err := db.CreateOperation(expr.ID, nil, "*", nil, floatPtr(3), true, nil, db.StatusPending)
+	if err != nil {
+		t.Fatalf("Failed to create root operation: %v", err)
+	}
+	// Дочерняя операция без позиции в родителе: записать ее результат в родителя невозможно
+	op, err := db.CreateOperation(expr.ID, &rootOp.ID, "+", floatPtr(1), floatPtr(2), false, nil, db.StatusReady)
+	if err != nil {
+		t.Fatalf("Failed to create operation: %v", err)
+	}
+	if err := db.LeaseOperation(op.ID, "agent-1", "lease-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("LeaseOperation() error = %v", err)
+	}
+
+	err = orchestrator.ProcessLeasedResult(context.Background(), orchestrator.TaskResult{ID: op.ID, Result: 3}, "lease-1")
+	if err == nil || errors.Is(err, db.ErrLeaseNotHeld) {
+		t.Fatalf("ProcessLeasedResult() error = %v, want processing error", err)
+	}
+
+	// Операция не завершена и по-прежнему арендована, поэтому после истечения аренды вернется в очередь
+	updated, err := db.GetOperationByID(op.ID)
+	if err != nil {
+		t.Fatalf("Failed to get operation: %v", err)
+	}
+	if updated.Status != db.StatusProcessing || updated.Result != nil {
+		t.Errorf("Operation status = %s, result = %v, want processing without result", updated.Status, updated.Result)
+	}
+	if lease, err := db.GetOperationLease(op.ID); err != nil || lease.LeaseID != "lease-1" {
+		t.Errorf("GetOperationLease() = %v, %v, want lease-1", lease, err)
+	}
+
+	// Результат без аренды не принимается
+	err = orchestrator.ProcessLeasedResult(context.Background(), orchestrator.TaskResult{ID: op.ID, Result: 3}, "")
+	if !errors.Is(err, db.ErrLeaseNotHeld) {
+		t.Errorf("ProcessLeasedResult() without lease error = %v, want %v", err, db.ErrLeaseNotHeld)
+	}
+}
+
+// readyOperation возвращает единственную готовую к вычислению операцию выражения
+func readyOperation(t *testing.T, exprID int64) *db.Operation {
+	t.Helper()
+	ops, err := db.GetOperationsByExpressionID(exprID)
+	if err != nil {
+		t.Fatalf("Failed to get operations: %v", err)
+	}
+	var ready []*db.Operation
+	for _, op := range ops {
+		if op.Status == db.StatusReady {
+			ready = append(ready, op)
+		}
+	}
+	if len(ready) != 1 {
+		t.Fatalf("Ready operations = %d, want 1", len(ready))
+	}
+	return ready[0]
+}
+
+// TestProcessExpression_RationalMode проверяет вычисление выражения в режиме rational
+func TestProcessExpression_RationalMode(t *testing.T) {
+	initTestDB(t)
+	defer cleanupTestDB()
+
+	user, err := db.CreateUser("testuser_rational", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	opts := orchestrator.ExpressionOptions{Mode: "rational"}
+
+	t.Run("Exact operands and result", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "(0.1 + 0.2) * 3", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+
+		sum := readyOperation(t, *exprID)
+		if sum.Mode != "rational" || sum.LeftExact == nil || *sum.LeftExact != "1/10" ||
+			sum.RightExact == nil || *sum.RightExact != "1/5" {
+			t.Fatalf("Sum operation = mode %q, exact operands %v %v, want rational 1/10 1/5", sum.Mode, sum.LeftExact, sum.RightExact)
+		}
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: sum.ID, Result: 0.30000000000000004, Error: "nil", Exact: "3/10"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		product := readyOperation(t, *exprID)
+		if product.LeftExact == nil || *product.LeftExact != "3/10" || *product.LeftValue != 0.3 {
+			t.Fatalf("Product left operand = %v (%v), want 3/10 (0.3)", product.LeftExact, *product.LeftValue)
+		}
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: product.ID, Result: 0.9, Error: "nil", Exact: "9/10"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.Status != db.StatusCompleted || expr.Mode != "rational" || expr.ExactResult == nil || *expr.ExactResult != "9/10" {
+			t.Errorf("Expression = %s %s %v, want completed rational 9/10", expr.Status, expr.Mode, expr.ExactResult)
+		}
+	})
+
+	t.Run("Result without exact value", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "1 + 2", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+
+		op := readyOperation(t, *exprID)
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: op.ID, Result: 3, Error: "nil"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.Status != db.StatusError || expr.ExactResult != nil {
+			t.Errorf("Expression status = %s, exact result = %v, want error without exact result", expr.Status, expr.ExactResult)
+		}
+	})
+
+	t.Run("Literal out of float64 range", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "1e400 + 1", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.Status != db.StatusError || expr.Result != nil || expr.ErrorMessage == nil || !strings.Contains(*expr.ErrorMessage, "overflow") {
+			t.Errorf("Expression status = %s, result = %v, error = %v, want overflow error", expr.Status, expr.Result, expr.ErrorMessage)
+		}
+	})
+
+	t.Run("Result out of float64 range", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "1e300 * 1e300", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+
+		op := readyOperation(t, *exprID)
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: op.ID, Error: "nil", Exact: "1" + strings.Repeat("0", 600)})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.Status != db.StatusError || expr.Result != nil || expr.ErrorMessage == nil || *expr.ErrorMessage != "overflow" {
+			t.Errorf("Expression status = %s, result = %v, error = %v, want overflow error", expr.Status, expr.Result, expr.ErrorMessage)
+		}
+	})
+
+	t.Run("Unsupported function", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "sqrt(2)", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.Status != db.StatusError || expr.ErrorMessage == nil || !strings.Contains(*expr.ErrorMessage, "not supported in rational mode") {
+			t.Errorf("Expression status = %s, error = %v, want unsupported function error", expr.Status, expr.ErrorMessage)
+		}
+	})
+
+	t.Run("Invalid mode", func(t *testing.T) {
+		_, err := orchestrator.ProcessExpressionOptions(context.Background(), "1 + 2", user.ID, orchestrator.ExpressionOptions{Mode: "complex"})
+		if !errors.Is(err, orchestrator.ErrInvalidMode) {
+			t.Errorf("ProcessExpressionOptions() error = %v, want ErrInvalidMode", err)
+		}
+	})
+}
+
+// TestProcessExpression_DecimalMode проверяет округление результата в режиме decimal
+func TestProcessExpression_DecimalMode(t *testing.T) {
+	initTestDB(t)
+	defer cleanupTestDB()
+
+	user, err := db.CreateUser("testuser_decimal", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	precision := 2
+
+	// Агент возвращает 0.125 с лишними знаками, FinalizeExpression округляет результат до двух знаков
+	for rounding, want := range map[string]string{"half_even": "0.12", "half_up": "0.13", "down": "0.12"} {
+		t.Run("Rounding "+rounding, func(t *testing.T) {
+			opts := orchestrator.ExpressionOptions{Mode: "decimal", Precision: &precision, Rounding: rounding}
+			exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "0.5 * 0.25", user.ID, opts)
+			if err != nil {
+				t.Fatalf("ProcessExpressionOptions() error = %v", err)
+			}
+
+			op := readyOperation(t, *exprID)
+			if op.Precision == nil || *op.Precision != precision || op.Rounding == nil || *op.Rounding != rounding {
+				t.Fatalf("Operation decimal options = %v %v, want %d %s", op.Precision, op.Rounding, precision, rounding)
+			}
+			err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: op.ID, Result: 0.125, Error: "nil", Exact: "0.125"})
+			if err != nil {
+				t.Fatalf("ProcessExpressionResult() error = %v", err)
+			}
+
+			expr, err := db.GetExpressionByID(*exprID)
+			if err != nil {
+				t.Fatalf("Failed to get expression: %v", err)
+			}
+			if expr.Status != db.StatusCompleted || expr.ExactResult == nil || *expr.ExactResult != want {
+				t.Errorf("Expression = %s %v, want completed %s", expr.Status, expr.ExactResult, want)
+			}
+			if op, _ := db.GetOperationByID(op.ID); op.ResultExact == nil || *op.ResultExact != "0.125" {
+				t.Errorf("Operation exact result = %v, want unrounded 0.125", op.ResultExact)
+			}
+		})
+	}
+
+	t.Run("Constant expression", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "2.675", user.ID,
+			orchestrator.ExpressionOptions{Mode: "decimal"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.ExactResult == nil || *expr.ExactResult != "2.68" || expr.Result == nil || *expr.Result != 2.68 {
+			t.Errorf("Expression result = %v %v, want 2.68", expr.ExactResult, expr.Result)
+		}
+		if expr.Precision == nil || *expr.Precision != 2 || expr.Rounding == nil || *expr.Rounding != "half_even" {
+			t.Errorf("Expression decimal options = %v %v, want defaults 2 half_even", expr.Precision, expr.Rounding)
+		}
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		tooPrecise := 51
+		for _, opts := range []orchestrator.ExpressionOptions{
+			{Mode: "decimal", Precision: &tooPrecise},
+			{Mode: "decimal", Rounding: "ceiling"},
+			{Mode: "rational", Rounding: "half_up"},
+			{Precision: &precision},
+		} {
+			_, err := orchestrator.ProcessExpressionOptions(context.Background(), "1 + 2", user.ID, opts)
+			if !errors.Is(err, orchestrator.ErrInvalidDecimal) {
+				t.Errorf("ProcessExpressionOptions(%+v) error = %v, want ErrInvalidDecimal", opts, err)
+			}
+		}
+	})
+}
+
+func TestProcessExpression_IntervalMode(t *testing.T) {
+	initTestDB(t)
+	defer cleanupTestDB()
+
+	user, err := db.CreateUser("testuser_interval", "testpass")
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	opts := orchestrator.ExpressionOptions{Mode: "interval"}
+
+	t.Run("Interval literal", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "[1.9, 2.1] * 3 - 1", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+
+		product := readyOperation(t, *exprID)
+		if product.Mode != "interval" || product.LeftLower == nil || product.LeftUpper == nil ||
+			*product.LeftLower > 1.9 || *product.LeftUpper < 2.1 || *product.RightLower != 3 || *product.RightUpper != 3 {
+			t.Fatalf("Product operation = mode %q, bounds %v..%v, %v..%v, want interval [1.9, 2.1] * [3, 3]",
+				product.Mode, product.LeftLower, product.LeftUpper, product.RightLower, product.RightUpper)
+		}
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: product.ID, Result: 6, Error: "nil",
+			Interval: &numeric.Interval{Lower: 5.7, Upper: 6.3}})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		difference := readyOperation(t, *exprID)
+		if difference.LeftLower == nil || *difference.LeftLower != 5.7 || *difference.LeftUpper != 6.3 || *difference.LeftValue != 6 {
+			t.Fatalf("Difference left operand = %v..%v (%v), want 5.7..6.3 (6)",
+				difference.LeftLower, difference.LeftUpper, *difference.LeftValue)
+		}
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: difference.ID, Result: 5, Error: "nil",
+			Interval: &numeric.Interval{Lower: 4.7, Upper: 5.3}})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.Status != db.StatusCompleted || expr.ResultLower == nil || *expr.ResultLower != 4.7 ||
+			expr.ResultUpper == nil || *expr.ResultUpper != 5.3 || *expr.Result != 5 {
+			t.Errorf("Expression = %s %v..%v (%v), want completed 4.7..5.3 (5)",
+				expr.Status, expr.ResultLower, expr.ResultUpper, expr.Result)
+		}
+	})
+
+	t.Run("Tolerance", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "2 ± 0.5 + 1 +/- 0.25", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+
+		sum := readyOperation(t, *exprID)
+		if *sum.LeftLower != 1.5 || *sum.LeftUpper != 2.5 || *sum.RightLower != 0.75 || *sum.RightUpper != 1.25 {
+			t.Errorf("Sum bounds = %v..%v, %v..%v, want 1.5..2.5, 0.75..1.25",
+				*sum.LeftLower, *sum.LeftUpper, *sum.RightLower, *sum.RightUpper)
+		}
+	})
+
+	t.Run("Constant expression", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "[1, 3]", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.Status != db.StatusCompleted || *expr.ResultLower != 1 || *expr.ResultUpper != 3 || *expr.Result != 2 {
+			t.Errorf("Expression = %s %v..%v (%v), want completed 1..3 (2)",
+				expr.Status, expr.ResultLower, expr.ResultUpper, expr.Result)
+		}
+	})
+
+	t.Run("Result without interval", func(t *testing.T) {
+		exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), "1 + 2", user.ID, opts)
+		if err != nil {
+			t.Fatalf("ProcessExpressionOptions() error = %v", err)
+		}
+
+		op := readyOperation(t, *exprID)
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: op.ID, Result: 3, Error: "nil"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		expr, err := db.GetExpressionByID(*exprID)
+		if err != nil {
+			t.Fatalf("Failed to get expression: %v", err)
+		}
+		if expr.Status != db.StatusError || expr.ResultLower != nil {
+			t.Errorf("Expression status = %s, lower bound = %v, want error without bounds", expr.Status, expr.ResultLower)
+		}
+	})
+
+	t.Run("Unsupported syntax", func(t *testing.T) {
+		for _, tt := range []struct {
+			expression string
+			opts       orchestrator.ExpressionOptions
+			wantError  string
+		}{
+			{"[1, 2] * 3", orchestrator.ExpressionOptions{}, "interval literals require interval mode"},
+			{"2 ± 0.1", orchestrator.ExpressionOptions{Mode: "rational"}, "interval literals require interval mode"},
+			{"7 % [2, 3]", opts, "not supported in interval mode"},
+			{"sin([0, 1])", opts, "not supported in interval mode"},
+			{"[3, 2] + 1", opts, "invalid interval"},
+		} {
+			exprID, err := orchestrator.ProcessExpressionOptions(context.Background(), tt.expression, user.ID, tt.opts)
+			if err != nil {
+				t.Fatalf("ProcessExpressionOptions(%q) error = %v", tt.expression, err)
+			}
+			expr, err := db.GetExpressionByID(*exprID)
+			if err != nil {
+				t.Fatalf("Failed to get expression: %v", err)
+			}
+			if expr.Status != db.StatusError || expr.ErrorMessage == nil || !strings.Contains(*expr.ErrorMessage, tt.wantError) {
+				t.Errorf("%q: status = %s, error = %v, want error containing %q", tt.expression, expr.Status, expr.ErrorMessage, tt.wantError)
+			}
+		}
+	})
+}
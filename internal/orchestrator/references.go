@@ -0,0 +1,141 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/mathfunc"
+	"parallel-calculator/internal/numeric"
+	"parallel-calculator/internal/syntax"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Имя переменной: буква или "_", затем буквы, цифры и "_"
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateVariableName проверяет, что имя можно использовать как переменную в выражениях
+func ValidateVariableName(name string) error {
+	if !variableNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: name must match %s", ErrInvalidVariable, variableNamePattern)
+	}
+	if _, ok := mathfunc.Lookup(name); ok {
+		return fmt.Errorf("%w: %s is a built-in function", ErrInvalidVariable, name)
+	}
+	return nil
+}
+
+// resolveReferences заменяет в AST имена переменных пользователя и ссылки вида $id
+// на результаты его вычисленных выражений числовыми литералами. В режиме rational
+// точный результат выражения подставляется дробью "p/q", в режиме interval результат
+// выражения в режиме interval подставляется интервальным литералом
+func resolveReferences(node syntax.Node, userID int64, mode string) (syntax.Node, error) {
+	switch n := node.(type) {
+	case *syntax.Ident:
+		value, bounds, err := referenceValue(n.Name, userID, mode)
+		if err != nil {
+			return nil, err
+		}
+		// Подставленное число или интервал занимает в выражении место имени
+		if bounds != nil {
+			return &syntax.Interval{
+				Lbracket: n.Pos(),
+				Lo:       &syntax.Number{ValuePos: n.Pos(), ValueEnd: n.End(), Value: exactFloat(bounds.Lower)},
+				Hi:       &syntax.Number{ValuePos: n.Pos(), ValueEnd: n.End(), Value: exactFloat(bounds.Upper)},
+				Rbracket: n.End() - 1,
+			}, nil
+		}
+		return &syntax.Number{
+			ValuePos: n.Pos(),
+			ValueEnd: n.End(),
+			Value:    value,
+		}, nil
+
+	case *syntax.Binary:
+		x, err := resolveReferences(n.X, userID, mode)
+		if err != nil {
+			return nil, err
+		}
+		y, err := resolveReferences(n.Y, userID, mode)
+		if err != nil {
+			return nil, err
+		}
+		n.X, n.Y = x, y
+
+	case *syntax.Paren:
+		x, err := resolveReferences(n.X, userID, mode)
+		if err != nil {
+			return nil, err
+		}
+		n.X = x
+
+	case *syntax.Unary:
+		x, err := resolveReferences(n.X, userID, mode)
+		if err != nil {
+			return nil, err
+		}
+		n.X = x
+
+	case *syntax.Call:
+		// Имя функции не подставляется, только аргументы
+		for i, arg := range n.Args {
+			resolved, err := resolveReferences(arg, userID, mode)
+			if err != nil {
+				return nil, err
+			}
+			n.Args[i] = resolved
+		}
+	}
+
+	return node, nil
+}
+
+// referenceValue возвращает запись литерала со значением переменной name или результатом
+// выражения $id пользователя для выражения в режиме mode. В режиме interval для выражения
+// с границами результата возвращаются границы
+func referenceValue(name string, userID int64, mode string) (string, *numeric.Interval, error) {
+	if idStr, ok := strings.CutPrefix(name, "$"); ok {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: invalid expression reference %s", ErrUnresolvedReference, name)
+		}
+
+		// Чужое выражение не отличается от несуществующего
+		expr, err := GetExpressionByID(id)
+		if errors.Is(err, ErrExpressionNotFound) || err == nil && expr.UserID != userID {
+			return "", nil, fmt.Errorf("%w: expression %s not found", ErrUnresolvedReference, name)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("ошибка при получении выражения %s: %w", name, err)
+		}
+
+		if expr.Status != db.StatusCompleted || expr.Result == nil {
+			return "", nil, fmt.Errorf("%w: expression %s has no result (status %s)", ErrUnresolvedReference, name, expr.Status)
+		}
+		if numeric.Exact(mode) && expr.ExactResult != nil {
+			return *expr.ExactResult, nil, nil
+		}
+		if mode == numeric.ModeInterval && expr.ResultLower != nil && expr.ResultUpper != nil {
+			return "", &numeric.Interval{Lower: *expr.ResultLower, Upper: *expr.ResultUpper}, nil
+		}
+		return strconv.FormatFloat(*expr.Result, 'g', -1, 64), nil, nil
+	}
+
+	variable, err := db.GetVariable(userID, name)
+	if err != nil {
+		if errors.Is(err, db.ErrVariableNotFound) {
+			return "", nil, fmt.Errorf("%w: unknown variable %s", ErrUnresolvedReference, name)
+		}
+		return "", nil, fmt.Errorf("ошибка при получении переменной %s: %w", name, err)
+	}
+	// Кратчайшая запись float64: в режиме rational переменная 0.1 равна ровно 1/10
+	return strconv.FormatFloat(variable.Value, 'g', -1, 64), nil, nil
+}
+
+// exactFloat возвращает точную запись x дробью "p/q": граница интервала
+// не должна расширяться при повторном разборе
+func exactFloat(x float64) string {
+	return new(big.Rat).SetFloat64(x).RatString()
+}
@@ -0,0 +1,16 @@
+package orchestrator
+
+import (
+	"context"
+	"parallel-calculator/internal/tracing"
+)
+
+// traceDB выполняет запись в БД write в дочернем спане "db.<operation>"
+func traceDB(ctx context.Context, operation string, write func() error) error {
+	_, span := tracing.Start(ctx, "db."+operation, tracing.WithAttributes("db.operation.name", operation))
+	defer span.End()
+
+	err := write()
+	span.RecordError(err)
+	return err
+}
@@ -0,0 +1,114 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// VariableRequest — тело запроса на создание или изменение переменной
+type VariableRequest struct {
+	Name  string   `json:"name"`
+	Value *float64 `json:"value"`
+}
+
+// HandleSetVariable создает переменную пользователя или изменяет значение существующей
+func HandleSetVariable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := GetUserIDFromToken(r)
+	if err != nil {
+		logger.Warn(r.Context(), "Authentication error", "error", err)
+		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
+		return
+	}
+
+	var request VariableRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Value == nil {
+		logger.Warn(r.Context(), "Failed to decode variable request", "error", err)
+		http.Error(w, "Неверный формат запроса", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := ValidateVariableName(request.Name); err != nil {
+		logger.Warn(r.Context(), "Invalid variable name", "name", request.Name, "error", err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	logger.Info(r.Context(), "Setting variable", "name", request.Name)
+
+	variable, err := db.SetVariable(userID, request.Name, *request.Value)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to set variable", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(variable)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode variable response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleGetVariables возвращает все переменные пользователя
+func HandleGetVariables(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := GetUserIDFromToken(r)
+	if err != nil {
+		logger.Warn(r.Context(), "Authentication error", "error", err)
+		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
+		return
+	}
+
+	variables, err := db.GetUserVariables(userID)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to get variables", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	if variables == nil {
+		variables = []*db.Variable{}
+	}
+
+	err = json.NewEncoder(w).Encode(variables)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode variables response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleDeleteVariable удаляет переменную пользователя
+func HandleDeleteVariable(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromToken(r)
+	if err != nil {
+		logger.Warn(r.Context(), "Authentication error", "error", err)
+		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	err = db.DeleteVariable(userID, name)
+	if err != nil {
+		if errors.Is(err, db.ErrVariableNotFound) {
+			logger.Warn(r.Context(), "Variable not found", "name", name)
+			http.Error(w, "Переменная не найдена", http.StatusNotFound)
+			return
+		}
+		logger.Error(r.Context(), "Failed to delete variable", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
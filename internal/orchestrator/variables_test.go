@@ -0,0 +1,201 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"parallel-calculator/internal/auth"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/orchestrator"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestHandleVariables проверяет создание, получение и удаление переменных через API
+func TestHandleVariables(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+
+	_, token := createTestUser(t)
+
+	setVariable := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/variables", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		orchestrator.HandleSetVariable(rr, req)
+		return rr
+	}
+
+	t.Run("Set and update", func(t *testing.T) {
+		if rr := setVariable(`{"name": "rate", "value": 0.13}`); rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr := setVariable(`{"name": "rate", "value": 0.2}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var variable db.Variable
+		if err := json.NewDecoder(rr.Body).Decode(&variable); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if variable.Name != "rate" || variable.Value != 0.2 {
+			t.Errorf("Variable = %s %v, want rate 0.2", variable.Name, variable.Value)
+		}
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		for _, body := range []string{
+			`{"name": "2fast", "value": 1}`,
+			`{"name": "sqrt", "value": 1}`,
+			`{"name": "rate"}`,
+			`{"name": "rate", "value": "high"}`,
+		} {
+			if rr := setVariable(body); rr.Code != http.StatusUnprocessableEntity {
+				t.Errorf("%s: expected status code %d, got %d", body, http.StatusUnprocessableEntity, rr.Code)
+			}
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/variables", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		orchestrator.HandleGetVariables(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var variables []db.Variable
+		if err := json.NewDecoder(rr.Body).Decode(&variables); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(variables) != 1 || variables[0].Name != "rate" {
+			t.Errorf("Variables = %v, want only rate", variables)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		for _, expectedStatus := range []int{http.StatusNoContent, http.StatusNotFound} {
+			req := httptest.NewRequest("DELETE", "/variables/rate", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req = mux.SetURLVars(req, map[string]string{"name": "rate"})
+			rr := httptest.NewRecorder()
+			orchestrator.HandleDeleteVariable(rr, req)
+
+			if rr.Code != expectedStatus {
+				t.Errorf("Expected status code %d, got %d", expectedStatus, rr.Code)
+			}
+		}
+	})
+}
+
+// TestHandleCalculate_References проверяет подстановку переменных и результатов выражений
+func TestHandleCalculate_References(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+
+	userID, token := createTestUser(t)
+
+	other, err := db.CreateUser("otheruser", "password123")
+	if err != nil {
+		t.Fatalf("Failed to create other user: %v", err)
+	}
+
+	if _, err := db.SetVariable(userID, "rate", 0.5); err != nil {
+		t.Fatalf("SetVariable() error = %v", err)
+	}
+
+	// Вычисленное выражение пользователя, выражение в процессе и чужое выражение
+	completed, err := db.CreateExpression(userID, "40+2")
+	if err != nil {
+		t.Fatalf("Failed to create expression: %v", err)
+	}
+	if err := orchestrator.FinalizeExpression(completed.ID, 42); err != nil {
+		t.Fatalf("FinalizeExpression() error = %v", err)
+	}
+
+	pending, err := db.CreateExpression(userID, "1+1")
+	if err != nil {
+		t.Fatalf("Failed to create expression: %v", err)
+	}
+
+	foreign, err := db.CreateExpression(other.ID, "7")
+	if err != nil {
+		t.Fatalf("Failed to create expression: %v", err)
+	}
+	if err := orchestrator.FinalizeExpression(foreign.ID, 7); err != nil {
+		t.Fatalf("FinalizeExpression() error = %v", err)
+	}
+
+	calculate := func(expression string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(orchestrator.CalculateRequest{Expression: expression})
+		req := httptest.NewRequest("POST", "/calculate", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		orchestrator.HandleCalculate(rr, req)
+		return rr
+	}
+
+	t.Run("Substituted values", func(t *testing.T) {
+		rr := calculate("$" + strconv.FormatInt(completed.ID, 10) + " * rate")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var response orchestrator.CalculateResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		ops, err := db.GetOperationsByExpressionID(response.ID)
+		if err != nil {
+			t.Fatalf("GetOperationsByExpressionID() error = %v", err)
+		}
+		if len(ops) != 1 || *ops[0].LeftValue != 42 || *ops[0].RightValue != 0.5 {
+			t.Fatalf("Operations = %v, want 42 * 0.5", ops)
+		}
+
+		// В выражении сохраняется исходный текст со ссылками
+		expr, err := db.GetExpressionByID(response.ID)
+		if err != nil {
+			t.Fatalf("GetExpressionByID() error = %v", err)
+		}
+		if expr.Expression != "$"+strconv.FormatInt(completed.ID, 10)+" * rate" {
+			t.Errorf("Saved expression = %v", expr.Expression)
+		}
+	})
+
+	for name, expression := range map[string]string{
+		"Unknown variable":      "2 * missing",
+		"Foreign expression":    "$" + strconv.FormatInt(foreign.ID, 10) + " + 1",
+		"Unfinished expression": "$" + strconv.FormatInt(pending.ID, 10) + " + 1",
+		"Missing expression":    "$999999 + 1",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if rr := calculate(expression); rr.Code != http.StatusUnprocessableEntity {
+				t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+			}
+		})
+	}
+
+	// Токен другого пользователя не дает доступа к переменным пользователя
+	otherToken, err := auth.GenerateToken(other)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/calculate", bytes.NewBufferString(`{"expression": "rate"}`))
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+	rr := httptest.NewRecorder()
+	orchestrator.HandleCalculate(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d for other user's variable, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
@@ -0,0 +1,487 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"parallel-calculator/internal/config"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/logger"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Заголовки запроса webhook
+const (
+	// WebhookSignatureHeader содержит подпись тела запроса: "sha256=" и HMAC-SHA256 в hex
+	// с ключом пользователя (см. GET /api/v1/webhooks/secret)
+	WebhookSignatureHeader = "X-Calculator-Signature"
+	// WebhookDeliveryHeader содержит ID доставки, одинаковый для всех ее попыток
+	WebhookDeliveryHeader = "X-Calculator-Delivery"
+)
+
+// HTTP-клиент доставки webhook. Таймаут задается для каждого запроса из конфигурации,
+// адрес получателя проверяется при каждом соединении, в том числе после перенаправления
+var webhookClient = &http.Client{Transport: newWebhookTransport()}
+
+// Сигнал диспетчеру доставок о новых доставках в очереди
+var webhookWake = make(chan struct{}, 1)
+
+// WebhookSecretResponse — ответ с ключом подписи webhook пользователя
+type WebhookSecretResponse struct {
+	Secret string `json:"secret"`
+}
+
+// validateCallbackURL проверяет, что callback_url — абсолютный адрес http или https
+// и что адрес получателя, если он указан IP-адресом, разрешен политикой webhook.
+// Адрес имени хоста проверяется при соединении: он может измениться после проверки
+func validateCallbackURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidCallbackURL, callbackURL)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !webhookAddressAllowed(addr) {
+		return fmt.Errorf("%w: address %s is not allowed", ErrInvalidCallbackURL, addr)
+	}
+	return nil
+}
+
+// Сети, запросы webhook в которые запрещены всегда, в том числе при WebhookAllowPrivate
+// и для WebhookAllowedNetworks: адреса локального хоста и сети провайдера, а также
+// IPv6-адреса со встроенным IPv4-адресом, через которые можно обратиться к внутреннему адресу
+var webhookDefaultDeniedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "этот хост": Linux направляет запросы на локальный хост
+	netip.MustParsePrefix("100.64.0.0/10"),  // CGNAT
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"), // локальный NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4
+	netip.MustParsePrefix("::/96"),          // IPv4-совместимые адреса ::a.b.c.d
+}
+
+// webhookAddressAllowed сообщает, разрешены ли запросы webhook на адрес addr. Адреса
+// из WebhookDeniedNetworks и webhookDefaultDeniedNetworks запрещены всегда. Частные, loopback
+// и link-local адреса запрещены, если не включен WebhookAllowPrivate и адрес не входит
+// в WebhookAllowedNetworks
+func webhookAddressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	for _, network := range config.AppConfig.WebhookDeniedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	// Loopback ::1 входит в ::/96, но разрешается так же, как 127.0.0.1
+	if !addr.IsLoopback() {
+		for _, network := range webhookDefaultDeniedNetworks {
+			if network.Contains(addr) {
+				return false
+			}
+		}
+	}
+	for _, network := range config.AppConfig.WebhookAllowedNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	internal := addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsUnspecified()
+	return !internal || config.AppConfig.WebhookAllowPrivate
+}
+
+// newWebhookTransport создает транспорт доставки webhook, который соединяется только с адресами,
+// разрешенными политикой. Прокси не используется: иначе проверялся бы адрес прокси, а не получателя
+func newWebhookTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   webhookDialControl,
+	}).DialContext
+	return transport
+}
+
+// webhookDialControl проверяет адрес, с которым соединяется транспорт webhook,
+// после разрешения имени хоста и перед установкой соединения
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("ошибка при разборе адреса получателя webhook: %w", err)
+	}
+	if !webhookAddressAllowed(addrPort.Addr()) {
+		return fmt.Errorf("webhook address %s is not allowed", addrPort.Addr())
+	}
+	return nil
+}
+
+// newWebhookSecret создает случайный ключ подписи webhook
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// WebhookSecret возвращает ключ подписи webhook пользователя, создавая его при первом обращении
+func WebhookSecret(userID int64) (string, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return "", fmt.Errorf("ошибка при создании ключа подписи: %w", err)
+	}
+
+	secret, err = db.EnsureWebhookSecret(userID, secret)
+	if err != nil {
+		return "", fmt.Errorf("ошибка при получении ключа подписи: %w", err)
+	}
+	return secret, nil
+}
+
+// RotateWebhookSecret заменяет ключ подписи webhook пользователя новым.
+// Повторные попытки уже поставленных в очередь доставок подписываются новым ключом
+func RotateWebhookSecret(userID int64) (string, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return "", fmt.Errorf("ошибка при создании ключа подписи: %w", err)
+	}
+
+	if err := db.SetWebhookSecret(userID, secret); err != nil {
+		return "", fmt.Errorf("ошибка при сохранении ключа подписи: %w", err)
+	}
+	return secret, nil
+}
+
+// SignWebhookPayload возвращает значение заголовка WebhookSignatureHeader для тела запроса
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// expressionUpdated оповещает подписчиков об изменении состояния выражения и,
+// если выражение завершено, ставит в очередь отправку результата на его callback_url
+func expressionUpdated(expressionID int64) {
+	notifyExpression(expressionID)
+
+	if err := enqueueWebhook(expressionID); err != nil {
+		logger.Error(context.Background(), "Failed to enqueue webhook", logger.KeyExpressionID, expressionID, "error", err)
+	}
+}
+
+// enqueueWebhook создает доставку результата завершенного выражения с callback_url.
+// Повторный вызов для того же выражения доставку не дублирует
+func enqueueWebhook(expressionID int64) error {
+	expression, err := db.GetExpressionByID(expressionID)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении выражения: %w", err)
+	}
+
+	if expression.CallbackURL == nil || !isFinalStatus(expression.Status) {
+		return nil
+	}
+
+	payload, err := json.Marshal(newExpressionResponse(expression))
+	if err != nil {
+		return fmt.Errorf("ошибка при формировании тела webhook: %w", err)
+	}
+
+	created, err := db.CreateWebhookDelivery(&db.WebhookDelivery{
+		ExpressionID:  expressionID,
+		URL:           *expression.CallbackURL,
+		Payload:       payload,
+		NextAttemptAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка при создании доставки webhook: %w", err)
+	}
+
+	if created {
+		select {
+		case webhookWake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// DeliverWebhooks выполняет попытки всех доставок, время которых наступило к now.
+// Ошибка сохранения одной доставки не прерывает остальные: ошибки возвращаются вместе
+// после прохода по очереди. Возвращает число выполненных попыток
+func DeliverWebhooks(now time.Time) (int, error) {
+	return deliverWebhooks(context.Background(), now, nil)
+}
+
+// deliverWebhooks выполняет попытки доставок одновременно в WebhookWorkers потоках, чтобы медленный
+// получатель не задерживал доставки остальных пользователей. Проход завершается, когда доставок,
+// время которых наступило к now, не осталось и все попытки завершены. После закрытия stop
+// или отмены ctx новые доставки не выбираются; отмена ctx также прерывает текущие запросы
+func deliverWebhooks(ctx context.Context, now time.Time, stop <-chan struct{}) (int, error) {
+	workers := max(config.AppConfig.WebhookWorkers, 1)
+	finished := make(chan error)
+	inFlight, attempts := 0, 0
+	var errs []error
+	wait := func() {
+		if err := <-finished; err != nil {
+			errs = append(errs, err)
+		}
+		inFlight--
+	}
+
+claim:
+	for {
+		if inFlight == workers {
+			wait()
+		}
+		select {
+		case <-stop:
+			break claim
+		case <-ctx.Done():
+			break claim
+		default:
+		}
+
+		// Пока идет попытка, доставка отложена позже now: если оркестратор остановится,
+		// ее повторит он же или другой оркестратор. Отложенная доставка не выбирается
+		// повторно в этом же проходе, даже если результат попытки не удалось сохранить
+		until := time.Now()
+		if now.After(until) {
+			until = now
+		}
+		delivery, err := db.ClaimWebhookDelivery(now, until.Add(2*config.AppConfig.WebhookTimeout))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ошибка при выборе доставки webhook: %w", err))
+			break
+		}
+		if delivery == nil {
+			// Неудачная попытка может назначить повтор, время которого тоже наступило к now
+			if inFlight == 0 {
+				break
+			}
+			wait()
+			continue
+		}
+
+		attempts++
+		inFlight++
+		go func() {
+			finished <- deliverWebhook(ctx, delivery)
+		}()
+	}
+
+	for inFlight > 0 {
+		wait()
+	}
+	return attempts, errors.Join(errs...)
+}
+
+// deliverWebhook отправляет тело доставки на ее URL и сохраняет результат попытки.
+// При неудаче следующая попытка назначается с экспоненциальной задержкой,
+// после WebhookMaxAttempts попыток доставка получает статус "failed".
+// Доставка удаленного выражения сразу получает статус "failed".
+// Попытка, прерванная отменой ctx при остановке оркестратора, не сохраняется:
+// доставка отложена при выборе и будет повторена
+func deliverWebhook(ctx context.Context, delivery *db.WebhookDelivery) error {
+	delivery.Attempts++
+	ctx, code, sendErr := attemptWebhook(ctx, delivery)
+	if sendErr != nil && ctx.Err() != nil {
+		logger.Warn(ctx, "Webhook attempt interrupted by shutdown", "delivery_id", delivery.ID)
+		return nil
+	}
+	delivery.ResponseCode = code
+
+	if sendErr == nil {
+		now := time.Now()
+		delivery.Status = db.StatusDelivered
+		delivery.LastError = nil
+		delivery.DeliveredAt = &now
+		logger.Info(ctx, "Webhook delivered", "delivery_id", delivery.ID)
+	} else {
+		message := sendErr.Error()
+		delivery.LastError = &message
+
+		if delivery.Attempts >= config.AppConfig.WebhookMaxAttempts || errors.Is(sendErr, db.ErrExpressionNotFound) {
+			delivery.Status = db.StatusFailed
+			logger.Error(ctx, "Webhook failed", "delivery_id", delivery.ID, "attempts", delivery.Attempts, "error", sendErr)
+		} else {
+			delivery.NextAttemptAt = time.Now().Add(webhookRetryDelay(delivery.Attempts))
+			logger.Warn(ctx, "Webhook attempt failed", "delivery_id", delivery.ID, "attempts", delivery.Attempts,
+				"error", sendErr, "next_attempt_at", delivery.NextAttemptAt)
+		}
+	}
+
+	if err := db.UpdateWebhookDelivery(delivery); err != nil {
+		return fmt.Errorf("ошибка при сохранении попытки доставки webhook %d: %w", delivery.ID, err)
+	}
+	return nil
+}
+
+// attemptWebhook подписывает тело доставки ключом владельца выражения и отправляет его.
+// Ошибка получения выражения или ключа, как и ошибка отправки, означает неудачную попытку.
+// Возвращает контекст журнала выражения и код ответа, если ответ получен
+func attemptWebhook(ctx context.Context, delivery *db.WebhookDelivery) (context.Context, *int, error) {
+	expression, err := db.GetExpressionByID(delivery.ExpressionID)
+	if err != nil {
+		return ctx, nil, fmt.Errorf("ошибка при получении выражения: %w", err)
+	}
+	ctx = ExpressionContext(ctx, expression)
+
+	secret, err := WebhookSecret(expression.UserID)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	code, err := sendWebhook(ctx, delivery, secret)
+	return ctx, code, err
+}
+
+// sendWebhook выполняет один POST-запрос доставки с таймаутом WebhookTimeout, включающим
+// соединение. Возвращает код ответа, если ответ получен
+func sendWebhook(ctx context.Context, delivery *db.WebhookDelivery, secret string) (*int, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.AppConfig.WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, delivery.Payload))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	code := resp.StatusCode
+	if code < 200 || code >= 300 {
+		return &code, fmt.Errorf("unexpected response status %d", code)
+	}
+	return &code, nil
+}
+
+// webhookRetryDelay возвращает задержку перед попыткой, следующей за attempts неудачными:
+// WebhookRetryBase, удвоенная attempts-1 раз, но не более WebhookRetryMax
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := config.AppConfig.WebhookRetryBase
+	for i := 1; i < attempts && delay < config.AppConfig.WebhookRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, config.AppConfig.WebhookRetryMax)
+}
+
+// StartWebhookDispatcher запускает фоновую доставку webhook: очередь проверяется с заданным
+// периодом и сразу после появления новой доставки. Возвращает функцию остановки,
+// которая дожидается завершения текущих попыток доставки, но не дольше срока ctx:
+// по его истечении запросы прерываются, а прерванные доставки повторяются позже
+func StartWebhookDispatcher(interval time.Duration) func(ctx context.Context) {
+	deliverCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			case <-webhookWake:
+			}
+
+			if _, err := deliverWebhooks(deliverCtx, time.Now(), done); err != nil {
+				logger.Error(context.Background(), "Webhook delivery failed", "error", err)
+			}
+		}
+	}()
+
+	return func(ctx context.Context) {
+		defer cancel()
+		close(done)
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			logger.Warn(ctx, "Доставка webhook прервана: истек срок остановки")
+			cancel()
+			<-stopped
+		}
+	}
+}
+
+// HandleGetWebhookSecret возвращает ключ подписи webhook пользователя
+func HandleGetWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	handleWebhookSecret(w, r, WebhookSecret)
+}
+
+// HandleRotateWebhookSecret заменяет ключ подписи webhook пользователя и возвращает новый
+func HandleRotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	handleWebhookSecret(w, r, RotateWebhookSecret)
+}
+
+func handleWebhookSecret(w http.ResponseWriter, r *http.Request, secretFor func(userID int64) (string, error)) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := GetUserIDFromToken(r)
+	if err != nil {
+		logger.Warn(r.Context(), "Authentication error", "error", err)
+		http.Error(w, "Ошибка аутентификации", http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := secretFor(userID)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to get webhook secret", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(WebhookSecretResponse{Secret: secret})
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode webhook secret response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleGetExpressionWebhooks возвращает журнал доставок webhook выражения
+func HandleGetExpressionWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	expression, ok := loadUserExpression(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := db.GetExpressionWebhookDeliveries(expression.ID)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to get webhook deliveries", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []*db.WebhookDelivery{}
+	}
+
+	err = json.NewEncoder(w).Encode(deliveries)
+	if err != nil {
+		logger.Error(r.Context(), "Failed to encode webhook deliveries response", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+}
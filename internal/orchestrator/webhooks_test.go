@@ -0,0 +1,563 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"parallel-calculator/internal/config"
+	"parallel-calculator/internal/db"
+	"parallel-calculator/internal/orchestrator"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// webhookReceiver принимает webhook и отвечает кодами из statuses по очереди (затем 200)
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.requests = append(rcv.requests, r)
+	rcv.bodies = append(rcv.bodies, body)
+
+	status := http.StatusOK
+	if len(rcv.statuses) > 0 {
+		status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// getWebhookLog получает журнал доставок выражения через API
+func getWebhookLog(t *testing.T, token string, expressionID int64) []db.WebhookDelivery {
+	id := strconv.FormatInt(expressionID, 10)
+	req := httptest.NewRequest("GET", "/expressions/"+id+"/webhooks", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+
+	rr := httptest.NewRecorder()
+	orchestrator.HandleGetExpressionWebhooks(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var deliveries []db.WebhookDelivery
+	if err := json.NewDecoder(rr.Body).Decode(&deliveries); err != nil {
+		t.Fatalf("Failed to decode webhook log: %v", err)
+	}
+	return deliveries
+}
+
+// allowPrivateWebhooks разрешает до конца теста webhook на адреса httptest-получателей (127.0.0.1)
+func allowPrivateWebhooks(t *testing.T) {
+	allow := config.AppConfig.WebhookAllowPrivate
+	config.AppConfig.WebhookAllowPrivate = true
+	t.Cleanup(func() { config.AppConfig.WebhookAllowPrivate = allow })
+}
+
+// TestWebhookDelivery проверяет отправку подписанного результата выражения на callback_url
+func TestWebhookDelivery(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+	allowPrivateWebhooks(t)
+
+	userID, token := createTestUser(t)
+
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	body := fmt.Sprintf(`{"expression": "2+3", "callback_url": %q}`, server.URL+"/hook")
+	req := httptest.NewRequest("POST", "/calculate", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	orchestrator.HandleCalculate(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	var response orchestrator.CalculateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	// До завершения выражения доставлять нечего
+	if attempts, err := orchestrator.DeliverWebhooks(time.Now()); err != nil || attempts != 0 {
+		t.Fatalf("DeliverWebhooks() = %d, %v, want no attempts", attempts, err)
+	}
+
+	completeExpression(t, response.ID, 5)
+
+	if attempts, err := orchestrator.DeliverWebhooks(time.Now()); err != nil || attempts != 1 {
+		t.Fatalf("DeliverWebhooks() = %d, %v, want 1 attempt", attempts, err)
+	}
+
+	if len(receiver.requests) != 1 {
+		t.Fatalf("Receiver got %d requests, want 1", len(receiver.requests))
+	}
+
+	var payload orchestrator.ExpressionResponse
+	if err := json.Unmarshal(receiver.bodies[0], &payload); err != nil {
+		t.Fatalf("Failed to decode webhook payload: %v", err)
+	}
+	if payload.ID != response.ID || payload.Status != db.StatusCompleted || payload.Result == nil || *payload.Result != 5 {
+		t.Errorf("Webhook payload = %+v, want completed expression with result 5", payload)
+	}
+
+	secret, err := orchestrator.WebhookSecret(userID)
+	if err != nil {
+		t.Fatalf("WebhookSecret() error = %v", err)
+	}
+	signature := receiver.requests[0].Header.Get(orchestrator.WebhookSignatureHeader)
+	if want := orchestrator.SignWebhookPayload(secret, receiver.bodies[0]); signature != want {
+		t.Errorf("Signature = %q, want %q", signature, want)
+	}
+
+	deliveries := getWebhookLog(t, token, response.ID)
+	if len(deliveries) != 1 || deliveries[0].Status != db.StatusDelivered || deliveries[0].Attempts != 1 ||
+		deliveries[0].ResponseCode == nil || *deliveries[0].ResponseCode != http.StatusOK || deliveries[0].DeliveredAt == nil {
+		t.Errorf("Webhook log = %+v, want one delivered attempt", deliveries)
+	}
+
+	// Доставленный webhook не отправляется повторно
+	if attempts, _ := orchestrator.DeliverWebhooks(time.Now().Add(time.Hour)); attempts != 0 {
+		t.Errorf("DeliverWebhooks() after delivery made %d attempts", attempts)
+	}
+}
+
+// TestWebhookRetries проверяет повторные попытки доставки и отказ после WebhookMaxAttempts
+func TestWebhookRetries(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+	allowPrivateWebhooks(t)
+
+	config.AppConfig.WebhookMaxAttempts = 3
+	config.AppConfig.WebhookRetryBase = time.Minute
+	config.AppConfig.WebhookRetryMax = 3 * time.Minute
+
+	userID, token := createTestUser(t)
+
+	t.Run("Delivered after retries", func(t *testing.T) {
+		receiver := &webhookReceiver{statuses: []int{http.StatusInternalServerError, http.StatusServiceUnavailable}}
+		server := httptest.NewServer(receiver)
+		defer server.Close()
+
+		id, err := orchestrator.ProcessExpressionWithCallback("4*5", userID, server.URL)
+		if err != nil {
+			t.Fatalf("ProcessExpressionWithCallback() error = %v", err)
+		}
+		completeExpression(t, *id, 20)
+
+		// Первая попытка неудачна, следующая назначена через WebhookRetryBase
+		start := time.Now()
+		if attempts, _ := orchestrator.DeliverWebhooks(start); attempts != 1 {
+			t.Fatalf("DeliverWebhooks() made %d attempts, want 1", attempts)
+		}
+		deliveries := getWebhookLog(t, token, *id)
+		if deliveries[0].Status != db.StatusPending || deliveries[0].LastError == nil ||
+			deliveries[0].NextAttemptAt.Before(start.Add(time.Minute).Truncate(time.Millisecond)) {
+			t.Fatalf("Delivery after failed attempt = %+v, want retry in a minute", deliveries[0])
+		}
+
+		// Следующая попытка выполняется только когда наступает ее время
+		if attempts, _ := orchestrator.DeliverWebhooks(time.Now()); attempts != 0 {
+			t.Fatalf("DeliverWebhooks() made %d attempts before retry time", attempts)
+		}
+		if attempts, _ := orchestrator.DeliverWebhooks(time.Now().Add(time.Hour)); attempts != 2 {
+			t.Fatalf("DeliverWebhooks() made %d attempts, want 2", attempts)
+		}
+
+		deliveries = getWebhookLog(t, token, *id)
+		if deliveries[0].Status != db.StatusDelivered || deliveries[0].Attempts != 3 || len(receiver.requests) != 3 {
+			t.Errorf("Delivery = %+v, want delivered on third attempt", deliveries[0])
+		}
+
+		// Все попытки — одна доставка с одним ID
+		for _, r := range receiver.requests {
+			if r.Header.Get(orchestrator.WebhookDeliveryHeader) != strconv.FormatInt(deliveries[0].ID, 10) {
+				t.Errorf("Delivery header = %q, want %d", r.Header.Get(orchestrator.WebhookDeliveryHeader), deliveries[0].ID)
+			}
+		}
+	})
+
+	t.Run("Failed after max attempts", func(t *testing.T) {
+		receiver := &webhookReceiver{statuses: []int{500, 500, 500, 500}}
+		server := httptest.NewServer(receiver)
+		defer server.Close()
+
+		// Ошибка вычисления тоже доставляется
+		id, err := orchestrator.ProcessExpressionWithCallback("1/0", userID, server.URL)
+		if err != nil {
+			t.Fatalf("ProcessExpressionWithCallback() error = %v", err)
+		}
+		operations, _ := db.GetOperationsByExpressionID(*id)
+		err = orchestrator.ProcessExpressionResult(orchestrator.TaskResult{ID: operations[0].ID, Error: "division by zero"})
+		if err != nil {
+			t.Fatalf("ProcessExpressionResult() error = %v", err)
+		}
+
+		if attempts, _ := orchestrator.DeliverWebhooks(time.Now().Add(time.Hour)); attempts != 3 {
+			t.Fatalf("DeliverWebhooks() made %d attempts, want 3", attempts)
+		}
+
+		deliveries := getWebhookLog(t, token, *id)
+		if deliveries[0].Status != db.StatusFailed || deliveries[0].Attempts != 3 ||
+			deliveries[0].ResponseCode == nil || *deliveries[0].ResponseCode != 500 {
+			t.Errorf("Delivery = %+v, want failed after 3 attempts", deliveries[0])
+		}
+
+		var payload orchestrator.ExpressionResponse
+		if err := json.Unmarshal(receiver.bodies[0], &payload); err != nil || payload.Status != db.StatusError {
+			t.Errorf("Webhook payload = %s, want expression with error", receiver.bodies[0])
+		}
+	})
+}
+
+// TestWebhookDeliveryErrors проверяет, что ошибка подготовки одной доставки не прерывает остальные
+func TestWebhookDeliveryErrors(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+	allowPrivateWebhooks(t)
+
+	userID, token := createTestUser(t)
+
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	// Владелец выражения не найден: ключ подписи получить нельзя
+	orphan := &db.Expression{UserID: userID + 1000, Expression: "1+1"}
+	if err := db.InsertExpression(orphan); err != nil {
+		t.Fatalf("Failed to create expression: %v", err)
+	}
+	// Выражение удалено после постановки доставки в очередь
+	for _, expressionID := range []int64{orphan.ID, orphan.ID + 1000} {
+		_, err := db.CreateWebhookDelivery(&db.WebhookDelivery{
+			ExpressionID:  expressionID,
+			URL:           server.URL,
+			Payload:       []byte(`{}`),
+			NextAttemptAt: time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("CreateWebhookDelivery() error = %v", err)
+		}
+	}
+
+	id, err := orchestrator.ProcessExpressionWithCallback("42", userID, server.URL)
+	if err != nil {
+		t.Fatalf("ProcessExpressionWithCallback() error = %v", err)
+	}
+
+	if attempts, err := orchestrator.DeliverWebhooks(time.Now()); err != nil || attempts != 3 {
+		t.Fatalf("DeliverWebhooks() = %d, %v, want 3 attempts", attempts, err)
+	}
+	if len(receiver.requests) != 1 {
+		t.Errorf("Receiver got %d requests, want 1", len(receiver.requests))
+	}
+	if deliveries := getWebhookLog(t, token, *id); deliveries[0].Status != db.StatusDelivered {
+		t.Errorf("Delivery status = %s, want %s", deliveries[0].Status, db.StatusDelivered)
+	}
+
+	orphaned, err := db.GetExpressionWebhookDeliveries(orphan.ID)
+	if err != nil {
+		t.Fatalf("GetExpressionWebhookDeliveries() error = %v", err)
+	}
+	if d := orphaned[0]; d.Status != db.StatusPending || d.Attempts != 1 || d.LastError == nil {
+		t.Errorf("Orphaned delivery = %+v, want pending after a failed attempt", d)
+	}
+	deleted, err := db.GetExpressionWebhookDeliveries(orphan.ID + 1000)
+	if err != nil {
+		t.Fatalf("GetExpressionWebhookDeliveries() error = %v", err)
+	}
+	if d := deleted[0]; d.Status != db.StatusFailed || d.Attempts != 1 {
+		t.Errorf("Delivery of deleted expression = %+v, want failed", d)
+	}
+}
+
+// blockingReceiver принимает webhook и не отвечает, пока не закрыт release или не отменен запрос
+type blockingReceiver struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingReceiver() *blockingReceiver {
+	return &blockingReceiver{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (rcv *blockingReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rcv.started <- struct{}{}
+	select {
+	case <-rcv.release:
+	case <-r.Context().Done():
+	}
+}
+
+// TestWebhookWorkers проверяет, что медленный получатель не задерживает доставки другим получателям
+func TestWebhookWorkers(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+	allowPrivateWebhooks(t)
+	config.AppConfig.WebhookWorkers = 2
+
+	userID, _ := createTestUser(t)
+
+	slow := newBlockingReceiver()
+	slowServer := httptest.NewServer(slow)
+	defer slowServer.Close()
+	fast := &webhookReceiver{}
+	fastServer := httptest.NewServer(fast)
+	defer fastServer.Close()
+
+	for _, callbackURL := range []string{slowServer.URL, fastServer.URL} {
+		if _, err := orchestrator.ProcessExpressionWithCallback("42", userID, callbackURL); err != nil {
+			t.Fatalf("ProcessExpressionWithCallback() error = %v", err)
+		}
+	}
+
+	type result struct {
+		attempts int
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		attempts, err := orchestrator.DeliverWebhooks(time.Now())
+		done <- result{attempts, err}
+	}()
+
+	// Быстрый получатель получает webhook, пока медленный еще не ответил
+	<-slow.started
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fast.mu.Lock()
+		received := len(fast.requests)
+		fast.mu.Unlock()
+		if received == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Fast receiver got no webhook while slow receiver was blocked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(slow.release)
+	if r := <-done; r.err != nil || r.attempts != 2 {
+		t.Errorf("DeliverWebhooks() = %d, %v, want 2 attempts", r.attempts, r.err)
+	}
+}
+
+// TestWebhookDispatcherShutdown проверяет, что остановка диспетчера не ждет дольше срока
+// и прерванная попытка не засчитывается
+func TestWebhookDispatcherShutdown(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+	allowPrivateWebhooks(t)
+	config.AppConfig.WebhookTimeout = time.Minute
+
+	userID, token := createTestUser(t)
+
+	slow := newBlockingReceiver()
+	server := httptest.NewServer(slow)
+	defer server.Close()
+	defer close(slow.release)
+
+	stop := orchestrator.StartWebhookDispatcher(time.Hour)
+	id, err := orchestrator.ProcessExpressionWithCallback("42", userID, server.URL)
+	if err != nil {
+		t.Fatalf("ProcessExpressionWithCallback() error = %v", err)
+	}
+	<-slow.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	stop(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("stop() took %v, want about the shutdown timeout", elapsed)
+	}
+
+	deliveries := getWebhookLog(t, token, *id)
+	if deliveries[0].Status != db.StatusPending || deliveries[0].Attempts != 0 {
+		t.Errorf("Delivery = %+v, want pending without recorded attempts", deliveries[0])
+	}
+}
+
+// TestWebhookCallbackURL проверяет проверку callback_url и доставку для сразу вычисленного выражения
+func TestWebhookCallbackURL(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+	allowPrivateWebhooks(t)
+
+	userID, token := createTestUser(t)
+
+	for _, callbackURL := range []string{"ftp://example.com/hook", "/hook", "not a url"} {
+		body := fmt.Sprintf(`{"expression": "2+2", "callback_url": %q}`, callbackURL)
+		req := httptest.NewRequest("POST", "/calculate", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		orchestrator.HandleCalculate(rr, req)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status code %d, got %d", callbackURL, http.StatusUnprocessableEntity, rr.Code)
+		}
+	}
+
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	// Выражение из одного числа завершается сразу, и webhook ставится в очередь при создании
+	id, err := orchestrator.ProcessExpressionWithCallback("42", userID, server.URL)
+	if err != nil {
+		t.Fatalf("ProcessExpressionWithCallback() error = %v", err)
+	}
+	if attempts, _ := orchestrator.DeliverWebhooks(time.Now()); attempts != 1 || len(receiver.requests) != 1 {
+		t.Fatalf("DeliverWebhooks() made %d attempts, want 1", attempts)
+	}
+	if deliveries := getWebhookLog(t, token, *id); deliveries[0].Status != db.StatusDelivered {
+		t.Errorf("Delivery status = %s, want %s", deliveries[0].Status, db.StatusDelivered)
+	}
+}
+
+// TestWebhookAddressPolicy проверяет запрет webhook на внутренние адреса при приеме выражения и при соединении
+func TestWebhookAddressPolicy(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+	defer func() {
+		config.AppConfig.WebhookAllowedNetworks = nil
+		config.AppConfig.WebhookDeniedNetworks = nil
+	}()
+
+	userID, token := createTestUser(t)
+
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	// Внутренний адрес, заданный IP, отклоняется сразу
+	internalURLs := []string{
+		server.URL,
+		"http://[::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://169.254.169.254/latest",
+		"http://[fe80::1%25eth0]/hook",
+		"http://10.0.0.1/hook",
+	}
+	// Адреса, запрещенные всегда
+	reservedURLs := []string{
+		"http://0.0.0.0/hook",
+		"http://0.1.2.3/hook",
+		"http://100.64.0.1/hook",
+		"http://[::127.0.0.1]/hook",
+		"http://[64:ff9b::7f00:1]/hook",
+		"http://[2002:7f00:1::]/hook",
+	}
+	for _, callbackURL := range append(internalURLs, reservedURLs...) {
+		if _, err := orchestrator.ProcessExpressionWithCallback("2+2", userID, callbackURL); !errors.Is(err, orchestrator.ErrInvalidCallbackURL) {
+			t.Errorf("%s: ProcessExpressionWithCallback() error = %v, want %v", callbackURL, err, orchestrator.ErrInvalidCallbackURL)
+		}
+	}
+	if _, err := orchestrator.ProcessExpressionWithCallback("2+2", userID, "http://203.0.113.10/hook"); err != nil {
+		t.Errorf("ProcessExpressionWithCallback() for public address error = %v", err)
+	}
+
+	// Адрес имени хоста проверяется при соединении
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	id, err := orchestrator.ProcessExpressionWithCallback("42", userID, "http://localhost:"+port+"/hook")
+	if err != nil {
+		t.Fatalf("ProcessExpressionWithCallback() error = %v", err)
+	}
+	if attempts, _ := orchestrator.DeliverWebhooks(time.Now()); attempts != 1 || len(receiver.requests) != 0 {
+		t.Fatalf("DeliverWebhooks() made %d attempts and %d requests, want 1 attempt without requests", attempts, len(receiver.requests))
+	}
+	deliveries := getWebhookLog(t, token, *id)
+	if deliveries[0].Status != db.StatusPending || deliveries[0].LastError == nil || !strings.Contains(*deliveries[0].LastError, "not allowed") {
+		t.Errorf("Delivery = %+v, want pending after a denied connection", deliveries[0])
+	}
+
+	// Сеть из списка разрешенных доступна несмотря на запрет частных адресов
+	config.AppConfig.WebhookAllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	if attempts, _ := orchestrator.DeliverWebhooks(time.Now().Add(time.Hour)); attempts != 1 || len(receiver.requests) != 1 {
+		t.Fatalf("DeliverWebhooks() made %d attempts and %d requests, want 1", attempts, len(receiver.requests))
+	}
+	if deliveries := getWebhookLog(t, token, *id); deliveries[0].Status != db.StatusDelivered {
+		t.Errorf("Delivery status = %s, want %s", deliveries[0].Status, db.StatusDelivered)
+	}
+
+	// Адреса локального хоста, сети провайдера и со встроенным IPv4-адресом запрещены,
+	// даже если разрешены частные адреса и все сети
+	allowPrivateWebhooks(t)
+	config.AppConfig.WebhookAllowedNetworks = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+	for _, callbackURL := range reservedURLs {
+		if _, err := orchestrator.ProcessExpressionWithCallback("2+2", userID, callbackURL); !errors.Is(err, orchestrator.ErrInvalidCallbackURL) {
+			t.Errorf("%s: ProcessExpressionWithCallback() error = %v, want %v", callbackURL, err, orchestrator.ErrInvalidCallbackURL)
+		}
+	}
+	if _, err := orchestrator.ProcessExpressionWithCallback("2+2", userID, "http://[::1]/hook"); err != nil {
+		t.Errorf("ProcessExpressionWithCallback() for loopback with private addresses allowed error = %v", err)
+	}
+
+	// Запрещенная сеть недоступна, даже если частные адреса разрешены
+	config.AppConfig.WebhookAllowedNetworks = nil
+	config.AppConfig.WebhookDeniedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	if _, err := orchestrator.ProcessExpressionWithCallback("2+2", userID, server.URL); !errors.Is(err, orchestrator.ErrInvalidCallbackURL) {
+		t.Errorf("ProcessExpressionWithCallback() error = %v, want %v", err, orchestrator.ErrInvalidCallbackURL)
+	}
+}
+
+// TestHandleWebhookSecret проверяет получение и замену ключа подписи
+func TestHandleWebhookSecret(t *testing.T) {
+	initTestDB(t)
+	defer db.CleanupDB()
+
+	_, token := createTestUser(t)
+
+	secretRequest := func(method string, handler http.HandlerFunc) string {
+		req := httptest.NewRequest(method, "/webhooks/secret", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response orchestrator.WebhookSecretResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response.Secret
+	}
+
+	secret := secretRequest("GET", orchestrator.HandleGetWebhookSecret)
+	if secret == "" {
+		t.Fatal("Expected non-empty secret")
+	}
+	if again := secretRequest("GET", orchestrator.HandleGetWebhookSecret); again != secret {
+		t.Errorf("Secret changed between requests: %q != %q", again, secret)
+	}
+
+	rotated := secretRequest("POST", orchestrator.HandleRotateWebhookSecret)
+	if rotated == secret || rotated == "" {
+		t.Errorf("Rotated secret = %q, want new secret", rotated)
+	}
+	if current := secretRequest("GET", orchestrator.HandleGetWebhookSecret); current != rotated {
+		t.Errorf("Secret after rotation = %q, want %q", current, rotated)
+	}
+}
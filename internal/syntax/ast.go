@@ -0,0 +1,116 @@
+// Package syntax содержит грамматику выражений калькулятора: лексер, парсер и AST.
+// Позиции узлов и ошибок — смещения в байтах от начала выражения
+package syntax
+
+// Operator — арифметический оператор выражения
+type Operator int
+
+const (
+	Add    Operator = iota + 1 // +
+	Sub                        // -
+	Mul                        // *
+	Div                        // /
+	Mod                        // %
+	IntDiv                     // //
+	Pow                        // ^ или **
+)
+
+// Символы операторов, под которыми операции сохраняются в БД и передаются агентам
+var operatorSymbols = map[Operator]string{
+	Add:    "+",
+	Sub:    "-",
+	Mul:    "*",
+	Div:    "/",
+	Mod:    "%",
+	IntDiv: "//",
+	Pow:    "^",
+}
+
+// String возвращает символ оператора; степень всегда записывается как "^"
+func (op Operator) String() string {
+	if symbol, ok := operatorSymbols[op]; ok {
+		return symbol
+	}
+	return "?"
+}
+
+// Node — узел AST выражения
+type Node interface {
+	Pos() int // смещение первого байта узла
+	End() int // смещение байта, следующего за узлом
+}
+
+// Number — числовой литерал
+type Number struct {
+	ValuePos int
+	ValueEnd int
+	Value    string // текст числа, например "2.5e-3"
+}
+
+// Ident — имя переменной или ссылка на результат выражения вида $42
+type Ident struct {
+	NamePos int
+	Name    string
+}
+
+// Unary — унарный плюс или минус
+type Unary struct {
+	OpPos int
+	Op    Operator
+	X     Node
+}
+
+// Binary — бинарная операция
+type Binary struct {
+	X     Node
+	OpPos int
+	Op    Operator
+	Y     Node
+}
+
+// Paren — выражение в скобках
+type Paren struct {
+	Lparen int
+	X      Node
+	Rparen int
+}
+
+// Call — вызов функции
+type Call struct {
+	Fun    *Ident
+	Lparen int
+	Args   []Node
+	Rparen int
+}
+
+// Interval — интервальный литерал [Lo, Hi]. Границы — числа, возможно со знаком: *Number или *Unary над *Number
+type Interval struct {
+	Lbracket int
+	Lo, Hi   Node
+	Rbracket int
+}
+
+// Tolerance — число с допуском X ± Delta, то есть интервал [X - Delta, X + Delta]
+type Tolerance struct {
+	X     *Number
+	OpPos int
+	Delta *Number
+}
+
+func (n *Number) Pos() int    { return n.ValuePos }
+func (n *Ident) Pos() int     { return n.NamePos }
+func (n *Unary) Pos() int     { return n.OpPos }
+func (n *Binary) Pos() int    { return n.X.Pos() }
+func (n *Paren) Pos() int     { return n.Lparen }
+func (n *Call) Pos() int      { return n.Fun.Pos() }
+func (n *Interval) Pos() int  { return n.Lbracket }
+func (n *Tolerance) Pos() int { return n.X.Pos() }
+
+func (n *Number) End() int    { return n.ValueEnd }
+func (n *Ident) End() int     { return n.NamePos + len(n.Name) }
+func (n *Unary) End() int     { return n.X.End() }
+func (n *Binary) End() int    { return n.Y.End() }
+func (n *Paren) End() int     { return n.Rparen + 1 }
+func (n *Call) End() int      { return n.Rparen + 1 }
+func (n *Interval) End() int  { return n.Rbracket + 1 }
+func (n *Tolerance) End() int { return n.Delta.End() }
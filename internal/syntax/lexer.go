@@ -0,0 +1,191 @@
+package syntax
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind — вид лексемы
+type tokenKind int
+
+const (
+	tokenEOF       tokenKind = iota
+	tokenNumber              // 42, 2.5, .5, 1e3
+	tokenName                // имя функции или переменной, ссылка $42
+	tokenOperator            // арифметический оператор
+	tokenLParen              // (
+	tokenRParen              // )
+	tokenComma               // ,
+	tokenLBracket            // [
+	tokenRBracket            // ]
+	tokenPlusMinus           // ± или +/-
+	tokenInvalid             // "++" или "--"
+)
+
+// token — лексема выражения
+type token struct {
+	kind tokenKind
+	op   Operator // для tokenOperator
+	text string   // исходный текст лексемы
+	pos  int
+}
+
+// String описывает лексему для сообщений об ошибках
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenNumber:
+		return "number " + t.text
+	case tokenName:
+		return "name " + t.text
+	}
+	return "'" + t.text + "'"
+}
+
+// lexer выделяет лексемы по одной, по мере продвижения парсера: ошибка в конце выражения
+// не скрывает синтаксическую ошибку перед ней
+type lexer struct {
+	src string
+	pos int
+}
+
+// next возвращает следующую лексему или ошибку в недопустимом символе
+func (l *lexer) next() (token, error) {
+	src := l.src
+
+	for l.pos < len(src) && isSpace(src[l.pos]) {
+		l.pos++
+	}
+	if l.pos == len(src) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	emit := func(kind tokenKind, op Operator, end int) (token, error) {
+		l.pos = end
+		return token{kind: kind, op: op, text: src[start:end], pos: start}, nil
+	}
+
+	c := src[start]
+	switch {
+	case isDigit(c) || c == '.':
+		end := l.scanNumber(start)
+		if src[start:end] == "." {
+			return token{}, newError(src, start, []string{"digit"}, "unexpected '.'")
+		}
+		return emit(tokenNumber, 0, end)
+
+	// Ссылка на результат ранее вычисленного выражения: $42
+	case c == '$':
+		end := start + 1
+		for end < len(src) && isDigit(src[end]) {
+			end++
+		}
+		if end == start+1 {
+			return token{}, newError(src, end, []string{"expression id"}, "'$' is not followed by an expression id")
+		}
+		return emit(tokenName, 0, end)
+
+	case isIdentStart(c):
+		end := start + 1
+		for end < len(src) && (isIdentStart(src[end]) || isDigit(src[end])) {
+			end++
+		}
+		return emit(tokenName, 0, end)
+	}
+
+	// Допуск числа: "±" или "+/-". Выражение "2+/-1" и раньше было некорректным
+	for _, text := range []string{"±", "+/-"} {
+		if strings.HasPrefix(src[start:], text) {
+			return emit(tokenPlusMinus, 0, start+len(text))
+		}
+	}
+
+	// Двухсимвольные лексемы. Как и в прежней грамматике go/scanner, "++" и "--" —
+	// отдельные лексемы, поэтому "2++2" некорректно, а "2+ +2" и "2+-2" допустимы
+	if start+1 < len(src) {
+		switch src[start : start+2] {
+		case "**":
+			return emit(tokenOperator, Pow, start+2)
+		case "//":
+			return emit(tokenOperator, IntDiv, start+2)
+		case "++", "--":
+			return emit(tokenInvalid, 0, start+2)
+		}
+	}
+
+	switch c {
+	case '+':
+		return emit(tokenOperator, Add, start+1)
+	case '-':
+		return emit(tokenOperator, Sub, start+1)
+	case '*':
+		return emit(tokenOperator, Mul, start+1)
+	case '/':
+		return emit(tokenOperator, Div, start+1)
+	case '%':
+		return emit(tokenOperator, Mod, start+1)
+	case '^':
+		return emit(tokenOperator, Pow, start+1)
+	case '(':
+		return emit(tokenLParen, 0, start+1)
+	case ')':
+		return emit(tokenRParen, 0, start+1)
+	case ',':
+		return emit(tokenComma, 0, start+1)
+	case '[':
+		return emit(tokenLBracket, 0, start+1)
+	case ']':
+		return emit(tokenRBracket, 0, start+1)
+	}
+
+	r, _ := utf8.DecodeRuneInString(src[start:])
+	if unicode.IsPrint(r) {
+		return token{}, newError(src, start, nil, fmt.Sprintf("unexpected character %q", r))
+	}
+	return token{}, newError(src, start, nil, fmt.Sprintf("unexpected character %U", r))
+}
+
+// scanNumber возвращает конец числа, начинающегося в start: цифры, дробная часть
+// и экспонента (1e3, 2.5E-4). "e" без цифр после нее не входит в число
+func (l *lexer) scanNumber(start int) int {
+	src := l.src
+	digits := func(i int) int {
+		for i < len(src) && isDigit(src[i]) {
+			i++
+		}
+		return i
+	}
+
+	end := digits(start)
+	if end < len(src) && src[end] == '.' {
+		end = digits(end + 1)
+	}
+
+	if end < len(src) && (src[end] == 'e' || src[end] == 'E') {
+		i := end + 1
+		if i < len(src) && (src[i] == '+' || src[i] == '-') {
+			i++
+		}
+		if i < len(src) && isDigit(src[i]) {
+			end = digits(i)
+		}
+	}
+	return end
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentStart сообщает, может ли с символа c начинаться имя функции или переменной
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,294 @@
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error — синтаксическая ошибка выражения с ее позицией
+type Error struct {
+	Offset   int      // смещение в байтах от начала выражения
+	Line     int      // номер строки, начиная с 1
+	Column   int      // номер символа в строке, начиная с 1
+	Msg      string   // описание ошибки
+	Expected []string // что допустимо в этой позиции
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+	if len(e.Expected) > 0 {
+		msg += ", expected " + alternatives(e.Expected)
+	}
+	return msg
+}
+
+// alternatives перечисляет варианты через запятую, последний — через "or"
+func alternatives(list []string) string {
+	if len(list) == 1 {
+		return list[0]
+	}
+	return strings.Join(list[:len(list)-1], ", ") + " or " + list[len(list)-1]
+}
+
+// newError создает ошибку в позиции offset выражения src
+func newError(src string, offset int, expected []string, msg string) *Error {
+	line, column := Position(src, offset)
+	return &Error{Offset: offset, Line: line, Column: column, Msg: msg, Expected: expected}
+}
+
+// Что может стоять на месте операнда
+var operandExpected = []string{"number", "name", "'('"}
+
+// Приоритеты бинарных операторов: чем больше, тем раньше применяется оператор.
+// Унарные "+" и "-" применяются после степени, но раньше умножения: -2^2 = -(2^2)
+const (
+	precedenceAdditive       = 1
+	precedenceMultiplicative = 2
+	precedenceUnary          = 3
+	precedencePower          = 4
+)
+
+func precedence(op Operator) int {
+	switch op {
+	case Add, Sub:
+		return precedenceAdditive
+	case Pow:
+		return precedencePower
+	}
+	return precedenceMultiplicative
+}
+
+// parser разбирает выражение методом Пратта. Степень правоассоциативна: 2^3^2 = 2^(3^2),
+// остальные бинарные операторы левоассоциативны
+type parser struct {
+	src string
+	lex lexer
+	tok token // текущая лексема
+}
+
+// Parse разбирает выражение калькулятора в AST. Ошибка разбора имеет тип *Error
+func Parse(src string) (Node, error) {
+	p := &parser{src: src, lex: lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	node, err := p.parseExpr(precedenceAdditive, "end of expression")
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF {
+		return nil, p.unexpected("operator", "end of expression")
+	}
+	return node, nil
+}
+
+// advance переходит к следующей лексеме
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// unexpected возвращает ошибку в текущей лексеме
+func (p *parser) unexpected(expected ...string) error {
+	return newError(p.src, p.tok.pos, expected, "unexpected "+p.tok.String())
+}
+
+// parseExpr разбирает операнд и следующие за ним бинарные операции с приоритетом не ниже minPrecedence.
+// closing — лексемы, которые могут завершать выражение в этом месте, для подсказки в ошибке
+func (p *parser) parseExpr(minPrecedence int, closing ...string) (Node, error) {
+	left, err := p.parseOperand(closing)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.kind == tokenOperator && precedence(p.tok.op) >= minPrecedence {
+		op := p.tok
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		next := precedence(op.op) + 1
+		if op.op == Pow {
+			next = precedencePower
+		}
+		right, err := p.parseExpr(next, closing...)
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{X: left, OpPos: op.pos, Op: op.op, Y: right}
+	}
+
+	// После операнда допустим только оператор или лексема, завершающая выражение
+	switch p.tok.kind {
+	case tokenInvalid, tokenNumber, tokenName, tokenLParen, tokenLBracket, tokenPlusMinus:
+		return nil, p.unexpected(append([]string{"operator"}, closing...)...)
+	}
+	return left, nil
+}
+
+// parseOperand разбирает число, возможно с допуском, интервал, имя, вызов функции,
+// выражение в скобках или унарную операцию
+func (p *parser) parseOperand(closing []string) (Node, error) {
+	tok := p.tok
+
+	switch tok.kind {
+	case tokenNumber:
+		number, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenPlusMinus {
+			return number, nil
+		}
+		return p.parseTolerance(number)
+
+	case tokenLBracket:
+		return p.parseInterval()
+
+	case tokenName:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name := &Ident{NamePos: tok.pos, Name: tok.text}
+		if p.tok.kind != tokenLParen {
+			return name, nil
+		}
+		return p.parseCall(name)
+
+	case tokenLParen:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseExpr(precedenceAdditive, "')'")
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenRParen {
+			return nil, p.unexpected("operator", "')'")
+		}
+		paren := &Paren{Lparen: tok.pos, X: inner, Rparen: p.tok.pos}
+		return paren, p.advance()
+
+	case tokenOperator:
+		if tok.op != Add && tok.op != Sub {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseExpr(precedenceUnary, closing...)
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{OpPos: tok.pos, Op: tok.op, X: operand}, nil
+	}
+
+	return nil, p.unexpected(operandExpected...)
+}
+
+// parseCall разбирает аргументы вызова функции name: (арг, арг, ...)
+func (p *parser) parseCall(name *Ident) (Node, error) {
+	call := &Call{Fun: name, Lparen: p.tok.pos}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokenRParen {
+		for {
+			arg, err := p.parseExpr(precedenceAdditive, "','", "')'")
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+
+			if p.tok.kind != tokenComma {
+				break
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if p.tok.kind != tokenRParen {
+		return nil, p.unexpected("operator", "','", "')'")
+	}
+	call.Rparen = p.tok.pos
+	return call, p.advance()
+}
+
+// parseNumber разбирает числовой литерал
+func (p *parser) parseNumber() (*Number, error) {
+	tok := p.tok
+	if tok.kind != tokenNumber {
+		return nil, p.unexpected("number")
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return &Number{ValuePos: tok.pos, ValueEnd: tok.pos + len(tok.text), Value: tok.text}, nil
+}
+
+// parseTolerance разбирает допуск числа x: ± число
+func (p *parser) parseTolerance(x *Number) (Node, error) {
+	opPos := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	delta, err := p.parseNumber()
+	if err != nil {
+		return nil, err
+	}
+	return &Tolerance{X: x, OpPos: opPos, Delta: delta}, nil
+}
+
+// parseInterval разбирает интервальный литерал [число, число]
+func (p *parser) parseInterval() (Node, error) {
+	interval := &Interval{Lbracket: p.tok.pos}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	lo, err := p.parseBound()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenComma {
+		return nil, p.unexpected("','")
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	hi, err := p.parseBound()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenRBracket {
+		return nil, p.unexpected("']'")
+	}
+
+	interval.Lo, interval.Hi, interval.Rbracket = lo, hi, p.tok.pos
+	return interval, p.advance()
+}
+
+// parseBound разбирает границу интервала: число с необязательным знаком
+func (p *parser) parseBound() (Node, error) {
+	tok := p.tok
+	if tok.kind != tokenOperator || tok.op != Add && tok.op != Sub {
+		return p.parseNumber()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	x, err := p.parseNumber()
+	if err != nil {
+		return nil, err
+	}
+	return &Unary{OpPos: tok.pos, Op: tok.op, X: x}, nil
+}
@@ -0,0 +1,196 @@
+package syntax_test
+
+import (
+	"errors"
+	"fmt"
+	"parallel-calculator/internal/syntax"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// format записывает AST в виде со всеми скобками для сравнения структуры дерева
+func format(node syntax.Node) string {
+	switch n := node.(type) {
+	case *syntax.Number:
+		return n.Value
+	case *syntax.Ident:
+		return n.Name
+	case *syntax.Unary:
+		return fmt.Sprintf("(%s%s)", n.Op, format(n.X))
+	case *syntax.Binary:
+		return fmt.Sprintf("(%s %s %s)", format(n.X), n.Op, format(n.Y))
+	case *syntax.Paren:
+		return format(n.X)
+	case *syntax.Call:
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = format(arg)
+		}
+		return n.Fun.Name + "(" + strings.Join(args, ", ") + ")"
+	case *syntax.Interval:
+		return "[" + format(n.Lo) + ", " + format(n.Hi) + "]"
+	case *syntax.Tolerance:
+		return "(" + n.X.Value + " ± " + n.Delta.Value + ")"
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+// TestParse проверяет приоритеты и ассоциативность операторов
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"2+2*2", "(2 + (2 * 2))"},
+		{"(2+2)*2", "((2 + 2) * 2)"},
+		{"8-3-2", "((8 - 3) - 2)"},
+		{"2^3^2", "(2 ^ (3 ^ 2))"},
+		{"2**3", "(2 ^ 3)"},
+		{"-2^2", "(-(2 ^ 2))"},
+		{"-2*3", "((-2) * 3)"},
+		{"2^-1", "(2 ^ (-1))"},
+		{"2+ +2", "(2 + (+2))"},
+		{"2+-2", "(2 + (-2))"},
+		{"1 + 7 % 3 // 2", "(1 + ((7 % 3) // 2))"},
+		{"sqrt(16) + max(2, 3*4)", "(sqrt(16) + max(2, (3 * 4)))"},
+		{"rate * $42", "(rate * $42)"},
+		{"1.5e3 / .5", "(1.5e3 / .5)"},
+		{"pi()", "pi()"},
+		{"2 *\n\t(3 + 4)", "(2 * (3 + 4))"},
+		{"[1.9, 2.1] * 3", "([1.9, 2.1] * 3)"},
+		{"[-0.5,+1e-3]", "[(-0.5), (+1e-3)]"},
+		{"2 ± 0.1 * 3", "((2 ± 0.1) * 3)"},
+		{"-2 +/- 0.1", "(-(2 ± 0.1))"},
+		{"sqrt([4, 9])", "sqrt([4, 9])"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			node, err := syntax.Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := format(node); got != tt.want {
+				t.Errorf("Parse() = %s, want %s", got, tt.want)
+			}
+			if node.Pos() != strings.IndexFunc(tt.expression, func(r rune) bool { return r != ' ' }) ||
+				node.End() != len(strings.TrimRight(tt.expression, " ")) {
+				t.Errorf("Node span = [%d, %d), want whole expression", node.Pos(), node.End())
+			}
+		})
+	}
+}
+
+// TestParseErrors проверяет позиции ошибок и подсказки об ожидаемых лексемах
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		offset     int
+		line       int
+		column     int
+		msg        string
+		expected   []string
+	}{
+		{"", 0, 1, 1, "unexpected end of expression", []string{"number", "name", "'('"}},
+		{"2+", 2, 1, 3, "unexpected end of expression", []string{"number", "name", "'('"}},
+		{"2++2", 1, 1, 2, "unexpected '++'", []string{"operator", "end of expression"}},
+		{"2 3", 2, 1, 3, "unexpected number 3", []string{"operator", "end of expression"}},
+		{"(1 + 2", 6, 1, 7, "unexpected end of expression", []string{"operator", "')'"}},
+		{"max(1 2)", 6, 1, 7, "unexpected number 2", []string{"operator", "','", "')'"}},
+		{"1 + 2)", 5, 1, 6, "unexpected ')'", []string{"operator", "end of expression"}},
+		{"2 * / 3", 4, 1, 5, "unexpected '/'", []string{"number", "name", "'('"}},
+		{"0x10", 1, 1, 2, "unexpected name x10", []string{"operator", "end of expression"}},
+		{"2 & 3", 2, 1, 3, "unexpected character '&'", nil},
+		{"$ + 1", 1, 1, 2, "'$' is not followed by an expression id", []string{"expression id"}},
+		{"1 +\nπ", 4, 2, 1, "unexpected character 'π'", nil},
+		{"(π) + (", 1, 1, 2, "unexpected character 'π'", nil},
+		{"√4 +\n 2 *", 0, 1, 1, "unexpected character '√'", nil},
+		{"1 +\n 2 *", 8, 2, 5, "unexpected end of expression", []string{"number", "name", "'('"}},
+		{"[1, 2", 5, 1, 6, "unexpected end of expression", []string{"']'"}},
+		{"[1 2]", 3, 1, 4, "unexpected number 2", []string{"','"}},
+		{"[x, 2]", 1, 1, 2, "unexpected name x", []string{"number"}},
+		{"[1, 1+1]", 5, 1, 6, "unexpected '+'", []string{"']'"}},
+		{"2 ± -0.1", 5, 1, 5, "unexpected '-'", []string{"number"}},
+		{"(2) ± 1", 4, 1, 5, "unexpected '±'", []string{"operator", "end of expression"}},
+		{"2 [1, 2]", 2, 1, 3, "unexpected '['", []string{"operator", "end of expression"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := syntax.Parse(tt.expression)
+
+			var syntaxErr *syntax.Error
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse() error = %v, want *syntax.Error", err)
+			}
+			if syntaxErr.Offset != tt.offset || syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Errorf("Error position = %d (%d:%d), want %d (%d:%d)",
+					syntaxErr.Offset, syntaxErr.Line, syntaxErr.Column, tt.offset, tt.line, tt.column)
+			}
+			if syntaxErr.Msg != tt.msg || !reflect.DeepEqual(syntaxErr.Expected, tt.expected) {
+				t.Errorf("Error = %q %q, want %q %q", syntaxErr.Msg, syntaxErr.Expected, tt.msg, tt.expected)
+			}
+		})
+	}
+}
+
+// TestErrorMessage проверяет текст ошибки
+func TestErrorMessage(t *testing.T) {
+	_, err := syntax.Parse("max(1 2)")
+	want := "1:7: unexpected number 2, expected operator, ',' or ')'"
+	if err == nil || err.Error() != want {
+		t.Errorf("Error() = %v, want %q", err, want)
+	}
+}
+
+// TestNodePositions проверяет границы узлов в исходном выражении
+func TestNodePositions(t *testing.T) {
+	expression := "1 + (4 / (2 - 2)) * max(3, 4)"
+	node, err := syntax.Parse(expression)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	sum := node.(*syntax.Binary)
+	product := sum.Y.(*syntax.Binary)
+	call := product.Y.(*syntax.Call)
+	quotient := product.X.(*syntax.Paren).X.(*syntax.Binary)
+
+	for _, tt := range []struct {
+		node syntax.Node
+		want string
+	}{
+		{product, "(4 / (2 - 2)) * max(3, 4)"},
+		{product.X, "(4 / (2 - 2))"},
+		{quotient, "4 / (2 - 2)"},
+		{quotient.Y, "(2 - 2)"},
+		{call, "max(3, 4)"},
+		{call.Args[1], "4"},
+	} {
+		if got := expression[tt.node.Pos():tt.node.End()]; got != tt.want {
+			t.Errorf("Node %T spans %q, want %q", tt.node, got, tt.want)
+		}
+	}
+}
+
+// TestHighlight проверяет отметку фрагмента выражения
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		src        string
+		start, end int
+		want       string
+	}{
+		{"1 + (4 / (2 - 2))", 4, 17, "1 + (4 / (2 - 2))\n    ^^^^^^^^^^^^^"},
+		{"√16 + 1/0", 8, 11, "√16 + 1/0\n      ^^^"},
+		{"2 *\n\t(1 / 0)", 5, 12, "\t(1 / 0)\n\t^^^^^^^"},
+		{"max(1,\n 2) / 0", 0, 14, "max(1,\n^^^^^^"},
+		{"1/0", 3, 3, "1/0\n   ^"},
+	}
+
+	for _, tt := range tests {
+		if got := syntax.Highlight(tt.src, tt.start, tt.end); got != tt.want {
+			t.Errorf("Highlight(%q, %d, %d) = %q, want %q", tt.src, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
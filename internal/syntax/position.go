@@ -0,0 +1,46 @@
+package syntax
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Position переводит смещение в байтах в номер строки и символа в строке (с 1)
+func Position(src string, offset int) (line, column int) {
+	offset = min(max(offset, 0), len(src))
+	before := src[:offset]
+
+	line = strings.Count(before, "\n") + 1
+	if i := strings.LastIndexByte(before, '\n'); i >= 0 {
+		before = before[i+1:]
+	}
+	return line, utf8.RuneCountInString(before) + 1
+}
+
+// Highlight отмечает фрагмент src[start:end]: возвращает строку выражения, в которой он начинается,
+// и под ней строку с "^" под каждым символом фрагмента. Фрагмент, продолжающийся на следующих
+// строках, отмечается до конца первой строки
+func Highlight(src string, start, end int) string {
+	start = min(max(start, 0), len(src))
+	end = min(max(end, start), len(src))
+
+	lineStart := strings.LastIndexByte(src[:start], '\n') + 1
+	lineEnd := len(src)
+	if i := strings.IndexByte(src[start:], '\n'); i >= 0 {
+		lineEnd = start + i
+	}
+	end = min(end, lineEnd)
+
+	var marker strings.Builder
+	// Табуляция сохраняется, чтобы отметка оставалась под фрагментом при любой ширине табуляции
+	for _, r := range src[lineStart:start] {
+		if r == '\t' {
+			marker.WriteByte('\t')
+		} else {
+			marker.WriteByte(' ')
+		}
+	}
+	marker.WriteString(strings.Repeat("^", max(utf8.RuneCountInString(src[start:end]), 1)))
+
+	return strings.TrimRight(src[lineStart:lineEnd], "\r") + "\n" + marker.String()
+}
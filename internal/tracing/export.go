@@ -0,0 +1,384 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Форматы файла трасс
+const (
+	FormatOTLP = "otlp" // строка файла — запрос ExportTraceServiceRequest в кодировке OTLP/JSON
+	FormatJSON = "json" // строка файла — один спан в простом JSON
+)
+
+// Параметры пакетной передачи спанов экспортеру
+const (
+	exportInterval  = time.Second
+	exportBatchSize = 512
+	maxQueueSize    = 8192
+)
+
+// Exporter сохраняет завершенные спаны процесса service
+type Exporter interface {
+	Export(service string, spans []SpanData) error
+	Close() error
+}
+
+// Текущий обработчик спанов; nil — трассировка выключена
+var active atomic.Pointer[processor]
+
+// Init включает трассировку: завершенные спаны пачками передаются exporter от имени процесса service.
+// Возвращает функцию остановки, которая выключает трассировку, экспортирует оставшиеся спаны
+// и закрывает экспортер (не дольше, чем позволяет ctx)
+func Init(service string, exporter Exporter) func(ctx context.Context) error {
+	p := &processor{
+		service:  service,
+		exporter: exporter,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	active.Store(p)
+	go p.run()
+
+	var once sync.Once
+	return func(ctx context.Context) error {
+		var err error
+		once.Do(func() {
+			active.CompareAndSwap(p, nil)
+			err = p.shutdown(ctx)
+		})
+		return err
+	}
+}
+
+// processor накапливает завершенные спаны и передает их экспортеру в фоне
+type processor struct {
+	service  string
+	exporter Exporter
+
+	mu      sync.Mutex
+	queue   []SpanData
+	dropped int
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// enqueue ставит спан в очередь экспорта. Если очередь переполнена, спан отбрасывается
+func (p *processor) enqueue(span SpanData) {
+	p.mu.Lock()
+	if len(p.queue) >= maxQueueSize {
+		p.dropped++
+		p.mu.Unlock()
+		return
+	}
+	p.queue = append(p.queue, span)
+	full := len(p.queue) >= exportBatchSize
+	p.mu.Unlock()
+
+	if full {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *processor) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+		p.flush()
+	}
+}
+
+// flush передает экспортеру все накопленные спаны
+func (p *processor) flush() error {
+	p.mu.Lock()
+	spans := p.queue
+	dropped := p.dropped
+	p.queue = nil
+	p.dropped = 0
+	p.mu.Unlock()
+
+	if dropped > 0 {
+		fmt.Fprintf(os.Stderr, "tracing: export queue is full, %d spans dropped\n", dropped)
+	}
+
+	var err error
+	for len(spans) > 0 {
+		n := min(len(spans), exportBatchSize)
+		if exportErr := p.exporter.Export(p.service, spans[:n]); exportErr != nil {
+			fmt.Fprintf(os.Stderr, "tracing: export: %v\n", exportErr)
+			err = exportErr
+		}
+		spans = spans[n:]
+	}
+	return err
+}
+
+func (p *processor) shutdown(ctx context.Context) error {
+	close(p.done)
+
+	select {
+	case <-p.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	err := p.flush()
+	if closeErr := p.exporter.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// FileExporter дописывает спаны в локальный файл: в формате OTLP/JSON (его читают OpenTelemetry
+// Collector и совместимые инструменты) или по одному спану в строке в простом JSON
+type FileExporter struct {
+	mu     sync.Mutex
+	file   *os.File
+	format string
+}
+
+// NewFileExporter открывает файл path для дозаписи спанов в формате format (FormatOTLP или FormatJSON)
+func NewFileExporter(path, format string) (*FileExporter, error) {
+	if format != FormatOTLP && format != FormatJSON {
+		return nil, fmt.Errorf("tracing: unknown format %q", format)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file, format: format}, nil
+}
+
+// Export записывает спаны: в формате OTLP — одной строкой, в формате JSON — по строке на спан
+func (e *FileExporter) Export(service string, spans []SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	w := bufio.NewWriter(e.file)
+	enc := json.NewEncoder(w)
+
+	if e.format == FormatOTLP {
+		if err := enc.Encode(otlpRequest(service, spans)); err != nil {
+			return err
+		}
+	} else {
+		for _, span := range spans {
+			if err := enc.Encode(jsonSpan(service, span)); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// Close закрывает файл
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
+
+// Структуры кодировки OTLP/JSON (opentelemetry/proto/collector/trace/v1)
+type (
+	otlpExportRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"` // int64 кодируется строкой
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// instrumentationScope — имя библиотеки, создавшей спаны
+const instrumentationScope = "parallel-calculator/internal/tracing"
+
+func otlpRequest(service string, spans []SpanData) otlpExportRequest {
+	list := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.SpanContext.TraceID.String(),
+			SpanID:            span.SpanContext.SpanID.String(),
+			Name:              span.Name,
+			Kind:              int(span.Kind),
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            otlpStatus{Code: int(span.StatusCode), Message: span.StatusMessage},
+		}
+		if span.Parent != (SpanID{}) {
+			s.ParentSpanID = span.Parent.String()
+		}
+		list = append(list, s)
+	}
+
+	return otlpExportRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: otlpAttributes([]Attribute{{Key: "service.name", Value: service}}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: instrumentationScope},
+				Spans: list,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attrs []Attribute) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	list := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		list = append(list, otlpKeyValue{Key: attr.Key, Value: otlpValue(attr.Value)})
+	}
+	return list
+}
+
+// otlpValue кодирует значение атрибута; типы, которых нет в OTLP, записываются строкой
+func otlpValue(value any) otlpAnyValue {
+	integer := func(v int64) otlpAnyValue {
+		s := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &s}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		return integer(int64(v))
+	case int32:
+		return integer(int64(v))
+	case int64:
+		return integer(v)
+	case uint32:
+		return integer(int64(v))
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return otlpAnyValue{DoubleValue: &v}
+		}
+	}
+
+	s := fmt.Sprint(value)
+	return otlpAnyValue{StringValue: &s}
+}
+
+// jsonSpanRecord — спан в простом формате JSON
+type jsonSpanRecord struct {
+	Service       string         `json:"service"`
+	TraceID       string         `json:"trace_id"`
+	SpanID        string         `json:"span_id"`
+	ParentSpanID  string         `json:"parent_span_id,omitempty"`
+	Name          string         `json:"name"`
+	Kind          string         `json:"kind"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	DurationMs    float64        `json:"duration_ms"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	Status        string         `json:"status,omitempty"`
+	StatusMessage string         `json:"status_message,omitempty"`
+}
+
+func jsonSpan(service string, span SpanData) jsonSpanRecord {
+	record := jsonSpanRecord{
+		Service:       service,
+		TraceID:       span.SpanContext.TraceID.String(),
+		SpanID:        span.SpanContext.SpanID.String(),
+		Name:          span.Name,
+		Kind:          span.Kind.String(),
+		Start:         span.Start,
+		End:           span.End,
+		DurationMs:    float64(span.End.Sub(span.Start).Microseconds()) / 1000,
+		StatusMessage: span.StatusMessage,
+	}
+	if span.Parent != (SpanID{}) {
+		record.ParentSpanID = span.Parent.String()
+	}
+
+	switch span.StatusCode {
+	case StatusOK:
+		record.Status = "ok"
+	case StatusError:
+		record.Status = "error"
+	}
+
+	if len(span.Attributes) > 0 {
+		record.Attributes = make(map[string]any, len(span.Attributes))
+		for _, attr := range span.Attributes {
+			value := attr.Value
+			if f, ok := value.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				value = fmt.Sprint(f)
+			}
+			if _, ok := value.(error); ok {
+				value = fmt.Sprint(value)
+			}
+			record.Attributes[attr.Key] = value
+		}
+	}
+	return record
+}
@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// TraceparentHeader — заголовок W3C с контекстом родительского спана
+const TraceparentHeader = "traceparent"
+
+// Middleware создает серверный спан для каждого HTTP-запроса. Если клиент передал заголовок
+// traceparent, спан становится частью его трассы, иначе начинает новую.
+// Ответ содержит traceparent созданного спана, чтобы трассу можно было найти по ответу
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if active.Load() == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Имя спана — шаблон маршрута, а не путь с идентификаторами
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := ContextWithTraceparent(r.Context(), r.Header.Get(TraceparentHeader))
+		ctx, span := Start(ctx, r.Method+" "+route, WithKind(SpanKindServer), WithAttributes(
+			"http.request.method", r.Method,
+			"http.route", route,
+			"url.path", r.URL.Path,
+		))
+		defer span.End()
+
+		w.Header().Set(TraceparentHeader, span.SpanContext().Traceparent())
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes("http.response.status_code", rec.status)
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(StatusError, http.StatusText(rec.status))
+		}
+	})
+}
+
+// statusRecorder запоминает код ответа. Flush и Unwrap нужны потоку событий SSE
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *statusRecorder) Flush() {
+	r.wroteHeader = true
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
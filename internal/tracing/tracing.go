@@ -0,0 +1,287 @@
+// Package tracing реализует трассировку в духе OpenTelemetry: спаны с родительскими связями,
+// передачу контекста между процессами в формате W3C traceparent и экспорт завершенных спанов.
+// Пока экспорт не настроен (см. Init), спаны не создаются, а контекст родителя передается дальше без изменений
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID — идентификатор трассы
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID — идентификатор спана
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext — идентификаторы спана, которые передаются дочерним спанам, в том числе в другие процессы
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// IsValid сообщает, заданы ли оба идентификатора
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent возвращает значение заголовка W3C traceparent или пустую строку для пустого контекста
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-01"
+}
+
+// ParseTraceparent разбирает значение заголовка W3C traceparent
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return sc, false
+	}
+	// Версия 00 содержит ровно четыре поля, будущие версии могут добавить новые
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// SpanKind — роль спана в взаимодействии процессов, значения совпадают с OTLP
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1 // работа внутри процесса
+	SpanKindServer   SpanKind = 2 // обработка входящего запроса
+	SpanKindClient   SpanKind = 3 // исходящий запрос
+	SpanKindProducer SpanKind = 4 // передача работы, которую выполнит другой процесс
+	SpanKindConsumer SpanKind = 5 // выполнение переданной работы
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	case SpanKindProducer:
+		return "producer"
+	case SpanKindConsumer:
+		return "consumer"
+	}
+	return "internal"
+}
+
+// StatusCode — итог спана, значения совпадают с OTLP
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute — атрибут спана
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// attributes преобразует пары ключ-значение в атрибуты. Лишний ключ без значения отбрасывается
+func attributes(kv []any) []Attribute {
+	attrs := make([]Attribute, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		attrs = append(attrs, Attribute{Key: fmt.Sprint(kv[i]), Value: kv[i+1]})
+	}
+	return attrs
+}
+
+// SpanData — завершенный спан, передаваемый экспортеру
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanID // пустой у корневого спана
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Span — выполняемая операция. Методы nil-спана ничего не делают,
+// поэтому спан из Start можно использовать и при выключенной трассировке
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+	proc  *processor
+}
+
+// SpanContext возвращает идентификаторы спана
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttributes добавляет атрибуты спана: пары ключ-значение
+func (s *Span) SetAttributes(kv ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Attributes = append(s.data.Attributes, attributes(kv)...)
+	s.mu.Unlock()
+}
+
+// RecordError отмечает спан как завершившийся ошибкой err. Для nil ничего не делает
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.StatusCode = StatusError
+	s.data.StatusMessage = err.Error()
+	s.mu.Unlock()
+}
+
+// SetStatus задает итог спана
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.StatusCode = code
+	s.data.StatusMessage = message
+	s.mu.Unlock()
+}
+
+// End завершает спан и передает его на экспорт. Повторный вызов ничего не делает
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.proc.enqueue(data)
+}
+
+// Option задает параметры нового спана
+type Option func(*SpanData)
+
+// WithKind задает роль спана; по умолчанию SpanKindInternal
+func WithKind(kind SpanKind) Option {
+	return func(d *SpanData) {
+		d.Kind = kind
+	}
+}
+
+// WithAttributes добавляет атрибуты спана: пары ключ-значение
+func WithAttributes(kv ...any) Option {
+	return func(d *SpanData) {
+		d.Attributes = append(d.Attributes, attributes(kv)...)
+	}
+}
+
+type spanContextKey struct{}
+
+// Start создает спан name, дочерний к спану из ctx, и возвращает контекст с ним.
+// Если в ctx нет спана, создается корневой спан новой трассы. При выключенной трассировке
+// возвращает ctx без изменений и nil-спан
+func Start(ctx context.Context, name string, opts ...Option) (context.Context, *Span) {
+	proc := active.Load()
+	if proc == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	parent := SpanContextFromContext(ctx)
+	span := &Span{
+		data: SpanData{
+			Name:  name,
+			Kind:  SpanKindInternal,
+			Start: time.Now(),
+		},
+		proc: proc,
+	}
+	for _, opt := range opts {
+		opt(&span.data)
+	}
+
+	if parent.IsValid() {
+		span.data.SpanContext.TraceID = parent.TraceID
+		span.data.Parent = parent.SpanID
+	} else {
+		rand.Read(span.data.SpanContext.TraceID[:])
+	}
+	rand.Read(span.data.SpanContext.SpanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, span.data.SpanContext), span
+}
+
+// SpanContextFromContext возвращает контекст текущего спана из ctx или пустой контекст
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// ContextWithTraceparent возвращает контекст, в котором родителем следующих спанов будет
+// спан из значения traceparent, полученного от другого процесса. Некорректное значение игнорируется
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	sc, ok := ParseTraceparent(traceparent)
+	if !ok {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// Traceparent возвращает значение traceparent текущего спана из ctx или пустую строку
+func Traceparent(ctx context.Context) string {
+	return SpanContextFromContext(ctx).Traceparent()
+}
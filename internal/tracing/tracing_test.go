@@ -0,0 +1,248 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// memoryExporter запоминает экспортированные спаны
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *memoryExporter) Export(service string, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) Close() error {
+	return nil
+}
+
+// startTracing включает трассировку в память. Возвращает функцию, которая выключает ее
+// и возвращает экспортированные спаны
+func startTracing(t *testing.T) func() []SpanData {
+	t.Helper()
+
+	exporter := &memoryExporter{}
+	stop := Init("test", exporter)
+	t.Cleanup(func() { stop(context.Background()) })
+
+	return func() []SpanData {
+		if err := stop(context.Background()); err != nil {
+			t.Fatalf("Shutdown error = %v", err)
+		}
+		return exporter.spans
+	}
+}
+
+// TestTraceparent проверяет разбор и формирование заголовка traceparent
+func TestTraceparent(t *testing.T) {
+	valid := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+	sc, ok := ParseTraceparent(valid)
+	if !ok {
+		t.Fatalf("ParseTraceparent(%q) failed", valid)
+	}
+	if sc.TraceID.String() != "0af7651916cd43dd8448eb211c80319c" || sc.SpanID.String() != "b7ad6b7169203331" {
+		t.Errorf("Unexpected span context: %s %s", sc.TraceID, sc.SpanID)
+	}
+	if sc.Traceparent() != valid {
+		t.Errorf("Traceparent() = %q, want %q", sc.Traceparent(), valid)
+	}
+
+	invalid := []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319z-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+	}
+	for _, value := range invalid {
+		if _, ok := ParseTraceparent(value); ok {
+			t.Errorf("ParseTraceparent(%q) should fail", value)
+		}
+	}
+}
+
+// TestStartParentChild проверяет связи спанов внутри процесса и с удаленным родителем
+func TestStartParentChild(t *testing.T) {
+	stop := startTracing(t)
+
+	ctx, root := Start(context.Background(), "root", WithKind(SpanKindServer))
+	_, child := Start(ctx, "child", WithAttributes("operation.id", 7))
+	child.RecordError(errors.New("division by zero"))
+	child.End()
+	root.End()
+	root.End() // повторное завершение не экспортирует спан еще раз
+
+	remote := ContextWithTraceparent(context.Background(), Traceparent(ctx))
+	_, agent := Start(remote, "agent")
+	agent.End()
+
+	spans := stop()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+
+	byName := make(map[string]SpanData)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	rootData, childData, agentData := byName["root"], byName["child"], byName["agent"]
+	if rootData.Parent != (SpanID{}) || rootData.Kind != SpanKindServer {
+		t.Errorf("Unexpected root span: %+v", rootData)
+	}
+	for _, span := range []SpanData{childData, agentData} {
+		if span.SpanContext.TraceID != rootData.SpanContext.TraceID || span.Parent != rootData.SpanContext.SpanID {
+			t.Errorf("Span %s is not a child of root: %+v", span.Name, span)
+		}
+	}
+	if childData.StatusCode != StatusError || childData.StatusMessage != "division by zero" {
+		t.Errorf("Unexpected child status: %d %q", childData.StatusCode, childData.StatusMessage)
+	}
+	if len(childData.Attributes) != 1 || childData.Attributes[0] != (Attribute{Key: "operation.id", Value: 7}) {
+		t.Errorf("Unexpected child attributes: %v", childData.Attributes)
+	}
+}
+
+// TestDisabled проверяет, что без Init спаны не создаются, а контекст родителя передается дальше
+func TestDisabled(t *testing.T) {
+	parent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	ctx := ContextWithTraceparent(context.Background(), parent)
+
+	ctx, span := Start(ctx, "disabled")
+	if span != nil {
+		t.Fatal("Expected nil span when tracing is disabled")
+	}
+	span.SetAttributes("key", "value")
+	span.RecordError(errors.New("ignored"))
+	span.End()
+
+	if Traceparent(ctx) != parent {
+		t.Errorf("Traceparent() = %q, want parent %q", Traceparent(ctx), parent)
+	}
+}
+
+// TestFileExporter проверяет запись спанов в форматах OTLP/JSON и JSON
+func TestFileExporter(t *testing.T) {
+	for _, format := range []string{FormatOTLP, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "traces.jsonl")
+			exporter, err := NewFileExporter(path, format)
+			if err != nil {
+				t.Fatalf("NewFileExporter() error = %v", err)
+			}
+
+			stop := Init("orchestrator", exporter)
+			ctx, root := Start(context.Background(), "POST /api/v1/calculate", WithKind(SpanKindServer),
+				WithAttributes("http.response.status_code", 201, "user.id", int64(3)))
+			_, child := Start(ctx, "ParseAST")
+			child.End()
+			root.End()
+			if err := stop(context.Background()); err != nil {
+				t.Fatalf("Shutdown error = %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read trace file: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+			if format == FormatOTLP {
+				if len(lines) != 1 {
+					t.Fatalf("Expected 1 OTLP request, got %d lines", len(lines))
+				}
+
+				var request otlpExportRequest
+				if err := json.Unmarshal([]byte(lines[0]), &request); err != nil {
+					t.Fatalf("Invalid OTLP JSON: %v", err)
+				}
+				resource := request.ResourceSpans[0]
+				if *resource.Resource.Attributes[0].Value.StringValue != "orchestrator" {
+					t.Errorf("Unexpected resource: %+v", resource.Resource)
+				}
+
+				spans := resource.ScopeSpans[0].Spans
+				if len(spans) != 2 || spans[0].Name != "ParseAST" || spans[0].ParentSpanID != spans[1].SpanID {
+					t.Fatalf("Unexpected spans: %+v", spans)
+				}
+				if spans[1].Kind != int(SpanKindServer) || *spans[1].Attributes[0].Value.IntValue != "201" {
+					t.Errorf("Unexpected root span: %+v", spans[1])
+				}
+				return
+			}
+
+			if len(lines) != 2 {
+				t.Fatalf("Expected 2 JSON spans, got %d lines", len(lines))
+			}
+			var record jsonSpanRecord
+			if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+				t.Fatalf("Invalid span JSON: %v", err)
+			}
+			if record.Service != "orchestrator" || record.Kind != "server" || record.Attributes["user.id"] != float64(3) {
+				t.Errorf("Unexpected span record: %+v", record)
+			}
+		})
+	}
+
+	if _, err := NewFileExporter(filepath.Join(t.TempDir(), "traces"), "zipkin"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+// TestMiddleware проверяет серверный спан HTTP-запроса
+func TestMiddleware(t *testing.T) {
+	stop := startTracing(t)
+
+	var handlerTraceparent string
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/api/v1/expressions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerTraceparent = Traceparent(r.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	parent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	req := httptest.NewRequest("GET", "/api/v1/expressions/42", nil)
+	req.Header.Set(TraceparentHeader, parent)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Header().Get(TraceparentHeader) != handlerTraceparent {
+		t.Errorf("Response traceparent %q does not match handler span %q", rr.Header().Get(TraceparentHeader), handlerTraceparent)
+	}
+
+	spans := stop()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name != "GET /api/v1/expressions/{id}" || span.Kind != SpanKindServer {
+		t.Errorf("Unexpected span: %+v", span)
+	}
+	if span.SpanContext.TraceID.String() != "0af7651916cd43dd8448eb211c80319c" || span.Parent.String() != "b7ad6b7169203331" {
+		t.Errorf("Span does not continue client trace: %+v", span)
+	}
+	if span.StatusCode != StatusError {
+		t.Errorf("Expected error status for 500 response, got %d", span.StatusCode)
+	}
+}
@@ -21,9 +21,60 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-// Запрос на получение задачи (пустой)
+// Вид операции
+type OperationKind int32
+
+const (
+	OperationKind_OPERATION_KIND_BINARY   OperationKind = 0 // left_value operator right_value
+	OperationKind_OPERATION_KIND_UNARY    OperationKind = 1 // operator left_value, right_value не используется
+	OperationKind_OPERATION_KIND_FUNCTION OperationKind = 2 // operator(args...), operator — имя функции
+)
+
+// Enum value maps for OperationKind.
+var (
+	OperationKind_name = map[int32]string{
+		0: "OPERATION_KIND_BINARY",
+		1: "OPERATION_KIND_UNARY",
+		2: "OPERATION_KIND_FUNCTION",
+	}
+	OperationKind_value = map[string]int32{
+		"OPERATION_KIND_BINARY":   0,
+		"OPERATION_KIND_UNARY":    1,
+		"OPERATION_KIND_FUNCTION": 2,
+	}
+)
+
+func (x OperationKind) Enum() *OperationKind {
+	p := new(OperationKind)
+	*p = x
+	return p
+}
+
+func (x OperationKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OperationKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_task_proto_enumTypes[0].Descriptor()
+}
+
+func (OperationKind) Type() protoreflect.EnumType {
+	return &file_proto_task_proto_enumTypes[0]
+}
+
+func (x OperationKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OperationKind.Descriptor instead.
+func (OperationKind) EnumDescriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{0}
+}
+
+// Запрос на получение задачи
 type GetTaskRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"` // идентификатор агента, за которым закрепляется аренда
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -58,18 +109,48 @@ func (*GetTaskRequest) Descriptor() ([]byte, []int) {
 	return file_proto_task_proto_rawDescGZIP(), []int{0}
 }
 
+func (x *GetTaskRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
 // Ответ с задачей
 type GetTaskResponse struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// Если нет задачи, все поля будут иметь значения по умолчанию
-	HasTask         bool    `protobuf:"varint,1,opt,name=has_task,json=hasTask,proto3" json:"has_task,omitempty"` // true если задача есть, false если очередь пуста
-	Id              uint32  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
-	LeftValue       float64 `protobuf:"fixed64,3,opt,name=left_value,json=leftValue,proto3" json:"left_value,omitempty"`
-	RightValue      float64 `protobuf:"fixed64,4,opt,name=right_value,json=rightValue,proto3" json:"right_value,omitempty"`
-	Operator        string  `protobuf:"bytes,5,opt,name=operator,proto3" json:"operator,omitempty"`
-	OperationTimeNs int64   `protobuf:"varint,6,opt,name=operation_time_ns,json=operationTimeNs,proto3" json:"operation_time_ns,omitempty"` // время операции в наносекундах
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+	HasTask         bool          `protobuf:"varint,1,opt,name=has_task,json=hasTask,proto3" json:"has_task,omitempty"` // true если задача есть, false если очередь пуста
+	Id              uint32        `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	LeftValue       float64       `protobuf:"fixed64,3,opt,name=left_value,json=leftValue,proto3" json:"left_value,omitempty"`
+	RightValue      float64       `protobuf:"fixed64,4,opt,name=right_value,json=rightValue,proto3" json:"right_value,omitempty"`
+	Operator        string        `protobuf:"bytes,5,opt,name=operator,proto3" json:"operator,omitempty"`                                         // +, -, *, /, % (остаток), // (целочисленное деление), ^ (степень)
+	OperationTimeNs int64         `protobuf:"varint,6,opt,name=operation_time_ns,json=operationTimeNs,proto3" json:"operation_time_ns,omitempty"` // время операции в наносекундах
+	LeaseId         string        `protobuf:"bytes,7,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`                            // идентификатор аренды, который нужно вернуть вместе с результатом
+	Kind            OperationKind `protobuf:"varint,8,opt,name=kind,proto3,enum=task.OperationKind" json:"kind,omitempty"`
+	Args            []float64     `protobuf:"fixed64,9,rep,packed,name=args,proto3" json:"args,omitempty"` // аргументы функции для OPERATION_KIND_FUNCTION
+	// Поля журнала: агент добавляет их в свои записи о задаче и возвращает в метаданных SendTaskResult
+	RequestId    string `protobuf:"bytes,10,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"` // идентификатор HTTP-запроса, создавшего выражение
+	UserId       int64  `protobuf:"varint,11,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ExpressionId int64  `protobuf:"varint,12,opt,name=expression_id,json=expressionId,proto3" json:"expression_id,omitempty"`
+	// W3C traceparent спана передачи операции: спаны агента по задаче становятся его дочерними
+	Traceparent string `protobuf:"bytes,13,opt,name=traceparent,proto3" json:"traceparent,omitempty"`
+	// Числовой режим операции: "float" (пустая строка у старых оркестраторов), "rational", "decimal" или "interval".
+	// В режиме rational операнды передаются точно дробями "p/q", в режиме decimal — десятичной записью,
+	// а left_value, right_value и args содержат их приближения
+	Mode       string   `protobuf:"bytes,14,opt,name=mode,proto3" json:"mode,omitempty"`
+	LeftExact  string   `protobuf:"bytes,15,opt,name=left_exact,json=leftExact,proto3" json:"left_exact,omitempty"`
+	RightExact string   `protobuf:"bytes,16,opt,name=right_exact,json=rightExact,proto3" json:"right_exact,omitempty"`
+	ArgsExact  []string `protobuf:"bytes,17,rep,name=args_exact,json=argsExact,proto3" json:"args_exact,omitempty"`
+	// Режим decimal: результат операции округляется до precision + 10 знаков после запятой способом rounding
+	Precision int32  `protobuf:"varint,18,opt,name=precision,proto3" json:"precision,omitempty"`
+	Rounding  string `protobuf:"bytes,19,opt,name=rounding,proto3" json:"rounding,omitempty"`
+	// Режим interval: операнды передаются интервалами, left_value, right_value и args содержат их середины
+	LeftInterval  *Interval   `protobuf:"bytes,20,opt,name=left_interval,json=leftInterval,proto3" json:"left_interval,omitempty"`
+	RightInterval *Interval   `protobuf:"bytes,21,opt,name=right_interval,json=rightInterval,proto3" json:"right_interval,omitempty"`
+	ArgsInterval  []*Interval `protobuf:"bytes,22,rep,name=args_interval,json=argsInterval,proto3" json:"args_interval,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GetTaskResponse) Reset() {
@@ -144,19 +225,241 @@ func (x *GetTaskResponse) GetOperationTimeNs() int64 {
 	return 0
 }
 
-// Запрос на отправку результата задачи
-type TaskResultRequest struct {
+func (x *GetTaskResponse) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetKind() OperationKind {
+	if x != nil {
+		return x.Kind
+	}
+	return OperationKind_OPERATION_KIND_BINARY
+}
+
+func (x *GetTaskResponse) GetArgs() []float64 {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *GetTaskResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *GetTaskResponse) GetExpressionId() int64 {
+	if x != nil {
+		return x.ExpressionId
+	}
+	return 0
+}
+
+func (x *GetTaskResponse) GetTraceparent() string {
+	if x != nil {
+		return x.Traceparent
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetLeftExact() string {
+	if x != nil {
+		return x.LeftExact
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetRightExact() string {
+	if x != nil {
+		return x.RightExact
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetArgsExact() []string {
+	if x != nil {
+		return x.ArgsExact
+	}
+	return nil
+}
+
+func (x *GetTaskResponse) GetPrecision() int32 {
+	if x != nil {
+		return x.Precision
+	}
+	return 0
+}
+
+func (x *GetTaskResponse) GetRounding() string {
+	if x != nil {
+		return x.Rounding
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetLeftInterval() *Interval {
+	if x != nil {
+		return x.LeftInterval
+	}
+	return nil
+}
+
+func (x *GetTaskResponse) GetRightInterval() *Interval {
+	if x != nil {
+		return x.RightInterval
+	}
+	return nil
+}
+
+func (x *GetTaskResponse) GetArgsInterval() []*Interval {
+	if x != nil {
+		return x.ArgsInterval
+	}
+	return nil
+}
+
+// Интервал [lower, upper], содержащий точное значение операнда или результата
+type Interval struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
-	Result        float64                `protobuf:"fixed64,2,opt,name=result,proto3" json:"result,omitempty"`
-	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"` // "nil" если ошибок нет
+	Lower         float64                `protobuf:"fixed64,1,opt,name=lower,proto3" json:"lower,omitempty"`
+	Upper         float64                `protobuf:"fixed64,2,opt,name=upper,proto3" json:"upper,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Interval) Reset() {
+	*x = Interval{}
+	mi := &file_proto_task_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Interval) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Interval) ProtoMessage() {}
+
+func (x *Interval) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_task_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Interval.ProtoReflect.Descriptor instead.
+func (*Interval) Descriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Interval) GetLower() float64 {
+	if x != nil {
+		return x.Lower
+	}
+	return 0
+}
+
+func (x *Interval) GetUpper() float64 {
+	if x != nil {
+		return x.Upper
+	}
+	return 0
+}
+
+// Сообщение агента в потоке задач
+type TaskStreamRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	FreeSlots     int32                  `protobuf:"varint,2,opt,name=free_slots,json=freeSlots,proto3" json:"free_slots,omitempty"` // сколько воркеров освободилось с момента предыдущего сообщения
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
+func (x *TaskStreamRequest) Reset() {
+	*x = TaskStreamRequest{}
+	mi := &file_proto_task_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskStreamRequest) ProtoMessage() {}
+
+func (x *TaskStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_task_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskStreamRequest.ProtoReflect.Descriptor instead.
+func (*TaskStreamRequest) Descriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TaskStreamRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *TaskStreamRequest) GetFreeSlots() int32 {
+	if x != nil {
+		return x.FreeSlots
+	}
+	return 0
+}
+
+// Запрос на отправку результата задачи
+type TaskResultRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Result         float64                `protobuf:"fixed64,2,opt,name=result,proto3" json:"result,omitempty"`
+	Error          string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"` // "nil" если ошибок нет
+	AgentId        string                 `protobuf:"bytes,4,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	LeaseId        string                 `protobuf:"bytes,5,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`                      // идентификатор аренды из GetTaskResponse
+	ExactResult    string                 `protobuf:"bytes,6,opt,name=exact_result,json=exactResult,proto3" json:"exact_result,omitempty"`          // точный результат в режиме rational или decimal, result содержит его приближение
+	IntervalResult *Interval              `protobuf:"bytes,7,opt,name=interval_result,json=intervalResult,proto3" json:"interval_result,omitempty"` // границы результата в режиме interval, result содержит их середину
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
 func (x *TaskResultRequest) Reset() {
 	*x = TaskResultRequest{}
-	mi := &file_proto_task_proto_msgTypes[2]
+	mi := &file_proto_task_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -168,7 +471,7 @@ func (x *TaskResultRequest) String() string {
 func (*TaskResultRequest) ProtoMessage() {}
 
 func (x *TaskResultRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_task_proto_msgTypes[2]
+	mi := &file_proto_task_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -181,7 +484,7 @@ func (x *TaskResultRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TaskResultRequest.ProtoReflect.Descriptor instead.
 func (*TaskResultRequest) Descriptor() ([]byte, []int) {
-	return file_proto_task_proto_rawDescGZIP(), []int{2}
+	return file_proto_task_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *TaskResultRequest) GetId() uint32 {
@@ -205,6 +508,34 @@ func (x *TaskResultRequest) GetError() string {
 	return ""
 }
 
+func (x *TaskResultRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *TaskResultRequest) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *TaskResultRequest) GetExactResult() string {
+	if x != nil {
+		return x.ExactResult
+	}
+	return ""
+}
+
+func (x *TaskResultRequest) GetIntervalResult() *Interval {
+	if x != nil {
+		return x.IntervalResult
+	}
+	return nil
+}
+
 // Ответ на отправку результата задачи
 type TaskResultResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -216,7 +547,7 @@ type TaskResultResponse struct {
 
 func (x *TaskResultResponse) Reset() {
 	*x = TaskResultResponse{}
-	mi := &file_proto_task_proto_msgTypes[3]
+	mi := &file_proto_task_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -228,7 +559,7 @@ func (x *TaskResultResponse) String() string {
 func (*TaskResultResponse) ProtoMessage() {}
 
 func (x *TaskResultResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_task_proto_msgTypes[3]
+	mi := &file_proto_task_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -241,7 +572,7 @@ func (x *TaskResultResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TaskResultResponse.ProtoReflect.Descriptor instead.
 func (*TaskResultResponse) Descriptor() ([]byte, []int) {
-	return file_proto_task_proto_rawDescGZIP(), []int{3}
+	return file_proto_task_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *TaskResultResponse) GetSuccess() bool {
@@ -258,12 +589,347 @@ func (x *TaskResultResponse) GetError() string {
 	return ""
 }
 
+// Запрос на возврат невыполненной задачи в очередь
+type ReleaseTaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	AgentId       string                 `protobuf:"bytes,2,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	LeaseId       string                 `protobuf:"bytes,3,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"` // идентификатор аренды из GetTaskResponse
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseTaskRequest) Reset() {
+	*x = ReleaseTaskRequest{}
+	mi := &file_proto_task_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseTaskRequest) ProtoMessage() {}
+
+func (x *ReleaseTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_task_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseTaskRequest.ProtoReflect.Descriptor instead.
+func (*ReleaseTaskRequest) Descriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReleaseTaskRequest) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ReleaseTaskRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *ReleaseTaskRequest) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+// Ответ на возврат задачи
+type ReleaseTaskResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"` // пустая строка, если ошибок нет
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseTaskResponse) Reset() {
+	*x = ReleaseTaskResponse{}
+	mi := &file_proto_task_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseTaskResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseTaskResponse) ProtoMessage() {}
+
+func (x *ReleaseTaskResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_task_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseTaskResponse.ProtoReflect.Descriptor instead.
+func (*ReleaseTaskResponse) Descriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ReleaseTaskResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ReleaseTaskResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Запрос на регистрацию агента
+type RegisterAgentRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	AgentId        string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Hostname       string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	ComputingPower int32                  `protobuf:"varint,3,opt,name=computing_power,json=computingPower,proto3" json:"computing_power,omitempty"` // число воркеров агента
+	Version        string                 `protobuf:"bytes,4,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *RegisterAgentRequest) Reset() {
+	*x = RegisterAgentRequest{}
+	mi := &file_proto_task_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterAgentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterAgentRequest) ProtoMessage() {}
+
+func (x *RegisterAgentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_task_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterAgentRequest.ProtoReflect.Descriptor instead.
+func (*RegisterAgentRequest) Descriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RegisterAgentRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *RegisterAgentRequest) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *RegisterAgentRequest) GetComputingPower() int32 {
+	if x != nil {
+		return x.ComputingPower
+	}
+	return 0
+}
+
+func (x *RegisterAgentRequest) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+// Ответ на регистрацию агента
+type RegisterAgentResponse struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Success             bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Error               string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`                                                           // пустая строка, если ошибок нет
+	HeartbeatIntervalMs int64                  `protobuf:"varint,3,opt,name=heartbeat_interval_ms,json=heartbeatIntervalMs,proto3" json:"heartbeat_interval_ms,omitempty"` // как часто агент должен отправлять Heartbeat
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *RegisterAgentResponse) Reset() {
+	*x = RegisterAgentResponse{}
+	mi := &file_proto_task_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterAgentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterAgentResponse) ProtoMessage() {}
+
+func (x *RegisterAgentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_task_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterAgentResponse.ProtoReflect.Descriptor instead.
+func (*RegisterAgentResponse) Descriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RegisterAgentResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *RegisterAgentResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *RegisterAgentResponse) GetHeartbeatIntervalMs() int64 {
+	if x != nil {
+		return x.HeartbeatIntervalMs
+	}
+	return 0
+}
+
+// Подтверждение работы агента
+type HeartbeatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_proto_task_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_task_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *HeartbeatRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+// Ответ на подтверждение работы агента
+type HeartbeatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Registered    bool                   `protobuf:"varint,1,opt,name=registered,proto3" json:"registered,omitempty"` // false, если оркестратор не знает агента: агент должен зарегистрироваться заново
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatResponse) Reset() {
+	*x = HeartbeatResponse{}
+	mi := &file_proto_task_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResponse) ProtoMessage() {}
+
+func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_task_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatResponse.ProtoReflect.Descriptor instead.
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
+	return file_proto_task_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *HeartbeatResponse) GetRegistered() bool {
+	if x != nil {
+		return x.Registered
+	}
+	return false
+}
+
 var File_proto_task_proto protoreflect.FileDescriptor
 
 const file_proto_task_proto_rawDesc = "" +
 	"\n" +
-	"\x10proto/task.proto\x12\x04task\"\x10\n" +
-	"\x0eGetTaskRequest\"\xc4\x01\n" +
+	"\x10proto/task.proto\x12\x04task\"+\n" +
+	"\x0eGetTaskRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\"\xe9\x05\n" +
 	"\x0fGetTaskResponse\x12\x19\n" +
 	"\bhas_task\x18\x01 \x01(\bR\ahasTask\x12\x0e\n" +
 	"\x02id\x18\x02 \x01(\rR\x02id\x12\x1d\n" +
@@ -272,17 +938,79 @@ const file_proto_task_proto_rawDesc = "" +
 	"\vright_value\x18\x04 \x01(\x01R\n" +
 	"rightValue\x12\x1a\n" +
 	"\boperator\x18\x05 \x01(\tR\boperator\x12*\n" +
-	"\x11operation_time_ns\x18\x06 \x01(\x03R\x0foperationTimeNs\"Q\n" +
+	"\x11operation_time_ns\x18\x06 \x01(\x03R\x0foperationTimeNs\x12\x19\n" +
+	"\blease_id\x18\a \x01(\tR\aleaseId\x12'\n" +
+	"\x04kind\x18\b \x01(\x0e2\x13.task.OperationKindR\x04kind\x12\x12\n" +
+	"\x04args\x18\t \x03(\x01R\x04args\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\n" +
+	" \x01(\tR\trequestId\x12\x17\n" +
+	"\auser_id\x18\v \x01(\x03R\x06userId\x12#\n" +
+	"\rexpression_id\x18\f \x01(\x03R\fexpressionId\x12 \n" +
+	"\vtraceparent\x18\r \x01(\tR\vtraceparent\x12\x12\n" +
+	"\x04mode\x18\x0e \x01(\tR\x04mode\x12\x1d\n" +
+	"\n" +
+	"left_exact\x18\x0f \x01(\tR\tleftExact\x12\x1f\n" +
+	"\vright_exact\x18\x10 \x01(\tR\n" +
+	"rightExact\x12\x1d\n" +
+	"\n" +
+	"args_exact\x18\x11 \x03(\tR\targsExact\x12\x1c\n" +
+	"\tprecision\x18\x12 \x01(\x05R\tprecision\x12\x1a\n" +
+	"\brounding\x18\x13 \x01(\tR\brounding\x123\n" +
+	"\rleft_interval\x18\x14 \x01(\v2\x0e.task.IntervalR\fleftInterval\x125\n" +
+	"\x0eright_interval\x18\x15 \x01(\v2\x0e.task.IntervalR\rrightInterval\x123\n" +
+	"\rargs_interval\x18\x16 \x03(\v2\x0e.task.IntervalR\fargsInterval\"6\n" +
+	"\bInterval\x12\x14\n" +
+	"\x05lower\x18\x01 \x01(\x01R\x05lower\x12\x14\n" +
+	"\x05upper\x18\x02 \x01(\x01R\x05upper\"M\n" +
+	"\x11TaskStreamRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1d\n" +
+	"\n" +
+	"free_slots\x18\x02 \x01(\x05R\tfreeSlots\"\xe3\x01\n" +
 	"\x11TaskResultRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\rR\x02id\x12\x16\n" +
 	"\x06result\x18\x02 \x01(\x01R\x06result\x12\x14\n" +
-	"\x05error\x18\x03 \x01(\tR\x05error\"D\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x19\n" +
+	"\bagent_id\x18\x04 \x01(\tR\aagentId\x12\x19\n" +
+	"\blease_id\x18\x05 \x01(\tR\aleaseId\x12!\n" +
+	"\fexact_result\x18\x06 \x01(\tR\vexactResult\x127\n" +
+	"\x0finterval_result\x18\a \x01(\v2\x0e.task.IntervalR\x0eintervalResult\"D\n" +
 	"\x12TaskResultResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
-	"\x05error\x18\x02 \x01(\tR\x05error2\x8a\x01\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"Z\n" +
+	"\x12ReleaseTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12\x19\n" +
+	"\bagent_id\x18\x02 \x01(\tR\aagentId\x12\x19\n" +
+	"\blease_id\x18\x03 \x01(\tR\aleaseId\"E\n" +
+	"\x13ReleaseTaskResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x90\x01\n" +
+	"\x14RegisterAgentRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1a\n" +
+	"\bhostname\x18\x02 \x01(\tR\bhostname\x12'\n" +
+	"\x0fcomputing_power\x18\x03 \x01(\x05R\x0ecomputingPower\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\tR\aversion\"{\n" +
+	"\x15RegisterAgentResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x122\n" +
+	"\x15heartbeat_interval_ms\x18\x03 \x01(\x03R\x13heartbeatIntervalMs\"-\n" +
+	"\x10HeartbeatRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\"3\n" +
+	"\x11HeartbeatResponse\x12\x1e\n" +
+	"\n" +
+	"registered\x18\x01 \x01(\bR\n" +
+	"registered*a\n" +
+	"\rOperationKind\x12\x19\n" +
+	"\x15OPERATION_KIND_BINARY\x10\x00\x12\x18\n" +
+	"\x14OPERATION_KIND_UNARY\x10\x01\x12\x1b\n" +
+	"\x17OPERATION_KIND_FUNCTION\x10\x022\x99\x03\n" +
 	"\vTaskService\x126\n" +
 	"\aGetTask\x12\x14.task.GetTaskRequest\x1a\x15.task.GetTaskResponse\x12C\n" +
-	"\x0eSendTaskResult\x12\x17.task.TaskResultRequest\x1a\x18.task.TaskResultResponseB\x1cZ\x1aparallel-calculator/proto/b\x06proto3"
+	"\x0eSendTaskResult\x12\x17.task.TaskResultRequest\x1a\x18.task.TaskResultResponse\x12A\n" +
+	"\vStreamTasks\x12\x17.task.TaskStreamRequest\x1a\x15.task.GetTaskResponse(\x010\x01\x12B\n" +
+	"\vReleaseTask\x12\x18.task.ReleaseTaskRequest\x1a\x19.task.ReleaseTaskResponse\x12H\n" +
+	"\rRegisterAgent\x12\x1a.task.RegisterAgentRequest\x1a\x1b.task.RegisterAgentResponse\x12<\n" +
+	"\tHeartbeat\x12\x16.task.HeartbeatRequest\x1a\x17.task.HeartbeatResponseB\x1cZ\x1aparallel-calculator/proto/b\x06proto3"
 
 var (
 	file_proto_task_proto_rawDescOnce sync.Once
@@ -296,23 +1024,46 @@ func file_proto_task_proto_rawDescGZIP() []byte {
 	return file_proto_task_proto_rawDescData
 }
 
-var file_proto_task_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_proto_task_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_task_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
 var file_proto_task_proto_goTypes = []any{
-	(*GetTaskRequest)(nil),     // 0: task.GetTaskRequest
-	(*GetTaskResponse)(nil),    // 1: task.GetTaskResponse
-	(*TaskResultRequest)(nil),  // 2: task.TaskResultRequest
-	(*TaskResultResponse)(nil), // 3: task.TaskResultResponse
+	(OperationKind)(0),            // 0: task.OperationKind
+	(*GetTaskRequest)(nil),        // 1: task.GetTaskRequest
+	(*GetTaskResponse)(nil),       // 2: task.GetTaskResponse
+	(*Interval)(nil),              // 3: task.Interval
+	(*TaskStreamRequest)(nil),     // 4: task.TaskStreamRequest
+	(*TaskResultRequest)(nil),     // 5: task.TaskResultRequest
+	(*TaskResultResponse)(nil),    // 6: task.TaskResultResponse
+	(*ReleaseTaskRequest)(nil),    // 7: task.ReleaseTaskRequest
+	(*ReleaseTaskResponse)(nil),   // 8: task.ReleaseTaskResponse
+	(*RegisterAgentRequest)(nil),  // 9: task.RegisterAgentRequest
+	(*RegisterAgentResponse)(nil), // 10: task.RegisterAgentResponse
+	(*HeartbeatRequest)(nil),      // 11: task.HeartbeatRequest
+	(*HeartbeatResponse)(nil),     // 12: task.HeartbeatResponse
 }
 var file_proto_task_proto_depIdxs = []int32{
-	0, // 0: task.TaskService.GetTask:input_type -> task.GetTaskRequest
-	2, // 1: task.TaskService.SendTaskResult:input_type -> task.TaskResultRequest
-	1, // 2: task.TaskService.GetTask:output_type -> task.GetTaskResponse
-	3, // 3: task.TaskService.SendTaskResult:output_type -> task.TaskResultResponse
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: task.GetTaskResponse.kind:type_name -> task.OperationKind
+	3,  // 1: task.GetTaskResponse.left_interval:type_name -> task.Interval
+	3,  // 2: task.GetTaskResponse.right_interval:type_name -> task.Interval
+	3,  // 3: task.GetTaskResponse.args_interval:type_name -> task.Interval
+	3,  // 4: task.TaskResultRequest.interval_result:type_name -> task.Interval
+	1,  // 5: task.TaskService.GetTask:input_type -> task.GetTaskRequest
+	5,  // 6: task.TaskService.SendTaskResult:input_type -> task.TaskResultRequest
+	4,  // 7: task.TaskService.StreamTasks:input_type -> task.TaskStreamRequest
+	7,  // 8: task.TaskService.ReleaseTask:input_type -> task.ReleaseTaskRequest
+	9,  // 9: task.TaskService.RegisterAgent:input_type -> task.RegisterAgentRequest
+	11, // 10: task.TaskService.Heartbeat:input_type -> task.HeartbeatRequest
+	2,  // 11: task.TaskService.GetTask:output_type -> task.GetTaskResponse
+	6,  // 12: task.TaskService.SendTaskResult:output_type -> task.TaskResultResponse
+	2,  // 13: task.TaskService.StreamTasks:output_type -> task.GetTaskResponse
+	8,  // 14: task.TaskService.ReleaseTask:output_type -> task.ReleaseTaskResponse
+	10, // 15: task.TaskService.RegisterAgent:output_type -> task.RegisterAgentResponse
+	12, // 16: task.TaskService.Heartbeat:output_type -> task.HeartbeatResponse
+	11, // [11:17] is the sub-list for method output_type
+	5,  // [5:11] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_proto_task_proto_init() }
@@ -325,13 +1076,14 @@ func file_proto_task_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_task_proto_rawDesc), len(file_proto_task_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   4,
+			NumEnums:      1,
+			NumMessages:   12,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_proto_task_proto_goTypes,
 		DependencyIndexes: file_proto_task_proto_depIdxs,
+		EnumInfos:         file_proto_task_proto_enumTypes,
 		MessageInfos:      file_proto_task_proto_msgTypes,
 	}.Build()
 	File_proto_task_proto = out.File
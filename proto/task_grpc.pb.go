@@ -21,6 +21,10 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	TaskService_GetTask_FullMethodName        = "/task.TaskService/GetTask"
 	TaskService_SendTaskResult_FullMethodName = "/task.TaskService/SendTaskResult"
+	TaskService_StreamTasks_FullMethodName    = "/task.TaskService/StreamTasks"
+	TaskService_ReleaseTask_FullMethodName    = "/task.TaskService/ReleaseTask"
+	TaskService_RegisterAgent_FullMethodName  = "/task.TaskService/RegisterAgent"
+	TaskService_Heartbeat_FullMethodName      = "/task.TaskService/Heartbeat"
 )
 
 // TaskServiceClient is the client API for TaskService service.
@@ -33,6 +37,15 @@ type TaskServiceClient interface {
 	GetTask(ctx context.Context, in *GetTaskRequest, opts ...grpc.CallOption) (*GetTaskResponse, error)
 	// Отправка результата задачи
 	SendTaskResult(ctx context.Context, in *TaskResultRequest, opts ...grpc.CallOption) (*TaskResultResponse, error)
+	// Потоковое получение задач: агент сообщает о свободных воркерах,
+	// оркестратор отправляет операции по мере их готовности
+	StreamTasks(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TaskStreamRequest, GetTaskResponse], error)
+	// Возврат в очередь задачи, которую агент получил, но не начал выполнять (при остановке агента)
+	ReleaseTask(ctx context.Context, in *ReleaseTaskRequest, opts ...grpc.CallOption) (*ReleaseTaskResponse, error)
+	// Регистрация агента при запуске
+	RegisterAgent(ctx context.Context, in *RegisterAgentRequest, opts ...grpc.CallOption) (*RegisterAgentResponse, error)
+	// Периодическое подтверждение, что агент работает
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
 }
 
 type taskServiceClient struct {
@@ -63,6 +76,49 @@ func (c *taskServiceClient) SendTaskResult(ctx context.Context, in *TaskResultRe
 	return out, nil
 }
 
+func (c *taskServiceClient) StreamTasks(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TaskStreamRequest, GetTaskResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TaskService_ServiceDesc.Streams[0], TaskService_StreamTasks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TaskStreamRequest, GetTaskResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TaskService_StreamTasksClient = grpc.BidiStreamingClient[TaskStreamRequest, GetTaskResponse]
+
+func (c *taskServiceClient) ReleaseTask(ctx context.Context, in *ReleaseTaskRequest, opts ...grpc.CallOption) (*ReleaseTaskResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReleaseTaskResponse)
+	err := c.cc.Invoke(ctx, TaskService_ReleaseTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskServiceClient) RegisterAgent(ctx context.Context, in *RegisterAgentRequest, opts ...grpc.CallOption) (*RegisterAgentResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterAgentResponse)
+	err := c.cc.Invoke(ctx, TaskService_RegisterAgent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, TaskService_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TaskServiceServer is the server API for TaskService service.
 // All implementations must embed UnimplementedTaskServiceServer
 // for forward compatibility.
@@ -73,6 +129,15 @@ type TaskServiceServer interface {
 	GetTask(context.Context, *GetTaskRequest) (*GetTaskResponse, error)
 	// Отправка результата задачи
 	SendTaskResult(context.Context, *TaskResultRequest) (*TaskResultResponse, error)
+	// Потоковое получение задач: агент сообщает о свободных воркерах,
+	// оркестратор отправляет операции по мере их готовности
+	StreamTasks(grpc.BidiStreamingServer[TaskStreamRequest, GetTaskResponse]) error
+	// Возврат в очередь задачи, которую агент получил, но не начал выполнять (при остановке агента)
+	ReleaseTask(context.Context, *ReleaseTaskRequest) (*ReleaseTaskResponse, error)
+	// Регистрация агента при запуске
+	RegisterAgent(context.Context, *RegisterAgentRequest) (*RegisterAgentResponse, error)
+	// Периодическое подтверждение, что агент работает
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
 	mustEmbedUnimplementedTaskServiceServer()
 }
 
@@ -89,6 +154,18 @@ func (UnimplementedTaskServiceServer) GetTask(context.Context, *GetTaskRequest)
 func (UnimplementedTaskServiceServer) SendTaskResult(context.Context, *TaskResultRequest) (*TaskResultResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendTaskResult not implemented")
 }
+func (UnimplementedTaskServiceServer) StreamTasks(grpc.BidiStreamingServer[TaskStreamRequest, GetTaskResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTasks not implemented")
+}
+func (UnimplementedTaskServiceServer) ReleaseTask(context.Context, *ReleaseTaskRequest) (*ReleaseTaskResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseTask not implemented")
+}
+func (UnimplementedTaskServiceServer) RegisterAgent(context.Context, *RegisterAgentRequest) (*RegisterAgentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterAgent not implemented")
+}
+func (UnimplementedTaskServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
 func (UnimplementedTaskServiceServer) mustEmbedUnimplementedTaskServiceServer() {}
 func (UnimplementedTaskServiceServer) testEmbeddedByValue()                     {}
 
@@ -146,6 +223,67 @@ func _TaskService_SendTaskResult_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TaskService_StreamTasks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TaskServiceServer).StreamTasks(&grpc.GenericServerStream[TaskStreamRequest, GetTaskResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TaskService_StreamTasksServer = grpc.BidiStreamingServer[TaskStreamRequest, GetTaskResponse]
+
+func _TaskService_ReleaseTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).ReleaseTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_ReleaseTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).ReleaseTask(ctx, req.(*ReleaseTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskService_RegisterAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterAgentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).RegisterAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_RegisterAgent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).RegisterAgent(ctx, req.(*RegisterAgentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // TaskService_ServiceDesc is the grpc.ServiceDesc for TaskService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -161,7 +299,26 @@ var TaskService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendTaskResult",
 			Handler:    _TaskService_SendTaskResult_Handler,
 		},
+		{
+			MethodName: "ReleaseTask",
+			Handler:    _TaskService_ReleaseTask_Handler,
+		},
+		{
+			MethodName: "RegisterAgent",
+			Handler:    _TaskService_RegisterAgent_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _TaskService_Heartbeat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTasks",
+			Handler:       _TaskService_StreamTasks_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/task.proto",
 }